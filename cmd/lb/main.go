@@ -2,18 +2,28 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
 	"flag"
 	"fmt"
 	ratelimit_http "github.com/athebyme/cloud-ru-assign/internal/adapters/primary/http"
 	"github.com/athebyme/cloud-ru-assign/internal/adapters/primary/http/middleware"
+	"github.com/athebyme/cloud-ru-assign/internal/adapters/primary/tcp"
+	"github.com/athebyme/cloud-ru-assign/internal/adapters/primary/udp"
 	"github.com/athebyme/cloud-ru-assign/internal/adapters/secondary/healthcheck"
 	"github.com/athebyme/cloud-ru-assign/internal/adapters/secondary/logger"
 	"github.com/athebyme/cloud-ru-assign/internal/adapters/secondary/proxy"
+	"github.com/athebyme/cloud-ru-assign/internal/adapters/secondary/proxyproto"
 	"github.com/athebyme/cloud-ru-assign/internal/adapters/secondary/rate_limiter/memory"
 	"github.com/athebyme/cloud-ru-assign/internal/adapters/secondary/repository"
+	"github.com/athebyme/cloud-ru-assign/internal/adapters/secondary/responsecache"
 	"github.com/athebyme/cloud-ru-assign/internal/adapters/secondary/storage/hybrid"
+	"github.com/athebyme/cloud-ru-assign/internal/adapters/secondary/tlsconfig"
 	"github.com/athebyme/cloud-ru-assign/internal/config"
 	"github.com/athebyme/cloud-ru-assign/internal/core/app"
+	"github.com/athebyme/cloud-ru-assign/internal/core/domain/clientip"
+	"github.com/athebyme/cloud-ru-assign/internal/core/domain/requestid"
+	"github.com/athebyme/cloud-ru-assign/internal/core/domain/retry"
+	"github.com/athebyme/cloud-ru-assign/internal/core/domain/routing"
 	"github.com/athebyme/cloud-ru-assign/internal/core/ports"
 	"net/http"
 	"os"
@@ -47,8 +57,80 @@ func main() {
 		slogAdapter.Error("не удалось создать репозиторий бэкендов", "error", err)
 		os.Exit(1)
 	}
-	forwarder := proxy.NewHttpUtilForwarder(slogAdapter)
-	checker := healthcheck.NewHTTPChecker(cfg.HealthCheck.Timeout, cfg.HealthCheck.Path)
+
+	// именованные пулы бэкендов, на которые ссылаются маршруты
+	namedPools := make(map[string]*repository.MemoryPool, len(cfg.Pools))
+	for name, poolCfg := range cfg.Pools {
+		pool, err := repository.NewMemoryPool(poolCfg.Backends, slogAdapter.With("pool", name))
+		if err != nil {
+			slogAdapter.Error("не удалось создать пул бэкендов", "pool", name, "error", err)
+			os.Exit(1)
+		}
+		if err := pool.SetStrategy(poolCfg.Strategy); err != nil {
+			slogAdapter.Error("не удалось установить стратегию балансировки пула", "pool", name, "error", err)
+			os.Exit(1)
+		}
+		namedPools[name] = pool
+	}
+	// TLS до бэкендов: общий из proxy.tls, пулы и отдельные бэкенды переопределяют его
+	// одни и те же настройки получают и форвардер, и health checker
+	defaultTLS, err := buildUpstreamTLS(cfg.Proxy.TLS)
+	if err != nil {
+		slogAdapter.Error("не удалось собрать TLS для бэкендов", "section", "proxy.tls", "error", err)
+		os.Exit(1)
+	}
+	forwarderOpts := []proxy.ForwarderOption{
+		proxy.WithTransportSettings(proxy.TransportSettings{
+			MaxIdleConns:        cfg.Proxy.MaxIdleConns,
+			MaxIdleConnsPerHost: cfg.Proxy.MaxIdleConnsPerHost,
+			IdleConnTimeout:     cfg.Proxy.IdleConnTimeout,
+			KeepAlive:           cfg.Proxy.KeepAlive,
+			DialTimeout:         cfg.Proxy.DialTimeout,
+			TLSHandshakeTimeout: cfg.Proxy.TLSHandshakeTimeout,
+		}),
+		proxy.WithForwardedHeader(cfg.Forwarding.ForwardedHeader),
+		proxy.WithDefaultUpstream(proxy.UpstreamSettings{
+			Protocol:      proxy.UpstreamProtocol(cfg.Proxy.Protocol),
+			TLS:           defaultTLS,
+			ProxyProtocol: proxyproto.Version(cfg.Proxy.SendProxyProtocol),
+		}),
+	}
+	checkerOpts := []healthcheck.CheckerOption{healthcheck.WithDefaultTLS(defaultTLS)}
+	addUpstream := func(backend, protocol, sendProxyProtocol string, tlsCfg *config.UpstreamTLSConfig) {
+		backendTLS, err := buildUpstreamTLS(tlsCfg)
+		if err != nil {
+			slogAdapter.Error("не удалось собрать TLS для бэкенда", "backend_url", backend, "error", err)
+			os.Exit(1)
+		}
+		forwarderOpts = append(forwarderOpts, proxy.WithUpstream(backend, proxy.UpstreamSettings{
+			Protocol:      proxy.UpstreamProtocol(protocol),
+			TLS:           backendTLS,
+			ProxyProtocol: proxyproto.Version(sendProxyProtocol),
+		}))
+		checkerOpts = append(checkerOpts,
+			healthcheck.WithBackendTLS(backend, backendTLS),
+			healthcheck.WithBackendProxyProtocol(backend, proxyproto.Version(sendProxyProtocol)),
+		)
+	}
+	for _, backend := range cfg.Backends {
+		if _, ok := cfg.Proxy.BackendTLS[backend]; ok || cfg.Proxy.SendProxyProtocol != "" {
+			addUpstream(backend, cfg.Proxy.Protocol, cfg.Proxy.SendProxyProtocol, cfg.BackendTLS(backend, cfg.Proxy.TLS))
+		}
+	}
+	for _, poolCfg := range cfg.Pools {
+		for _, backend := range poolCfg.Backends {
+			addUpstream(backend, poolCfg.Protocol, poolCfg.SendProxyProtocol, cfg.BackendTLS(backend, poolCfg.TLS))
+		}
+	}
+	forwarder := proxy.NewHttpUtilForwarder(slogAdapter, forwarderOpts...)
+	// удаленные бэкенды не должны держать прокси и соединения, но бэкенд может входить в несколько пулов
+	backendRepo.OnBackendAdded(forwarder.Retain)
+	backendRepo.OnBackendRemoved(forwarder.Invalidate)
+	for _, pool := range namedPools {
+		pool.OnBackendAdded(forwarder.Retain)
+		pool.OnBackendRemoved(forwarder.Invalidate)
+	}
+	checker := healthcheck.NewHTTPChecker(cfg.HealthCheck.Timeout, cfg.HealthCheck.Path, checkerOpts...)
 
 	// 2 инициализируем rate limiter
 	var rateLimiter ports.RateLimiter
@@ -78,10 +160,91 @@ func main() {
 	}
 
 	// 3 инициализируем сервисы приложения
-	lbService := app.NewLoadBalancerService(backendRepo, forwarder, slogAdapter)
-	var healthMonitor *app.HealthMonitor
+	// ошибки балансировщика и отказы rate limiter'а выглядят одинаково
+	errorRenderer, err := cfg.ErrorPages.Renderer()
+	if err != nil {
+		slogAdapter.Error("не удалось загрузить шаблоны ответов об ошибках", "error", err)
+		os.Exit(1)
+	}
+	upgrades := app.NewUpgradeTracker()
+	serviceOpts := []app.ServiceOption{
+		app.WithErrorRenderer(errorRenderer),
+		app.WithRetryPolicy(cfg.Retry.Policy()),
+		app.WithUpgradePolicy(cfg.Upgrade.Policy()),
+		app.WithUpgradeTracker(upgrades),
+		app.WithTimeouts(cfg.Timeouts.Timeouts()),
+	}
+	if cfg.RetryBudget.Enabled {
+		serviceOpts = append(serviceOpts, app.WithRetryBudget(retry.NewBudget(
+			cfg.RetryBudget.Ratio, cfg.RetryBudget.MinRetriesPerSecond, cfg.RetryBudget.Window,
+		)))
+	}
+	for name, pool := range namedPools {
+		serviceOpts = append(serviceOpts, app.WithPool(name, pool, cfg.PoolRetryPolicy(name)))
+		if rules := cfg.Pools[name].HeaderRules(); rules != nil {
+			serviceOpts = append(serviceOpts, app.WithPoolHeaders(name, rules))
+		}
+	}
+	routes := make([]*routing.Route, 0, len(cfg.Routes))
+	var mirrorer *app.Mirrorer
+	hasSplits, hasFaults := false, false
+	for _, routeCfg := range cfg.Routes {
+		routes = append(routes, &routing.Route{
+			Name:       routeCfg.Name,
+			PathPrefix: routeCfg.PathPrefix,
+			Pool:       routeCfg.Pool,
+			WebSocket:  routeCfg.WebSocket,
+			Retry:      cfg.RouteRetryPolicy(routeCfg),
+			Hedge:      routeCfg.HedgePolicy(),
+			Upgrade:    cfg.RouteUpgradePolicy(routeCfg),
+			Headers:    routeCfg.HeaderRules(),
+			Rewrite:    routeCfg.PathRewrite(),
+			Mirror:     routeCfg.MirrorPolicy(),
+			Split:      routeCfg.TrafficSplit(),
+			Fault:      routeCfg.FaultPolicy(),
+			Timeouts:   routeCfg.UpstreamTimeouts(),
+			GRPC:       routeCfg.GRPCPolicy(),
+			Stream:     routeCfg.StreamPolicy(),
+		})
+		hasSplits = hasSplits || routeCfg.Split != nil
+		hasFaults = hasFaults || routeCfg.Fault != nil
+		if routeCfg.Mirror != nil && mirrorer == nil {
+			// теневые запросы идут мимо кеша ответов, поэтому зеркалирование получает сам форвардер
+			mirrorer = app.NewMirrorer(forwarder, slogAdapter, cfg.Mirroring.MaxInFlight)
+			serviceOpts = append(serviceOpts, app.WithMirrorer(mirrorer))
+		}
+	}
+	routeTable := routing.NewTable(routes)
+	serviceOpts = append(serviceOpts, app.WithRoutes(routeTable))
+
+	// кеш ответов стоит между сервисом и форвардером: попадание в кеш не доходит до бэкенда
+	var lbForwarder ports.Forwarder = forwarder
+	var cacheService ports.CacheService
+	if cfg.Cache.Enabled {
+		cachingForwarder := app.NewCachingForwarder(forwarder, responsecache.NewLRU(cfg.Cache.MaxBytes), slogAdapter, cfg.Cache.MaxEntryBytes)
+		lbForwarder, cacheService = cachingForwarder, cachingForwarder
+	}
+
+	if hasFaults {
+		// сбои вносятся раньше кеша, чтобы прерывания и задержки срабатывали и на попаданиях в кеш
+		lbForwarder = app.NewFaultInjectingForwarder(lbForwarder, slogAdapter)
+	}
+
+	lbService := app.NewLoadBalancerService(backendRepo, lbForwarder, slogAdapter, serviceOpts...)
+	var healthMonitors []*app.HealthMonitor
 	if cfg.HealthCheck.Enabled {
-		healthMonitor = app.NewHealthMonitor(backendRepo, checker, slogAdapter, cfg.HealthCheck.Interval)
+		healthMonitors = append(healthMonitors, app.NewHealthMonitor(backendRepo, checker, slogAdapter, cfg.HealthCheck.Interval))
+		tcpChecker := healthcheck.NewTCPChecker(cfg.HealthCheck.Timeout)
+		tcpPools, udpProbes := cfg.TCPPools(), cfg.UDPProbes()
+		for name, pool := range namedPools {
+			poolChecker := checker
+			if tcpPools[name] {
+				poolChecker = tcpChecker // бэкенды TCP слушателей не обязаны говорить по HTTP
+			} else if probe, ok := udpProbes[name]; ok {
+				poolChecker = healthcheck.NewUDPChecker(cfg.HealthCheck.Timeout, udpProbe(probe))
+			}
+			healthMonitors = append(healthMonitors, app.NewHealthMonitor(pool, poolChecker, slogAdapter.With("pool", name), cfg.HealthCheck.Interval))
+		}
 	}
 
 	// 4 инициализируем HTTP сервер с middleware
@@ -93,9 +256,31 @@ func main() {
 		w.Write([]byte("OK\n"))
 	})
 
+	if cacheService != nil {
+		cacheMux := http.NewServeMux()
+		ratelimit_http.NewCacheAPIHandler(cacheService, slogAdapter).RegisterRoutes(cacheMux)
+		mux.Handle("/api/v1/cache/", http.StripPrefix("/api/v1/cache", cacheMux))
+		slogAdapter.Info("маршруты API кеша ответов зарегистрированы в /api/v1/cache/")
+	}
+
+	if hasSplits {
+		// доли трафика canary/blue-green меняются на лету: PUT /api/v1/split/routes/{route}
+		splitMux := http.NewServeMux()
+		ratelimit_http.NewSplitAPIHandler(app.NewTrafficSplitService(routeTable, slogAdapter), slogAdapter).RegisterRoutes(splitMux)
+		mux.Handle("/api/v1/split/", http.StripPrefix("/api/v1/split", splitMux))
+		slogAdapter.Info("маршруты API разделения трафика зарегистрированы в /api/v1/split/")
+	}
+
+	if mirrorer != nil {
+		mirrorMux := http.NewServeMux()
+		ratelimit_http.NewMirrorAPIHandler(mirrorer, slogAdapter).RegisterRoutes(mirrorMux)
+		mux.Handle("/api/v1/mirror/", http.StripPrefix("/api/v1/mirror", mirrorMux))
+		slogAdapter.Info("маршруты API зеркалирования зарегистрированы в /api/v1/mirror/")
+	}
+
 	if cfg.RateLimit.Enabled && cfg.RateLimit.Middleware {
 		mainHandler := http.HandlerFunc(lbService.HandleRequest)
-		rateLimitedMainHandler := middleware.RateLimitMiddleware(rateLimiter, slogAdapter)(mainHandler)
+		rateLimitedMainHandler := middleware.RateLimitMiddleware(rateLimiter, errorRenderer, slogAdapter)(mainHandler)
 
 		if rateLimitService != nil {
 			apiMux := http.NewServeMux()
@@ -112,18 +297,126 @@ func main() {
 		mux.HandleFunc("/", lbService.HandleRequest)
 	}
 
-	httpAdapter := ratelimit_http.NewServerAdapter(cfg.ListenAddress, lbService, slogAdapter)
-	httpAdapter.Server.Handler = mux
+	serverOpts := []ratelimit_http.ServerOption{
+		ratelimit_http.WithServerTimeouts(ratelimit_http.ServerTimeouts{
+			ReadTimeout:       cfg.Server.ReadTimeout,
+			ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout,
+			WriteTimeout:      cfg.Server.WriteTimeout,
+			IdleTimeout:       cfg.Server.IdleTimeout,
+		}),
+		ratelimit_http.WithHTTP2(ratelimit_http.HTTP2Settings{
+			Enabled:              cfg.Server.HTTP2.Enabled,
+			H2C:                  cfg.Server.HTTP2.H2C,
+			MaxConcurrentStreams: cfg.Server.HTTP2.MaxConcurrentStreams,
+		}),
+	}
+	if cfg.Server.ProxyProtocol.Enabled {
+		proxySources, err := clientip.NewResolver(cfg.Server.ProxyProtocol.TrustedSources)
+		if err != nil {
+			slogAdapter.Error("некорректный список источников PROXY protocol", "error", err)
+			os.Exit(1)
+		}
+		serverOpts = append(serverOpts, ratelimit_http.WithProxyProtocol(ratelimit_http.ProxyProtocolSettings{
+			Trusted:       proxySources.Trusted,
+			HeaderTimeout: cfg.Server.ProxyProtocol.HeaderTimeout,
+		}))
+	}
+	var certStore *ratelimit_http.CertificateStore
+	if cfg.Server.TLS.Enabled {
+		var sources []ratelimit_http.CertificateSource
+		for _, cert := range cfg.Server.TLS.AllCertificates() {
+			sources = append(sources, ratelimit_http.CertificateSource{
+				CertFile:    cert.CertFile,
+				KeyFile:     cert.KeyFile,
+				ServerNames: cert.ServerNames,
+			})
+		}
+		certStore, err = ratelimit_http.NewCertificateStore(sources, slogAdapter)
+		if err != nil {
+			slogAdapter.Error("не удалось загрузить сертификаты слушателя", "error", err)
+			os.Exit(1)
+		}
+		serverOpts = append(serverOpts, ratelimit_http.WithTLSConfig(&tls.Config{
+			GetCertificate: certStore.GetCertificate,
+			MinVersion:     cfg.Server.TLS.Version(),
+			CipherSuites:   cfg.Server.TLS.Ciphers(),
+		}))
+	}
+	httpAdapter := ratelimit_http.NewServerAdapter(cfg.ListenAddress, lbService, slogAdapter, serverOpts...)
+	// клиентский IP вычисляется один раз до rate limiting и балансировки
+	clientIPResolver, err := clientip.NewResolver(cfg.Forwarding.TrustedProxies)
+	if err != nil {
+		slogAdapter.Error("некорректный список доверенных прокси", "error", err)
+		os.Exit(1)
+	}
+	requestIDSettings, err := requestIDSettings(cfg.Forwarding.RequestID)
+	if err != nil {
+		slogAdapter.Error("некорректные настройки идентификатора запроса", "error", err)
+		os.Exit(1)
+	}
+	var handler http.Handler = mux
+	if cfg.Compression.Enabled {
+		handler = middleware.CompressionMiddleware(compressionSettings(cfg.Compression))(handler)
+	}
+	// идентификатор назначается до rate limiting, чтобы попасть и в ответ 429
+	handler = middleware.RequestIDMiddleware(requestIDSettings)(handler)
+	httpAdapter.Server.Handler = middleware.ClientIPMiddleware(clientIPResolver)(handler)
+	httpAdapter.AddDrainer(upgrades)
+
+	// слушатели режима TCP (L4): соединения уходят в пул без разбора протокола
+	tcpDialer := proxy.NewTCPDialer(cfg.Proxy.DialTimeout, cfg.Proxy.KeepAlive)
+	var tcpAdapters []*tcp.ListenerAdapter
+	for _, listenerCfg := range cfg.TCP.Listeners {
+		tcpService := app.NewTCPProxyService(namedPools[listenerCfg.Pool], tcpDialer, slogAdapter.With("listener", listenerCfg.Name), app.TCPProxySettings{
+			ConnectTimeout:  listenerCfg.ConnectTimeout,
+			ConnectAttempts: listenerCfg.ConnectAttempts,
+			IdleTimeout:     listenerCfg.IdleTimeout,
+			MaxLifetime:     listenerCfg.MaxLifetime,
+		})
+		tcpAdapters = append(tcpAdapters, tcp.NewListenerAdapter(listenerCfg.ListenAddress, tcpService, tcpService, slogAdapter))
+	}
+
+	// слушатели режима UDP: датаграммы клиента идут на бэкенд его сессии
+	udpDialer := proxy.NewUDPDialer()
+	var udpAdapters []*udp.ListenerAdapter
+	for _, listenerCfg := range cfg.UDP.Listeners {
+		udpService := app.NewUDPProxyService(namedPools[listenerCfg.Pool], udpDialer, slogAdapter.With("listener", listenerCfg.Name), app.UDPProxySettings{
+			SessionIdleTimeout: listenerCfg.SessionIdleTimeout,
+			MaxSessions:        listenerCfg.MaxSessions,
+		})
+		udpAdapters = append(udpAdapters, udp.NewListenerAdapter(listenerCfg.ListenAddress, udpService, udpService, slogAdapter))
+	}
 
 	// --- Запуск компонентов приложения ---
 	var wg sync.WaitGroup
 
-	if healthMonitor != nil {
+	for _, healthMonitor := range healthMonitors {
 		healthMonitor.Start()
-		slogAdapter.Info("монитор состояния запущен")
+	}
+	if len(healthMonitors) > 0 {
+		slogAdapter.Info("мониторы состояния запущены", "count", len(healthMonitors))
+	}
+
+	if certStore != nil && cfg.Server.TLS.ReloadInterval > 0 {
+		certStore.Start(cfg.Server.TLS.ReloadInterval)
 	}
 
-	httpAdapter.Run()
+	if err := httpAdapter.Run(); err != nil {
+		slogAdapter.Error("не удалось запустить HTTP сервер", "error", err)
+		os.Exit(1)
+	}
+	for _, tcpAdapter := range tcpAdapters {
+		if err := tcpAdapter.Run(); err != nil {
+			slogAdapter.Error("не удалось запустить TCP слушатель", "error", err)
+			os.Exit(1)
+		}
+	}
+	for _, udpAdapter := range udpAdapters {
+		if err := udpAdapter.Run(); err != nil {
+			slogAdapter.Error("не удалось запустить UDP слушатель", "error", err)
+			os.Exit(1)
+		}
+	}
 
 	// --- Graceful Shutdown ---
 	quit := make(chan os.Signal, 1)
@@ -143,15 +436,24 @@ func main() {
 		}()
 	}
 
-	// Останавливаем health monitor
-	if healthMonitor != nil {
+	// Останавливаем отслеживание сертификатов
+	if certStore != nil && cfg.Server.TLS.ReloadInterval > 0 {
 		wg.Add(1)
 		go func() {
+			defer wg.Done()
+			certStore.Stop()
+		}()
+	}
+
+	// Останавливаем health monitor'ы
+	for _, healthMonitor := range healthMonitors {
+		wg.Add(1)
+		go func(hm *app.HealthMonitor) {
 			defer wg.Done()
 			monitorCtx, monitorCancel := context.WithTimeout(shutdownCtx, 4*time.Second)
 			defer monitorCancel()
-			healthMonitor.Stop(monitorCtx)
-		}()
+			hm.Stop(monitorCtx)
+		}(healthMonitor)
 	}
 
 	// Останавливаем HTTP сервер
@@ -161,8 +463,31 @@ func main() {
 		serverCtx, serverCancel := context.WithTimeout(shutdownCtx, 5*time.Second)
 		defer serverCancel()
 		httpAdapter.Stop(serverCtx)
+		forwarder.CloseIdleConnections() // после остановки сервера пулы соединений к бэкендам больше не нужны
 	}()
 
+	// Останавливаем TCP слушатели, открытые соединения получают время закрыться самим
+	for _, tcpAdapter := range tcpAdapters {
+		wg.Add(1)
+		go func(a *tcp.ListenerAdapter) {
+			defer wg.Done()
+			listenerCtx, listenerCancel := context.WithTimeout(shutdownCtx, 10*time.Second)
+			defer listenerCancel()
+			a.Stop(listenerCtx)
+		}(tcpAdapter)
+	}
+
+	// Останавливаем UDP слушатели, ответы на уже отправленные датаграммы успевают вернуться клиентам
+	for _, udpAdapter := range udpAdapters {
+		wg.Add(1)
+		go func(a *udp.ListenerAdapter) {
+			defer wg.Done()
+			listenerCtx, listenerCancel := context.WithTimeout(shutdownCtx, 5*time.Second)
+			defer listenerCancel()
+			a.Stop(listenerCtx)
+		}(udpAdapter)
+	}
+
 	waitDone := make(chan struct{})
 	go func() {
 		wg.Wait()
@@ -178,3 +503,62 @@ func main() {
 
 	slogAdapter.Info("приложение завершило работу")
 }
+
+// buildUpstreamTLS собирает клиентский TLS для бэкендов, nil - настройки по умолчанию
+func buildUpstreamTLS(cfg *config.UpstreamTLSConfig) (*tls.Config, error) {
+	if cfg == nil {
+		return nil, nil
+	}
+	return tlsconfig.Build(tlsconfig.Upstream{
+		CAFile:             cfg.CAFile,
+		CertFile:           cfg.CertFile,
+		KeyFile:            cfg.KeyFile,
+		ServerName:         cfg.ServerName,
+		InsecureSkipVerify: cfg.InsecureSkipVerify,
+	})
+}
+
+// udpProbe переводит секцию probe UDP слушателя в пробу health checker'а
+func udpProbe(cfg config.UDPProbeConfig) healthcheck.UDPProbe {
+	if cfg.Type == "dns" {
+		return healthcheck.DNSProbe()
+	}
+	return healthcheck.PayloadProbe([]byte(cfg.Payload), cfg.ExpectReply)
+}
+
+// compressionSettings переводит секцию compression в настройки middleware
+func compressionSettings(cfg config.CompressionConfig) middleware.CompressionSettings {
+	settings := middleware.CompressionSettings{
+		Level:        cfg.Level,
+		MinSize:      cfg.MinSize,
+		ContentTypes: cfg.ContentTypes,
+	}
+	for _, name := range cfg.Encodings {
+		switch name {
+		case "gzip":
+			settings.Encodings = append(settings.Encodings, middleware.GzipEncoding())
+		case "deflate":
+			settings.Encodings = append(settings.Encodings, middleware.DeflateEncoding())
+		case "br":
+			settings.Encodings = append(settings.Encodings, middleware.BrotliEncoding())
+		}
+	}
+	return settings
+}
+
+// requestIDSettings переводит секцию forwarding.requestId в настройки middleware
+func requestIDSettings(cfg config.RequestIDConfig) (middleware.RequestIDSettings, error) {
+	settings := middleware.RequestIDSettings{Header: cfg.Header}
+	generate, err := requestid.NewGenerator(cfg.Format)
+	if err != nil {
+		return settings, err
+	}
+	settings.Generate = generate
+	if len(cfg.TrustedSources) > 0 {
+		// без своего списка входящий идентификатор принимается от доверенных прокси forwarding.trustedProxies
+		if settings.Trusted, err = clientip.NewResolver(cfg.TrustedSources); err != nil {
+			return settings, err
+		}
+	}
+	return settings, nil
+}
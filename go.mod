@@ -1,14 +1,17 @@
 module github.com/athebyme/cloud-ru-assign
 
-go 1.23
+go 1.23.0
 
 require (
+	github.com/andybalholm/brotli v1.2.6
 	github.com/go-redis/redis/v8 v8.11.5
 	github.com/golang/mock v1.6.0
+	golang.org/x/net v0.38.0
 	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
 	github.com/cespare/xxhash/v2 v2.1.2 // indirect
 	github.com/dgryski/go-rendezvous v0.0.0-20200823014737-9f7001d12a5f // indirect
+	golang.org/x/text v0.23.0 // indirect
 )
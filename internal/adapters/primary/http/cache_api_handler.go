@@ -0,0 +1,80 @@
+package http
+
+import (
+	"encoding/json"
+	"github.com/athebyme/cloud-ru-assign/internal/core/ports"
+	"net/http"
+)
+
+// CacheAPIHandler обрабатывает API управления кешем ответов
+type CacheAPIHandler struct {
+	service ports.CacheService
+	logger  ports.Logger
+}
+
+func NewCacheAPIHandler(service ports.CacheService, logger ports.Logger) *CacheAPIHandler {
+	return &CacheAPIHandler{
+		service: service,
+		logger:  logger.With("handler", "CacheAPI"),
+	}
+}
+
+func (h *CacheAPIHandler) RegisterRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("/purge", h.handlePurge)
+	mux.HandleFunc("/stats", h.handleStats)
+}
+
+// purgeRequest тело запроса очистки: точный ключ (хост и URI) или префикс ключа
+type purgeRequest struct {
+	Key    string `json:"key"`
+	Prefix string `json:"prefix"`
+}
+
+// handlePurge удаляет ответы из кеша
+func (h *CacheAPIHandler) handlePurge(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req purgeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.respondWithError(w, http.StatusBadRequest, "Invalid JSON")
+		return
+	}
+	if (req.Key == "") == (req.Prefix == "") {
+		h.respondWithError(w, http.StatusBadRequest, "нужно указать ровно одно из полей key или prefix")
+		return
+	}
+
+	var removed int
+	if req.Key != "" {
+		removed = h.service.Purge(req.Key)
+	} else {
+		removed = h.service.PurgePrefix(req.Prefix)
+	}
+	h.respondWithJSON(w, http.StatusOK, map[string]int{"purged": removed})
+}
+
+// handleStats возвращает размер кеша и счетчики попаданий
+func (h *CacheAPIHandler) handleStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	h.respondWithJSON(w, http.StatusOK, h.service.Stats())
+}
+
+// respondWithJSON отправляет JSON ответ
+func (h *CacheAPIHandler) respondWithJSON(w http.ResponseWriter, code int, payload interface{}) {
+	response, _ := json.Marshal(payload)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	w.Write(response)
+}
+
+// respondWithError отправляет ошибку в JSON формате
+func (h *CacheAPIHandler) respondWithError(w http.ResponseWriter, code int, message string) {
+	h.respondWithJSON(w, code, map[string]string{"error": message})
+}
@@ -0,0 +1,186 @@
+package http
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"github.com/athebyme/cloud-ru-assign/internal/core/ports"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// CertificateSource пара сертификат/ключ на диске
+type CertificateSource struct {
+	CertFile    string
+	KeyFile     string
+	ServerNames []string // имена для SNI, по умолчанию берутся из DNSNames и CN сертификата
+}
+
+// certificateSet снимок загруженных сертификатов
+// подменяется целиком при перезагрузке, поэтому читается без блокировок
+type certificateSet struct {
+	byName      map[string]*tls.Certificate // точные имена и шаблоны вида *.example.com
+	fallback    *tls.Certificate            // первый сертификат, для клиентов без SNI или с неизвестным именем
+	modTimes    map[string]time.Time        // время изменения файлов на момент загрузки
+	sourceCount int
+}
+
+// CertificateStore выбирает сертификат слушателя по SNI и перечитывает файлы при их изменении
+// уже установленные соединения перезагрузка не затрагивает: сертификат нужен только при рукопожатии
+type CertificateStore struct {
+	sources []CertificateSource
+	logger  ports.Logger
+	current atomic.Pointer[certificateSet]
+
+	stopCh chan struct{}
+	wg     sync.WaitGroup
+}
+
+// NewCertificateStore загружает сертификаты, ошибка любой пары не дает создать хранилище
+func NewCertificateStore(sources []CertificateSource, logger ports.Logger) (*CertificateStore, error) {
+	if len(sources) == 0 {
+		return nil, errors.New("не задано ни одного сертификата слушателя")
+	}
+	s := &CertificateStore{
+		sources: sources,
+		logger:  logger.With("component", "CertificateStore"),
+		stopCh:  make(chan struct{}),
+	}
+	set, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	s.current.Store(set)
+	return s, nil
+}
+
+// GetCertificate реализует tls.Config.GetCertificate
+// порядок выбора: точное имя, шаблон на уровень выше, сертификат по умолчанию
+func (s *CertificateStore) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	set := s.current.Load()
+	name := strings.ToLower(strings.TrimSuffix(hello.ServerName, "."))
+	if name != "" {
+		if cert, ok := set.byName[name]; ok {
+			return cert, nil
+		}
+		if i := strings.IndexByte(name, '.'); i > 0 {
+			if cert, ok := set.byName["*"+name[i:]]; ok {
+				return cert, nil
+			}
+		}
+	}
+	return set.fallback, nil
+}
+
+// Start запускает периодическую проверку файлов сертификатов
+func (s *CertificateStore) Start(interval time.Duration) {
+	s.logger.Info("запуск отслеживания изменений сертификатов", "interval", interval, "certificates", len(s.sources))
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				s.reloadIfChanged()
+			case <-s.stopCh:
+				s.logger.Info("остановка отслеживания изменений сертификатов")
+				return
+			}
+		}
+	}()
+}
+
+// Stop останавливает отслеживание изменений
+func (s *CertificateStore) Stop() {
+	close(s.stopCh)
+	s.wg.Wait()
+}
+
+// Reload перечитывает все сертификаты
+// при ошибке остается прежний набор, чтобы битый файл не уронил прием соединений
+func (s *CertificateStore) Reload() error {
+	set, err := s.load()
+	if err != nil {
+		return err
+	}
+	s.current.Store(set)
+	s.logger.Info("сертификаты слушателя перезагружены", "certificates", set.sourceCount, "names", len(set.byName))
+	return nil
+}
+
+func (s *CertificateStore) reloadIfChanged() {
+	set := s.current.Load()
+	changed := false
+	for file, loadedAt := range set.modTimes {
+		info, err := os.Stat(file)
+		if err != nil {
+			s.logger.Warn("не удалось проверить файл сертификата", "file", file, "error", err)
+			return
+		}
+		if !info.ModTime().Equal(loadedAt) {
+			changed = true
+			break
+		}
+	}
+	if !changed {
+		return
+	}
+	if err := s.Reload(); err != nil {
+		s.logger.Error("ошибка перезагрузки сертификатов, используются прежние", "error", err)
+	}
+}
+
+// load читает все пары с диска и строит индекс имен
+func (s *CertificateStore) load() (*certificateSet, error) {
+	set := &certificateSet{
+		byName:      make(map[string]*tls.Certificate),
+		modTimes:    make(map[string]time.Time),
+		sourceCount: len(s.sources),
+	}
+	for _, src := range s.sources {
+		// время изменения берем до чтения: если файл поменяется во время загрузки, следующая проверка это увидит
+		for _, file := range []string{src.CertFile, src.KeyFile} {
+			info, err := os.Stat(file)
+			if err != nil {
+				return nil, fmt.Errorf("ошибка чтения файла сертификата %s: %w", file, err)
+			}
+			set.modTimes[file] = info.ModTime()
+		}
+
+		cert, err := tls.LoadX509KeyPair(src.CertFile, src.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка загрузки сертификата %s: %w", src.CertFile, err)
+		}
+		if cert.Leaf == nil {
+			if cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0]); err != nil {
+				return nil, fmt.Errorf("ошибка разбора сертификата %s: %w", src.CertFile, err)
+			}
+		}
+
+		names := src.ServerNames
+		if len(names) == 0 {
+			names = cert.Leaf.DNSNames
+			if len(names) == 0 && cert.Leaf.Subject.CommonName != "" {
+				names = []string{cert.Leaf.Subject.CommonName}
+			}
+		}
+		for _, name := range names {
+			name = strings.ToLower(name)
+			if _, dup := set.byName[name]; dup {
+				s.logger.Warn("имя уже обслуживается другим сертификатом, используется первый", "name", name, "file", src.CertFile)
+				continue
+			}
+			set.byName[name] = &cert
+		}
+		if set.fallback == nil {
+			set.fallback = &cert
+		}
+	}
+	return set, nil
+}
@@ -0,0 +1,18 @@
+package middleware
+
+import (
+	"github.com/athebyme/cloud-ru-assign/internal/core/domain/clientip"
+	"github.com/athebyme/cloud-ru-assign/internal/core/domain/reqctx"
+	"net/http"
+)
+
+// ClientIPMiddleware вычисляет реального клиента с учетом доверенных прокси и кладет его в контекст
+// дальше этот IP используют логирование, rate limiting и форвардер
+func ClientIPMiddleware(resolver *clientip.Resolver) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			client := resolver.Resolve(r)
+			next.ServeHTTP(w, r.WithContext(reqctx.WithClient(r.Context(), client)))
+		})
+	}
+}
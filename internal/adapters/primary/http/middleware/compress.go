@@ -0,0 +1,334 @@
+package middleware
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"fmt"
+	"github.com/andybalholm/brotli"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Encoder сжимающий поток, который можно сбросить клиенту до конца ответа
+type Encoder interface {
+	io.WriteCloser
+	Flush() error
+}
+
+// Encoding алгоритм сжатия и имя, под которым он указывается в Accept-Encoding и Content-Encoding
+type Encoding struct {
+	Name      string
+	NewWriter func(w io.Writer, level int) (Encoder, error)
+}
+
+// GzipEncoding сжатие gzip из стандартной библиотеки
+func GzipEncoding() Encoding {
+	return Encoding{Name: "gzip", NewWriter: func(w io.Writer, level int) (Encoder, error) {
+		return gzip.NewWriterLevel(w, level)
+	}}
+}
+
+// DeflateEncoding сжатие deflate из стандартной библиотеки
+func DeflateEncoding() Encoding {
+	return Encoding{Name: "deflate", NewWriter: func(w io.Writer, level int) (Encoder, error) {
+		return flate.NewWriter(w, level)
+	}}
+}
+
+// BrotliEncoding сжатие brotli (br), уровни 1-9 совпадают с качеством brotli
+func BrotliEncoding() Encoding {
+	return Encoding{Name: "br", NewWriter: func(w io.Writer, level int) (Encoder, error) {
+		if level == flate.DefaultCompression {
+			level = brotli.DefaultCompression
+		}
+		return brotli.NewWriterLevel(w, level), nil
+	}}
+}
+
+// DefaultCompressibleTypes типы содержимого, которые сжимаются, если список не задан
+var DefaultCompressibleTypes = []string{
+	"text/*",
+	"application/json",
+	"application/problem+json",
+	"application/javascript",
+	"application/xml",
+	"image/svg+xml",
+}
+
+// CompressionSettings настройки сжатия ответов
+type CompressionSettings struct {
+	Encodings    []Encoding // в порядке предпочтения сервера, пусто - gzip и deflate
+	Level        int        // уровень сжатия, 0 - уровень алгоритма по умолчанию
+	MinSize      int        // ответы меньше этого размера отдаются как есть
+	ContentTypes []string   // типы вида application/json или text/*, пусто - DefaultCompressibleTypes
+}
+
+// CompressionMiddleware сжимает ответы по Accept-Encoding клиента
+// решение принимается по заголовкам ответа: уже закодированные ответы, неподходящие типы и no-transform не трогаются;
+// если размер ответа неизвестен, первые MinSize байт копятся в буфере, а Flush от обработчика начинает сжатие сразу
+func CompressionMiddleware(settings CompressionSettings) func(http.Handler) http.Handler {
+	if len(settings.Encodings) == 0 {
+		settings.Encodings = []Encoding{GzipEncoding(), DeflateEncoding()}
+	}
+	if settings.Level == 0 {
+		settings.Level = flate.DefaultCompression
+	}
+	if len(settings.ContentTypes) == 0 {
+		settings.ContentTypes = DefaultCompressibleTypes
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// у HEAD нет тела, а для смены протокола ответ не должен меняться
+			if r.Method == http.MethodHead || r.Header.Get("Upgrade") != "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			cw := &compressWriter{
+				ResponseWriter: w,
+				settings:       &settings,
+				encoding:       negotiateEncoding(r.Header.Values("Accept-Encoding"), settings.Encodings),
+			}
+			defer cw.finish()
+			next.ServeHTTP(cw, r)
+		})
+	}
+}
+
+// negotiateEncoding выбирает алгоритм с наибольшим q из Accept-Encoding, при равенстве - по порядку сервера
+// nil - клиент не принимает ни один из доступных алгоритмов
+func negotiateEncoding(accept []string, encodings []Encoding) *Encoding {
+	weights := make(map[string]float64)
+	for _, line := range accept {
+		for _, part := range strings.Split(line, ",") {
+			name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+			name = strings.ToLower(strings.TrimSpace(name))
+			if name == "" {
+				continue
+			}
+			q := 1.0
+			if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+				parsed, err := strconv.ParseFloat(value, 64)
+				if err != nil {
+					continue
+				}
+				q = parsed
+			}
+			weights[name] = q
+		}
+	}
+
+	var best *Encoding
+	bestQ := 0.0
+	for i := range encodings {
+		q, ok := weights[encodings[i].Name]
+		if !ok {
+			q = weights["*"] // * задает вес алгоритмов, не перечисленных явно
+		}
+		if q > bestQ {
+			best, bestQ = &encodings[i], q
+		}
+	}
+	return best
+}
+
+// compressWriter откладывает заголовки ответа, пока не станет ясно, сжимать ли тело
+type compressWriter struct {
+	http.ResponseWriter
+	settings *CompressionSettings
+	encoding *Encoding // nil - клиент не принимает сжатие
+
+	status  int
+	pending bool   // заголовки еще не отправлены, тело копится в buf
+	buf     []byte // начало тела до принятия решения
+	encoder Encoder
+	done    bool // решение принято, заголовки отправлены
+}
+
+func (cw *compressWriter) WriteHeader(code int) {
+	if cw.status != 0 || cw.done {
+		return
+	}
+	if code < http.StatusOK {
+		// промежуточные ответы (103 Early Hints, 101) уходят как есть
+		if code == http.StatusSwitchingProtocols {
+			cw.done = true
+		}
+		cw.ResponseWriter.WriteHeader(code)
+		return
+	}
+	cw.status = code
+
+	h := cw.Header()
+	if !cw.compressible(h) {
+		cw.commit(false)
+		return
+	}
+	// ответ мог бы сжиматься, поэтому кеши по пути должны различать его по Accept-Encoding
+	addVary(h, "Accept-Encoding")
+	if cw.encoding == nil {
+		cw.commit(false)
+		return
+	}
+	if length, err := strconv.ParseInt(h.Get("Content-Length"), 10, 64); err == nil {
+		cw.commit(length >= int64(cw.settings.MinSize))
+		return
+	}
+	cw.pending = true
+	if cw.settings.MinSize <= 0 {
+		cw.commit(true)
+	}
+}
+
+func (cw *compressWriter) Write(p []byte) (int, error) {
+	if cw.status == 0 && !cw.done {
+		cw.WriteHeader(http.StatusOK)
+	}
+	if cw.pending {
+		cw.buf = append(cw.buf, p...)
+		if len(cw.buf) < cw.settings.MinSize {
+			return len(p), nil
+		}
+		if err := cw.commit(true); err != nil {
+			return 0, err
+		}
+		return len(p), nil
+	}
+	if cw.encoder != nil {
+		return cw.encoder.Write(p)
+	}
+	return cw.ResponseWriter.Write(p)
+}
+
+// Flush сбрасывает сжатые данные клиенту: потоковые ответы не должны ждать конца тела
+func (cw *compressWriter) Flush() {
+	if cw.status == 0 && !cw.done {
+		cw.WriteHeader(http.StatusOK)
+	}
+	if cw.pending {
+		// размер потока неизвестен, а данные нужны клиенту уже сейчас
+		_ = cw.commit(true)
+	}
+	if cw.encoder != nil {
+		_ = cw.encoder.Flush()
+	}
+	_ = http.NewResponseController(cw.ResponseWriter).Flush()
+}
+
+// Hijack отдает соединение обработчику, если сжатие еще не началось
+func (cw *compressWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if cw.encoder != nil || cw.pending {
+		return nil, nil, fmt.Errorf("соединение нельзя перехватить после начала сжатого ответа")
+	}
+	return http.NewResponseController(cw.ResponseWriter).Hijack()
+}
+
+// Unwrap дает http.ResponseController доступ к остальным возможностям исходного writer'а
+func (cw *compressWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+// compressible проверяет по заголовкам ответа, можно ли его сжимать
+func (cw *compressWriter) compressible(h http.Header) bool {
+	switch cw.status {
+	case http.StatusNoContent, http.StatusNotModified, http.StatusPartialContent:
+		return false
+	}
+	if encoding := h.Get("Content-Encoding"); encoding != "" && !strings.EqualFold(encoding, "identity") {
+		return false
+	}
+	for _, line := range h.Values("Cache-Control") {
+		if strings.Contains(strings.ToLower(line), "no-transform") {
+			return false
+		}
+	}
+	return matchContentType(h.Get("Content-Type"), cw.settings.ContentTypes)
+}
+
+// commit отправляет заголовки и начало тела, compress - сжимать ли оставшийся ответ
+func (cw *compressWriter) commit(compress bool) error {
+	cw.pending = false
+	cw.done = true
+	h := cw.Header()
+	if compress {
+		encoder, err := cw.encoding.NewWriter(cw.ResponseWriter, cw.settings.Level)
+		if err != nil {
+			compress = false
+		} else {
+			cw.encoder = encoder
+			h.Set("Content-Encoding", cw.encoding.Name)
+			h.Del("Content-Length")
+			h.Del("Accept-Ranges")
+			// сжатое тело не совпадает побайтно с исходным, поэтому сильный ETag становится слабым
+			if etag := h.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+				h.Set("ETag", "W/"+etag)
+			}
+		}
+	}
+	cw.ResponseWriter.WriteHeader(cw.status)
+
+	buf := cw.buf
+	cw.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	if cw.encoder != nil {
+		_, err := cw.encoder.Write(buf)
+		return err
+	}
+	_, err := cw.ResponseWriter.Write(buf)
+	return err
+}
+
+// finish завершает ответ после обработчика: короткое тело уходит несжатым, сжатый поток закрывается
+func (cw *compressWriter) finish() {
+	if cw.pending {
+		_ = cw.commit(false)
+	}
+	if cw.encoder != nil {
+		_ = cw.encoder.Close()
+	}
+}
+
+// eventStreamType поток событий SSE: сжатие стоило бы сброса компрессора на каждое событие,
+// а часть клиентов и промежуточных прокси не ждет Content-Encoding у потока, поэтому он сжимается только по явному типу
+const eventStreamType = "text/event-stream"
+
+// matchContentType проверяет тип содержимого по списку вида application/json, text/*
+// шаблон text/* не покрывает text/event-stream
+func matchContentType(contentType string, allowed []string) bool {
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	mediaType = strings.ToLower(strings.TrimSpace(mediaType))
+	if mediaType == "" {
+		return false
+	}
+	for _, pattern := range allowed {
+		pattern = strings.ToLower(pattern)
+		if prefix, ok := strings.CutSuffix(pattern, "/*"); ok {
+			if strings.HasPrefix(mediaType, prefix+"/") && mediaType != eventStreamType {
+				return true
+			}
+		} else if mediaType == pattern {
+			return true
+		}
+	}
+	return false
+}
+
+// addVary добавляет заголовок в Vary, если его там еще нет
+func addVary(h http.Header, name string) {
+	for _, line := range h.Values("Vary") {
+		for _, existing := range strings.Split(line, ",") {
+			existing = strings.TrimSpace(existing)
+			if existing == "*" || strings.EqualFold(existing, name) {
+				return
+			}
+		}
+	}
+	h.Add("Vary", name)
+}
@@ -1,34 +1,26 @@
 package middleware
 
 import (
-	"encoding/json"
+	"github.com/athebyme/cloud-ru-assign/internal/core/domain/problem"
+	"github.com/athebyme/cloud-ru-assign/internal/core/domain/reqctx"
 	"github.com/athebyme/cloud-ru-assign/internal/core/ports"
-	"net"
 	"net/http"
-	"time"
 )
 
 // RateLimitMiddleware создает HTTP middleware для rate limiting
-func RateLimitMiddleware(rateLimiter ports.RateLimiter, logger ports.Logger) func(http.Handler) http.Handler {
+// отказ оформляется renderer'ом так же, как остальные ошибки балансировщика, nil - встроенный вид
+func RateLimitMiddleware(rateLimiter ports.RateLimiter, renderer *problem.Renderer, logger ports.Logger) func(http.Handler) http.Handler {
+	if renderer == nil {
+		renderer = problem.DefaultRenderer()
+	}
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			clientID := getClientID(r)
 
 			if !rateLimiter.Allow(clientID) {
-				w.Header().Set("Content-Type", "application/json")
-				w.WriteHeader(http.StatusTooManyRequests)
-
-				errorResponse := map[string]interface{}{
-					"code":    429,
-					"message": "Rate limit exceeded",
-					"time":    time.Now().UTC(),
-				}
-
-				if err := json.NewEncoder(w).Encode(errorResponse); err != nil {
-					logger.Error("Failed to encode rate limit error", "error", err)
-				}
-
-				logger.Info("Rate limit exceeded", "client", clientID, "uri", r.RequestURI)
+				// клиенты gRPC получают RESOURCE_EXHAUSTED в grpc-status, остальные - тело в формате из Accept
+				renderer.Write(w, r, http.StatusTooManyRequests, "rate limit exceeded")
+				logger.Info("Rate limit exceeded", "client", clientID, "uri", r.RequestURI, "request_id", reqctx.RequestID(r))
 				return
 			}
 
@@ -42,9 +34,6 @@ func getClientID(r *http.Request) string {
 		return "api_" + apiKey
 	}
 
-	ip, _, err := net.SplitHostPort(r.RemoteAddr)
-	if err != nil {
-		return r.RemoteAddr
-	}
-	return "ip_" + ip
+	// IP вычислен ClientIPMiddleware с учетом доверенных прокси, без него берется RemoteAddr
+	return "ip_" + reqctx.ClientIP(r)
 }
@@ -0,0 +1,88 @@
+package middleware
+
+import (
+	"github.com/athebyme/cloud-ru-assign/internal/core/domain/clientip"
+	"github.com/athebyme/cloud-ru-assign/internal/core/domain/reqctx"
+	"github.com/athebyme/cloud-ru-assign/internal/core/domain/requestid"
+	"net"
+	"net/http"
+)
+
+// RequestIDSettings настройки идентификатора запроса
+type RequestIDSettings struct {
+	Header   string        // заголовок с идентификатором, пусто - X-Request-ID
+	Generate func() string // генератор новых идентификаторов, nil - UUIDv4
+	// отправители, чей идентификатор принимается как есть, nil - доверенные прокси из ClientIPMiddleware
+	Trusted *clientip.Resolver
+}
+
+// RequestIDMiddleware назначает запросу идентификатор: принимает входящий от доверенных отправителей или создает новый
+// идентификатор попадает в контекст (логи, ответы об ошибках), в запрос к бэкенду и в ответ клиенту
+// должен стоять после ClientIPMiddleware, если Trusted не задан
+func RequestIDMiddleware(settings RequestIDSettings) func(http.Handler) http.Handler {
+	if settings.Header == "" {
+		settings.Header = "X-Request-ID"
+	}
+	if settings.Generate == nil {
+		settings.Generate = requestid.NewUUIDv4
+	}
+	header := http.CanonicalHeaderKey(settings.Header)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id := r.Header.Get(header)
+			if id == "" || !settings.trusted(r) || !requestid.Valid(id) {
+				id = settings.Generate()
+			}
+
+			// заголовки входящего запроса не меняются на месте: их может читать вызывающий код
+			req := r.WithContext(reqctx.WithRequestID(r.Context(), id))
+			req.Header = r.Header.Clone()
+			req.Header.Set(header, id)
+			next.ServeHTTP(&requestIDWriter{ResponseWriter: w, header: header, id: id}, req)
+		})
+	}
+}
+
+// trusted сообщает, можно ли принять идентификатор, пришедший в запросе
+func (s *RequestIDSettings) trusted(r *http.Request) bool {
+	if s.Trusted != nil {
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			host = r.RemoteAddr
+		}
+		return s.Trusted.Trusted(net.ParseIP(host))
+	}
+	client, ok := reqctx.ClientFrom(r.Context())
+	return ok && client.PeerTrusted
+}
+
+// requestIDWriter ставит идентификатор в ответ непосредственно перед заголовками
+// так он перекрывает значение из ответа бэкенда или кеша, которое могло остаться от другого запроса
+type requestIDWriter struct {
+	http.ResponseWriter
+	header      string
+	id          string
+	wroteHeader bool
+}
+
+func (rw *requestIDWriter) WriteHeader(code int) {
+	if !rw.wroteHeader {
+		rw.ResponseWriter.Header()[rw.header] = []string{rw.id}
+		// промежуточные ответы (103, 101) не закрывают заголовки окончательного ответа
+		rw.wroteHeader = code >= http.StatusOK
+	}
+	rw.ResponseWriter.WriteHeader(code)
+}
+
+func (rw *requestIDWriter) Write(p []byte) (int, error) {
+	if !rw.wroteHeader {
+		rw.WriteHeader(http.StatusOK)
+	}
+	return rw.ResponseWriter.Write(p)
+}
+
+// Unwrap дает http.ResponseController доступ к Flush, Hijack и дедлайнам исходного writer'а
+func (rw *requestIDWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
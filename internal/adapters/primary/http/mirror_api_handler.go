@@ -0,0 +1,37 @@
+package http
+
+import (
+	"encoding/json"
+	"github.com/athebyme/cloud-ru-assign/internal/core/ports"
+	"net/http"
+)
+
+// MirrorAPIHandler отдает результаты зеркалирования трафика в теневые пулы
+type MirrorAPIHandler struct {
+	service ports.MirrorService
+	logger  ports.Logger
+}
+
+func NewMirrorAPIHandler(service ports.MirrorService, logger ports.Logger) *MirrorAPIHandler {
+	return &MirrorAPIHandler{
+		service: service,
+		logger:  logger.With("handler", "MirrorAPI"),
+	}
+}
+
+func (h *MirrorAPIHandler) RegisterRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("/stats", h.handleStats)
+}
+
+// handleStats возвращает сравнение теневых ответов с основными по маршрутам
+func (h *MirrorAPIHandler) handleStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	response, _ := json.Marshal(h.service.MirrorStats())
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(response)
+}
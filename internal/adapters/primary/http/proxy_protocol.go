@@ -0,0 +1,247 @@
+package http
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/athebyme/cloud-ru-assign/internal/core/ports"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// proxyProtocolV2Signature первые 12 байт заголовка PROXY protocol v2
+var proxyProtocolV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+const (
+	proxyProtocolV1Prefix    = "PROXY "
+	proxyProtocolV1MaxLength = 107 // максимальная длина строки v1 вместе с CRLF
+	proxyProtocolV2HeaderLen = 16  // сигнатура, версия и команда, семейство, длина адресов
+)
+
+// ProxyProtocolSettings задает разбор заголовка PROXY protocol v1/v2 на слушателе
+type ProxyProtocolSettings struct {
+	Trusted       func(ip net.IP) bool // источники (L4 балансировщики), которым разрешено присылать заголовок
+	HeaderTimeout time.Duration        // сколько ждать заголовок после принятия соединения, 0 - без ограничения
+}
+
+// WithProxyProtocol включает разбор заголовка PROXY protocol от доверенных источников
+// адрес из заголовка становится RemoteAddr запроса и дальше участвует в определении IP клиента
+func WithProxyProtocol(settings ProxyProtocolSettings) ServerOption {
+	return func(s *ServerAdapter) {
+		s.proxyProtocol = &settings
+	}
+}
+
+// proxyProtocolListener оборачивает соединения доверенных источников разбором заголовка PROXY
+// соединения остальных источников отдаются как есть: их заголовок сервер примет за мусор и ответит 400
+type proxyProtocolListener struct {
+	net.Listener
+	settings ProxyProtocolSettings
+	logger   ports.Logger
+}
+
+func (l *proxyProtocolListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	peer, ok := conn.RemoteAddr().(*net.TCPAddr)
+	if !ok || l.settings.Trusted == nil || !l.settings.Trusted(peer.IP) {
+		return conn, nil
+	}
+	return &proxyProtocolConn{
+		Conn:    conn,
+		reader:  bufio.NewReader(conn),
+		timeout: l.settings.HeaderTimeout,
+		logger:  l.logger,
+	}, nil
+}
+
+// proxyProtocolConn читает заголовок PROXY при первом обращении
+// разбор ленивый: Accept не должен ждать медленного отправителя, это делает горутина соединения
+// заголовок необязателен, без него остаются адреса TCP соединения (например, проверки самого L4 балансировщика)
+type proxyProtocolConn struct {
+	net.Conn
+	reader  *bufio.Reader
+	timeout time.Duration
+	logger  ports.Logger
+
+	once        sync.Once
+	source      net.Addr
+	destination net.Addr
+	err         error
+}
+
+func (c *proxyProtocolConn) init() {
+	c.once.Do(func() {
+		if c.timeout > 0 {
+			c.Conn.SetReadDeadline(time.Now().Add(c.timeout))
+			defer c.Conn.SetReadDeadline(time.Time{})
+		}
+		c.source, c.destination, c.err = readProxyHeader(c.reader)
+		if c.err != nil {
+			c.logger.Warn("некорректный заголовок PROXY protocol, соединение закрывается",
+				"peer", c.Conn.RemoteAddr().String(), "error", c.err)
+		}
+	})
+}
+
+func (c *proxyProtocolConn) Read(p []byte) (int, error) {
+	c.init()
+	if c.err != nil {
+		return 0, c.err
+	}
+	return c.reader.Read(p)
+}
+
+// RemoteAddr возвращает адрес клиента из заголовка PROXY, а без заголовка - адрес отправителя
+func (c *proxyProtocolConn) RemoteAddr() net.Addr {
+	c.init()
+	if c.source != nil {
+		return c.source
+	}
+	return c.Conn.RemoteAddr()
+}
+
+// LocalAddr возвращает адрес, на который клиент подключался к L4 балансировщику
+func (c *proxyProtocolConn) LocalAddr() net.Addr {
+	c.init()
+	if c.destination != nil {
+		return c.destination
+	}
+	return c.Conn.LocalAddr()
+}
+
+// CloseWrite нужен туннелям WebSocket для полузакрытия соединения
+func (c *proxyProtocolConn) CloseWrite() error {
+	if cw, ok := c.Conn.(interface{ CloseWrite() error }); ok {
+		return cw.CloseWrite()
+	}
+	return errors.New("полузакрытие соединения не поддерживается")
+}
+
+// readProxyHeader разбирает заголовок v1 или v2, если он есть
+// nil адреса - заголовка нет либо он не несет адресов (UNKNOWN, LOCAL, не TCP)
+func readProxyHeader(r *bufio.Reader) (source, destination net.Addr, err error) {
+	first, err := r.Peek(1)
+	if errors.Is(err, io.EOF) {
+		return nil, nil, nil // соединение закрыли без данных, например TCP проверка L4 балансировщика
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("ошибка ожидания заголовка PROXY: %w", err)
+	}
+	switch first[0] {
+	case proxyProtocolV1Prefix[0]:
+		if prefix, err := r.Peek(len(proxyProtocolV1Prefix)); err == nil && string(prefix) == proxyProtocolV1Prefix {
+			return readProxyHeaderV1(r)
+		}
+	case proxyProtocolV2Signature[0]:
+		if sig, err := r.Peek(len(proxyProtocolV2Signature)); err == nil && bytes.Equal(sig, proxyProtocolV2Signature) {
+			return readProxyHeaderV2(r)
+		}
+	}
+	return nil, nil, nil
+}
+
+// readProxyHeaderV1 разбирает текстовую строку "PROXY TCP4 src dst sport dport\r\n"
+func readProxyHeaderV1(r *bufio.Reader) (net.Addr, net.Addr, error) {
+	var line []byte
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, nil, fmt.Errorf("ошибка чтения заголовка PROXY v1: %w", err)
+		}
+		line = append(line, b)
+		if b == '\n' {
+			break
+		}
+		if len(line) >= proxyProtocolV1MaxLength {
+			return nil, nil, errors.New("заголовок PROXY v1 длиннее допустимого")
+		}
+	}
+	if !bytes.HasSuffix(line, []byte("\r\n")) {
+		return nil, nil, errors.New("заголовок PROXY v1 должен заканчиваться CRLF")
+	}
+
+	fields := strings.Split(string(line[:len(line)-2]), " ")
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return nil, nil, nil
+	}
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return nil, nil, fmt.Errorf("некорректный заголовок PROXY v1: %q", line)
+	}
+	source, err := parseProxyAddr(fields[2], fields[4], fields[1] == "TCP4")
+	if err != nil {
+		return nil, nil, err
+	}
+	destination, err := parseProxyAddr(fields[3], fields[5], fields[1] == "TCP4")
+	if err != nil {
+		return nil, nil, err
+	}
+	return source, destination, nil
+}
+
+func parseProxyAddr(host, port string, ipv4 bool) (*net.TCPAddr, error) {
+	ip := net.ParseIP(host)
+	if ip == nil || (ip.To4() != nil) != ipv4 {
+		return nil, fmt.Errorf("некорректный адрес в заголовке PROXY v1: %s", host)
+	}
+	p, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("некорректный порт в заголовке PROXY v1: %s", port)
+	}
+	return &net.TCPAddr{IP: ip, Port: int(p)}, nil
+}
+
+// readProxyHeaderV2 разбирает бинарный заголовок v2, TLV расширения пропускаются
+func readProxyHeaderV2(r *bufio.Reader) (net.Addr, net.Addr, error) {
+	header := make([]byte, proxyProtocolV2HeaderLen)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, nil, fmt.Errorf("ошибка чтения заголовка PROXY v2: %w", err)
+	}
+	if header[12]>>4 != 2 {
+		return nil, nil, fmt.Errorf("неподдерживаемая версия PROXY protocol: %d", header[12]>>4)
+	}
+	command := header[12] & 0x0f
+	family := header[13]
+	payload := make([]byte, binary.BigEndian.Uint16(header[14:16]))
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, nil, fmt.Errorf("ошибка чтения адресов PROXY v2: %w", err)
+	}
+
+	switch command {
+	case 0x0: // LOCAL: соединение открыл сам балансировщик, адреса берутся из TCP
+		return nil, nil, nil
+	case 0x1: // PROXY
+	default:
+		return nil, nil, fmt.Errorf("неизвестная команда PROXY v2: %d", command)
+	}
+
+	var ipLen int
+	switch family {
+	case 0x11: // TCP поверх IPv4
+		ipLen = net.IPv4len
+	case 0x21: // TCP поверх IPv6
+		ipLen = net.IPv6len
+	default: // UDP, unix сокеты и UNSPEC к HTTP не относятся
+		return nil, nil, nil
+	}
+	if len(payload) < 2*ipLen+4 {
+		return nil, nil, errors.New("адресный блок PROXY v2 короче ожидаемого")
+	}
+	source := &net.TCPAddr{
+		IP:   net.IP(payload[:ipLen]),
+		Port: int(binary.BigEndian.Uint16(payload[2*ipLen:])),
+	}
+	destination := &net.TCPAddr{
+		IP:   net.IP(payload[ipLen : 2*ipLen]),
+		Port: int(binary.BigEndian.Uint16(payload[2*ipLen+2:])),
+	}
+	return source, destination, nil
+}
@@ -2,12 +2,69 @@ package http
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
+	"fmt"
 	"github.com/athebyme/cloud-ru-assign/internal/core/ports"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"net"
 	"net/http"
 	"time"
 )
 
+// HTTP2Settings задает поддержку HTTP/2 на стороне клиентов
+type HTTP2Settings struct {
+	Enabled              bool   // HTTP/2 поверх TLS, согласуется через ALPN
+	H2C                  bool   // HTTP/2 без TLS: prior knowledge и Upgrade: h2c
+	MaxConcurrentStreams uint32 // 0 - значение по умолчанию x/net/http2
+}
+
+// ServerTimeouts задает таймауты соединений клиентов, 0 - без ограничения
+type ServerTimeouts struct {
+	ReadTimeout       time.Duration // чтение всего запроса вместе с телом
+	ReadHeaderTimeout time.Duration // чтение заголовков запроса, 0 - равен ReadTimeout
+	WriteTimeout      time.Duration // от конца чтения заголовков до конца записи ответа
+	IdleTimeout       time.Duration // простой keep-alive соединения между запросами
+}
+
+// DefaultServerTimeouts возвращает таймауты слушателя по умолчанию
+func DefaultServerTimeouts() ServerTimeouts {
+	return ServerTimeouts{
+		ReadTimeout:  15 * time.Second,
+		WriteTimeout: 15 * time.Second,
+		IdleTimeout:  30 * time.Second,
+	}
+}
+
+// ServerOption настраивает ServerAdapter при создании
+type ServerOption func(s *ServerAdapter)
+
+// WithTLSConfig включает TLS на слушателе
+func WithTLSConfig(cfg *tls.Config) ServerOption {
+	return func(s *ServerAdapter) {
+		s.tlsConfig = cfg
+	}
+}
+
+// WithHTTP2 задает поддержку HTTP/2
+func WithHTTP2(settings HTTP2Settings) ServerOption {
+	return func(s *ServerAdapter) {
+		s.http2 = settings
+	}
+}
+
+// WithServerTimeouts задает таймауты соединений клиентов
+// WriteTimeout должен быть больше общего таймаута маршрутов, иначе клиент не получит 504
+func WithServerTimeouts(timeouts ServerTimeouts) ServerOption {
+	return func(s *ServerAdapter) {
+		s.httpServer.ReadTimeout = timeouts.ReadTimeout
+		s.httpServer.ReadHeaderTimeout = timeouts.ReadHeaderTimeout
+		s.httpServer.WriteTimeout = timeouts.WriteTimeout
+		s.httpServer.IdleTimeout = timeouts.IdleTimeout
+	}
+}
+
 // ServerAdapter управляет жизненным циклом HTTP сервера и направляет запросы в сервис ядра
 type ServerAdapter struct {
 	httpServer *http.Server
@@ -15,6 +72,12 @@ type ServerAdapter struct {
 	logger     ports.Logger
 	done       chan struct{}
 	Server     *http.Server
+	drainers   []ports.ConnectionDrainer
+	tlsConfig  *tls.Config
+	http2      HTTP2Settings
+	listener   net.Listener
+	// разбор PROXY protocol, nil - выключен
+	proxyProtocol *ProxyProtocolSettings
 }
 
 // NewServerAdapter создает новый адаптер HTTP сервера
@@ -22,45 +85,123 @@ func NewServerAdapter(
 	listenAddr string,
 	lbService ports.LoadBalancerService,
 	logger ports.Logger,
+	opts ...ServerOption,
 ) *ServerAdapter {
 	adapterLogger := logger.With("adapter", "HTTPServer")
 	mux := http.NewServeMux() // мультиплексор запросов
 
 	mux.HandleFunc("/", lbService.HandleRequest)
 
+	// WriteTimeout не обрывает WebSocket: после Hijack сервер снимает дедлайны соединения,
+	// дальше за простоем и сроком жизни следит учет переключенных соединений
 	errorLog := ports.NewSlogLogger(adapterLogger.With("source", "http_server_internal"))
+	timeouts := DefaultServerTimeouts()
 	srv := &http.Server{
-		Addr:         listenAddr,
-		Handler:      mux,
-		ReadTimeout:  15 * time.Second,
-		WriteTimeout: 15 * time.Second,
-		IdleTimeout:  30 * time.Second,
-		ErrorLog:     errorLog,
+		Addr:              listenAddr,
+		Handler:           mux,
+		ReadTimeout:       timeouts.ReadTimeout,
+		ReadHeaderTimeout: timeouts.ReadHeaderTimeout,
+		WriteTimeout:      timeouts.WriteTimeout,
+		IdleTimeout:       timeouts.IdleTimeout,
+		ErrorLog:          errorLog,
 	}
 
-	return &ServerAdapter{
+	s := &ServerAdapter{
 		httpServer: srv,
 		lbService:  lbService,
 		logger:     adapterLogger,
 		done:       make(chan struct{}),
 		Server:     srv,
+		http2:      HTTP2Settings{Enabled: true},
+	}
+	for _, opt := range opts {
+		opt(s)
 	}
+	return s
 }
 
-// Run запускает прослушивание сервером входящих запросов в отдельной горутине
-// не блокирует выполнение
-func (s *ServerAdapter) Run() {
-	s.logger.Info("HTTP server adapter starting", "address", s.httpServer.Addr)
+// AddDrainer регистрирует закрытие соединений, которые сервер не отслеживает после Hijack
+// они закрываются в Stop после остановки приема новых запросов
+func (s *ServerAdapter) AddDrainer(drainer ports.ConnectionDrainer) {
+	s.drainers = append(s.drainers, drainer)
+}
+
+// Run открывает слушатель и запускает обработку входящих запросов в отдельной горутине
+// не блокирует выполнение, возвращает ошибку, если слушатель не удалось открыть
+func (s *ServerAdapter) Run() error {
+	if err := s.configureHTTP2(); err != nil {
+		return err
+	}
+
+	ln, err := net.Listen("tcp", s.httpServer.Addr)
+	if err != nil {
+		return fmt.Errorf("не удалось открыть слушатель %s: %w", s.httpServer.Addr, err)
+	}
+	s.listener = ln
+	if s.proxyProtocol != nil {
+		// заголовок PROXY идет до TLS, поэтому обертка ставится под слушатель ServeTLS
+		ln = &proxyProtocolListener{Listener: ln, settings: *s.proxyProtocol, logger: s.logger}
+	}
+
+	s.logger.Info("HTTP server adapter starting",
+		"address", ln.Addr().String(),
+		"tls", s.tlsConfig != nil,
+		"http2", s.http2.Enabled && s.tlsConfig != nil,
+		"h2c", s.http2.H2C,
+		"proxy_protocol", s.proxyProtocol != nil,
+	)
 	go func() {
 		defer close(s.done) // сигнализируем о завершении при выходе
 
-		// ListenAndServe всегда возвращает ошибку, проверяем что это не ErrServerClosed
-		if err := s.httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		// Serve всегда возвращает ошибку, проверяем что это не ErrServerClosed
+		var err error
+		if s.tlsConfig != nil {
+			err = s.httpServer.ServeTLS(ln, "", "")
+		} else {
+			err = s.httpServer.Serve(ln)
+		}
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
 			s.logger.Error("ошибка запуска адаптера HTTP сервера", "error", err)
 		} else {
 			s.logger.Info("адаптер HTTP сервера прекратил прослушивание")
 		}
 	}()
+	return nil
+}
+
+// Addr возвращает адрес открытого слушателя, nil до вызова Run
+func (s *ServerAdapter) Addr() net.Addr {
+	if s.listener == nil {
+		return nil
+	}
+	return s.listener.Addr()
+}
+
+// configureHTTP2 включает HTTP/2 поверх TLS через ALPN и h2c для открытого текста
+// вызывается в Run, тк обработчик сервера может быть заменен после создания адаптера
+func (s *ServerAdapter) configureHTTP2() error {
+	h2s := &http2.Server{
+		MaxConcurrentStreams: s.http2.MaxConcurrentStreams,
+		IdleTimeout:          s.httpServer.IdleTimeout,
+	}
+
+	if s.tlsConfig != nil {
+		s.httpServer.TLSConfig = s.tlsConfig
+		if s.http2.Enabled {
+			// добавляет h2 в NextProtos и проверяет, что шифры допустимы для HTTP/2
+			if err := http2.ConfigureServer(s.httpServer, h2s); err != nil {
+				return fmt.Errorf("ошибка настройки HTTP/2: %w", err)
+			}
+		} else {
+			// непустая карта без h2 запрещает серверу согласовывать HTTP/2
+			s.httpServer.TLSNextProto = make(map[string]func(*http.Server, *tls.Conn, http.Handler))
+		}
+	}
+
+	if s.http2.H2C {
+		s.httpServer.Handler = h2c.NewHandler(s.httpServer.Handler, h2s)
+	}
+	return nil
 }
 
 // Stop корректно останавливает HTTP сервер
@@ -78,4 +219,10 @@ func (s *ServerAdapter) Stop(ctx context.Context) {
 	} else {
 		s.logger.Info("адаптер HTTP сервера корректно остановлен")
 	}
+
+	for _, drainer := range s.drainers {
+		if err := drainer.Drain(ctx); err != nil {
+			s.logger.Warn("переключенные соединения закрыты принудительно по таймауту остановки", "error", err)
+		}
+	}
 }
@@ -0,0 +1,84 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/athebyme/cloud-ru-assign/internal/core/domain/routing"
+	"github.com/athebyme/cloud-ru-assign/internal/core/ports"
+	"net/http"
+)
+
+// SplitAPIHandler обрабатывает API управления долями трафика маршрутов
+type SplitAPIHandler struct {
+	service ports.TrafficSplitService
+	logger  ports.Logger
+}
+
+func NewSplitAPIHandler(service ports.TrafficSplitService, logger ports.Logger) *SplitAPIHandler {
+	return &SplitAPIHandler{
+		service: service,
+		logger:  logger.With("handler", "SplitAPI"),
+	}
+}
+
+func (h *SplitAPIHandler) RegisterRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("/routes", h.handleRoutes)
+	mux.HandleFunc("/routes/", h.handleRoute)
+}
+
+// weightsRequest тело запроса изменения весов, например {"weights": {"stable": 90, "canary": 10}}
+type weightsRequest struct {
+	Weights map[string]int `json:"weights"`
+}
+
+func (h *SplitAPIHandler) handleRoutes(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	h.respondWithJSON(w, http.StatusOK, h.service.ListSplits())
+}
+
+func (h *SplitAPIHandler) handleRoute(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	route := r.URL.Path[len("/routes/"):]
+	if route == "" {
+		http.Error(w, "route required", http.StatusBadRequest)
+		return
+	}
+
+	var req weightsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || len(req.Weights) == 0 {
+		h.respondWithError(w, http.StatusBadRequest, "Invalid JSON")
+		return
+	}
+
+	groups, err := h.service.SetWeights(route, req.Weights)
+	if errors.Is(err, routing.ErrNoSplit) {
+		h.respondWithError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		h.respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	h.respondWithJSON(w, http.StatusOK, groups)
+}
+
+// respondWithJSON отправляет JSON ответ
+func (h *SplitAPIHandler) respondWithJSON(w http.ResponseWriter, code int, payload interface{}) {
+	response, _ := json.Marshal(payload)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	w.Write(response)
+}
+
+// respondWithError отправляет ошибку в JSON формате
+func (h *SplitAPIHandler) respondWithError(w http.ResponseWriter, code int, message string) {
+	h.respondWithJSON(w, code, map[string]string{"error": message})
+}
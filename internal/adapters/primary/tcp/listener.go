@@ -0,0 +1,100 @@
+package tcp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/athebyme/cloud-ru-assign/internal/core/ports"
+	"net"
+	"sync"
+	"time"
+)
+
+// acceptRetryDelay пауза после временной ошибки Accept (например, исчерпаны файловые дескрипторы)
+const acceptRetryDelay = 50 * time.Millisecond
+
+// ListenerAdapter принимает TCP соединения и передает их в сервис проксирования (L4)
+type ListenerAdapter struct {
+	listenAddr string
+	service    ports.StreamProxyService
+	drainer    ports.ConnectionDrainer
+	logger     ports.Logger
+
+	listener net.Listener
+	done     chan struct{}
+	handlers sync.WaitGroup // обработчики соединений, завершаются после закрытия соединений в Drain
+}
+
+// NewListenerAdapter создает адаптер TCP слушателя
+// drainer закрывает открытые соединения при остановке, обычно это сам сервис
+func NewListenerAdapter(
+	listenAddr string,
+	service ports.StreamProxyService,
+	drainer ports.ConnectionDrainer,
+	logger ports.Logger,
+) *ListenerAdapter {
+	return &ListenerAdapter{
+		listenAddr: listenAddr,
+		service:    service,
+		drainer:    drainer,
+		logger:     logger.With("adapter", "TCPListener", "address", listenAddr),
+		done:       make(chan struct{}),
+	}
+}
+
+// Run открывает слушатель и запускает прием соединений в отдельной горутине
+// не блокирует выполнение, возвращает ошибку, если слушатель не удалось открыть
+func (a *ListenerAdapter) Run() error {
+	ln, err := net.Listen("tcp", a.listenAddr)
+	if err != nil {
+		return fmt.Errorf("не удалось открыть TCP слушатель %s: %w", a.listenAddr, err)
+	}
+	a.listener = ln
+	a.logger.Info("TCP listener adapter starting", "address", ln.Addr().String())
+
+	go func() {
+		defer close(a.done)
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				if errors.Is(err, net.ErrClosed) {
+					a.logger.Info("адаптер TCP слушателя прекратил прием соединений")
+					return
+				}
+				a.logger.Warn("ошибка приема TCP соединения", "error", err)
+				time.Sleep(acceptRetryDelay)
+				continue
+			}
+			a.handlers.Add(1)
+			go func() {
+				defer a.handlers.Done()
+				a.service.HandleConn(conn)
+			}()
+		}
+	}()
+	return nil
+}
+
+// Addr возвращает адрес открытого слушателя, nil до вызова Run
+func (a *ListenerAdapter) Addr() net.Addr {
+	if a.listener == nil {
+		return nil
+	}
+	return a.listener.Addr()
+}
+
+// Stop перестает принимать соединения и ждет закрытия открытых до отмены ctx,
+// после чего закрывает оставшиеся принудительно
+func (a *ListenerAdapter) Stop(ctx context.Context) {
+	a.logger.Info("инициация корректной остановки адаптера TCP слушателя")
+	if a.listener != nil {
+		a.listener.Close()
+		<-a.done
+	}
+
+	if err := a.drainer.Drain(ctx); err != nil {
+		a.logger.Warn("TCP соединения закрыты принудительно по таймауту остановки", "error", err)
+	}
+	a.handlers.Wait()
+	a.logger.Info("адаптер TCP слушателя остановлен")
+}
@@ -0,0 +1,99 @@
+package udp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/athebyme/cloud-ru-assign/internal/core/ports"
+	"net"
+)
+
+// maxDatagram размер буфера чтения, больше датаграмма UDP не бывает
+const maxDatagram = 64 * 1024
+
+// ListenerAdapter принимает UDP датаграммы и передает их в сервис проксирования
+// ответы бэкендов отправляются клиентам с того же сокета, на который они писали
+type ListenerAdapter struct {
+	listenAddr string
+	service    ports.DatagramProxyService
+	drainer    ports.ConnectionDrainer
+	logger     ports.Logger
+
+	conn net.PacketConn
+	done chan struct{}
+}
+
+// NewListenerAdapter создает адаптер UDP слушателя
+// drainer закрывает сессии при остановке, обычно это сам сервис
+func NewListenerAdapter(
+	listenAddr string,
+	service ports.DatagramProxyService,
+	drainer ports.ConnectionDrainer,
+	logger ports.Logger,
+) *ListenerAdapter {
+	return &ListenerAdapter{
+		listenAddr: listenAddr,
+		service:    service,
+		drainer:    drainer,
+		logger:     logger.With("adapter", "UDPListener", "address", listenAddr),
+		done:       make(chan struct{}),
+	}
+}
+
+// Run открывает сокет и запускает прием датаграмм в отдельной горутине
+// не блокирует выполнение, возвращает ошибку, если сокет не удалось открыть
+func (a *ListenerAdapter) Run() error {
+	conn, err := net.ListenPacket("udp", a.listenAddr)
+	if err != nil {
+		return fmt.Errorf("не удалось открыть UDP слушатель %s: %w", a.listenAddr, err)
+	}
+	a.conn = conn
+	a.logger.Info("UDP listener adapter starting", "address", conn.LocalAddr().String())
+
+	go func() {
+		defer close(a.done)
+		buf := make([]byte, maxDatagram)
+		for {
+			n, client, err := conn.ReadFrom(buf)
+			if err != nil {
+				if errors.Is(err, net.ErrClosed) {
+					a.logger.Info("адаптер UDP слушателя прекратил прием датаграмм")
+					return
+				}
+				a.logger.Warn("ошибка чтения UDP датаграммы", "error", err)
+				continue
+			}
+			// буфер переиспользуется для следующей датаграммы, сервис получает копию
+			payload := make([]byte, n)
+			copy(payload, buf[:n])
+			a.service.HandleDatagram(payload, client, func(reply []byte) error {
+				_, err := conn.WriteTo(reply, client)
+				return err
+			})
+		}
+	}()
+	return nil
+}
+
+// Addr возвращает адрес открытого сокета, nil до вызова Run
+func (a *ListenerAdapter) Addr() net.Addr {
+	if a.conn == nil {
+		return nil
+	}
+	return a.conn.LocalAddr()
+}
+
+// Stop перестает создавать сессии и ждет ответов бэкендов по открытым до отмены ctx,
+// после чего закрывает сессии и сокет
+func (a *ListenerAdapter) Stop(ctx context.Context) {
+	a.logger.Info("инициация корректной остановки адаптера UDP слушателя")
+	// сокет закрывается после сессий: через него уходят последние ответы бэкендов
+	if err := a.drainer.Drain(ctx); err != nil {
+		a.logger.Warn("UDP сессии закрыты принудительно по таймауту остановки", "error", err)
+	}
+	if a.conn != nil {
+		a.conn.Close()
+		<-a.done
+	}
+	a.logger.Info("адаптер UDP слушателя остановлен")
+}
@@ -1,8 +1,11 @@
 package healthcheck
 
 import (
+	"crypto/tls"
 	"fmt"
+	"github.com/athebyme/cloud-ru-assign/internal/adapters/secondary/proxyproto"
 	"github.com/athebyme/cloud-ru-assign/internal/core/ports"
+	"net"
 	"net/http"
 	"net/url"
 	"time"
@@ -11,23 +14,95 @@ import (
 // HTTPChecker реализует порт HealthChecker, используя HTTP GET запросы
 type HTTPChecker struct {
 	client  *http.Client
+	clients map[string]*http.Client // клиенты бэкендов со своими настройками соединения, ключ: URL бэкенда
 	timeout time.Duration
 	path    string
+
+	// настройки из опций, по ним клиенты собираются после применения всех опций
+	defaultTLS           *tls.Config
+	backendTLS           map[string]*tls.Config
+	backendProxyProtocol map[string]proxyproto.Version
+}
+
+// CheckerOption настраивает HTTPChecker при создании
+type CheckerOption func(c *HTTPChecker)
+
+// WithDefaultTLS задает TLS для бэкендов без собственных настроек
+func WithDefaultTLS(cfg *tls.Config) CheckerOption {
+	return func(c *HTTPChecker) {
+		c.defaultTLS = cfg
+	}
+}
+
+// WithBackendTLS задает TLS для проверок бэкенда backendUrl (CA, клиентский сертификат, SNI)
+func WithBackendTLS(backendUrl string, cfg *tls.Config) CheckerOption {
+	return func(c *HTTPChecker) {
+		if key, ok := backendKey(backendUrl); ok {
+			c.backendTLS[key] = cfg
+		}
+	}
+}
+
+// WithBackendProxyProtocol отправляет бэкенду backendUrl заголовок PROXY перед проверкой
+// бэкенд, ожидающий заголовок, без него отклоняет соединение
+func WithBackendProxyProtocol(backendUrl string, v proxyproto.Version) CheckerOption {
+	return func(c *HTTPChecker) {
+		if key, ok := backendKey(backendUrl); ok && v != proxyproto.None {
+			c.backendProxyProtocol[key] = v
+		}
+	}
 }
 
 // NewHTTPChecker создает новый HTTP health checker
-func NewHTTPChecker(timeout time.Duration, path string) ports.HealthChecker {
-	return &HTTPChecker{
-		client: &http.Client{
-			Timeout: timeout,
-			Transport: &http.Transport{
-				// отключаем keep-alive, тк проверки в данном варианте короткоживущие и редкие
-				DisableKeepAlives: true,
-				// можно было бы сделать таймауты для соединений, но в данном варианте упрощено все
-			},
-		},
-		timeout: timeout,
-		path:    path,
+func NewHTTPChecker(timeout time.Duration, path string, opts ...CheckerOption) ports.HealthChecker {
+	c := &HTTPChecker{
+		clients:              make(map[string]*http.Client),
+		timeout:              timeout,
+		path:                 path,
+		backendTLS:           make(map[string]*tls.Config),
+		backendProxyProtocol: make(map[string]proxyproto.Version),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	c.client = c.newClient(c.defaultTLS, proxyproto.None)
+	for key, cfg := range c.backendTLS {
+		c.clients[key] = c.newClient(cfg, c.backendProxyProtocol[key])
+	}
+	for key, v := range c.backendProxyProtocol {
+		if _, ok := c.backendTLS[key]; !ok {
+			c.clients[key] = c.newClient(c.defaultTLS, v)
+		}
+	}
+	return c
+}
+
+// backendKey нормализует URL бэкенда так же, как он выглядит в пуле
+// адрес, который не удается разобрать, игнорируется: такой бэкенд не попадет и в пул
+func backendKey(backendUrl string) (string, bool) {
+	parsed, err := url.Parse(backendUrl)
+	if err != nil {
+		return "", false
+	}
+	return parsed.String(), true
+}
+
+func (c *HTTPChecker) newClient(tlsConfig *tls.Config, proxyProtocol proxyproto.Version) *http.Client {
+	transport := &http.Transport{
+		// отключаем keep-alive, тк проверки в данном варианте короткоживущие и редкие
+		DisableKeepAlives: true,
+		// те же CA, клиентский сертификат и SNI, что и у форвардера, иначе проверка mTLS бэкенда всегда падает
+		TLSClientConfig: tlsConfig,
+		// можно было бы сделать таймауты для соединений, но в данном варианте упрощено все
+	}
+	if proxyProtocol != proxyproto.None {
+		// проверку открывает сам балансировщик, поэтому заголовок без адресов клиента (LOCAL / UNKNOWN)
+		transport.DialContext = proxyproto.Dial(&net.Dialer{Timeout: c.timeout}, proxyProtocol, nil)
+	}
+	return &http.Client{
+		Timeout:   c.timeout,
+		Transport: transport,
 	}
 }
 
@@ -45,7 +120,11 @@ func (c *HTTPChecker) Check(target *url.URL) error {
 
 	req.Header.Set("User-Agent", "LoadBalancer-HealthChecker/1.0") // user agent - сервис health checker
 
-	resp, err := c.client.Do(req)
+	client, ok := c.clients[target.String()]
+	if !ok {
+		client = c.client
+	}
+	resp, err := client.Do(req)
 	if err != nil {
 		// сетевая ошибка: таймаут, не удалось подключиться или другие
 		return fmt.Errorf("health check не удался для %s: %w", target, err)
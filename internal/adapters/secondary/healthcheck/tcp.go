@@ -0,0 +1,28 @@
+package healthcheck
+
+import (
+	"fmt"
+	"github.com/athebyme/cloud-ru-assign/internal/core/ports"
+	"net"
+	"net/url"
+	"time"
+)
+
+// TCPChecker реализует порт HealthChecker для бэкендов режима TCP: бэкенд здоров, если принимает соединение
+type TCPChecker struct {
+	timeout time.Duration
+}
+
+// NewTCPChecker создает health checker, который только открывает и сразу закрывает соединение
+func NewTCPChecker(timeout time.Duration) ports.HealthChecker {
+	return &TCPChecker{timeout: timeout}
+}
+
+// Check открывает TCP соединение с host:port бэкенда
+func (c *TCPChecker) Check(target *url.URL) error {
+	conn, err := net.DialTimeout("tcp", target.Host, c.timeout)
+	if err != nil {
+		return fmt.Errorf("health check не удался для %s: %w", target, err)
+	}
+	return conn.Close()
+}
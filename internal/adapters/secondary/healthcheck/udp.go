@@ -0,0 +1,85 @@
+package healthcheck
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/athebyme/cloud-ru-assign/internal/core/ports"
+	"net"
+	"net/url"
+	"time"
+)
+
+// UDPProbe проверка бэкенда через связанный с ним UDP сокет, ошибка - бэкенд нездоров
+// у сокета уже выставлен дедлайн проверки
+type UDPProbe func(conn net.Conn) error
+
+// PayloadProbe отправляет payload и, если expectReply, ждет любой ответ
+// без ответа (syslog и тд) нездоровым считается только бэкенд, на порту которого никто не слушает:
+// ICMP port unreachable приходит ошибкой чтения связанного сокета
+func PayloadProbe(payload []byte, expectReply bool) UDPProbe {
+	return func(conn net.Conn) error {
+		if _, err := conn.Write(payload); err != nil {
+			return err
+		}
+		_, err := conn.Read(make([]byte, 1500))
+		var netErr net.Error
+		if !expectReply && errors.As(err, &netErr) && netErr.Timeout() {
+			return nil
+		}
+		return err
+	}
+}
+
+// DNSProbe отправляет запрос SOA корневой зоны и ждет ответ с тем же ID
+// код ответа не проверяется: отказ в рекурсии тоже значит, что сервер жив
+func DNSProbe() UDPProbe {
+	return func(conn net.Conn) error {
+		const id = 0x4c42
+		query := []byte{
+			0x4c, 0x42, // ID
+			0x00, 0x00, // флаги: стандартный запрос без рекурсии
+			0x00, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, // один вопрос
+			0x00,       // корневая зона
+			0x00, 0x06, // SOA
+			0x00, 0x01, // IN
+		}
+		if _, err := conn.Write(query); err != nil {
+			return err
+		}
+		resp := make([]byte, 512)
+		n, err := conn.Read(resp)
+		if err != nil {
+			return err
+		}
+		if n < 12 || binary.BigEndian.Uint16(resp) != id || resp[2]&0x80 == 0 {
+			return errors.New("получен не DNS ответ на запрос проверки")
+		}
+		return nil
+	}
+}
+
+// UDPChecker реализует порт HealthChecker для бэкендов режима UDP
+type UDPChecker struct {
+	timeout time.Duration
+	probe   UDPProbe
+}
+
+// NewUDPChecker создает health checker, выполняющий probe для каждого бэкенда
+func NewUDPChecker(timeout time.Duration, probe UDPProbe) ports.HealthChecker {
+	return &UDPChecker{timeout: timeout, probe: probe}
+}
+
+// Check выполняет проверку через новый UDP сокет, связанный с host:port бэкенда
+func (c *UDPChecker) Check(target *url.URL) error {
+	conn, err := net.DialTimeout("udp", target.Host, c.timeout)
+	if err != nil {
+		return fmt.Errorf("health check не удался для %s: %w", target, err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(c.timeout))
+	if err := c.probe(conn); err != nil {
+		return fmt.Errorf("health check не удался для %s: %w", target, err)
+	}
+	return nil
+}
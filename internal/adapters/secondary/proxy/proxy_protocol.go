@@ -0,0 +1,34 @@
+package proxy
+
+import (
+	"context"
+	"github.com/athebyme/cloud-ru-assign/internal/core/domain/reqctx"
+	"net"
+	"net/http"
+	"strconv"
+)
+
+// proxyProtocolAddrs вычисляет адреса для заголовка PROXY: клиента и точки входа в балансировщик
+// порт клиента известен, только если клиент подключился к нам сам, а не через доверенный прокси
+func proxyProtocolAddrs(r *http.Request) (source, destination *net.TCPAddr) {
+	destination, _ = r.Context().Value(http.LocalAddrContextKey).(*net.TCPAddr)
+
+	ip := net.ParseIP(reqctx.ClientIP(r))
+	if ip == nil {
+		return nil, destination
+	}
+	source = &net.TCPAddr{IP: ip}
+	if host, port, err := net.SplitHostPort(r.RemoteAddr); err == nil && net.ParseIP(host).Equal(ip) {
+		source.Port, _ = strconv.Atoi(port)
+	}
+	return source, destination
+}
+
+// forwardAddrs достает адреса из состояния Forward
+// транспорт сохраняет значения контекста запроса, когда открывает под него соединение
+func forwardAddrs(ctx context.Context) (source, destination *net.TCPAddr) {
+	if state, ok := ctx.Value(forwardStateKey{}).(*forwardState); ok {
+		return state.source, state.destination
+	}
+	return nil, nil
+}
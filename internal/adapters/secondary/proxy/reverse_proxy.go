@@ -1,47 +1,250 @@
 package proxy
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"github.com/athebyme/cloud-ru-assign/internal/adapters/secondary/proxyproto"
 	"github.com/athebyme/cloud-ru-assign/internal/core/domain/balancer"
+	"github.com/athebyme/cloud-ru-assign/internal/core/domain/headers"
+	"github.com/athebyme/cloud-ru-assign/internal/core/domain/reqctx"
+	"github.com/athebyme/cloud-ru-assign/internal/core/domain/routing"
 	"github.com/athebyme/cloud-ru-assign/internal/core/ports"
+	"io"
+	"net"
 	"net/http"
 	"net/http/httputil"
+	"net/url"
+	"strconv"
+	"strings"
 	"sync"
+	"syscall"
+	"time"
 )
 
+// TransportSettings задает параметры пула соединений до одного бэкенда
+type TransportSettings struct {
+	MaxIdleConns        int           // общий лимит простаивающих соединений транспорта
+	MaxIdleConnsPerHost int           // лимит простаивающих соединений до хоста бэкенда
+	IdleConnTimeout     time.Duration // сколько простаивающее соединение живет в пуле
+	KeepAlive           time.Duration // период TCP keep-alive
+	DialTimeout         time.Duration // таймаут установки TCP соединения
+	TLSHandshakeTimeout time.Duration // таймаут TLS рукопожатия
+}
+
+// DefaultTransportSettings возвращает настройки пула по умолчанию
+func DefaultTransportSettings() TransportSettings {
+	return TransportSettings{
+		MaxIdleConns:        100,
+		MaxIdleConnsPerHost: 32,
+		IdleConnTimeout:     90 * time.Second,
+		KeepAlive:           30 * time.Second,
+		DialTimeout:         5 * time.Second,
+		TLSHandshakeTimeout: 10 * time.Second,
+	}
+}
+
+// ForwarderOption настраивает HttpUtilForwarder при создании
+type ForwarderOption func(f *HttpUtilForwarder)
+
+// WithTransportSettings задает параметры транспорта для всех бэкендов
+func WithTransportSettings(settings TransportSettings) ForwarderOption {
+	return func(f *HttpUtilForwarder) {
+		f.settings = settings
+	}
+}
+
+// roundTripper транспорт бэкенда: *http.Transport или *http2.Transport
+type roundTripper interface {
+	http.RoundTripper
+	CloseIdleConnections()
+}
+
+// WithForwardedHeader включает заголовок Forwarded (RFC 7239) в дополнение к X-Forwarded-*
+func WithForwardedHeader(enabled bool) ForwarderOption {
+	return func(f *HttpUtilForwarder) {
+		f.forwardedHeader = enabled
+	}
+}
+
+// backendProxy закешированный реверс-прокси бэкенда вместе с его транспортом
+type backendProxy struct {
+	proxy         *httputil.ReverseProxy
+	transport     roundTripper
+	proxyProtocol bool // транспорт отправляет заголовок PROXY, ему нужны адреса клиента
+}
+
+// forwardState хранит результат одного вызова Forward
+// передается через контекст запроса, тк прокси общий для всех запросов к бэкенду
+type forwardState struct {
+	err error
+
+	// адреса для заголовка PROXY, заполняются только для бэкендов, которым он отправляется
+	source      *net.TCPAddr
+	destination *net.TCPAddr
+
+	// переменные шаблонов заголовков, вычисляются в директоре и нужны еще в ModifyResponse
+	vars headers.Vars
+
+	// переписывание пути маршрута и адрес, по которому обратился клиент, для Location ответа
+	rewrite     *routing.Rewrite
+	clientHost  string
+	clientProto string
+
+	// таймаут соединения маршрута для дайлера и таймер ожидания заголовков ответа
+	connectTimeout time.Duration
+	headerTimer    *time.Timer
+}
+
+// errResponseHeaderTimeout причина отмены попытки, когда бэкенд не прислал заголовки ответа вовремя
+var errResponseHeaderTimeout = errors.New("истек таймаут ожидания заголовков ответа бэкенда")
+
+type forwardStateKey struct{}
+
 // HttpUtilForwarder реализует порт ports.Forwarder, используя net/http/httputil
+// держит по одному реверс-прокси и транспорту на каждый бэкенд
 type HttpUtilForwarder struct {
-	logger ports.Logger
+	logger          ports.Logger
+	settings        TransportSettings
+	defaultUpstream UpstreamSettings
+	upstreams       map[string]UpstreamSettings // ключ: URL бэкенда
+	forwardedHeader bool                        // добавлять стандартный заголовок Forwarded
+	proxies         map[string]*backendProxy    // ключ: URL бэкенда
+	refs            map[string]int              // сколько пулов содержат бэкенд, ключ: URL бэкенда
+	mu              sync.RWMutex
 }
 
 // NewHttpUtilForwarder создает новый адаптер форвардера
-func NewHttpUtilForwarder(logger ports.Logger) ports.Forwarder {
-	return &HttpUtilForwarder{
-		logger: logger.With("adapter", "HttputilForwarder"),
+func NewHttpUtilForwarder(logger ports.Logger, opts ...ForwarderOption) *HttpUtilForwarder {
+	f := &HttpUtilForwarder{
+		logger:    logger.With("adapter", "HttputilForwarder"),
+		settings:  DefaultTransportSettings(),
+		upstreams: make(map[string]UpstreamSettings),
+		proxies:   make(map[string]*backendProxy),
+		refs:      make(map[string]int),
+	}
+	for _, opt := range opts {
+		opt(f)
 	}
+	return f
 }
 
 // Forward реализует ports.Forwarder
 // проксирует запрос r на бэкенд target, используя w для ответа
 func (f *HttpUtilForwarder) Forward(w http.ResponseWriter, r *http.Request, target *balancer.Backend) error {
-	// создаем реверс-прокси для конкретного бэкенда
-	proxy := httputil.NewSingleHostReverseProxy(target.URL)
-	proxyLogger := f.logger.With("target_url", target.URL.String())
+	bp := f.proxyFor(target)
 
-	// переменная для захвата ошибки из ErrorHandler (требует синхронизации)
-	var proxyErr error
-	var mu sync.Mutex // мьютекс для защиты доступа к proxyErr
+	// ErrorHandler вызывается синхронно внутри ServeHTTP, поэтому состояние без мьютекса
+	state := &forwardState{}
+	if bp.proxyProtocol {
+		state.source, state.destination = proxyProtocolAddrs(r)
+	}
+	ctx := r.Context()
+	timeouts := routing.TimeoutsFrom(ctx)
+	state.connectTimeout = timeouts.Connect
+	if timeouts.ResponseHeader > 0 {
+		// отмена по таймеру, а не дедлайн контекста: после заголовков тело ответа читается без ограничения
+		var cancel context.CancelCauseFunc
+		ctx, cancel = context.WithCancelCause(ctx)
+		defer cancel(nil)
+		state.headerTimer = time.AfterFunc(timeouts.ResponseHeader, func() { cancel(errResponseHeaderTimeout) })
+		defer state.headerTimer.Stop()
+	}
+	req := r.WithContext(context.WithValue(ctx, forwardStateKey{}, state))
+
+	// выполняем проксирование (блокирующая операция)
+	bp.proxy.ServeHTTP(w, req)
+
+	if state.err != nil {
+		f.logger.Debug("перенаправление завершилось с ошибкой, захваченной ErrorHandler", "target_url", target.URL.String(), "error", state.err)
+		return state.err
+	}
+
+	// если ErrorHandler не сработал, считаем, что проксирование прошло успешно
+	// (бэкенд мог вернуть свою ошибку, но само проксирование удалось)
+	return nil
+}
+
+// Retain отмечает, что бэкенд входит в очередной пул
+// прокси общий для всех пулов с этим бэкендом, поэтому удаляется, только когда бэкенд убран из каждого из них
+func (f *HttpUtilForwarder) Retain(backendUrl *url.URL) {
+	f.mu.Lock()
+	f.refs[backendUrl.String()]++
+	f.mu.Unlock()
+}
+
+// Invalidate вызывается при удалении бэкенда из пула
+// если бэкенд не остался в других пулах, удаляет его закешированный прокси и закрывает простаивающие соединения
+func (f *HttpUtilForwarder) Invalidate(backendUrl *url.URL) {
+	key := backendUrl.String()
+
+	f.mu.Lock()
+	if f.refs[key] > 1 {
+		f.refs[key]--
+		f.mu.Unlock()
+		return
+	}
+	delete(f.refs, key)
+	bp, ok := f.proxies[key]
+	delete(f.proxies, key)
+	f.mu.Unlock()
+
+	if ok {
+		bp.transport.CloseIdleConnections()
+		f.logger.Info("прокси бэкенда удален из кеша", "target_url", key)
+	}
+}
+
+// CloseIdleConnections закрывает простаивающие соединения всех бэкендов
+func (f *HttpUtilForwarder) CloseIdleConnections() {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	for _, bp := range f.proxies {
+		bp.transport.CloseIdleConnections()
+	}
+}
+
+// proxyFor возвращает закешированный прокси бэкенда, создавая его при первом обращении
+func (f *HttpUtilForwarder) proxyFor(target *balancer.Backend) *backendProxy {
+	key := target.URL.String()
+
+	f.mu.RLock()
+	bp, ok := f.proxies[key]
+	f.mu.RUnlock()
+	if ok {
+		return bp
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	// двойная проверка: прокси мог создать конкурентный запрос
+	if bp, ok = f.proxies[key]; ok {
+		return bp
+	}
+
+	upstream := f.upstreamFor(key)
+	bp = f.newBackendProxy(target.URL, upstream)
+	f.proxies[key] = bp
+	f.logger.Debug("создан прокси для бэкенда", "target_url", key, "protocol", upstream.protocol(), "proxy_protocol", upstream.ProxyProtocol)
+	return bp
+}
+
+// newBackendProxy собирает реверс-прокси с выделенным транспортом для бэкенда
+func (f *HttpUtilForwarder) newBackendProxy(target *url.URL, upstream UpstreamSettings) *backendProxy {
+	transport := f.newTransport(upstream)
+	proxy := httputil.NewSingleHostReverseProxy(target)
+	proxy.Transport = transport
+	proxyLogger := f.logger.With("target_url", target.String())
 
 	// кастомный обработчик ошибок прокси
 	proxy.ErrorHandler = func(rw http.ResponseWriter, req *http.Request, err error) {
-		mu.Lock() //  захватываем мьютекс для безопасной записи
-
 		// сохраняем ошибку, чтобы вернуть ее из Forward
-		proxyErr = fmt.Errorf("ошибка проксирования на %s: %w", target.URL, err)
-		mu.Unlock()
-
-		// стандартный ErrorHandler пытается записать 502 Bad Gateway,
-		// мы не можем это предотвратить надежно, но ошибку захватили
+		if state, ok := req.Context().Value(forwardStateKey{}).(*forwardState); ok {
+			state.err = &balancer.ForwardError{
+				Kind: classifyError(req, err),
+				Err:  fmt.Errorf("ошибка проксирования на %s: %w", target, err),
+			}
+		}
 		proxyLogger.Warn("сработал ErrorHandler реверс-прокси", "error", err)
 
 		// не пишем здесь ответ, позволяем вызывающей стороне (сервису) решить, что делать дальше
@@ -51,41 +254,237 @@ func (f *HttpUtilForwarder) Forward(w http.ResponseWriter, r *http.Request, targ
 	// модифицируем запрос перед отправкой на бэкенд
 	originalDirector := proxy.Director // сохраняем стандартный директор
 	proxy.Director = func(req *http.Request) {
-		originalDirector(req)      // выполняем стандартные действия (копирование и тд)
-		req.Host = target.URL.Host // устанавливаем правильный Host для бэкенда (важно для vhost)
+		originalHost := req.Host // до директора req.Host еще содержит Host клиента
+		originalPath := req.URL.Path
+		if rw := routing.RewriteFrom(req.Context()); rw != nil {
+			// путь переписывается до того, как стандартный директор склеит его с путем бэкенда
+			req.URL.Path = rw.Path(req.URL.Path)
+			req.URL.RawPath = ""
+			if state, ok := req.Context().Value(forwardStateKey{}).(*forwardState); ok {
+				state.rewrite = rw
+				state.clientHost = originalHost
+				state.clientProto = "http"
+				if req.TLS != nil {
+					state.clientProto = "https"
+				}
+			}
+		}
+		originalDirector(req)  // выполняем стандартные действия (копирование и тд)
+		req.Host = target.Host // устанавливаем правильный Host для бэкенда (важно для vhost)
+		setDeadlineHeaders(req)
 
 		// заголовки
-		req.Header.Set("X-Forwarded-For", r.RemoteAddr)
-		proto := "http"
-		if r.TLS != nil {
-			proto = "https"
+		f.setForwardedHeaders(req, originalHost)
+		if rules := headers.RulesFrom(req.Context()); len(rules) > 0 {
+			vars := headers.Vars{
+				ClientIP:  reqctx.ClientIP(req),
+				RequestID: reqctx.RequestID(req),
+				Backend:   target.Host,
+				Host:      originalHost,
+				Method:    req.Method,
+				Path:      originalPath,
+			}
+			if state, ok := req.Context().Value(forwardStateKey{}).(*forwardState); ok {
+				state.vars = vars
+			}
+			applyRequestRules(req, rules, vars)
+		}
+		proxyLogger.Debug("модифицирован запрос в директоре", "host", req.Host, "x-fwd-for", req.Header.Get("X-Forwarded-For"))
+	}
+
+	// Location и правила заголовков ответа применяются до того, как ответ уйдет клиенту
+	proxy.ModifyResponse = func(resp *http.Response) error {
+		state, _ := resp.Request.Context().Value(forwardStateKey{}).(*forwardState)
+		if state == nil {
+			return nil
+		}
+		if state.headerTimer != nil && !state.headerTimer.Stop() {
+			// таймер успел сработать, запрос уже отменен
+			return errResponseHeaderTimeout
+		}
+		if state.rewrite != nil {
+			rewriteLocation(resp.Header, state, target)
+		}
+		for _, rule := range headers.RulesFrom(resp.Request.Context()) {
+			rule.Response.Apply(resp.Header, state.vars)
+		}
+		return nil
+	}
+
+	return &backendProxy{
+		proxy:         proxy,
+		transport:     transport,
+		proxyProtocol: upstream.ProxyProtocol != proxyproto.None,
+	}
+}
+
+// applyRequestRules применяет правила заголовков запроса
+// Host в правилах меняет Host запроса к бэкенду, а не обычный заголовок
+func applyRequestRules(req *http.Request, rules []*headers.Rules, vars headers.Vars) {
+	for _, rule := range rules {
+		rule.Request.Apply(req.Header, vars)
+	}
+	if host := req.Header.Get("Host"); host != "" {
+		req.Host = host
+		req.Header.Del("Host")
+	}
+}
+
+// rewriteLocation переводит Location и Content-Location бэкенда в адреса, которые видит клиент
+// абсолютный адрес на сам бэкенд получает схему и Host клиента, адреса на другие хосты не трогаются
+func rewriteLocation(h http.Header, state *forwardState, target *url.URL) {
+	for _, name := range []string{"Location", "Content-Location"} {
+		raw := h.Get(name)
+		if raw == "" {
+			continue
+		}
+		loc, err := url.Parse(raw)
+		if err != nil || (loc.Host != "" && loc.Host != target.Host) || !strings.HasPrefix(loc.Path, "/") {
+			continue
+		}
+
+		// путь бэкенда из его URL склеивается с путем запроса, в Location он тоже есть
+		path := loc.Path
+		if base := strings.TrimSuffix(target.Path, "/"); base != "" && (path == base || strings.HasPrefix(path, base+"/")) {
+			path = "/" + strings.TrimPrefix(path[len(base):], "/")
 		}
+		if reversed, ok := state.rewrite.ReversePath(path); ok {
+			loc.Path, loc.RawPath = reversed, ""
+		}
+		if loc.Host != "" {
+			loc.Scheme, loc.Host = state.clientProto, state.clientHost
+		}
+		h.Set(name, loc.String())
+	}
+}
+
+// setForwardedHeaders выставляет X-Forwarded-* и, если включено, Forwarded (RFC 7239)
+// цепочку сохраняем, только если ее прислал доверенный прокси, иначе ее мог подделать клиент
+// X-Forwarded-For дополняет сам ReverseProxy после директора: добавляет IP из RemoteAddr к цепочке
+func (f *HttpUtilForwarder) setForwardedHeaders(req *http.Request, originalHost string) {
+	client, _ := reqctx.ClientFrom(req.Context())
+	if !client.PeerTrusted {
+		req.Header.Del("X-Forwarded-For")
+		req.Header.Del("X-Forwarded-Proto")
+		req.Header.Del("X-Forwarded-Host")
+		req.Header.Del("Forwarded")
+	}
+
+	proto := "http"
+	if req.TLS != nil {
+		proto = "https"
+	}
+	if req.Header.Get("X-Forwarded-Proto") == "" {
 		req.Header.Set("X-Forwarded-Proto", proto)
-		if originalHost := r.Header.Get("X-Forwarded-Host"); originalHost != "" {
-			req.Header.Set("X-Forwarded-Host", originalHost)
+	}
+	if req.Header.Get("X-Forwarded-Host") == "" {
+		req.Header.Set("X-Forwarded-Host", originalHost) // используем оригинальный Host, если X-Forwarded-Host не было
+	}
+
+	if f.forwardedHeader {
+		peer, _, err := net.SplitHostPort(req.RemoteAddr)
+		if err != nil {
+			peer = req.RemoteAddr
+		}
+		// дописываем в одно значение, чтобы бэкенд, читающий первую строку заголовка, видел всю цепочку
+		element := forwardedElement(peer, proto, originalHost)
+		if prior := req.Header.Values("Forwarded"); len(prior) > 0 {
+			element = strings.Join(prior, ", ") + ", " + element
+		}
+		req.Header.Set("Forwarded", element)
+	}
+}
+
+// forwardedElement собирает элемент заголовка Forwarded для одного прокси
+// IPv6 по RFC 7239 берется в кавычки и квадратные скобки
+func forwardedElement(peer, proto, host string) string {
+	node := peer
+	if ip := net.ParseIP(peer); ip != nil && ip.To4() == nil {
+		node = `"[` + peer + `]"`
+	}
+	element := "for=" + node + ";proto=" + proto
+	if quoted, ok := quotedString(host); host != "" && ok {
+		element += ";host=" + quoted
+	}
+	return element
+}
+
+// quotedString записывает значение как quoted-string RFC 7230: обратная косая черта и кавычка экранируются,
+// иначе присланный клиентом Host мог бы закрыть кавычки и дописать в Forwarded свои for= и proto=
+// false - в значении есть управляющие символы, недопустимые и в quoted-string
+func quotedString(value string) (string, bool) {
+	var b strings.Builder
+	b.WriteByte('"')
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		if (c < 0x20 && c != '\t') || c == 0x7f {
+			return "", false
+		}
+		if c == '"' || c == '\\' {
+			b.WriteByte('\\')
+		}
+		b.WriteByte(c)
+	}
+	b.WriteByte('"')
+	return b.String(), true
+}
+
+// setDeadlineHeaders сообщает бэкенду, сколько осталось до дедлайна запроса
+// X-Request-Timeout в миллисекундах, для gRPC еще grpc-timeout; присланные клиентом значения заменяются
+func setDeadlineHeaders(req *http.Request) {
+	req.Header.Del("X-Request-Timeout")
+	deadline, ok := req.Context().Deadline()
+	if !ok {
+		return
+	}
+	remaining := time.Until(deadline).Milliseconds()
+	if remaining < 1 {
+		remaining = 1
+	}
+	req.Header.Set("X-Request-Timeout", strconv.FormatInt(remaining, 10))
+	if strings.HasPrefix(req.Header.Get("Content-Type"), "application/grpc") {
+		// grpc-timeout не длиннее 8 цифр
+		if remaining > 99999999 {
+			req.Header.Set("grpc-timeout", strconv.FormatInt(remaining/1000, 10)+"S")
 		} else {
-			req.Header.Set("X-Forwarded-Host", r.Host) // используем оригинальный Host, если X-Forwarded-Host не было
+			req.Header.Set("grpc-timeout", strconv.FormatInt(remaining, 10)+"m")
 		}
-		proxyLogger.Debug("модифицирован запрос в директоре", "host", req.Host, "x-fwd-for", req.Header.Get("X-Forwarded-For"))
 	}
+}
 
-	proxyLogger.Debug("вызов ServeHTTP для перенаправления запроса")
+// connectContext ограничивает установку соединения таймаутом маршрута, если он задан
+func connectContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if state, ok := ctx.Value(forwardStateKey{}).(*forwardState); ok && state.connectTimeout > 0 {
+		return context.WithTimeout(ctx, state.connectTimeout)
+	}
+	return ctx, func() {}
+}
 
-	// выполняем проксирование (блокирующая операция)
-	proxy.ServeHTTP(w, r)
+// classifyError определяет вид ошибки проксирования по ошибке транспорта
+func classifyError(req *http.Request, err error) balancer.ForwardErrorKind {
+	if errors.Is(context.Cause(req.Context()), errResponseHeaderTimeout) || errors.Is(err, errResponseHeaderTimeout) {
+		return balancer.ForwardErrorTimeout
+	}
+	if errors.Is(req.Context().Err(), context.Canceled) {
+		return balancer.ForwardErrorCanceled
+	}
 
-	// проверяем, была ли установлена ошибка в ErrorHandler
-	mu.Lock()
-	capturedErr := proxyErr
-	mu.Unlock()
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return balancer.ForwardErrorConnect
+	}
 
-	if capturedErr != nil {
-		proxyLogger.Debug("перенаправление завершилось с ошибкой, захваченной ErrorHandler", "error", capturedErr)
-		return capturedErr // возвращаем ошибку, если она была
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		return balancer.ForwardErrorTimeout
 	}
 
-	// если ErrorHandler не сработал, считаем, что проксирование прошло успешно
-	// (бэкенд мог вернуть свою ошибку, но само проксирование удалось)
-	proxyLogger.Debug("перенаправление завершено без срабатывания ErrorHandler")
-	return nil // нет ошибки проксирования
+	if errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.EPIPE) ||
+		errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return balancer.ForwardErrorReset
+	}
+
+	return balancer.ForwardErrorOther
 }
+
+var _ ports.Forwarder = (*HttpUtilForwarder)(nil)
@@ -0,0 +1,27 @@
+package proxy
+
+import (
+	"context"
+	"github.com/athebyme/cloud-ru-assign/internal/core/domain/balancer"
+	"github.com/athebyme/cloud-ru-assign/internal/core/ports"
+	"net"
+	"time"
+)
+
+// TCPDialer реализует порт ports.StreamDialer для режима TCP (L4)
+// адрес бэкенда берется из host:port его URL (tcp://db1:5432), схема не учитывается
+type TCPDialer struct {
+	dialer *net.Dialer
+}
+
+// NewTCPDialer создает дайлер с таймаутом установки соединения и периодом TCP keep-alive
+func NewTCPDialer(timeout, keepAlive time.Duration) *TCPDialer {
+	return &TCPDialer{dialer: &net.Dialer{Timeout: timeout, KeepAlive: keepAlive}}
+}
+
+// Dial реализует ports.StreamDialer
+func (d *TCPDialer) Dial(ctx context.Context, target *balancer.Backend) (net.Conn, error) {
+	return d.dialer.DialContext(ctx, "tcp", target.URL.Host)
+}
+
+var _ ports.StreamDialer = (*TCPDialer)(nil)
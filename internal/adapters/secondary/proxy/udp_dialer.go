@@ -0,0 +1,26 @@
+package proxy
+
+import (
+	"context"
+	"github.com/athebyme/cloud-ru-assign/internal/core/domain/balancer"
+	"github.com/athebyme/cloud-ru-assign/internal/core/ports"
+	"net"
+)
+
+// UDPDialer реализует порт ports.DatagramDialer
+// адрес бэкенда берется из host:port его URL (udp://dns1:53), схема не учитывается
+type UDPDialer struct {
+	dialer net.Dialer
+}
+
+// NewUDPDialer создает дайлер UDP сокетов, связанных с бэкендами
+func NewUDPDialer() *UDPDialer {
+	return &UDPDialer{}
+}
+
+// Dial реализует ports.DatagramDialer
+func (d *UDPDialer) Dial(ctx context.Context, target *balancer.Backend) (net.Conn, error) {
+	return d.dialer.DialContext(ctx, "udp", target.URL.Host)
+}
+
+var _ ports.DatagramDialer = (*UDPDialer)(nil)
@@ -0,0 +1,151 @@
+package proxy
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"github.com/athebyme/cloud-ru-assign/internal/adapters/secondary/proxyproto"
+	"golang.org/x/net/http2"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// UpstreamProtocol протокол, которым форвардер говорит с бэкендом
+type UpstreamProtocol string
+
+const (
+	ProtocolAuto  UpstreamProtocol = "auto"  // HTTP/1.1, для https - HTTP/2, если бэкенд согласует его через ALPN
+	ProtocolHTTP1 UpstreamProtocol = "http1" // только HTTP/1.1
+	ProtocolHTTP2 UpstreamProtocol = "http2" // только HTTP/2 поверх TLS
+	ProtocolH2C   UpstreamProtocol = "h2c"   // HTTP/2 без TLS с prior knowledge
+)
+
+// ParseUpstreamProtocol проверяет имя протокола из конфигурации, пустое имя - auto
+func ParseUpstreamProtocol(s string) (UpstreamProtocol, error) {
+	switch p := UpstreamProtocol(s); p {
+	case "":
+		return ProtocolAuto, nil
+	case ProtocolAuto, ProtocolHTTP1, ProtocolHTTP2, ProtocolH2C:
+		return p, nil
+	default:
+		return "", fmt.Errorf("неизвестный протокол бэкенда: %s", s)
+	}
+}
+
+// UpstreamSettings задает параметры соединения с конкретным бэкендом
+type UpstreamSettings struct {
+	Protocol UpstreamProtocol
+	TLS      *tls.Config // CA, клиентский сертификат и SNI для https бэкендов, nil - настройки по умолчанию
+	// заголовок PROXY protocol при соединении с бэкендом
+	// заголовок описывает одного клиента, поэтому соединения не переиспользуются и HTTP/2 не согласуется
+	ProxyProtocol proxyproto.Version
+}
+
+func (u UpstreamSettings) protocol() UpstreamProtocol {
+	if u.Protocol == "" {
+		return ProtocolAuto
+	}
+	return u.Protocol
+}
+
+// WithDefaultUpstream задает параметры соединения для бэкендов без собственных настроек
+func WithDefaultUpstream(settings UpstreamSettings) ForwarderOption {
+	return func(f *HttpUtilForwarder) {
+		f.defaultUpstream = settings
+	}
+}
+
+// WithUpstream задает параметры соединения для бэкенда backendUrl
+// адрес, который не удается разобрать, игнорируется: такой бэкенд не попадет и в пул
+func WithUpstream(backendUrl string, settings UpstreamSettings) ForwarderOption {
+	return func(f *HttpUtilForwarder) {
+		parsed, err := url.Parse(backendUrl)
+		if err != nil {
+			return
+		}
+		f.upstreams[parsed.String()] = settings
+	}
+}
+
+// upstreamFor возвращает настройки бэкенда по ключу кеша прокси
+func (f *HttpUtilForwarder) upstreamFor(key string) UpstreamSettings {
+	if settings, ok := f.upstreams[key]; ok {
+		return settings
+	}
+	return f.defaultUpstream
+}
+
+// newTransport создает транспорт бэкенда под его протокол с настройками пула соединений
+func (f *HttpUtilForwarder) newTransport(upstream UpstreamSettings) roundTripper {
+	dialer := &net.Dialer{
+		Timeout:   f.settings.DialTimeout,
+		KeepAlive: f.settings.KeepAlive,
+	}
+
+	var tlsConfig *tls.Config
+	if upstream.TLS != nil {
+		tlsConfig = upstream.TLS.Clone() // транспорт дополняет конфигурацию (NextProtos), общую копию не трогаем
+	}
+
+	switch upstream.protocol() {
+	case ProtocolH2C:
+		// HTTP/2 без TLS: транспорт http2 с обычным TCP вместо TLS рукопожатия
+		return &http2.Transport{
+			AllowHTTP: true,
+			DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+				ctx, cancel := connectContext(ctx)
+				defer cancel()
+				return dialer.DialContext(ctx, network, addr)
+			},
+			IdleConnTimeout: f.settings.IdleConnTimeout,
+		}
+	case ProtocolHTTP2:
+		return &http2.Transport{
+			TLSClientConfig: tlsConfig,
+			DialTLSContext: func(ctx context.Context, network, addr string, cfg *tls.Config) (net.Conn, error) {
+				tlsDialer := &tls.Dialer{NetDialer: dialer, Config: cfg}
+				ctx, cancel := connectContext(ctx)
+				defer cancel()
+				handshakeCtx := ctx
+				if f.settings.TLSHandshakeTimeout > 0 {
+					var cancel context.CancelFunc
+					handshakeCtx, cancel = context.WithTimeout(ctx, f.settings.DialTimeout+f.settings.TLSHandshakeTimeout)
+					defer cancel()
+				}
+				return tlsDialer.DialContext(handshakeCtx, network, addr)
+			},
+			IdleConnTimeout: f.settings.IdleConnTimeout,
+		}
+	}
+
+	dial := dialer.DialContext
+	if upstream.ProxyProtocol != proxyproto.None {
+		dial = proxyproto.Dial(dialer, upstream.ProxyProtocol, forwardAddrs)
+	}
+	transport := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			ctx, cancel := connectContext(ctx)
+			defer cancel()
+			return dial(ctx, network, addr)
+		},
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          f.settings.MaxIdleConns,
+		MaxIdleConnsPerHost:   f.settings.MaxIdleConnsPerHost,
+		IdleConnTimeout:       f.settings.IdleConnTimeout,
+		TLSHandshakeTimeout:   f.settings.TLSHandshakeTimeout,
+		TLSClientConfig:       tlsConfig,
+		ExpectContinueTimeout: 1 * time.Second,
+	}
+	if upstream.ProxyProtocol != proxyproto.None {
+		transport.DisableKeepAlives = true
+	}
+	if upstream.protocol() == ProtocolHTTP1 || upstream.ProxyProtocol != proxyproto.None {
+		// непустая карта без h2 запрещает транспорту согласовывать HTTP/2
+		transport.ForceAttemptHTTP2 = false
+		transport.TLSNextProto = make(map[string]func(string, *tls.Conn) http.RoundTripper)
+	}
+	return transport
+}
@@ -0,0 +1,89 @@
+package proxyproto
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net"
+)
+
+// Version версия заголовка PROXY protocol, который отправляется бэкенду при соединении
+type Version string
+
+const (
+	None Version = ""   // заголовок не отправляется
+	V1   Version = "v1" // текстовый
+	V2   Version = "v2" // бинарный
+)
+
+// v2Signature первые 12 байт заголовка PROXY protocol v2
+var v2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+// ParseVersion проверяет версию из конфигурации, пустая строка - не отправлять
+func ParseVersion(s string) (Version, error) {
+	switch v := Version(s); v {
+	case None, V1, V2:
+		return v, nil
+	default:
+		return "", fmt.Errorf("неизвестная версия PROXY protocol: %s", s)
+	}
+}
+
+// AddrsFunc возвращает адреса клиента и точки входа для соединения, открываемого с контекстом ctx
+// nil адреса - соединение открывает сам балансировщик (например, health check)
+type AddrsFunc func(ctx context.Context) (source, destination *net.TCPAddr)
+
+// Dial оборачивает установку соединения отправкой заголовка PROXY версии v
+func Dial(dialer *net.Dialer, v Version, addrs AddrsFunc) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dialer.DialContext(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		var source, destination *net.TCPAddr
+		if addrs != nil {
+			source, destination = addrs(ctx)
+		}
+		if _, err := conn.Write(Header(v, source, destination)); err != nil {
+			conn.Close()
+			// соединение не готово к запросу, для вызывающей стороны это та же ошибка соединения
+			return nil, &net.OpError{Op: "dial", Net: network, Addr: conn.RemoteAddr(), Err: err}
+		}
+		return conn, nil
+	}
+}
+
+// Header собирает заголовок PROXY
+// без адресов клиента отправляется UNKNOWN (v1) или LOCAL (v2): бэкенд возьмет адреса TCP соединения
+func Header(v Version, source, destination *net.TCPAddr) []byte {
+	known := source != nil && destination != nil
+	if v == V1 {
+		if !known || (source.IP.To4() == nil) != (destination.IP.To4() == nil) {
+			return []byte("PROXY UNKNOWN\r\n") // v1 не умеет смешивать семейства адресов
+		}
+		family := "TCP4"
+		if source.IP.To4() == nil {
+			family = "TCP6"
+		}
+		return []byte(fmt.Sprintf("PROXY %s %s %s %d %d\r\n",
+			family, source.IP.String(), destination.IP.String(), source.Port, destination.Port))
+	}
+
+	header := append([]byte{}, v2Signature...)
+	if !known {
+		return append(header, 0x20, 0x00, 0x00, 0x00) // LOCAL, UNSPEC, без адресов
+	}
+	family := byte(0x11) // TCP поверх IPv4
+	src, dst := source.IP.To4(), destination.IP.To4()
+	if src == nil || dst == nil {
+		family = 0x21 // TCP поверх IPv6, IPv4 адрес передается как IPv4-mapped
+		src, dst = source.IP.To16(), destination.IP.To16()
+	}
+	header = append(header, 0x21, family)
+	header = binary.BigEndian.AppendUint16(header, uint16(2*len(src)+4))
+	header = append(header, src...)
+	header = append(header, dst...)
+	header = binary.BigEndian.AppendUint16(header, uint16(source.Port))
+	header = binary.BigEndian.AppendUint16(header, uint16(destination.Port))
+	return header
+}
@@ -34,6 +34,8 @@ type MemoryPool struct {
 	strategy       string
 	connections    map[string]int
 	connectionsMux sync.RWMutex // либо синк мапу
+	onAdded        []func(backendUrl *url.URL)
+	onRemoved      []func(backendUrl *url.URL)
 }
 
 // NewMemoryPool создает новый in-memory репозиторий
@@ -88,6 +90,81 @@ func (p *MemoryPool) SetStrategy(strategy string) error {
 	}
 }
 
+// AddBackend добавляет бэкенд в пул во время работы
+func (p *MemoryPool) AddBackend(rawUrl string) error {
+	parsedUrl, err := url.Parse(rawUrl)
+	if err != nil {
+		return fmt.Errorf("невалидный URL бэкенда %s: %w", rawUrl, err)
+	}
+
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	for _, b := range p.backends {
+		if b.URL.String() == parsedUrl.String() {
+			return fmt.Errorf("бэкенд %s уже есть в пуле", rawUrl)
+		}
+	}
+
+	state := &BackendState{Backend: balancer.Backend{URL: parsedUrl}}
+	state.SetAlive(true)
+	p.backends = append(p.backends, state)
+	p.logger.Info("бэкенд добавлен в пул", "url", rawUrl)
+	// под блокировкой, чтобы подписчик не увидел удаление раньше добавления
+	for _, fn := range p.onAdded {
+		fn(parsedUrl)
+	}
+	return nil
+}
+
+// RemoveBackend удаляет бэкенд из пула и уведомляет подписчиков (например, форвардер с кешем прокси)
+func (p *MemoryPool) RemoveBackend(backendUrl *url.URL) error {
+	urlStr := backendUrl.String()
+
+	p.mux.Lock()
+	idx := -1
+	for i, b := range p.backends {
+		if b.URL.String() == urlStr {
+			idx = i
+			break
+		}
+	}
+	if idx < 0 {
+		p.mux.Unlock()
+		return fmt.Errorf("бэкенд %s не найден в пуле", urlStr)
+	}
+	removed := p.backends[idx].URL
+	p.backends = append(p.backends[:idx:idx], p.backends[idx+1:]...)
+	listeners := p.onRemoved
+	p.mux.Unlock()
+
+	p.connectionsMux.Lock()
+	delete(p.connections, urlStr)
+	p.connectionsMux.Unlock()
+
+	p.logger.Info("бэкенд удален из пула", "url", urlStr)
+	for _, fn := range listeners {
+		fn(removed)
+	}
+	return nil
+}
+
+// OnBackendAdded регистрирует функцию, вызываемую для каждого бэкенда пула: сразу для текущих и затем для добавленных
+func (p *MemoryPool) OnBackendAdded(fn func(backendUrl *url.URL)) {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	for _, b := range p.backends {
+		fn(b.URL)
+	}
+	p.onAdded = append(p.onAdded, fn)
+}
+
+// OnBackendRemoved регистрирует функцию, вызываемую после удаления бэкенда из пула
+func (p *MemoryPool) OnBackendRemoved(fn func(backendUrl *url.URL)) {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	p.onRemoved = append(p.onRemoved, fn)
+}
+
 // GetBackends реализует ports.BackendRepository
 func (p *MemoryPool) GetBackends() []*balancer.Backend {
 	p.mux.RLock()
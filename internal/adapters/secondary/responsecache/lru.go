@@ -0,0 +1,121 @@
+package responsecache
+
+import (
+	"container/list"
+	"github.com/athebyme/cloud-ru-assign/internal/core/domain/cache"
+	"github.com/athebyme/cloud-ru-assign/internal/core/ports"
+	"strings"
+	"sync"
+)
+
+// lruItem запись списка вытеснения
+type lruItem struct {
+	key   string
+	entry *cache.Entry
+	size  int64
+}
+
+// LRU хранит ответы в памяти в пределах maxBytes, вытесняя давно не использованные
+type LRU struct {
+	mu       sync.Mutex
+	maxBytes int64
+	bytes    int64
+	order    *list.List // в начале - недавно использованные
+	items    map[string]*list.Element
+}
+
+// NewLRU создает хранилище с лимитом maxBytes на суммарный размер записей
+func NewLRU(maxBytes int64) *LRU {
+	return &LRU{
+		maxBytes: maxBytes,
+		order:    list.New(),
+		items:    make(map[string]*list.Element),
+	}
+}
+
+// Get возвращает запись и отмечает ее как недавно использованную
+func (c *LRU) Get(key string) (*cache.Entry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(el)
+	return el.Value.(*lruItem).entry, true
+}
+
+// Set сохраняет запись, вытесняя старые при превышении лимита
+// запись больше всего лимита не сохраняется
+func (c *LRU) Set(key string, entry *cache.Entry) {
+	size := entry.Size() + int64(len(key))
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if size > c.maxBytes {
+		c.removeLocked(key)
+		return
+	}
+	if el, ok := c.items[key]; ok {
+		item := el.Value.(*lruItem)
+		c.bytes += size - item.size
+		item.entry, item.size = entry, size
+		c.order.MoveToFront(el)
+	} else {
+		c.items[key] = c.order.PushFront(&lruItem{key: key, entry: entry, size: size})
+		c.bytes += size
+	}
+	for c.bytes > c.maxBytes {
+		c.removeElementLocked(c.order.Back())
+	}
+}
+
+// Delete удаляет запись по ключу
+func (c *LRU) Delete(key string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.removeLocked(key)
+}
+
+// DeletePrefix удаляет записи с ключом, начинающимся с prefix
+func (c *LRU) DeletePrefix(prefix string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	removed := 0
+	for key, el := range c.items {
+		if strings.HasPrefix(key, prefix) {
+			c.removeElementLocked(el)
+			removed++
+		}
+	}
+	return removed
+}
+
+// Len возвращает число записей
+func (c *LRU) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.items)
+}
+
+// Size возвращает суммарный размер записей в байтах
+func (c *LRU) Size() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.bytes
+}
+
+func (c *LRU) removeLocked(key string) bool {
+	el, ok := c.items[key]
+	if ok {
+		c.removeElementLocked(el)
+	}
+	return ok
+}
+
+func (c *LRU) removeElementLocked(el *list.Element) {
+	item := c.order.Remove(el).(*lruItem)
+	delete(c.items, item.key)
+	c.bytes -= item.size
+}
+
+var _ ports.ResponseCache = (*LRU)(nil)
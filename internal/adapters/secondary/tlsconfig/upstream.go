@@ -0,0 +1,61 @@
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// Upstream описывает TLS соединения балансировщика с бэкендом
+type Upstream struct {
+	CAFile             string // PEM с доверенными CA, пусто - системное хранилище
+	CertFile           string // клиентский сертификат для mTLS
+	KeyFile            string // ключ клиентского сертификата
+	ServerName         string // SNI и имя для проверки сертификата, пусто - хост бэкенда
+	InsecureSkipVerify bool   // не проверять сертификат бэкенда, только для разработки
+}
+
+// IsZero сообщает, что настройки не заданы и нужен TLS по умолчанию
+func (u Upstream) IsZero() bool {
+	return u == Upstream{}
+}
+
+// Build собирает клиентскую конфигурацию TLS, nil для пустых настроек
+func Build(u Upstream) (*tls.Config, error) {
+	if u.IsZero() {
+		return nil, nil
+	}
+
+	cfg := &tls.Config{
+		ServerName:         u.ServerName,
+		InsecureSkipVerify: u.InsecureSkipVerify,
+		MinVersion:         tls.VersionTLS12,
+	}
+
+	if u.CAFile != "" {
+		pem, err := os.ReadFile(u.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка чтения CA бэкендов %s: %w", u.CAFile, err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("в файле %s нет ни одного PEM сертификата", u.CAFile)
+		}
+		cfg.RootCAs = pool
+	}
+
+	if u.CertFile != "" || u.KeyFile != "" {
+		if u.CertFile == "" || u.KeyFile == "" {
+			return nil, errors.New("для mTLS нужны и клиентский сертификат, и ключ")
+		}
+		cert, err := tls.LoadX509KeyPair(u.CertFile, u.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка загрузки клиентского сертификата %s: %w", u.CertFile, err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	return cfg, nil
+}
@@ -1,9 +1,21 @@
 package config
 
 import (
+	"crypto/tls"
 	"fmt"
+	"github.com/athebyme/cloud-ru-assign/internal/core/domain/clientip"
+	"github.com/athebyme/cloud-ru-assign/internal/core/domain/fault"
+	"github.com/athebyme/cloud-ru-assign/internal/core/domain/grpc"
+	"github.com/athebyme/cloud-ru-assign/internal/core/domain/headers"
+	"github.com/athebyme/cloud-ru-assign/internal/core/domain/mirror"
+	"github.com/athebyme/cloud-ru-assign/internal/core/domain/problem"
+	"github.com/athebyme/cloud-ru-assign/internal/core/domain/requestid"
+	"github.com/athebyme/cloud-ru-assign/internal/core/domain/retry"
+	"github.com/athebyme/cloud-ru-assign/internal/core/domain/routing"
 	"gopkg.in/yaml.v3"
 	"os"
+	"regexp"
+	"sort"
 	"strings" // For level conversion
 	"time"
 )
@@ -31,13 +43,767 @@ type LoadBalancerConfig struct {
 	Strategy string `yaml:"strategy"` // round-robin, least-connections, random
 }
 
+// ProxyConfig задает параметры пула соединений до бэкендов
+type ProxyConfig struct {
+	MaxIdleConns        int           `yaml:"maxIdleConns"`
+	MaxIdleConnsPerHost int           `yaml:"maxIdleConnsPerHost"`
+	IdleConnTimeout     time.Duration `yaml:"idleConnTimeout"`
+	KeepAlive           time.Duration `yaml:"keepAlive"`
+	DialTimeout         time.Duration `yaml:"dialTimeout"`
+	TLSHandshakeTimeout time.Duration `yaml:"tlsHandshakeTimeout"`
+	Protocol            string        `yaml:"protocol"`          // auto, http1, http2, h2c
+	SendProxyProtocol   string        `yaml:"sendProxyProtocol"` // v1, v2, пусто - не отправлять заголовок PROXY
+	// TLS до бэкендов по умолчанию, пулы и отдельные бэкенды переопределяют его целиком
+	TLS        *UpstreamTLSConfig           `yaml:"tls"`
+	BackendTLS map[string]UpstreamTLSConfig `yaml:"backendTLS"` // ключ: URL бэкенда из backends или pools
+}
+
+// UpstreamTLSConfig задает TLS соединений с бэкендами
+type UpstreamTLSConfig struct {
+	CAFile             string `yaml:"caFile"`
+	CertFile           string `yaml:"certFile"` // клиентский сертификат для mTLS
+	KeyFile            string `yaml:"keyFile"`
+	ServerName         string `yaml:"serverName"`         // переопределение SNI
+	InsecureSkipVerify bool   `yaml:"insecureSkipVerify"` // только для разработки
+}
+
+func (c UpstreamTLSConfig) validate(section string) error {
+	if (c.CertFile == "") != (c.KeyFile == "") {
+		return fmt.Errorf("%s: certFile и keyFile задаются вместе", section)
+	}
+	return nil
+}
+
+// HTTP2Config задает поддержку HTTP/2 на стороне клиентов
+type HTTP2Config struct {
+	Enabled              bool   `yaml:"enabled"` // HTTP/2 поверх TLS через ALPN
+	H2C                  bool   `yaml:"h2c"`     // HTTP/2 без TLS
+	MaxConcurrentStreams uint32 `yaml:"maxConcurrentStreams"`
+}
+
+// CertificateConfig пара сертификат/ключ слушателя
+type CertificateConfig struct {
+	CertFile    string   `yaml:"certFile"`
+	KeyFile     string   `yaml:"keyFile"`
+	ServerNames []string `yaml:"serverNames"` // имена SNI, по умолчанию из самого сертификата
+}
+
+// ListenerTLSConfig включает TLS на слушателе
+// certFile/keyFile - короткая запись для одного сертификата, certificates - для нескольких с выбором по SNI
+type ListenerTLSConfig struct {
+	Enabled        bool                `yaml:"enabled"`
+	CertFile       string              `yaml:"certFile"`
+	KeyFile        string              `yaml:"keyFile"`
+	Certificates   []CertificateConfig `yaml:"certificates"`
+	MinVersion     string              `yaml:"minVersion"`     // 1.0, 1.1, 1.2, 1.3
+	CipherSuites   []string            `yaml:"cipherSuites"`   // имена из crypto/tls, для TLS 1.3 не применяются
+	ReloadInterval time.Duration       `yaml:"reloadInterval"` // как часто проверять изменения файлов, 0 - не проверять
+}
+
+// AllCertificates возвращает все пары сертификатов, включая короткую запись
+func (c ListenerTLSConfig) AllCertificates() []CertificateConfig {
+	certs := make([]CertificateConfig, 0, len(c.Certificates)+1)
+	if c.CertFile != "" || c.KeyFile != "" {
+		certs = append(certs, CertificateConfig{CertFile: c.CertFile, KeyFile: c.KeyFile})
+	}
+	return append(certs, c.Certificates...)
+}
+
+// Version возвращает минимальную версию TLS, вызывать после валидации
+func (c ListenerTLSConfig) Version() uint16 {
+	version, _ := parseTLSVersion(c.MinVersion)
+	return version
+}
+
+// Ciphers возвращает идентификаторы наборов шифров, nil - набор по умолчанию crypto/tls
+func (c ListenerTLSConfig) Ciphers() []uint16 {
+	ids, _ := parseCipherSuites(c.CipherSuites)
+	return ids
+}
+
+func (c ListenerTLSConfig) validate() error {
+	if !c.Enabled {
+		return nil
+	}
+	certs := c.AllCertificates()
+	if len(certs) == 0 {
+		return fmt.Errorf("server.tls: при включенном TLS нужен certFile/keyFile или список certificates")
+	}
+	for i, cert := range certs {
+		if cert.CertFile == "" || cert.KeyFile == "" {
+			return fmt.Errorf("server.tls: у сертификата #%d не указан certFile или keyFile", i+1)
+		}
+	}
+	if _, err := parseTLSVersion(c.MinVersion); err != nil {
+		return fmt.Errorf("server.tls.minVersion: %w", err)
+	}
+	if _, err := parseCipherSuites(c.CipherSuites); err != nil {
+		return fmt.Errorf("server.tls.cipherSuites: %w", err)
+	}
+	if c.ReloadInterval < 0 {
+		return fmt.Errorf("server.tls.reloadInterval не может быть отрицательным")
+	}
+	return nil
+}
+
+func parseTLSVersion(v string) (uint16, error) {
+	switch v {
+	case "", "1.2":
+		return tls.VersionTLS12, nil
+	case "1.0":
+		return tls.VersionTLS10, nil
+	case "1.1":
+		return tls.VersionTLS11, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	default:
+		return 0, fmt.Errorf("неподдерживаемая версия TLS %s. Допустимые значения: 1.0, 1.1, 1.2, 1.3", v)
+	}
+}
+
+// parseCipherSuites принимает только наборы, которые crypto/tls считает безопасными
+func parseCipherSuites(names []string) ([]uint16, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+	known := make(map[string]uint16)
+	for _, suite := range tls.CipherSuites() {
+		known[suite.Name] = suite.ID
+	}
+	ids := make([]uint16, 0, len(names))
+	for _, name := range names {
+		id, ok := known[name]
+		if !ok {
+			return nil, fmt.Errorf("неизвестный или небезопасный набор шифров %s", name)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// ProxyProtocolConfig задает прием заголовка PROXY protocol v1/v2 от L4 балансировщика
+type ProxyProtocolConfig struct {
+	Enabled        bool          `yaml:"enabled"`
+	TrustedSources []string      `yaml:"trustedSources"` // подсети (CIDR) или адреса, от которых принимается заголовок
+	HeaderTimeout  time.Duration `yaml:"headerTimeout"`  // сколько ждать заголовок после соединения
+}
+
+func (c ProxyProtocolConfig) validate() error {
+	if !c.Enabled {
+		return nil
+	}
+	if len(c.TrustedSources) == 0 {
+		return fmt.Errorf("server.proxyProtocol.trustedSources: не задано ни одного источника")
+	}
+	if _, err := clientip.NewResolver(c.TrustedSources); err != nil {
+		return fmt.Errorf("server.proxyProtocol.trustedSources: %w", err)
+	}
+	if c.HeaderTimeout < 0 {
+		return fmt.Errorf("server.proxyProtocol.headerTimeout не может быть отрицательным")
+	}
+	return nil
+}
+
+// ServerConfig задает параметры слушателя балансировщика
+type ServerConfig struct {
+	ReadTimeout       time.Duration       `yaml:"readTimeout"`
+	ReadHeaderTimeout time.Duration       `yaml:"readHeaderTimeout"` // 0 - равен readTimeout
+	WriteTimeout      time.Duration       `yaml:"writeTimeout"`      // для запросов с timeouts.total заменяется дедлайном total + 1s
+	IdleTimeout       time.Duration       `yaml:"idleTimeout"`
+	HTTP2             HTTP2Config         `yaml:"http2"`
+	TLS               ListenerTLSConfig   `yaml:"tls"`
+	ProxyProtocol     ProxyProtocolConfig `yaml:"proxyProtocol"`
+}
+
+// ForwardingConfig задает доверие к X-Forwarded-For / Forwarded и заголовки для бэкендов
+type ForwardingConfig struct {
+	TrustedProxies  []string        `yaml:"trustedProxies"`  // подсети (CIDR) или адреса прокси перед балансировщиком
+	ForwardedHeader bool            `yaml:"forwardedHeader"` // добавлять заголовок Forwarded (RFC 7239)
+	RequestID       RequestIDConfig `yaml:"requestId"`
+}
+
+// RequestIDConfig задает идентификатор запроса, по которому логи балансировщика сопоставляются с логами бэкендов
+// идентификатор уходит бэкенду и клиенту в заголовке header, попадает в логи и ответы об ошибках
+type RequestIDConfig struct {
+	Header string `yaml:"header"` // по умолчанию X-Request-ID
+	Format string `yaml:"format"` // uuidv4 или ulid
+	// подсети, от которых входящий идентификатор принимается как есть, пусто - forwarding.trustedProxies
+	// от остальных отправителей он заменяется новым
+	TrustedSources []string `yaml:"trustedSources"`
+}
+
+// BackoffConfig задает задержку между повторными попытками
+type BackoffConfig struct {
+	Base   time.Duration `yaml:"base"`
+	Max    time.Duration `yaml:"max"`
+	Jitter float64       `yaml:"jitter"` // доля случайного разброса, 0..1
+}
+
+// RetryConfig задает политику повторных попыток проксирования
+// в пулах и маршрутах незаданные поля наследуются от уровня выше
+// поля-указатели можно переопределить нулем: perTryTimeout: 0 отключает таймаут попытки, заданный выше
+type RetryConfig struct {
+	MaxAttempts          int            `yaml:"maxAttempts"` // 0 - наследуется
+	RetryOn              []string       `yaml:"retryOn"`     // connect-failure, reset, timeout
+	StatusCodes          []int          `yaml:"statusCodes"` // например 502, 503, 504
+	PerTryTimeout        *time.Duration `yaml:"perTryTimeout"`
+	Backoff              *BackoffConfig `yaml:"backoff"` // переопределяется целиком
+	AvoidPreviousBackend *bool          `yaml:"avoidPreviousBackend"`
+	MaxBodyBytes         *int64         `yaml:"maxBodyBytes"` // сколько байт тела буферизуется для повтора
+}
+
+// RetryBudgetConfig ограничивает долю повторов относительно успешных запросов
+type RetryBudgetConfig struct {
+	Enabled             bool          `yaml:"enabled"`
+	Ratio               float64       `yaml:"ratio"`               // например 0.2 - не больше 20% повторов от успехов
+	MinRetriesPerSecond float64       `yaml:"minRetriesPerSecond"` // минимум повторов при малом трафике
+	Window              time.Duration `yaml:"window"`              // окно, в котором считаются успехи и повторы
+}
+
+// CacheConfig описывает кеш ответов бэкендов в памяти
+type CacheConfig struct {
+	Enabled       bool  `yaml:"enabled"`
+	MaxBytes      int64 `yaml:"maxBytes"`      // суммарный размер кеша, при превышении вытесняются давно не использованные ответы
+	MaxEntryBytes int64 `yaml:"maxEntryBytes"` // ответы с телом больше лимита не кешируются
+}
+
+// CompressionConfig описывает сжатие ответов клиентам
+type CompressionConfig struct {
+	Enabled      bool     `yaml:"enabled"`
+	Encodings    []string `yaml:"encodings"`    // br, gzip, deflate в порядке предпочтения, пусто - gzip и deflate
+	Level        int      `yaml:"level"`        // 1-9, 0 - уровень по умолчанию
+	MinSize      int      `yaml:"minSize"`      // ответы меньше этого размера в байтах не сжимаются
+	ContentTypes []string `yaml:"contentTypes"` // application/json, text/* и т.п., пусто - типичные текстовые типы
+}
+
+func (c CompressionConfig) validate() error {
+	for _, encoding := range c.Encodings {
+		switch encoding {
+		case "br", "gzip", "deflate":
+		default:
+			return fmt.Errorf("compression.encodings: неподдерживаемый алгоритм %q, допустимые значения: br, gzip, deflate", encoding)
+		}
+	}
+	if c.Level < 0 || c.Level > 9 {
+		return fmt.Errorf("compression.level должен быть в диапазоне 0-9")
+	}
+	if c.MinSize < 0 {
+		return fmt.Errorf("compression.minSize не может быть отрицательным")
+	}
+	return nil
+}
+
+// ErrorTemplatesConfig пути к файлам шаблонов ответа об ошибке по форматам, пустой путь - встроенный вид
+type ErrorTemplatesConfig struct {
+	JSON string `yaml:"json"` // вместо application/problem+json, строки экранируются функцией {{json .Detail}}
+	HTML string `yaml:"html"`
+	Text string `yaml:"text"`
+}
+
+func (c ErrorTemplatesConfig) load() (problem.Templates, error) {
+	var t problem.Templates
+	for _, f := range []struct {
+		path string
+		dst  *string
+	}{{c.JSON, &t.JSON}, {c.HTML, &t.HTML}, {c.Text, &t.Text}} {
+		if f.path == "" {
+			continue
+		}
+		content, err := os.ReadFile(f.path)
+		if err != nil {
+			return t, fmt.Errorf("не удалось прочитать шаблон ошибки: %w", err)
+		}
+		*f.dst = string(content)
+	}
+	return t, nil
+}
+
+// ErrorPagesConfig задает вид ошибок самого балансировщика (429, 502, 503, 504 и тд)
+// формат выбирается по Accept клиента: JSON (RFC 7807), HTML или текст
+// шаблоны статуса из statuses перекрывают общие только для заданных форматов
+type ErrorPagesConfig struct {
+	ErrorTemplatesConfig `yaml:",inline"`
+	Statuses             map[int]ErrorTemplatesConfig `yaml:"statuses"`
+}
+
+// Renderer читает файлы шаблонов и собирает отрисовку ответов об ошибках
+func (c ErrorPagesConfig) Renderer() (*problem.Renderer, error) {
+	defaults, err := c.ErrorTemplatesConfig.load()
+	if err != nil {
+		return nil, fmt.Errorf("errorPages: %w", err)
+	}
+	statuses := make(map[int]problem.Templates, len(c.Statuses))
+	for status, templates := range c.Statuses {
+		if status < 400 || status > 599 {
+			return nil, fmt.Errorf("errorPages.statuses: %d не является статусом ошибки", status)
+		}
+		if statuses[status], err = templates.load(); err != nil {
+			return nil, fmt.Errorf("errorPages.statuses.%d: %w", status, err)
+		}
+	}
+	renderer, err := problem.NewRenderer(defaults, statuses)
+	if err != nil {
+		return nil, fmt.Errorf("errorPages: %w", err)
+	}
+	return renderer, nil
+}
+
+// TCPConfig описывает слушатели режима TCP (L4): соединения передаются в пул без разбора протокола
+type TCPConfig struct {
+	Listeners []TCPListenerConfig `yaml:"listeners"`
+}
+
+// TCPListenerConfig описывает один TCP слушатель
+// бэкенды пула задаются как tcp://host:port, их здоровье проверяется установкой соединения
+type TCPListenerConfig struct {
+	Name            string        `yaml:"name"`
+	ListenAddress   string        `yaml:"listenAddress"`
+	Pool            string        `yaml:"pool"`
+	ConnectTimeout  time.Duration `yaml:"connectTimeout"`  // 0 - proxy.dialTimeout
+	ConnectAttempts int           `yaml:"connectAttempts"` // по умолчанию 2
+	IdleTimeout     time.Duration `yaml:"idleTimeout"`     // 0 - без ограничения простоя
+	MaxLifetime     time.Duration `yaml:"maxLifetime"`     // 0 - без ограничения срока жизни
+}
+
+// UDPConfig описывает слушатели режима UDP
+type UDPConfig struct {
+	Listeners []UDPListenerConfig `yaml:"listeners"`
+}
+
+// UDPListenerConfig описывает один UDP слушатель
+// бэкенды пула задаются как udp://host:port, их здоровье проверяется пробой probe
+type UDPListenerConfig struct {
+	Name               string         `yaml:"name"`
+	ListenAddress      string         `yaml:"listenAddress"`
+	Pool               string         `yaml:"pool"`
+	SessionIdleTimeout time.Duration  `yaml:"sessionIdleTimeout"` // по умолчанию 30s
+	MaxSessions        int            `yaml:"maxSessions"`        // 0 - без ограничения
+	Probe              UDPProbeConfig `yaml:"probe"`
+}
+
+// UDPProbeConfig описывает проверку здоровья UDP бэкендов
+type UDPProbeConfig struct {
+	Type        string `yaml:"type"`        // dns или payload (по умолчанию)
+	Payload     string `yaml:"payload"`     // для payload: содержимое датаграммы проверки
+	ExpectReply bool   `yaml:"expectReply"` // для payload: без ответа бэкенд нездоров
+}
+
+// PoolConfig описывает именованный пул бэкендов
+type PoolConfig struct {
+	Backends          []string           `yaml:"backends"`
+	Strategy          string             `yaml:"strategy"`          // по умолчанию loadBalancer.strategy
+	Protocol          string             `yaml:"protocol"`          // по умолчанию proxy.protocol
+	SendProxyProtocol string             `yaml:"sendProxyProtocol"` // по умолчанию proxy.sendProxyProtocol
+	TLS               *UpstreamTLSConfig `yaml:"tls"`               // по умолчанию proxy.tls
+	Retry             *RetryConfig       `yaml:"retry"`
+	Headers           *HeaderRulesConfig `yaml:"headers"`
+}
+
+// HeaderRules собирает правила заголовков пула, nil если они не заданы
+// шаблоны проверены при загрузке конфигурации, поэтому ошибки здесь нет
+func (p PoolConfig) HeaderRules() *headers.Rules {
+	if p.Headers == nil {
+		return nil
+	}
+	rules, _ := p.Headers.Rules()
+	return rules
+}
+
+// HedgeConfig задает хеджирование запросов маршрута
+type HedgeConfig struct {
+	Delay      time.Duration `yaml:"delay"`      // через сколько отправить запрос на второй бэкенд
+	Percentile float64       `yaml:"percentile"` // если задан, задержка берется как перцентиль задержек маршрута (0..1)
+	MinSamples int           `yaml:"minSamples"` // сколько замеров нужно для перцентиля
+}
+
+// TimeoutsConfig задает таймауты запросов к бэкендам, 0 - без ограничения
+// в маршрутах незаданные (нулевые) поля наследуются от корневой секции
+type TimeoutsConfig struct {
+	Connect        time.Duration `yaml:"connect"`        // установка соединения с бэкендом
+	ResponseHeader time.Duration `yaml:"responseHeader"` // от начала попытки до заголовков ответа
+	Total          time.Duration `yaml:"total"`          // весь запрос вместе с повторами
+}
+
+// Timeouts собирает доменные таймауты
+func (c TimeoutsConfig) Timeouts() routing.Timeouts {
+	return routing.Timeouts{
+		Connect:        c.Connect,
+		ResponseHeader: c.ResponseHeader,
+		Total:          c.Total,
+	}
+}
+
+func (c TimeoutsConfig) validate(section string) error {
+	if c.Connect < 0 || c.ResponseHeader < 0 || c.Total < 0 {
+		return fmt.Errorf("таймауты в секции %s не могут быть отрицательными", section)
+	}
+	return nil
+}
+
+// UpgradeConfig задает таймауты соединений после смены протокола (WebSocket и тд)
+// в маршрутах незаданные (нулевые) поля наследуются от корневой секции
+type UpgradeConfig struct {
+	IdleTimeout time.Duration `yaml:"idleTimeout"` // 0 - без ограничения простоя
+	MaxLifetime time.Duration `yaml:"maxLifetime"` // 0 - без ограничения срока жизни
+}
+
+// Policy собирает доменную политику переключенных соединений
+func (c UpgradeConfig) Policy() routing.UpgradePolicy {
+	return routing.UpgradePolicy{
+		IdleTimeout: c.IdleTimeout,
+		MaxLifetime: c.MaxLifetime,
+	}
+}
+
+// HeaderOpsConfig изменения одного набора заголовков
+// значения - шаблоны с переменными ${client_ip}, ${request_id}, ${backend}, ${host}, ${method}, ${path}
+type HeaderOpsConfig struct {
+	Add    map[string]string `yaml:"add"`
+	Set    map[string]string `yaml:"set"`
+	Remove []string          `yaml:"remove"`
+}
+
+func (c HeaderOpsConfig) ops() (headers.Ops, error) {
+	ops := headers.Ops{Remove: c.Remove}
+	var err error
+	if ops.Set, err = parseHeaderTemplates(c.Set); err != nil {
+		return headers.Ops{}, err
+	}
+	if ops.Add, err = parseHeaderTemplates(c.Add); err != nil {
+		return headers.Ops{}, err
+	}
+	return ops, nil
+}
+
+// parseHeaderTemplates разбирает шаблоны, заголовки сортируются для предсказуемого порядка
+func parseHeaderTemplates(values map[string]string) ([]headers.Header, error) {
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	result := make([]headers.Header, 0, len(names))
+	for _, name := range names {
+		if name == "" {
+			return nil, fmt.Errorf("пустое имя заголовка")
+		}
+		tmpl, err := headers.ParseTemplate(values[name])
+		if err != nil {
+			return nil, fmt.Errorf("заголовок %s: %w", name, err)
+		}
+		result = append(result, headers.Header{Name: name, Value: tmpl})
+	}
+	return result, nil
+}
+
+// HeaderRulesConfig задает правила заголовков маршрута или пула
+type HeaderRulesConfig struct {
+	Request  HeaderOpsConfig `yaml:"request"`  // перед отправкой бэкенду
+	Response HeaderOpsConfig `yaml:"response"` // перед отправкой клиенту
+}
+
+// Rules собирает доменные правила заголовков
+func (c HeaderRulesConfig) Rules() (*headers.Rules, error) {
+	request, err := c.Request.ops()
+	if err != nil {
+		return nil, fmt.Errorf("request: %w", err)
+	}
+	response, err := c.Response.ops()
+	if err != nil {
+		return nil, fmt.Errorf("response: %w", err)
+	}
+	return &headers.Rules{Request: request, Response: response}, nil
+}
+
+// RewriteConfig задает переписывание пути маршрута перед отправкой бэкенду
+// шаги применяются по порядку: stripPrefix, regex, addPrefix
+type RewriteConfig struct {
+	StripPrefix string `yaml:"stripPrefix"`
+	AddPrefix   string `yaml:"addPrefix"`
+	Regex       string `yaml:"regex"`
+	Replacement string `yaml:"replacement"` // группы захвата через $1 или ${name}
+	// обратная замена для Location ответов бэкенда, если путь переписан regex
+	RedirectRegex       string `yaml:"redirectRegex"`
+	RedirectReplacement string `yaml:"redirectReplacement"`
+}
+
+// Rewrite собирает доменное переписывание пути
+func (c RewriteConfig) Rewrite() (*routing.Rewrite, error) {
+	rw := &routing.Rewrite{
+		StripPrefix:         c.StripPrefix,
+		AddPrefix:           c.AddPrefix,
+		Replacement:         c.Replacement,
+		RedirectReplacement: c.RedirectReplacement,
+	}
+	for _, prefix := range []string{c.StripPrefix, c.AddPrefix} {
+		if prefix != "" && !strings.HasPrefix(prefix, "/") {
+			return nil, fmt.Errorf("префикс %q должен начинаться с '/'", prefix)
+		}
+	}
+	var err error
+	if c.Regex != "" {
+		if rw.Regex, err = regexp.Compile(c.Regex); err != nil {
+			return nil, fmt.Errorf("некорректное регулярное выражение regex: %w", err)
+		}
+	}
+	if c.RedirectRegex != "" {
+		if rw.RedirectRegex, err = regexp.Compile(c.RedirectRegex); err != nil {
+			return nil, fmt.Errorf("некорректное регулярное выражение redirectRegex: %w", err)
+		}
+	}
+	return rw, nil
+}
+
+// RouteConfig описывает маршрут: запросы с префиксом пути pathPrefix уходят в пул pool
+type RouteConfig struct {
+	Name       string             `yaml:"name"`
+	PathPrefix string             `yaml:"pathPrefix"`
+	Pool       string             `yaml:"pool"`      // по умолчанию пул из корневого списка backends
+	WebSocket  bool               `yaml:"websocket"` // маршрут принимает только рукопожатия WebSocket
+	Retry      *RetryConfig       `yaml:"retry"`
+	Hedge      *HedgeConfig       `yaml:"hedge"`
+	Upgrade    *UpgradeConfig     `yaml:"upgrade"`
+	Headers    *HeaderRulesConfig `yaml:"headers"`
+	Rewrite    *RewriteConfig     `yaml:"rewrite"`
+	Mirror     *MirrorConfig      `yaml:"mirror"`
+	Split      *SplitConfig       `yaml:"split"` // pool маршрута при этом не используется
+	Fault      *FaultConfig       `yaml:"fault"`
+	Timeouts   *TimeoutsConfig    `yaml:"timeouts"`
+	GRPC       *GRPCConfig        `yaml:"grpc"` // маршрут принимает только вызовы gRPC
+	Streaming  *StreamingConfig   `yaml:"streaming"`
+}
+
+// StreamingConfig включает потоковую передачу ответов маршрута (Server-Sent Events и тд)
+// ответы маршрута не ограничены server.writeTimeout и timeouts.total, поток обрывается только по простою
+type StreamingConfig struct {
+	FlushInterval time.Duration `yaml:"flushInterval"` // период сброса ответа клиенту, 0 - после каждой записи
+	IdleTimeout   time.Duration `yaml:"idleTimeout"`   // пауза в данных бэкенда, после которой поток прерывается, 0 - без ограничения
+}
+
+// GRPCConfig описывает gRPC маршрут
+// service и method задают путь /service/method вместо pathPrefix: без method подходят все методы сервиса
+type GRPCConfig struct {
+	Service    string   `yaml:"service"` // полное имя сервиса: package.Service
+	Method     string   `yaml:"method"`
+	RetryOn    []string `yaml:"retryOn"`    // коды grpc-status: UNAVAILABLE, RESOURCE_EXHAUSTED и тд
+	Idempotent []string `yaml:"idempotent"` // методы /package.Service/Method или сервисы /package.Service/, которые можно повторять
+}
+
+// GRPCPolicy собирает политику gRPC маршрута, nil если маршрут не gRPC
+// коды проверены при загрузке конфигурации, поэтому ошибки здесь нет
+func (r RouteConfig) GRPCPolicy() *grpc.Policy {
+	if r.GRPC == nil {
+		return nil
+	}
+	policy := &grpc.Policy{Idempotent: r.GRPC.Idempotent}
+	for _, name := range r.GRPC.RetryOn {
+		code, _ := grpc.ParseCode(name)
+		policy.RetryOn = append(policy.RetryOn, code)
+	}
+	return policy
+}
+
+// FaultConfig описывает внесение сбоев в запросы маршрута для проверки устойчивости клиентов
+// сбои включаются заголовком header от доверенных отправителей, либо, при allTraffic: true, вносятся во все запросы
+type FaultConfig struct {
+	Header     string `yaml:"header"`     // например X-Fault-Inject: сбои только в запросах с этим заголовком
+	AllTraffic bool   `yaml:"allTraffic"` // без header: сбои во всех запросах маршрута
+	// подсети, которым разрешено включать сбои заголовком, пусто - forwarding.trustedProxies
+	TrustedSources []string `yaml:"trustedSources"`
+	// пределы явных сбоев из заголовка, по умолчанию 30s и 1024 байт/с
+	MaxDelay          time.Duration `yaml:"maxDelay"`
+	MinBytesPerSecond int64         `yaml:"minBytesPerSecond"`
+	Delay             *struct {
+		Fixed   time.Duration `yaml:"fixed"`
+		Random  time.Duration `yaml:"random"` // случайная добавка к fixed от 0 до random
+		Percent float64       `yaml:"percent"`
+	} `yaml:"delay"`
+	Abort *struct {
+		Status  int     `yaml:"status"`
+		Percent float64 `yaml:"percent"`
+	} `yaml:"abort"`
+	Throttle *struct {
+		BytesPerSecond int64   `yaml:"bytesPerSecond"`
+		Percent        float64 `yaml:"percent"`
+	} `yaml:"throttle"`
+}
+
+// Policy собирает доменную политику сбоев
+// подсети trustedSources проверены при загрузке конфигурации, поэтому ошибки здесь нет
+func (c *FaultConfig) Policy() *fault.Policy {
+	p := &fault.Policy{
+		Header:            c.Header,
+		AllTraffic:        c.AllTraffic,
+		MaxDelay:          c.MaxDelay,
+		MinBytesPerSecond: c.MinBytesPerSecond,
+	}
+	if len(c.TrustedSources) > 0 {
+		p.Trusted, _ = clientip.NewResolver(c.TrustedSources)
+	}
+	if c.Delay != nil {
+		p.Delay = &fault.Delay{Fixed: c.Delay.Fixed, Random: c.Delay.Random, Percent: c.Delay.Percent}
+	}
+	if c.Abort != nil {
+		p.Abort = &fault.Abort{Status: c.Abort.Status, Percent: c.Abort.Percent}
+	}
+	if c.Throttle != nil {
+		p.Throttle = &fault.Throttle{BytesPerSecond: c.Throttle.BytesPerSecond, Percent: c.Throttle.Percent}
+	}
+	return p
+}
+
+// FaultPolicy собирает политику сбоев маршрута, nil если сбои не заданы
+func (r RouteConfig) FaultPolicy() *fault.Policy {
+	if r.Fault == nil {
+		return nil
+	}
+	return r.Fault.Policy()
+}
+
+// UpstreamTimeouts возвращает таймауты маршрута, незаданные поля сервис возьмет из корневой секции timeouts
+// nil, если у маршрута нет своей секции
+func (r RouteConfig) UpstreamTimeouts() *routing.Timeouts {
+	if r.Timeouts == nil {
+		return nil
+	}
+	timeouts := r.Timeouts.Timeouts()
+	return &timeouts
+}
+
+// StreamPolicy возвращает политику потоковых ответов маршрута, nil если секции streaming нет
+func (r RouteConfig) StreamPolicy() *routing.StreamPolicy {
+	if r.Streaming == nil {
+		return nil
+	}
+	return &routing.StreamPolicy{
+		FlushInterval: r.Streaming.FlushInterval,
+		IdleTimeout:   r.Streaming.IdleTimeout,
+	}
+}
+
+// SplitConfig описывает разделение трафика маршрута между группами бэкендов
+type SplitConfig struct {
+	Groups    []SplitGroupConfig    `yaml:"groups"`
+	Overrides []SplitOverrideConfig `yaml:"overrides"`
+}
+
+// SplitGroupConfig группа бэкендов и ее вес
+type SplitGroupConfig struct {
+	Name   string `yaml:"name"`
+	Pool   string `yaml:"pool"`
+	Weight int    `yaml:"weight"`
+}
+
+// SplitOverrideConfig принудительный выбор группы по заголовку или cookie
+type SplitOverrideConfig struct {
+	Header string `yaml:"header"`
+	Cookie string `yaml:"cookie"`
+	Value  string `yaml:"value"` // пусто - любое непустое значение
+	Group  string `yaml:"group"`
+}
+
+// Split собирает разделение трафика
+func (c *SplitConfig) Split() (*routing.Split, error) {
+	groups := make([]routing.SplitGroup, 0, len(c.Groups))
+	for _, g := range c.Groups {
+		groups = append(groups, routing.SplitGroup{Name: g.Name, Pool: g.Pool, Weight: g.Weight})
+	}
+	overrides := make([]routing.SplitOverride, 0, len(c.Overrides))
+	for _, o := range c.Overrides {
+		overrides = append(overrides, routing.SplitOverride{Header: o.Header, Cookie: o.Cookie, Value: o.Value, Group: o.Group})
+	}
+	return routing.NewSplit(groups, overrides)
+}
+
+// TrafficSplit собирает разделение трафика маршрута, nil если оно не задано
+// каждый вызов создает новый объект: веса, измененные через API, живут только в нем
+func (r RouteConfig) TrafficSplit() *routing.Split {
+	if r.Split == nil {
+		return nil
+	}
+	split, _ := r.Split.Split()
+	return split
+}
+
+// MirrorConfig описывает копирование запросов маршрута в теневой пул
+type MirrorConfig struct {
+	Pool         string        `yaml:"pool"`
+	Percent      float64       `yaml:"percent"`      // 0-100
+	MaxBodyBytes int64         `yaml:"maxBodyBytes"` // запросы с телом больше лимита не копируются, по умолчанию 1 MiB
+	Timeout      time.Duration `yaml:"timeout"`      // по умолчанию 10s
+}
+
+// MirroringConfig общие настройки зеркалирования
+type MirroringConfig struct {
+	MaxInFlight int `yaml:"maxInFlight"` // сколько теневых запросов может идти одновременно, лишние пропускаются
+}
+
+// MirrorPolicy собирает доменную политику зеркалирования маршрута, nil если зеркалирование не задано
+func (r RouteConfig) MirrorPolicy() *mirror.Policy {
+	if r.Mirror == nil {
+		return nil
+	}
+	return &mirror.Policy{
+		Pool:         r.Mirror.Pool,
+		Percent:      r.Mirror.Percent,
+		MaxBodyBytes: r.Mirror.MaxBodyBytes,
+		Timeout:      r.Mirror.Timeout,
+	}
+}
+
+// PathRewrite собирает переписывание пути маршрута, nil если оно не задано
+func (r RouteConfig) PathRewrite() *routing.Rewrite {
+	if r.Rewrite == nil {
+		return nil
+	}
+	rw, _ := r.Rewrite.Rewrite()
+	return rw
+}
+
+// HeaderRules собирает правила заголовков маршрута, nil если они не заданы
+func (r RouteConfig) HeaderRules() *headers.Rules {
+	if r.Headers == nil {
+		return nil
+	}
+	rules, _ := r.Headers.Rules()
+	return rules
+}
+
+// HedgePolicy собирает доменную политику хеджирования маршрута, nil если хеджирование не задано
+func (r RouteConfig) HedgePolicy() *retry.Hedge {
+	if r.Hedge == nil {
+		return nil
+	}
+	return &retry.Hedge{
+		Delay:      r.Hedge.Delay,
+		Percentile: r.Hedge.Percentile,
+		MinSamples: r.Hedge.MinSamples,
+	}
+}
+
 type Config struct {
-	ListenAddress string             `yaml:"listenAddress"`
-	Backends      []string           `yaml:"backends"`
-	Log           LogConfig          `yaml:"log"`
-	HealthCheck   HealthCheckConfig  `yaml:"healthCheck"`
-	RateLimit     RateLimitConfig    `yaml:"rateLimit"`
-	LoadBalancer  LoadBalancerConfig `yaml:"loadBalancer"`
+	ListenAddress string                `yaml:"listenAddress"`
+	Server        ServerConfig          `yaml:"server"`
+	Forwarding    ForwardingConfig      `yaml:"forwarding"`
+	Backends      []string              `yaml:"backends"`
+	Log           LogConfig             `yaml:"log"`
+	HealthCheck   HealthCheckConfig     `yaml:"healthCheck"`
+	RateLimit     RateLimitConfig       `yaml:"rateLimit"`
+	LoadBalancer  LoadBalancerConfig    `yaml:"loadBalancer"`
+	Proxy         ProxyConfig           `yaml:"proxy"`
+	Retry         RetryConfig           `yaml:"retry"`
+	RetryBudget   RetryBudgetConfig     `yaml:"retryBudget"`
+	Pools         map[string]PoolConfig `yaml:"pools"`
+	Routes        []RouteConfig         `yaml:"routes"`
+	Upgrade       UpgradeConfig         `yaml:"upgrade"`
+	Cache         CacheConfig           `yaml:"cache"`
+	Compression   CompressionConfig     `yaml:"compression"`
+	Mirroring     MirroringConfig       `yaml:"mirroring"`
+	Timeouts      TimeoutsConfig        `yaml:"timeouts"`
+	TCP           TCPConfig             `yaml:"tcp"`
+	UDP           UDPConfig             `yaml:"udp"`
+	ErrorPages    ErrorPagesConfig      `yaml:"errorPages"`
 }
 
 const (
@@ -47,9 +813,20 @@ const (
 )
 
 func LoadConfig(configPath string) (*Config, error) {
+	retryBodyBytes := int64(1 << 20)
 	conf := &Config{
 		ListenAddress: ":8080",
 		Log:           LogConfig{Level: "info", Format: "text"},
+		Server: ServerConfig{
+			ReadTimeout:   15 * time.Second,
+			WriteTimeout:  15 * time.Second,
+			IdleTimeout:   30 * time.Second,
+			HTTP2:         HTTP2Config{Enabled: true},
+			ProxyProtocol: ProxyProtocolConfig{HeaderTimeout: 5 * time.Second},
+		},
+		Forwarding: ForwardingConfig{
+			RequestID: RequestIDConfig{Header: "X-Request-ID", Format: requestid.FormatUUIDv4},
+		},
 		HealthCheck: HealthCheckConfig{
 			Enabled:  true,
 			Interval: 15 * time.Second,
@@ -64,6 +841,37 @@ func LoadConfig(configPath string) (*Config, error) {
 		LoadBalancer: LoadBalancerConfig{
 			Strategy: StrategyRoundRobin, // значение по умолчанию
 		},
+		Proxy: ProxyConfig{
+			MaxIdleConns:        100,
+			MaxIdleConnsPerHost: 32,
+			IdleConnTimeout:     90 * time.Second,
+			KeepAlive:           30 * time.Second,
+			DialTimeout:         5 * time.Second,
+			TLSHandshakeTimeout: 10 * time.Second,
+		},
+		Retry: RetryConfig{
+			MaxAttempts:  3,
+			RetryOn:      []string{"connect-failure", "reset", "timeout"},
+			MaxBodyBytes: &retryBodyBytes,
+		},
+		RetryBudget: RetryBudgetConfig{
+			Ratio:               0.2,
+			MinRetriesPerSecond: 10,
+			Window:              10 * time.Second,
+		},
+		Upgrade: UpgradeConfig{
+			IdleTimeout: 10 * time.Minute,
+		},
+		Cache: CacheConfig{
+			MaxBytes:      64 << 20,
+			MaxEntryBytes: 1 << 20,
+		},
+		Compression: CompressionConfig{
+			MinSize: 1024,
+		},
+		Mirroring: MirroringConfig{
+			MaxInFlight: 64,
+		},
 	}
 
 	yamlFile, err := os.ReadFile(configPath)
@@ -136,5 +944,601 @@ func LoadConfig(configPath string) (*Config, error) {
 		}
 	}
 
+	// валидация параметров пула соединений
+	if conf.Proxy.MaxIdleConns < 0 || conf.Proxy.MaxIdleConnsPerHost < 0 {
+		return nil, fmt.Errorf("proxy.maxIdleConns и proxy.maxIdleConnsPerHost не могут быть отрицательными")
+	}
+	if conf.Proxy.IdleConnTimeout < 0 || conf.Proxy.KeepAlive < 0 || conf.Proxy.DialTimeout < 0 || conf.Proxy.TLSHandshakeTimeout < 0 {
+		return nil, fmt.Errorf("таймауты в секции proxy не могут быть отрицательными")
+	}
+
+	if err := validateProtocol("proxy.protocol", conf.Proxy.Protocol); err != nil {
+		return nil, err
+	}
+	if err := validateSendProxyProtocol("proxy", conf.Proxy.Protocol, conf.Proxy.SendProxyProtocol); err != nil {
+		return nil, err
+	}
+	if conf.Server.ReadTimeout < 0 || conf.Server.ReadHeaderTimeout < 0 || conf.Server.WriteTimeout < 0 || conf.Server.IdleTimeout < 0 {
+		return nil, fmt.Errorf("таймауты в секции server не могут быть отрицательными")
+	}
+	if err := conf.Server.TLS.validate(); err != nil {
+		return nil, err
+	}
+	if err := conf.Server.ProxyProtocol.validate(); err != nil {
+		return nil, err
+	}
+	if _, err := clientip.NewResolver(conf.Forwarding.TrustedProxies); err != nil {
+		return nil, fmt.Errorf("forwarding.trustedProxies: %w", err)
+	}
+	if _, err := requestid.NewGenerator(conf.Forwarding.RequestID.Format); err != nil {
+		return nil, fmt.Errorf("forwarding.requestId.format: %w", err)
+	}
+	if _, err := clientip.NewResolver(conf.Forwarding.RequestID.TrustedSources); err != nil {
+		return nil, fmt.Errorf("forwarding.requestId.trustedSources: %w", err)
+	}
+	if conf.Proxy.TLS != nil {
+		if err := conf.Proxy.TLS.validate("proxy.tls"); err != nil {
+			return nil, err
+		}
+	}
+	for backend, backendTLS := range conf.Proxy.BackendTLS {
+		if err := backendTLS.validate("proxy.backendTLS." + backend); err != nil {
+			return nil, err
+		}
+	}
+
+	// валидация политики повторов, пулов и маршрутов
+	if err := conf.Retry.validate("retry"); err != nil {
+		return nil, err
+	}
+	if conf.RetryBudget.Enabled {
+		if conf.RetryBudget.Ratio < 0 || conf.RetryBudget.MinRetriesPerSecond < 0 {
+			return nil, fmt.Errorf("retryBudget.ratio и retryBudget.minRetriesPerSecond не могут быть отрицательными")
+		}
+		if conf.RetryBudget.Window <= 0 {
+			return nil, fmt.Errorf("retryBudget.window должен быть положительным значением")
+		}
+	}
+	if conf.Upgrade.IdleTimeout < 0 || conf.Upgrade.MaxLifetime < 0 {
+		return nil, fmt.Errorf("таймауты в секции upgrade не могут быть отрицательными")
+	}
+	if err := conf.Timeouts.validate("timeouts"); err != nil {
+		return nil, err
+	}
+	if conf.Cache.Enabled {
+		if conf.Cache.MaxBytes <= 0 || conf.Cache.MaxEntryBytes <= 0 {
+			return nil, fmt.Errorf("cache.maxBytes и cache.maxEntryBytes должны быть положительными значениями")
+		}
+		if conf.Cache.MaxEntryBytes > conf.Cache.MaxBytes {
+			return nil, fmt.Errorf("cache.maxEntryBytes не может быть больше cache.maxBytes")
+		}
+	}
+	if err := conf.Compression.validate(); err != nil {
+		return nil, err
+	}
+	// шаблоны проверяются при загрузке, чтобы ошибка в них не всплыла только на первом отказе
+	if _, err := conf.ErrorPages.Renderer(); err != nil {
+		return nil, err
+	}
+	if conf.Mirroring.MaxInFlight <= 0 {
+		return nil, fmt.Errorf("mirroring.maxInFlight должен быть положительным значением")
+	}
+	if err := conf.validatePools(); err != nil {
+		return nil, err
+	}
+	if err := conf.validateRoutes(); err != nil {
+		return nil, err
+	}
+	if err := conf.validateTCP(); err != nil {
+		return nil, err
+	}
+	if err := conf.validateUDP(); err != nil {
+		return nil, err
+	}
+
 	return conf, nil
 }
+
+// validate проверяет политику повторов, section - путь секции для сообщений об ошибках
+func (c *RetryConfig) validate(section string) error {
+	if c.MaxAttempts < 0 {
+		return fmt.Errorf("%s.maxAttempts не может быть отрицательным", section)
+	}
+	for _, cond := range c.RetryOn {
+		if _, err := retry.ParseCondition(cond); err != nil {
+			return fmt.Errorf("%s.retryOn: %w", section, err)
+		}
+	}
+	for _, code := range c.StatusCodes {
+		if code < 100 || code > 599 {
+			return fmt.Errorf("%s.statusCodes: недопустимый статус %d", section, code)
+		}
+	}
+	if c.PerTryTimeout != nil && *c.PerTryTimeout < 0 {
+		return fmt.Errorf("%s.perTryTimeout не может быть отрицательным", section)
+	}
+	if c.Backoff != nil {
+		if c.Backoff.Base < 0 || c.Backoff.Max < 0 {
+			return fmt.Errorf("задержки в секции %s.backoff не могут быть отрицательными", section)
+		}
+		if c.Backoff.Jitter < 0 || c.Backoff.Jitter > 1 {
+			return fmt.Errorf("%s.backoff.jitter должен быть в диапазоне 0..1", section)
+		}
+	}
+	if c.MaxBodyBytes != nil && *c.MaxBodyBytes < 0 {
+		return fmt.Errorf("%s.maxBodyBytes не может быть отрицательным", section)
+	}
+	return nil
+}
+
+// inherit возвращает копию политики, где незаданные поля взяты из parent
+func (c RetryConfig) inherit(parent RetryConfig) RetryConfig {
+	if c.MaxAttempts == 0 {
+		c.MaxAttempts = parent.MaxAttempts
+	}
+	if c.RetryOn == nil {
+		c.RetryOn = parent.RetryOn
+	}
+	if c.StatusCodes == nil {
+		c.StatusCodes = parent.StatusCodes
+	}
+	if c.PerTryTimeout == nil {
+		c.PerTryTimeout = parent.PerTryTimeout
+	}
+	if c.Backoff == nil {
+		c.Backoff = parent.Backoff
+	}
+	if c.AvoidPreviousBackend == nil {
+		c.AvoidPreviousBackend = parent.AvoidPreviousBackend
+	}
+	if c.MaxBodyBytes == nil {
+		c.MaxBodyBytes = parent.MaxBodyBytes
+	}
+	return c
+}
+
+// Policy собирает доменную политику повторов
+func (c RetryConfig) Policy() retry.Policy {
+	policy := retry.Policy{
+		MaxAttempts:          c.MaxAttempts,
+		StatusCodes:          c.StatusCodes,
+		AvoidPreviousBackend: c.AvoidPreviousBackend != nil && *c.AvoidPreviousBackend,
+	}
+	if policy.MaxAttempts == 0 {
+		policy.MaxAttempts = 1
+	}
+	if c.PerTryTimeout != nil {
+		policy.PerTryTimeout = *c.PerTryTimeout
+	}
+	if c.Backoff != nil {
+		policy.Backoff = retry.Backoff{Base: c.Backoff.Base, Max: c.Backoff.Max, Jitter: c.Backoff.Jitter}
+	}
+	if c.MaxBodyBytes != nil {
+		policy.MaxBodyBytes = *c.MaxBodyBytes
+	}
+	for _, cond := range c.RetryOn {
+		parsed, _ := retry.ParseCondition(cond) // условия проверены в validate
+		policy.RetryOn = append(policy.RetryOn, parsed)
+	}
+	return policy
+}
+
+// PoolRetryPolicy возвращает итоговую политику пула с учетом наследования от корневой секции retry
+// nil, если у пула нет своей политики
+func (c *Config) PoolRetryPolicy(name string) *retry.Policy {
+	pool, ok := c.Pools[name]
+	if !ok || pool.Retry == nil {
+		return nil
+	}
+	policy := pool.Retry.inherit(c.Retry).Policy()
+	return &policy
+}
+
+// RouteRetryPolicy возвращает итоговую политику маршрута: маршрут, затем пул, затем корневая секция
+// nil, если у маршрута нет своей политики
+func (c *Config) RouteRetryPolicy(route RouteConfig) *retry.Policy {
+	if route.Retry == nil {
+		return nil
+	}
+	parent := c.Retry
+	if pool, ok := c.Pools[route.Pool]; ok && pool.Retry != nil {
+		parent = pool.Retry.inherit(c.Retry)
+	}
+	policy := route.Retry.inherit(parent).Policy()
+	return &policy
+}
+
+// RouteUpgradePolicy возвращает таймауты переключенных соединений маршрута с учетом корневой секции upgrade
+// nil, если у маршрута нет своей секции
+func (c *Config) RouteUpgradePolicy(route RouteConfig) *routing.UpgradePolicy {
+	if route.Upgrade == nil {
+		return nil
+	}
+	merged := *route.Upgrade
+	if merged.IdleTimeout == 0 {
+		merged.IdleTimeout = c.Upgrade.IdleTimeout
+	}
+	if merged.MaxLifetime == 0 {
+		merged.MaxLifetime = c.Upgrade.MaxLifetime
+	}
+	policy := merged.Policy()
+	return &policy
+}
+
+// BackendTLS возвращает настройки TLS бэкенда: собственные, затем пула (poolTLS), nil - по умолчанию
+func (c *Config) BackendTLS(backend string, poolTLS *UpstreamTLSConfig) *UpstreamTLSConfig {
+	if backendTLS, ok := c.Proxy.BackendTLS[backend]; ok {
+		return &backendTLS
+	}
+	return poolTLS
+}
+
+// validateProtocol проверяет протокол соединения с бэкендами
+func validateProtocol(section, protocol string) error {
+	switch protocol {
+	case "", "auto", "http1", "http2", "h2c":
+		return nil
+	default:
+		return fmt.Errorf("%s: неподдерживаемый протокол %s. Допустимые значения: auto, http1, http2, h2c", section, protocol)
+	}
+}
+
+// validateSendProxyProtocol проверяет версию заголовка PROXY для бэкендов
+// заголовок описывает одного клиента на соединение, а HTTP/2 смешивает в нем запросы разных клиентов
+func validateSendProxyProtocol(section, protocol, version string) error {
+	switch version {
+	case "":
+		return nil
+	case "v1", "v2":
+	default:
+		return fmt.Errorf("%s.sendProxyProtocol: неподдерживаемая версия %s. Допустимые значения: v1, v2", section, version)
+	}
+	if protocol == "http2" || protocol == "h2c" {
+		return fmt.Errorf("%s.sendProxyProtocol несовместим с протоколом %s", section, protocol)
+	}
+	return nil
+}
+
+func (c *Config) validatePools() error {
+	for name, pool := range c.Pools {
+		if name == "" || name == routing.DefaultPool {
+			return fmt.Errorf("недопустимое имя пула %q: имя %q зарезервировано за корневым списком backends", name, routing.DefaultPool)
+		}
+		if len(pool.Backends) == 0 {
+			return fmt.Errorf("в пуле %s не указаны бэкенды", name)
+		}
+		pool.Strategy = strings.ToLower(pool.Strategy)
+		if pool.Strategy == "" {
+			pool.Strategy = c.LoadBalancer.Strategy
+		}
+		switch pool.Strategy {
+		case StrategyRoundRobin, StrategyLeastConnections, StrategyRandom:
+		default:
+			return fmt.Errorf("неподдерживаемая стратегия балансировки пула %s: %s", name, pool.Strategy)
+		}
+		if pool.Protocol == "" {
+			pool.Protocol = c.Proxy.Protocol
+		}
+		if err := validateProtocol("pools."+name+".protocol", pool.Protocol); err != nil {
+			return err
+		}
+		if pool.SendProxyProtocol == "" {
+			pool.SendProxyProtocol = c.Proxy.SendProxyProtocol
+		}
+		if err := validateSendProxyProtocol("pools."+name, pool.Protocol, pool.SendProxyProtocol); err != nil {
+			return err
+		}
+		if pool.TLS == nil {
+			pool.TLS = c.Proxy.TLS
+		} else if err := pool.TLS.validate("pools." + name + ".tls"); err != nil {
+			return err
+		}
+		if pool.Retry != nil {
+			if err := pool.Retry.validate("pools." + name + ".retry"); err != nil {
+				return err
+			}
+		}
+		if pool.Headers != nil {
+			if _, err := pool.Headers.Rules(); err != nil {
+				return fmt.Errorf("pools.%s.headers: %w", name, err)
+			}
+		}
+		c.Pools[name] = pool
+	}
+	return c.validateSharedBackends()
+}
+
+// upstreamSettings параметры соединения с бэкендом, которые прокси хранит по его URL
+type upstreamSettings struct {
+	protocol          string
+	sendProxyProtocol string
+	tls               UpstreamTLSConfig
+}
+
+// validateSharedBackends запрещает бэкенду из нескольких пулов разные параметры соединения:
+// транспорт выбирается по URL бэкенда, и иначе молча действовали бы настройки последнего пула
+func (c *Config) validateSharedBackends() error {
+	owners := make(map[string]string)
+	seen := make(map[string]upstreamSettings)
+	check := func(pool string, backends []string, protocol, sendProxyProtocol string, poolTLS *UpstreamTLSConfig) error {
+		for _, backend := range backends {
+			settings := upstreamSettings{protocol: protocol, sendProxyProtocol: sendProxyProtocol}
+			if settings.protocol == "" {
+				settings.protocol = "auto"
+			}
+			if tls := c.BackendTLS(backend, poolTLS); tls != nil {
+				settings.tls = *tls
+			}
+			if prev, ok := seen[backend]; ok && prev != settings {
+				return fmt.Errorf("бэкенд %s входит в пулы %s и %s с разными protocol, sendProxyProtocol или tls: параметры соединения задаются на бэкенд, а не на пул", backend, owners[backend], pool)
+			} else if !ok {
+				seen[backend] = settings
+				owners[backend] = pool
+			}
+		}
+		return nil
+	}
+
+	if err := check(routing.DefaultPool, c.Backends, c.Proxy.Protocol, c.Proxy.SendProxyProtocol, c.Proxy.TLS); err != nil {
+		return err
+	}
+	names := make([]string, 0, len(c.Pools))
+	for name := range c.Pools {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		pool := c.Pools[name]
+		if err := check(name, pool.Backends, pool.Protocol, pool.SendProxyProtocol, pool.TLS); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Config) validateRoutes() error {
+	names := make(map[string]bool)
+	for i := range c.Routes {
+		route := &c.Routes[i]
+		if route.Name == "" {
+			return fmt.Errorf("у маршрута #%d не указано имя ('name')", i)
+		}
+		if names[route.Name] {
+			return fmt.Errorf("дублирующееся имя маршрута: %s", route.Name)
+		}
+		names[route.Name] = true
+
+		if route.GRPC != nil {
+			if err := route.GRPC.apply(route); err != nil {
+				return fmt.Errorf("routes.%s.grpc: %w", route.Name, err)
+			}
+		}
+		if !strings.HasPrefix(route.PathPrefix, "/") {
+			return fmt.Errorf("pathPrefix маршрута %s должен начинаться с '/'", route.Name)
+		}
+		if route.Pool == "" {
+			route.Pool = routing.DefaultPool
+		}
+		if _, ok := c.Pools[route.Pool]; !ok && route.Pool != routing.DefaultPool {
+			return fmt.Errorf("маршрут %s ссылается на неизвестный пул %s", route.Name, route.Pool)
+		}
+		if route.Retry != nil {
+			if err := route.Retry.validate("routes." + route.Name + ".retry"); err != nil {
+				return err
+			}
+		}
+		if route.Headers != nil {
+			if _, err := route.Headers.Rules(); err != nil {
+				return fmt.Errorf("routes.%s.headers: %w", route.Name, err)
+			}
+		}
+		if route.Rewrite != nil {
+			if _, err := route.Rewrite.Rewrite(); err != nil {
+				return fmt.Errorf("routes.%s.rewrite: %w", route.Name, err)
+			}
+		}
+		if route.Split != nil {
+			if _, err := route.Split.Split(); err != nil {
+				return fmt.Errorf("routes.%s.split: %w", route.Name, err)
+			}
+			for _, g := range route.Split.Groups {
+				if _, ok := c.Pools[g.Pool]; !ok && g.Pool != routing.DefaultPool {
+					return fmt.Errorf("routes.%s.split: группа %s ссылается на неизвестный пул %s", route.Name, g.Name, g.Pool)
+				}
+			}
+		}
+		if route.Fault != nil {
+			if _, err := clientip.NewResolver(route.Fault.TrustedSources); err != nil {
+				return fmt.Errorf("routes.%s.fault.trustedSources: %w", route.Name, err)
+			}
+			if err := route.Fault.Policy().Validate(); err != nil {
+				return fmt.Errorf("routes.%s.fault.%w", route.Name, err)
+			}
+		}
+		if route.Mirror != nil {
+			if _, ok := c.Pools[route.Mirror.Pool]; !ok && route.Mirror.Pool != routing.DefaultPool {
+				return fmt.Errorf("routes.%s.mirror ссылается на неизвестный пул %q", route.Name, route.Mirror.Pool)
+			}
+			if route.Mirror.Pool == route.Pool {
+				return fmt.Errorf("routes.%s.mirror: теневой пул должен отличаться от основного", route.Name)
+			}
+			if route.Mirror.Percent < 0 || route.Mirror.Percent > 100 {
+				return fmt.Errorf("routes.%s.mirror.percent должен быть в диапазоне 0-100", route.Name)
+			}
+			if route.Mirror.MaxBodyBytes < 0 || route.Mirror.Timeout < 0 {
+				return fmt.Errorf("routes.%s.mirror: maxBodyBytes и timeout не могут быть отрицательными", route.Name)
+			}
+			if route.Mirror.MaxBodyBytes == 0 {
+				route.Mirror.MaxBodyBytes = 1 << 20
+			}
+		}
+		if route.Timeouts != nil {
+			if err := route.Timeouts.validate("routes." + route.Name + ".timeouts"); err != nil {
+				return err
+			}
+		}
+		if route.Streaming != nil && (route.Streaming.FlushInterval < 0 || route.Streaming.IdleTimeout < 0) {
+			return fmt.Errorf("routes.%s.streaming: flushInterval и idleTimeout не могут быть отрицательными", route.Name)
+		}
+		if route.Upgrade != nil && (route.Upgrade.IdleTimeout < 0 || route.Upgrade.MaxLifetime < 0) {
+			return fmt.Errorf("таймауты в секции routes.%s.upgrade не могут быть отрицательными", route.Name)
+		}
+		if route.Hedge != nil {
+			if route.Hedge.Delay <= 0 {
+				return fmt.Errorf("routes.%s.hedge.delay должен быть положительным значением", route.Name)
+			}
+			if route.Hedge.Percentile < 0 || route.Hedge.Percentile > 1 {
+				return fmt.Errorf("routes.%s.hedge.percentile должен быть в диапазоне 0..1", route.Name)
+			}
+			if route.Hedge.MinSamples < 0 {
+				return fmt.Errorf("routes.%s.hedge.minSamples не может быть отрицательным", route.Name)
+			}
+		}
+	}
+	return nil
+}
+
+// httpPools возвращает пулы, в которые идут HTTP запросы: пул по умолчанию и пулы маршрутов
+func (c *Config) httpPools() map[string]bool {
+	pools := map[string]bool{routing.DefaultPool: true}
+	for _, route := range c.Routes {
+		pools[route.Pool] = true
+		if route.Split != nil {
+			for _, g := range route.Split.Groups {
+				pools[g.Pool] = true
+			}
+		}
+		if route.Mirror != nil {
+			pools[route.Mirror.Pool] = true
+		}
+	}
+	return pools
+}
+
+// apply проверяет секцию grpc маршрута и выводит pathPrefix из service и method
+func (c *GRPCConfig) apply(route *RouteConfig) error {
+	if c.Service != "" {
+		if route.PathPrefix != "" {
+			return fmt.Errorf("service и pathPrefix маршрута нельзя задавать вместе")
+		}
+		route.PathPrefix = "/" + c.Service + "/" + c.Method
+	} else if c.Method != "" {
+		return fmt.Errorf("method задан без service")
+	}
+	for _, name := range c.RetryOn {
+		if _, err := grpc.ParseCode(name); err != nil {
+			return fmt.Errorf("retryOn: %w", err)
+		}
+	}
+	for _, method := range c.Idempotent {
+		if !strings.HasPrefix(method, "/") {
+			return fmt.Errorf("idempotent: метод %s должен начинаться с '/'", method)
+		}
+	}
+	return nil
+}
+
+// validateTCP проверяет слушатели режима TCP
+// пул слушателя проверяется установкой соединения, поэтому его не могут использовать HTTP маршруты
+func (c *Config) validateTCP() error {
+	names := make(map[string]bool)
+	httpPools := c.httpPools()
+	for i := range c.TCP.Listeners {
+		listener := &c.TCP.Listeners[i]
+		if listener.Name == "" {
+			return fmt.Errorf("у TCP слушателя #%d не указано имя ('name')", i)
+		}
+		if names[listener.Name] {
+			return fmt.Errorf("дублирующееся имя TCP слушателя: %s", listener.Name)
+		}
+		names[listener.Name] = true
+
+		section := "tcp.listeners." + listener.Name
+		if listener.ListenAddress == "" {
+			return fmt.Errorf("%s: не указан адрес для прослушивания ('listenAddress')", section)
+		}
+		if listener.ListenAddress == c.ListenAddress {
+			return fmt.Errorf("%s: адрес %s уже занят HTTP слушателем", section, listener.ListenAddress)
+		}
+		if _, ok := c.Pools[listener.Pool]; !ok {
+			return fmt.Errorf("%s ссылается на неизвестный пул %q", section, listener.Pool)
+		}
+		if httpPools[listener.Pool] {
+			return fmt.Errorf("%s: пул %s уже используется HTTP маршрутами", section, listener.Pool)
+		}
+		if listener.ConnectTimeout < 0 || listener.IdleTimeout < 0 || listener.MaxLifetime < 0 {
+			return fmt.Errorf("таймауты в секции %s не могут быть отрицательными", section)
+		}
+		if listener.ConnectAttempts < 0 {
+			return fmt.Errorf("%s.connectAttempts не может быть отрицательным", section)
+		}
+		if listener.ConnectAttempts == 0 {
+			listener.ConnectAttempts = 2
+		}
+		if listener.ConnectTimeout == 0 {
+			listener.ConnectTimeout = c.Proxy.DialTimeout
+		}
+	}
+	return nil
+}
+
+// TCPPools возвращает имена пулов, на которые ссылаются TCP слушатели
+func (c *Config) TCPPools() map[string]bool {
+	pools := make(map[string]bool, len(c.TCP.Listeners))
+	for _, listener := range c.TCP.Listeners {
+		pools[listener.Pool] = true
+	}
+	return pools
+}
+
+// validateUDP проверяет слушатели режима UDP
+// у каждого пула своя проба здоровья, поэтому пул принадлежит одному UDP слушателю
+func (c *Config) validateUDP() error {
+	names := make(map[string]bool)
+	usedPools := c.httpPools()
+	for pool := range c.TCPPools() {
+		usedPools[pool] = true
+	}
+	for i := range c.UDP.Listeners {
+		listener := &c.UDP.Listeners[i]
+		if listener.Name == "" {
+			return fmt.Errorf("у UDP слушателя #%d не указано имя ('name')", i)
+		}
+		if names[listener.Name] {
+			return fmt.Errorf("дублирующееся имя UDP слушателя: %s", listener.Name)
+		}
+		names[listener.Name] = true
+
+		section := "udp.listeners." + listener.Name
+		if listener.ListenAddress == "" {
+			return fmt.Errorf("%s: не указан адрес для прослушивания ('listenAddress')", section)
+		}
+		if _, ok := c.Pools[listener.Pool]; !ok {
+			return fmt.Errorf("%s ссылается на неизвестный пул %q", section, listener.Pool)
+		}
+		if usedPools[listener.Pool] {
+			return fmt.Errorf("%s: пул %s уже используется другим слушателем или маршрутом", section, listener.Pool)
+		}
+		usedPools[listener.Pool] = true
+		if listener.SessionIdleTimeout < 0 || listener.MaxSessions < 0 {
+			return fmt.Errorf("%s: sessionIdleTimeout и maxSessions не могут быть отрицательными", section)
+		}
+		switch listener.Probe.Type {
+		case "":
+			listener.Probe.Type = "payload"
+		case "payload", "dns":
+		default:
+			return fmt.Errorf("%s.probe: неподдерживаемый тип %s. Допустимые значения: payload, dns", section, listener.Probe.Type)
+		}
+	}
+	return nil
+}
+
+// UDPProbes возвращает пробы здоровья пулов UDP слушателей, ключ: имя пула
+func (c *Config) UDPProbes() map[string]UDPProbeConfig {
+	probes := make(map[string]UDPProbeConfig, len(c.UDP.Listeners))
+	for _, listener := range c.UDP.Listeners {
+		probes[listener.Pool] = listener.Probe
+	}
+	return probes
+}
@@ -0,0 +1,377 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"github.com/athebyme/cloud-ru-assign/internal/core/domain/balancer"
+	"github.com/athebyme/cloud-ru-assign/internal/core/domain/cache"
+	"github.com/athebyme/cloud-ru-assign/internal/core/domain/routing"
+	"github.com/athebyme/cloud-ru-assign/internal/core/ports"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// cacheVariantSeparator отделяет ключ ответа от значений заголовков Vary в ключе варианта
+	cacheVariantSeparator = "\x00"
+	// cacheRevalidateTimeout ограничивает фоновую проверку устаревшего ответа
+	cacheRevalidateTimeout = 30 * time.Second
+)
+
+// CachingForwarder кеширует ответы бэкендов перед форвардером
+// свежий ответ отдается без обращения к бэкенду, устаревший с валидаторами проверяется условным запросом,
+// в окне stale-while-revalidate устаревший ответ отдается сразу, а проверка идет в фоне
+type CachingForwarder struct {
+	next          ports.Forwarder
+	store         ports.ResponseCache
+	logger        ports.Logger
+	maxEntryBytes int64 // ответы больше лимита проходят мимо кеша
+
+	mu           sync.Mutex
+	revalidating map[string]struct{} // ключи с идущей фоновой проверкой
+
+	hits   atomic.Uint64
+	misses atomic.Uint64
+}
+
+// NewCachingForwarder создает кеширующую обертку над форвардером
+func NewCachingForwarder(next ports.Forwarder, store ports.ResponseCache, logger ports.Logger, maxEntryBytes int64) *CachingForwarder {
+	return &CachingForwarder{
+		next:          next,
+		store:         store,
+		logger:        logger.With("component", "ResponseCache"),
+		maxEntryBytes: maxEntryBytes,
+		revalidating:  make(map[string]struct{}),
+	}
+}
+
+// CacheKey ключ ответа в кеше: хост и URI запроса клиента
+// по этому же ключу ответ удаляется через Purge вместе с вариантами по Vary и группам разделения трафика
+func CacheKey(r *http.Request) string {
+	return r.Host + r.URL.RequestURI()
+}
+
+// entryKey ключ, под которым хранится ответ на запрос
+// у маршрута с разделением трафика группы отвечают разными пулами, поэтому их ответы хранятся раздельно:
+// иначе запрос, закрепленный за канареечной группой, получал бы ответ стабильной и наоборот
+func entryKey(r *http.Request) string {
+	key := CacheKey(r)
+	if route, group := routing.SplitGroupFrom(r.Context()); group != "" {
+		key += cacheVariantSeparator + "split:" + route + "/" + group
+	}
+	return key
+}
+
+// Forward реализует ports.Forwarder
+func (c *CachingForwarder) Forward(w http.ResponseWriter, r *http.Request, target *balancer.Backend) error {
+	if balancer.IsUpgrade(r) {
+		return c.next.Forward(w, r, target)
+	}
+	key := entryKey(r)
+	if !cache.Cacheable(r) {
+		if isSafeMethod(r.Method) {
+			return c.next.Forward(w, r, target)
+		}
+		// изменяющий запрос делает сохраненный ответ по тому же адресу неактуальным
+		rec := newCacheRecorder(w, nil, false)
+		err := c.next.Forward(rec, r, target)
+		if err == nil && rec.status < http.StatusBadRequest {
+			c.Purge(CacheKey(r))
+		}
+		return err
+	}
+
+	now := time.Now()
+	entry, storeKey := c.lookup(key, r)
+	if entry != nil && !cache.WantsRevalidation(r) {
+		if entry.Fresh(now) {
+			c.hits.Add(1)
+			c.serve(w, r, entry, now)
+			return nil
+		}
+		if entry.StaleWhileRevalidate(now) {
+			c.hits.Add(1)
+			c.revalidateInBackground(storeKey, r, target, entry)
+			c.serve(w, r, entry, now)
+			return nil
+		}
+	}
+
+	// условный запрос к бэкенду, если ответ устарел, но его можно подтвердить
+	// собственные условия клиента не подменяем: его 304 нужен ему самому
+	var stale *cache.Entry
+	req := r
+	if entry != nil && entry.HasValidators() && !hasConditionals(r) {
+		stale = entry
+		req = r.Clone(r.Context())
+		setValidators(req, entry)
+	}
+
+	var capture *bytes.Buffer
+	if r.Method == http.MethodGet {
+		capture = &bytes.Buffer{}
+	}
+	rec := newCacheRecorder(w, capture, stale != nil)
+	rec.maxBytes = c.maxEntryBytes
+	if err := c.next.Forward(rec, req, target); err != nil {
+		return err
+	}
+
+	if rec.notModified {
+		c.hits.Add(1)
+		served := stale
+		if refreshed, ok := stale.Refreshed(rec.header, time.Now()); ok {
+			c.store.Set(storeKey, refreshed)
+			served = refreshed
+		}
+		c.serve(w, r, served, time.Now())
+		return nil
+	}
+	c.misses.Add(1)
+	if capture != nil && !rec.truncated {
+		c.storeResponse(key, r, rec.status, rec.sentHeader, capture.Bytes(), time.Now())
+	}
+	return nil
+}
+
+// Purge реализует ports.CacheService
+func (c *CachingForwarder) Purge(key string) int {
+	removed := c.store.DeletePrefix(key + cacheVariantSeparator)
+	if c.store.Delete(key) {
+		removed++
+	}
+	if removed > 0 {
+		c.logger.Info("ответ удален из кеша", "key", key, "entries", removed)
+	}
+	return removed
+}
+
+// PurgePrefix реализует ports.CacheService
+func (c *CachingForwarder) PurgePrefix(prefix string) int {
+	removed := c.store.DeletePrefix(prefix)
+	c.logger.Info("ответы удалены из кеша по префиксу", "prefix", prefix, "entries", removed)
+	return removed
+}
+
+// Stats реализует ports.CacheService
+func (c *CachingForwarder) Stats() cache.Stats {
+	return cache.Stats{
+		Entries: c.store.Len(),
+		Bytes:   c.store.Size(),
+		Hits:    c.hits.Load(),
+		Misses:  c.misses.Load(),
+	}
+}
+
+// lookup находит ответ по ключу с учетом Vary
+// возвращает и ключ, под которым лежит (или должен лежать) вариант для этого запроса
+func (c *CachingForwarder) lookup(key string, r *http.Request) (*cache.Entry, string) {
+	entry, ok := c.store.Get(key)
+	if !ok {
+		return nil, key
+	}
+	if len(entry.Vary) == 0 {
+		return entry, key
+	}
+	variantKey := key + cacheVariantSeparator + cache.VaryKey(entry.Vary, r)
+	variant, ok := c.store.Get(variantKey)
+	if !ok {
+		return nil, variantKey
+	}
+	return variant, variantKey
+}
+
+// storeResponse сохраняет ответ, если его заголовки это разрешают
+// для ответа с Vary по основному ключу кладется маркер, а сам ответ - по ключу варианта
+func (c *CachingForwarder) storeResponse(key string, r *http.Request, status int, header http.Header, body []byte, now time.Time) {
+	fresh, swr, ok := cache.Lifetime(status, header, now)
+	if !ok {
+		return
+	}
+	entry := &cache.Entry{
+		Status:     status,
+		Header:     header.Clone(),
+		Body:       bytes.Clone(body),
+		StoredAt:   now,
+		FreshUntil: now.Add(fresh),
+		StaleUntil: now.Add(fresh + swr),
+	}
+	storeKey := key
+	if vary := cache.VaryHeaders(header); len(vary) > 0 {
+		c.store.Set(key, &cache.Entry{Vary: vary, StoredAt: now})
+		storeKey = key + cacheVariantSeparator + cache.VaryKey(vary, r)
+	}
+	c.store.Set(storeKey, entry)
+	c.logger.Debug("ответ сохранен в кеш", "key", key, "status", status, "fresh_for", fresh, "bytes", len(body))
+}
+
+// serve отдает сохраненный ответ, на совпавший условный запрос клиента - 304 без тела
+func (c *CachingForwarder) serve(w http.ResponseWriter, r *http.Request, entry *cache.Entry, now time.Time) {
+	h := w.Header()
+	for k, v := range entry.Header {
+		h[k] = v
+	}
+	h.Set("Age", strconv.FormatInt(entry.Age(now), 10))
+	h.Set("X-Cache", "HIT")
+	if entry.NotModified(r) {
+		h.Del("Content-Length")
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.WriteHeader(entry.Status)
+	_, _ = w.Write(entry.Body)
+}
+
+// revalidateInBackground обновляет устаревший ответ, не задерживая клиента
+// на один ключ одновременно идет не больше одной проверки
+func (c *CachingForwarder) revalidateInBackground(storeKey string, r *http.Request, target *balancer.Backend, entry *cache.Entry) {
+	c.mu.Lock()
+	if _, busy := c.revalidating[storeKey]; busy {
+		c.mu.Unlock()
+		return
+	}
+	c.revalidating[storeKey] = struct{}{}
+	c.mu.Unlock()
+
+	// клиент получит ответ раньше, чем закончится проверка, поэтому его отмена проверку не прерывает
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), cacheRevalidateTimeout)
+	req := r.Clone(ctx)
+	req.Method = http.MethodGet
+	for _, name := range []string{"If-None-Match", "If-Modified-Since", "Cache-Control", "Pragma"} {
+		req.Header.Del(name)
+	}
+	if entry.HasValidators() {
+		setValidators(req, entry)
+	}
+
+	go func() {
+		defer cancel()
+		defer func() {
+			c.mu.Lock()
+			delete(c.revalidating, storeKey)
+			c.mu.Unlock()
+		}()
+
+		resp := newBufferedResponse(nil)
+		if err := c.next.Forward(resp, req, target); err != nil {
+			c.logger.Warn("фоновая проверка устаревшего ответа не удалась", "key", storeKey, "error", err)
+			return
+		}
+		now := time.Now()
+		if resp.Status() == http.StatusNotModified {
+			if refreshed, ok := entry.Refreshed(resp.header, now); ok {
+				c.store.Set(storeKey, refreshed)
+			}
+			return
+		}
+		header := resp.sentHeader
+		if header == nil {
+			header = resp.header
+		}
+		c.storeResponse(CacheKey(r), req, resp.Status(), header, resp.body.Bytes(), now)
+	}()
+}
+
+// isSafeMethod сообщает, что метод не меняет состояние на бэкенде
+func isSafeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	}
+	return false
+}
+
+// hasConditionals сообщает, что клиент сам прислал условия запроса
+func hasConditionals(r *http.Request) bool {
+	return r.Header.Get("If-None-Match") != "" || r.Header.Get("If-Modified-Since") != ""
+}
+
+// setValidators добавляет к запросу условия по валидаторам сохраненного ответа
+func setValidators(r *http.Request, entry *cache.Entry) {
+	if etag := entry.Header.Get("ETag"); etag != "" {
+		r.Header.Set("If-None-Match", etag)
+	}
+	if lastModified := entry.Header.Get("Last-Modified"); lastModified != "" {
+		r.Header.Set("If-Modified-Since", lastModified)
+	}
+}
+
+// cacheRecorder передает ответ клиенту и одновременно копирует тело для кеша
+// при проверке устаревшего ответа 304 бэкенда перехватывается: клиенту уходит сохраненный ответ
+type cacheRecorder struct {
+	dst        http.ResponseWriter
+	header     http.Header
+	sentHeader http.Header // заголовки на момент WriteHeader
+	committed  bool
+	status     int
+
+	revalidating bool
+	notModified  bool
+
+	capture   *bytes.Buffer // nil - тело не копируется
+	maxBytes  int64         // 0 - без ограничения
+	truncated bool          // тело не поместилось в лимит и не будет сохранено
+}
+
+func newCacheRecorder(dst http.ResponseWriter, capture *bytes.Buffer, revalidating bool) *cacheRecorder {
+	return &cacheRecorder{dst: dst, header: make(http.Header), capture: capture, revalidating: revalidating}
+}
+
+// Header до WriteHeader возвращает собственные заголовки, после - заголовки клиента (нужно для трейлеров)
+func (cr *cacheRecorder) Header() http.Header {
+	if cr.committed {
+		return cr.dst.Header()
+	}
+	return cr.header
+}
+
+func (cr *cacheRecorder) WriteHeader(code int) {
+	if cr.status != 0 {
+		return
+	}
+	cr.status = code
+	cr.sentHeader = cr.header.Clone()
+	if cr.revalidating && code == http.StatusNotModified {
+		cr.notModified = true
+		return
+	}
+
+	cr.committed = true
+	dst := cr.dst.Header()
+	for k, v := range cr.header {
+		dst[k] = v
+	}
+	dst.Set("X-Cache", "MISS")
+	cr.dst.WriteHeader(code)
+}
+
+func (cr *cacheRecorder) Write(p []byte) (int, error) {
+	if cr.status == 0 {
+		cr.WriteHeader(http.StatusOK)
+	}
+	if cr.notModified {
+		return len(p), nil
+	}
+	if cr.capture != nil && !cr.truncated {
+		if cr.maxBytes > 0 && int64(cr.capture.Len()+len(p)) > cr.maxBytes {
+			cr.truncated = true
+			cr.capture.Reset()
+		} else {
+			cr.capture.Write(p)
+		}
+	}
+	return cr.dst.Write(p)
+}
+
+// Unwrap дает http.ResponseController доступ к Flush исходного writer'а
+func (cr *cacheRecorder) Unwrap() http.ResponseWriter {
+	return cr.dst
+}
+
+var (
+	_ ports.Forwarder    = (*CachingForwarder)(nil)
+	_ ports.CacheService = (*CachingForwarder)(nil)
+)
@@ -0,0 +1,95 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/athebyme/cloud-ru-assign/internal/core/domain/balancer"
+	"github.com/athebyme/cloud-ru-assign/internal/core/domain/fault"
+	"github.com/athebyme/cloud-ru-assign/internal/core/ports"
+	"net/http"
+	"time"
+)
+
+// FaultInjectingForwarder вносит задержку и ограничение скорости из плана сбоев перед отправкой запроса форвардеру
+// план выбирает сервис и передает в контексте запроса, запросы без него проходят без изменений
+// прерывания сервис отвечает сам, до обращения к форвардеру
+type FaultInjectingForwarder struct {
+	next   ports.Forwarder
+	logger ports.Logger
+}
+
+// NewFaultInjectingForwarder создает обертку над форвардером, вносящую сбои
+func NewFaultInjectingForwarder(next ports.Forwarder, logger ports.Logger) *FaultInjectingForwarder {
+	return &FaultInjectingForwarder{
+		next:   next,
+		logger: logger.With("component", "FaultInjection"),
+	}
+}
+
+// Forward реализует ports.Forwarder
+func (f *FaultInjectingForwarder) Forward(w http.ResponseWriter, r *http.Request, target *balancer.Backend) error {
+	plan := fault.PlanFrom(r.Context())
+	if plan.Delay == 0 && plan.BytesPerSecond == 0 {
+		return f.next.Forward(w, r, target)
+	}
+	f.logger.Debug("в запрос внесен сбой",
+		"uri", r.RequestURI,
+		"delay", plan.Delay,
+		"bytes_per_second", plan.BytesPerSecond,
+	)
+
+	if plan.Delay > 0 && !sleepContext(r.Context(), plan.Delay) {
+		// отмена во время задержки выглядит так же, как отмена во время ожидания бэкенда,
+		// но ErrInjected не дает сервису счесть бэкенд недоступным
+		kind := balancer.ForwardErrorCanceled
+		if errors.Is(r.Context().Err(), context.DeadlineExceeded) {
+			kind = balancer.ForwardErrorTimeout
+		}
+		return &balancer.ForwardError{Kind: kind, Err: fmt.Errorf("%w: задержка прервана: %w", fault.ErrInjected, r.Context().Err())}
+	}
+	if plan.BytesPerSecond > 0 {
+		w = &throttledWriter{ResponseWriter: w, ctx: r.Context(), bytesPerSecond: plan.BytesPerSecond}
+	}
+	return f.next.Forward(w, r, target)
+}
+
+// throttleTick как часто throttledWriter отдает очередную порцию тела
+const throttleTick = 100 * time.Millisecond
+
+// throttledWriter отдает тело ответа клиенту не быстрее bytesPerSecond
+// каждая порция сбрасывается сразу, иначе буфер сервера сгладил бы ограничение
+type throttledWriter struct {
+	http.ResponseWriter
+	ctx            context.Context
+	bytesPerSecond int64
+}
+
+func (tw *throttledWriter) Write(p []byte) (int, error) {
+	chunk := int(tw.bytesPerSecond * int64(throttleTick) / int64(time.Second))
+	if chunk < 1 {
+		chunk = 1
+	}
+	written := 0
+	for written < len(p) {
+		end := min(written+chunk, len(p))
+		n, err := tw.ResponseWriter.Write(p[written:end])
+		written += n
+		if err != nil {
+			return written, err
+		}
+		_ = http.NewResponseController(tw.ResponseWriter).Flush()
+		pause := time.Duration(int64(n) * int64(time.Second) / tw.bytesPerSecond)
+		if !sleepContext(tw.ctx, pause) {
+			return written, tw.ctx.Err()
+		}
+	}
+	return written, nil
+}
+
+// Unwrap дает http.ResponseController доступ к исходному writer'у
+func (tw *throttledWriter) Unwrap() http.ResponseWriter {
+	return tw.ResponseWriter
+}
+
+var _ ports.Forwarder = (*FaultInjectingForwarder)(nil)
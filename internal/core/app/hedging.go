@@ -0,0 +1,219 @@
+package app
+
+import (
+	"context"
+	"github.com/athebyme/cloud-ru-assign/internal/core/domain/balancer"
+	"github.com/athebyme/cloud-ru-assign/internal/core/domain/retry"
+	"github.com/athebyme/cloud-ru-assign/internal/core/ports"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// latencyWindowSize сколько последних задержек маршрута хранится для расчета перцентиля
+const latencyWindowSize = 256
+
+// latencyWindow кольцевой буфер недавних задержек успешных ответов маршрута
+type latencyWindow struct {
+	mu      sync.Mutex
+	samples [latencyWindowSize]time.Duration
+	next    int
+	count   int
+}
+
+func (lw *latencyWindow) record(d time.Duration) {
+	lw.mu.Lock()
+	defer lw.mu.Unlock()
+	lw.samples[lw.next] = d
+	lw.next = (lw.next + 1) % latencyWindowSize
+	if lw.count < latencyWindowSize {
+		lw.count++
+	}
+}
+
+// percentile возвращает перцентиль p (0..1) и false, если замеров меньше minSamples
+func (lw *latencyWindow) percentile(p float64, minSamples int) (time.Duration, bool) {
+	lw.mu.Lock()
+	if lw.count == 0 || lw.count < minSamples {
+		lw.mu.Unlock()
+		return 0, false
+	}
+	sorted := make([]time.Duration, lw.count)
+	copy(sorted, lw.samples[:lw.count])
+	lw.mu.Unlock()
+
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	idx := int(p * float64(len(sorted)-1))
+	return sorted[idx], true
+}
+
+// hedgeResult итог одного из параллельных запросов
+type hedgeResult struct {
+	backend *balancer.Backend
+	resp    *bufferedResponse
+	err     error
+	latency time.Duration
+}
+
+// hedgeDelay возвращает задержку перед вторым запросом: перцентиль маршрута или фиксированную
+func hedgeDelay(hedge *retry.Hedge, window *latencyWindow) time.Duration {
+	if hedge.Percentile > 0 && window != nil {
+		if d, ok := window.percentile(hedge.Percentile, hedge.MinSamples); ok {
+			return d
+		}
+	}
+	return hedge.Delay
+}
+
+// hedgeOverflow запрос попытки, чей ответ не поместился в буфер, на передачу ответа клиенту напрямую
+type hedgeOverflow struct {
+	backend *balancer.Backend
+	grant   chan http.ResponseWriter // writer клиента или nil, если клиенту уже отдается другой ответ
+}
+
+// forwardHedged выполняет попытку с хеджированием
+// ответы буферизуются, клиенту уходит первый удачный, второй запрос отменяется
+// ответ больше maxHeldBodyBytes сразу становится победителем: он передается клиенту напрямую, а хеджирование прекращается
+// хеджирующий запрос расходует бюджет повторов, как и повторная попытка
+// возвращает бэкенд, чей результат принят, и ошибку, если не удались оба запроса
+func (s *loadBalancerService) forwardHedged(
+	w http.ResponseWriter,
+	r *http.Request,
+	primary *balancer.Backend,
+	pool *Pool,
+	body replayableBody,
+	policy *retry.Policy,
+	hedge *retry.Hedge,
+	window *latencyWindow,
+	logger ports.Logger,
+) (*balancer.Backend, error) {
+	ctx, cancelAll := context.WithCancel(r.Context())
+	defer cancelAll()
+
+	results := make(chan hedgeResult, 2)
+	overflows := make(chan hedgeOverflow)
+	cancels := make(map[*balancer.Backend]context.CancelFunc, 2)
+	launch := func(backend *balancer.Backend) {
+		attemptCtx, cancel := context.WithCancel(ctx)
+		if policy.PerTryTimeout > 0 {
+			attemptCtx, cancel = context.WithTimeout(ctx, policy.PerTryTimeout)
+		}
+		cancels[backend] = cancel
+
+		req := r.Clone(attemptCtx)
+		if body != nil {
+			body.rewind(req)
+		}
+		go func() {
+			start := time.Now()
+			resp := newBufferedResponse(func() http.ResponseWriter {
+				ov := hedgeOverflow{backend: backend, grant: make(chan http.ResponseWriter, 1)}
+				select {
+				case overflows <- ov:
+					return <-ov.grant
+				case <-ctx.Done():
+					return nil
+				}
+			})
+			err := s.forwarder.Forward(resp, req, backend)
+			results <- hedgeResult{backend: backend, resp: resp, err: err, latency: time.Since(start)}
+		}()
+	}
+
+	launch(primary)
+	inFlight := 1
+
+	timer := time.NewTimer(hedgeDelay(hedge, window))
+	defer timer.Stop()
+
+	var fallback *hedgeResult       // ответ с ошибочным статусом, если лучшего не будет
+	var streaming *balancer.Backend // попытка, чей ответ уже передается клиенту напрямую
+	var failed []*balancer.Backend  // бэкенды, упавшие с ошибкой транспорта
+	var lastErr error
+	lastBackend := primary
+	// упавшие бэкенды помечаем здесь, кроме того, чью ошибку вернем: его пометит цикл попыток
+	markFailed := func(except *balancer.Backend) {
+		for _, b := range failed {
+			if b != except {
+				pool.Repo.MarkBackendStatus(b.URL, false)
+			}
+		}
+	}
+	for inFlight > 0 {
+		select {
+		case <-timer.C:
+			if len(cancels) > 1 || streaming != nil {
+				continue
+			}
+			second, found := s.pickBackend(pool.Repo, map[string]struct{}{primary.URL.String(): {}})
+			if !found || second.URL.String() == primary.URL.String() {
+				logger.Debug("нет второго бэкенда для хеджирования")
+				continue
+			}
+			if s.retryBudget != nil && !s.retryBudget.TryRetry() {
+				logger.Warn("бюджет повторов исчерпан, хеджирующий запрос пропущен", "retries_skipped_total", s.retryBudget.Exhausted())
+				continue
+			}
+			logger.Info("первый бэкенд не ответил вовремя, отправлен хеджирующий запрос", "hedge_backend", second.URL.String())
+			launch(second)
+			inFlight++
+
+		case ov := <-overflows:
+			if streaming != nil {
+				ov.grant <- nil
+				continue
+			}
+			// большой ответ не придерживаем: он уходит клиенту, остальные попытки отменяются
+			logger.Debug("ответ не помещается в буфер хеджирования, передается клиенту напрямую", "backend_url", ov.backend.URL.String())
+			streaming = ov.backend
+			for b, cancel := range cancels {
+				if b != streaming {
+					cancel()
+				}
+			}
+			ov.grant <- w
+
+		case res := <-results:
+			inFlight--
+			cancels[res.backend]() // освобождаем контекст завершившейся попытки
+			if streaming != nil {
+				if res.backend != streaming {
+					continue // отмененная попытка, ее ошибка ничего не говорит о бэкенде
+				}
+				if res.err == nil && window != nil {
+					window.record(res.latency)
+				}
+				markFailed(nil)
+				return res.backend, res.err
+			}
+			if res.err == nil && !policy.RetriesStatus(res.resp.Status()) {
+				// победитель: отменяем второй запрос и отдаем ответ
+				cancelAll()
+				if window != nil {
+					window.record(res.latency)
+				}
+				markFailed(nil)
+				res.resp.writeTo(w)
+				return res.backend, nil
+			}
+
+			if res.err == nil {
+				fallback = &res
+				continue
+			}
+			if marksUnhealthy(res.err) {
+				failed = append(failed, res.backend)
+			}
+			lastErr, lastBackend = res.err, res.backend
+		}
+	}
+
+	if fallback != nil {
+		markFailed(nil)
+		fallback.resp.writeTo(w)
+		return fallback.backend, nil
+	}
+	markFailed(lastBackend)
+	return lastBackend, lastErr
+}
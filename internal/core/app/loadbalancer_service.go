@@ -1,35 +1,153 @@
 package app
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"github.com/athebyme/cloud-ru-assign/internal/core/domain/balancer"
+	"github.com/athebyme/cloud-ru-assign/internal/core/domain/fault"
+	"github.com/athebyme/cloud-ru-assign/internal/core/domain/grpc"
+	"github.com/athebyme/cloud-ru-assign/internal/core/domain/headers"
+	"github.com/athebyme/cloud-ru-assign/internal/core/domain/mirror"
+	"github.com/athebyme/cloud-ru-assign/internal/core/domain/problem"
+	"github.com/athebyme/cloud-ru-assign/internal/core/domain/reqctx"
+	"github.com/athebyme/cloud-ru-assign/internal/core/domain/retry"
+	"github.com/athebyme/cloud-ru-assign/internal/core/domain/routing"
 	"github.com/athebyme/cloud-ru-assign/internal/core/ports"
 	"net/http"
 	"time"
 )
 
-// serviceMaxRetries максимальное количество попыток отправить запрос разным бэкендам
-// можно вынести в yml конфиг
-const serviceMaxRetries = 3
+// Pool именованный пул бэкендов со своей политикой повторов
+type Pool struct {
+	Name  string
+	Repo  ports.BackendRepository
+	Retry *retry.Policy // nil - используется общая политика сервиса
+}
+
+// totalWriteSlack запас дедлайна записи сверх общего таймаута: за него клиент успевает получить 504
+const totalWriteSlack = time.Second
 
 // loadBalancerService реализует входящий порт LoadBalancerService
 // оркестрирует процесс обработки запроса
 type loadBalancerService struct {
-	repo      ports.BackendRepository
-	forwarder ports.Forwarder
-	logger    ports.Logger
+	pools       map[string]*Pool
+	routes      *routing.Table
+	forwarder   ports.Forwarder
+	logger      ports.Logger
+	retryPolicy retry.Policy
+	retryBudget *retry.Budget             // nil - повторы не ограничены бюджетом
+	latency     map[string]*latencyWindow // задержки маршрутов с хеджированием, ключ: имя маршрута
+	poolHeaders map[string]*headers.Rules // правила заголовков пулов, ключ: имя пула
+
+	upgradePolicy routing.UpgradePolicy // таймауты переключенных соединений для маршрутов без своей политики
+	upgrades      *UpgradeTracker
+	mirrorer      *Mirrorer
+	timeouts      routing.Timeouts // таймауты запросов к бэкендам для маршрутов без своих
+	errorRenderer *problem.Renderer
+}
+
+// ServiceOption настраивает loadBalancerService при создании
+type ServiceOption func(s *loadBalancerService)
+
+// WithRetryPolicy задает общую политику повторов для пулов и маршрутов без своей политики
+func WithRetryPolicy(policy retry.Policy) ServiceOption {
+	return func(s *loadBalancerService) {
+		s.retryPolicy = policy
+	}
+}
+
+// WithRetryBudget ограничивает повторы общим бюджетом, пропорциональным успешным запросам
+func WithRetryBudget(budget *retry.Budget) ServiceOption {
+	return func(s *loadBalancerService) {
+		s.retryBudget = budget
+	}
+}
+
+// WithPool регистрирует именованный пул бэкендов
+// для имени routing.DefaultPool заменяет пул, переданный в конструктор
+func WithPool(name string, repo ports.BackendRepository, policy *retry.Policy) ServiceOption {
+	return func(s *loadBalancerService) {
+		s.pools[name] = &Pool{Name: name, Repo: repo, Retry: policy}
+	}
+}
+
+// WithPoolHeaders задает правила заголовков для запросов в пул name
+// правила маршрута применяются после правил пула и могут их перекрыть
+func WithPoolHeaders(name string, rules *headers.Rules) ServiceOption {
+	return func(s *loadBalancerService) {
+		s.poolHeaders[name] = rules
+	}
+}
+
+// WithTimeouts задает общие таймауты запросов к бэкендам
+func WithTimeouts(timeouts routing.Timeouts) ServiceOption {
+	return func(s *loadBalancerService) {
+		s.timeouts = timeouts
+	}
+}
+
+// WithRoutes задает таблицу маршрутов, запросы без подходящего маршрута идут в пул по умолчанию
+func WithRoutes(table *routing.Table) ServiceOption {
+	return func(s *loadBalancerService) {
+		s.routes = table
+	}
+}
+
+// WithUpgradePolicy задает общие таймауты соединений после смены протокола (WebSocket и тд)
+func WithUpgradePolicy(policy routing.UpgradePolicy) ServiceOption {
+	return func(s *loadBalancerService) {
+		s.upgradePolicy = policy
+	}
+}
+
+// WithUpgradeTracker задает учет переключенных соединений, через него они закрываются при остановке
+func WithUpgradeTracker(tracker *UpgradeTracker) ServiceOption {
+	return func(s *loadBalancerService) {
+		s.upgrades = tracker
+	}
+}
+
+// WithErrorRenderer задает вид ответов с ошибками самого балансировщика (503, 504 и тд)
+func WithErrorRenderer(renderer *problem.Renderer) ServiceOption {
+	return func(s *loadBalancerService) {
+		s.errorRenderer = renderer
+	}
 }
 
 // NewLoadBalancerService создает новый сервис балансировки
+// repo становится пулом по умолчанию
 func NewLoadBalancerService(
 	repo ports.BackendRepository,
 	forwarder ports.Forwarder,
 	logger ports.Logger,
+	opts ...ServiceOption,
 ) ports.LoadBalancerService {
-	return &loadBalancerService{
-		repo:      repo,
-		forwarder: forwarder,
-		logger:    logger.With("service", "LoadBalancerService"),
+	s := &loadBalancerService{
+		pools: map[string]*Pool{
+			routing.DefaultPool: {Name: routing.DefaultPool, Repo: repo},
+		},
+		forwarder:     forwarder,
+		logger:        logger.With("service", "LoadBalancerService"),
+		retryPolicy:   retry.DefaultPolicy(),
+		poolHeaders:   make(map[string]*headers.Rules),
+		upgrades:      NewUpgradeTracker(),
+		errorRenderer: problem.DefaultRenderer(),
+	}
+	for _, opt := range opts {
+		opt(s)
 	}
+
+	s.latency = make(map[string]*latencyWindow)
+	for _, route := range s.routes.Routes() {
+		if route.Hedge != nil {
+			s.latency[route.Name] = &latencyWindow{}
+		}
+		if route.Mirror != nil && s.mirrorer == nil {
+			s.mirrorer = NewMirrorer(s.forwarder, logger, defaultMirrorInFlight)
+		}
+	}
+	return s
 }
 
 // HandleRequest основной метод обработки входящего запроса
@@ -39,21 +157,172 @@ func (s *loadBalancerService) HandleRequest(w http.ResponseWriter, r *http.Reque
 		"method", r.Method,
 		"uri", r.RequestURI,
 		"remote_addr", r.RemoteAddr,
+		"client_ip", reqctx.ClientIP(r),
 	)
+	if id := reqctx.RequestID(r); id != "" {
+		// по идентификатору строки балансировщика сопоставляются с логами бэкенда
+		reqLogger = reqLogger.With("request_id", id)
+	}
 	reqLogger.Info("начало обработки входящего запроса")
 
+	upgrade := balancer.IsUpgrade(r)
+	if upgrade && s.upgrades.Draining() {
+		reqLogger.Warn("балансировщик останавливается, смена протокола отклонена")
+		s.writeError(w, r, http.StatusServiceUnavailable, "balancer is shutting down")
+		return
+	}
+
+	route, pool, group := s.resolve(r)
+	if group != "" {
+		reqLogger = reqLogger.With("route", route.Name, "split_group", group)
+		// по группе кеш ответов отличает ответы пулов маршрута
+		r = r.WithContext(routing.WithSplitGroup(r.Context(), route.Name, group))
+	}
+	policy := s.policyFor(route, pool)
+	if rules := s.headerRulesFor(route, pool); len(rules) > 0 {
+		// правила применяет форвардер: в директоре к запросу, в ModifyResponse к ответу
+		r = r.WithContext(headers.WithRules(r.Context(), rules))
+	}
+	if route != nil && route.Rewrite != nil {
+		// маршрут уже выбран по исходному пути, переписанный путь увидит только бэкенд
+		r = r.WithContext(routing.WithRewrite(r.Context(), route.Rewrite))
+	}
+	timeouts := s.timeoutsFor(route)
+	if !timeouts.IsZero() {
+		r = r.WithContext(routing.WithTimeouts(r.Context(), timeouts))
+	}
+	stream := streamPolicyFor(route, upgrade)
+	if timeouts.Total > 0 && !upgrade && stream == nil {
+		// общий дедлайн покрывает все попытки, форвардер передает остаток времени бэкенду
+		ctx, cancel := context.WithTimeout(r.Context(), timeouts.Total)
+		defer cancel()
+		r = r.WithContext(ctx)
+		// WriteTimeout сервера отсчитывается от чтения запроса и при total больше него оборвал бы соединение вместо 504
+		_ = http.NewResponseController(w).SetWriteDeadline(time.Now().Add(timeouts.Total + totalWriteSlack))
+	}
+	if stream != nil {
+		// поток длится, пока бэкенд присылает данные, поэтому вместо общих таймаутов его ограничивает простой
+		ctx, cancel := context.WithCancelCause(r.Context())
+		defer cancel(nil)
+		r = r.WithContext(ctx)
+		sw := newStreamWriter(w, *stream, cancel, reqLogger)
+		defer sw.stop()
+		w = sw
+	}
+	if route != nil && route.Fault != nil {
+		// план выбирается один раз: повторные попытки получают те же сбои
+		plan := route.Fault.PlanFor(r)
+		if plan.AbortStatus != 0 {
+			// прерывание не обращается к бэкенду и не повторяется, как и другие ответы балансировщика
+			reqLogger.Debug("запрос прерван внесенным сбоем", "status", plan.AbortStatus)
+			w.Header().Set("X-Fault-Injected", "abort")
+			s.writeError(w, r, plan.AbortStatus, "fault injected")
+			return
+		}
+		if !plan.IsZero() {
+			// задержку и ограничение скорости вносит обертка над форвардером
+			r = r.WithContext(fault.WithPlan(r.Context(), plan))
+		}
+	}
+
+	// вызовы gRPC - всегда POST, идемпотентность метода задается в политике маршрута
+	idempotent := balancer.IsIdempotent(r)
+	grpcRetry := false
+	if route != nil && route.GRPC != nil && grpc.IsGRPC(r) {
+		idempotent = idempotent || route.GRPC.IsIdempotent(r.URL.Path)
+		grpcRetry = len(route.GRPC.RetryOn) > 0
+	}
+
+	// тело читается целиком до первой попытки, только если его копии уходят одновременно: хедж и зеркало
+	// вызов gRPC без длины тела может быть клиентским потоком, который ждет ответов до закрытия своей стороны,
+	// поэтому он не хеджируется и не зеркалируется
+	mirrorPolicy, shadowPool := s.mirrorFor(route, upgrade)
+	hedge := hedgeFor(route, r, idempotent)
+	if grpc.IsGRPC(r) && r.ContentLength < 0 {
+		hedge = nil
+		if mirrorPolicy != nil {
+			s.mirrorer.skipBody(route.Name)
+			mirrorPolicy = nil
+		}
+	}
+	var body replayableBody // тело, прочитанное целиком
+	var tee *teeBody        // тело, которое копится для повтора по мере отправки
+	replayable := true
+	switch {
+	case hedge != nil || mirrorPolicy != nil:
+		// для зеркалируемого запроса лимит может быть больше, но повторяемым тело делает только лимит политики
+		bodyLimit := policy.MaxBodyBytes
+		if mirrorPolicy != nil && mirrorPolicy.MaxBodyBytes > bodyLimit {
+			bodyLimit = mirrorPolicy.MaxBodyBytes
+		}
+		var buffered bool
+		var err error
+		body, buffered, err = bufferRequestBody(r, bodyLimit)
+		if err != nil {
+			reqLogger.Warn("не удалось прочитать тело запроса", "error", err)
+			s.writeError(w, r, http.StatusBadRequest, "failed to read request body")
+			return
+		}
+		replayable = buffered && int64(len(body)) <= policy.MaxBodyBytes
+		if !replayable {
+			hedge = nil
+		}
+		if mirrorPolicy != nil {
+			if !buffered || int64(len(body)) > mirrorPolicy.MaxBodyBytes {
+				s.mirrorer.skipBody(route.Name)
+			} else if shot := s.mirrorer.fire(route.Name, mirrorPolicy, shadowPool, r, body); shot != nil {
+				w = shot.wrap(w)
+				defer shot.done()
+			}
+		}
+	case policy.MaxAttempts > 1:
+		// повтор отправит тело заново, а первая попытка не ждет его конца
+		tee = newTeeBody(r, policy.MaxBodyBytes)
+		replayable = tee == nil || policy.MaxBodyBytes > 0
+	}
+
 	attempts := 0
 	var lastError error
-	for attempts < serviceMaxRetries {
+	var held *attemptWriter       // последний придержанный ответ бэкенда со статусом для повтора
+	var tried map[string]struct{} // бэкенды, уже упавшие на этом запросе
+	for attempts < policy.MaxAttempts {
+		if errors.Is(r.Context().Err(), context.DeadlineExceeded) {
+			// общий таймаут истек, новая попытка уже не успеет
+			lastError = &balancer.ForwardError{Kind: balancer.ForwardErrorTimeout, Err: errors.New("истек общий таймаут запроса")}
+			break
+		}
 		attempts++
 		attemptLogger := reqLogger.With("attempt", attempts) // логгер для конкретной попытки
 
+		// тело, копившееся во время прошлой попытки, отправляется заново; если оно не поместилось в буфер, повтор невозможен
+		if tee != nil && !tee.rewind(r) {
+			attemptLogger.Warn("тело запроса больше лимита буфера, повтор запрещен", "max_body_bytes", policy.MaxBodyBytes)
+			break
+		}
+
+		// перед повтором сверяемся с бюджетом, чтобы не умножать нагрузку на и так страдающие бэкенды
+		if attempts > 1 && s.retryBudget != nil && !s.retryBudget.TryRetry() {
+			attemptLogger.Warn("бюджет повторов исчерпан, повтор пропущен", "retries_skipped_total", s.retryBudget.Exhausted())
+			break
+		}
+
+		if delay := policy.Delay(attempts); delay > 0 {
+			if !sleepContext(r.Context(), delay) {
+				if errors.Is(r.Context().Err(), context.DeadlineExceeded) {
+					lastError = &balancer.ForwardError{Kind: balancer.ForwardErrorTimeout, Err: errors.New("общий таймаут запроса истек во время ожидания повтора")}
+					break
+				}
+				reqLogger.Info("запрос отменен клиентом во время ожидания повтора", "attempts", attempts)
+				return
+			}
+		}
+
 		// 1 выбираем следующий здоровый бэкенд через репозиторий
-		backend, found := s.repo.GetNextHealthyBackend()
+		backend, found := s.pickBackend(pool.Repo, tried)
 		if !found {
 			// если репозиторий не нашел здоровых бэкендов, нет смысла пробовать дальше
 			attemptLogger.Warn("нет доступных здоровых бэкендов")
-			lastError = errors.New("нет доступных здоровых бэкендов")
+			lastError = errNoHealthyBackends
 			break
 		}
 
@@ -61,11 +330,59 @@ func (s *loadBalancerService) HandleRequest(w http.ResponseWriter, r *http.Reque
 		attemptLogger.Info("попытка перенаправления запроса на бэкенд")
 
 		// 2 пересылаем запрос на выбранный бэкенд через форвардер
-		err := s.forwarder.Forward(w, r, backend)
+		// ответ попытки изолирован, пока форвардер не начнет писать его клиенту
+		if body != nil {
+			body.rewind(r)
+		}
+		aw := newAttemptWriter(w)
+		if attempts < policy.MaxAttempts && replayable && idempotent {
+			aw.holdStatus = policy.RetriesStatus
+			if grpcRetry {
+				// статус вызова gRPC приходит в трейлере после тела, поэтому придерживается любой ответ 200
+				// ошибка вызова обычно приходит без сообщений, а первое сообщение фиксирует ответ:
+				// серверный поток идет клиенту сразу, а не после завершения вызова
+				aw.holdStatus = func(code int) bool { return code == http.StatusOK || policy.RetriesStatus(code) }
+				aw.streamStatus = func(code int) bool { return code == http.StatusOK }
+			}
+		}
+		var err error
+		if upgrade {
+			err = s.forwardUpgrade(aw, r, backend, pool, route, attemptLogger)
+		} else if hedge != nil {
+			backend, err = s.forwardHedged(aw, r, backend, pool, body, policy, hedge, s.latency[route.Name], attemptLogger)
+		} else {
+			err = s.forwardAttempt(aw, r, backend, policy.PerTryTimeout)
+		}
 
 		// 3 обрабатываем результат форвардинга
 		if err == nil {
+			if grpcRetry && aw.HeldStatus() == http.StatusOK {
+				if code, ok := grpc.StatusOf(aw.Header()); ok && route.GRPC.RetriesCode(code) {
+					attemptLogger.Warn("вызов gRPC завершился кодом для повтора", "grpc_status", code.String())
+					held = aw
+					lastError = fmt.Errorf("бэкенд %s завершил вызов gRPC кодом %s", backend.URL, code)
+					tried = markTried(tried, policy, backend)
+					continue
+				}
+				aw.Release()
+			}
+			if status := aw.HeldStatus(); status != 0 {
+				// бэкенд жив, но ответил статусом из политики повтора
+				attemptLogger.Warn("бэкенд ответил статусом для повтора", "status", status)
+				held = aw
+				lastError = fmt.Errorf("бэкенд %s ответил статусом %d", backend.URL, status)
+				tried = markTried(tried, policy, backend)
+				continue
+			}
+
 			// успех
+			if code, ok := grpc.StatusOf(aw.Header()); ok && code != grpc.OK {
+				// для HTTP это успешный ответ 200, ошибку вызова видно только в grpc-status
+				attemptLogger.Warn("вызов gRPC завершился ошибкой", "grpc_status", code.String(), "grpc_message", aw.Header().Get("Grpc-Message"))
+			}
+			if s.retryBudget != nil {
+				s.retryBudget.RecordSuccess()
+			}
 			duration := time.Since(startTime)
 			attemptLogger.Info("Request forwarded successfully", "duration", duration)
 			return
@@ -73,19 +390,263 @@ func (s *loadBalancerService) HandleRequest(w http.ResponseWriter, r *http.Reque
 
 		// ошибка при форвардинге на этот бэкенд
 		lastError = err
-		attemptLogger.Warn("Forwarding failed for backend", "error", err)
+		kind := balancer.KindOf(err)
+		attemptLogger.Warn("Forwarding failed for backend", "error", err, "kind", kind.String())
 
-		// помечаем этот бэкенд как недоступный в репозитории
-		s.repo.MarkBackendStatus(backend.URL, false)
-		attemptLogger.Info("Marked backend as unhealthy")
+		if kind == balancer.ForwardErrorCanceled {
+			// клиент ушел, бэкенд не виноват и отвечать уже некому
+			reqLogger.Info("запрос отменен клиентом", "attempts", attempts, "duration", time.Since(startTime))
+			return
+		}
+
+		if marksUnhealthy(err) {
+			// помечаем этот бэкенд как недоступный в репозитории
+			pool.Repo.MarkBackendStatus(backend.URL, false)
+			attemptLogger.Info("Marked backend as unhealthy")
+		}
+		tried = markTried(tried, policy, backend)
+
+		if aw.Committed() {
+			// часть ответа уже ушла клиенту: ни повтор, ни свой ответ об ошибке невозможны
+			reqLogger.Error("ответ бэкенда прерван после начала передачи клиенту", "attempts", attempts, "last_error", lastError, "duration", time.Since(startTime))
+			return
+		}
+
+		if !canRetry(policy, kind, replayable, idempotent) {
+			attemptLogger.Warn("повтор запроса запрещен политикой", "method", r.Method, "kind", kind.String(), "body_replayable", replayable)
+			break
+		}
 
 		// цикл продолжится для следующей попытки с другим бэкендом
 	}
 
+	if held != nil {
+		// повторы не помогли, но ответ бэкенда лучше собственной ошибки
+		reqLogger.Warn("повторы исчерпаны, клиенту отдан ответ бэкенда", "attempts", attempts, "status", held.heldStatus, "duration", time.Since(startTime))
+		held.Release()
+		return
+	}
+
 	// если мы вышли из цикла, значит все попытки провалились
 	duration := time.Since(startTime)
 	reqLogger.Error("Failed to handle request after all retries", "attempts", attempts, "last_error", lastError, "duration", duration)
 
 	// отвечаем клиенту ошибкой ТОЛЬКО после всех попыток, а не в момент попытки
-	http.Error(w, "Service Unavailable (Failed after multiple attempts)", http.StatusServiceUnavailable)
+	switch kind := balancer.KindOf(lastError); {
+	case kind == balancer.ForwardErrorTimeout:
+		// бэкенд не успел ответить: клиент получает 504, а не оборванное соединение
+		s.writeError(w, r, http.StatusGatewayTimeout, "backend did not respond in time")
+	case kind == balancer.ForwardErrorConnect || errors.Is(lastError, errNoHealthyBackends):
+		// до бэкенда не достучаться: сервис временно недоступен
+		s.writeError(w, r, http.StatusServiceUnavailable, "failed after multiple attempts")
+	default:
+		// бэкенд принял запрос, но оборвал соединение или ответил не по протоколу
+		s.writeError(w, r, http.StatusBadGateway, "invalid response from backend")
+	}
+}
+
+// writeError отвечает клиенту ошибкой самого балансировщика
+// формат тела выбирается по Accept клиента, вызов gRPC получает ее как grpc-status
+func (s *loadBalancerService) writeError(w http.ResponseWriter, r *http.Request, status int, detail string) {
+	s.errorRenderer.Write(w, r, status, detail)
+}
+
+// resolve выбирает маршрут и пул для запроса
+// для маршрута с разделением трафика пул берется из выбранной группы, ее имя возвращается в group
+func (s *loadBalancerService) resolve(r *http.Request) (route *routing.Route, pool *Pool, group string) {
+	route, ok := s.routes.Match(r)
+	if !ok {
+		return nil, s.pools[routing.DefaultPool], ""
+	}
+	poolName := route.Pool
+	if route.Split != nil {
+		picked := route.Split.Pick(r)
+		poolName, group = picked.Pool, picked.Name
+	}
+	pool, ok = s.pools[poolName]
+	if !ok {
+		s.logger.Warn("пул маршрута не зарегистрирован, используется пул по умолчанию", "route", route.Name, "pool", poolName)
+		pool = s.pools[routing.DefaultPool]
+	}
+	return route, pool, group
+}
+
+// mirrorFor возвращает политику зеркалирования и теневой пул, если этот запрос нужно зеркалировать
+// запросы на смену протокола не зеркалируются: туннель нельзя раздвоить
+func (s *loadBalancerService) mirrorFor(route *routing.Route, upgrade bool) (*mirror.Policy, *Pool) {
+	if route == nil || route.Mirror == nil || upgrade || !route.Mirror.Sample() {
+		return nil, nil
+	}
+	pool, ok := s.pools[route.Mirror.Pool]
+	if !ok {
+		return nil, nil
+	}
+	return route.Mirror, pool
+}
+
+// timeoutsFor возвращает таймауты маршрута, дополненные общими
+func (s *loadBalancerService) timeoutsFor(route *routing.Route) routing.Timeouts {
+	if route != nil && route.Timeouts != nil {
+		return route.Timeouts.Merge(s.timeouts)
+	}
+	return s.timeouts
+}
+
+// policyFor возвращает политику повторов: маршрута, затем пула, затем общую
+func (s *loadBalancerService) policyFor(route *routing.Route, pool *Pool) *retry.Policy {
+	if route != nil && route.Retry != nil {
+		return route.Retry
+	}
+	if pool.Retry != nil {
+		return pool.Retry
+	}
+	return &s.retryPolicy
+}
+
+// headerRulesFor возвращает правила заголовков в порядке применения: пула, затем маршрута
+func (s *loadBalancerService) headerRulesFor(route *routing.Route, pool *Pool) []*headers.Rules {
+	var rules []*headers.Rules
+	if poolRules, ok := s.poolHeaders[pool.Name]; ok {
+		rules = append(rules, poolRules)
+	}
+	if route != nil && route.Headers != nil {
+		rules = append(rules, route.Headers)
+	}
+	return rules
+}
+
+// forwardAttempt выполняет одну попытку с таймаутом попытки, если он задан
+func (s *loadBalancerService) forwardAttempt(w http.ResponseWriter, r *http.Request, backend *balancer.Backend, timeout time.Duration) error {
+	if timeout <= 0 {
+		return s.forwarder.Forward(w, r, backend)
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	defer cancel()
+	return s.forwarder.Forward(w, r.WithContext(ctx), backend)
+}
+
+// forwardUpgrade проксирует запрос на смену протокола
+// вызов длится, пока открыт туннель, поэтому таймаут попытки к нему не применяется,
+// а соединение все это время учитывается как активное на бэкенде
+func (s *loadBalancerService) forwardUpgrade(
+	w http.ResponseWriter,
+	r *http.Request,
+	backend *balancer.Backend,
+	pool *Pool,
+	route *routing.Route,
+	logger ports.Logger,
+) error {
+	pool.Repo.IncrementConnections(backend)
+	defer pool.Repo.DecrementConnections(backend)
+
+	uw := &upgradeWriter{
+		ResponseWriter: w,
+		tracker:        s.upgrades,
+		policy:         s.upgradePolicyFor(route),
+		logger:         logger,
+	}
+	return s.forwarder.Forward(uw, r, backend)
+}
+
+// upgradePolicyFor возвращает таймауты переключенного соединения: маршрута или общие
+func (s *loadBalancerService) upgradePolicyFor(route *routing.Route) routing.UpgradePolicy {
+	if route != nil && route.Upgrade != nil {
+		return *route.Upgrade
+	}
+	return s.upgradePolicy
+}
+
+// pickBackend выбирает здоровый бэкенд, по возможности пропуская уже упавшие на этом запросе
+// перебор останавливается, как только стратегия вернула бэкенд повторно
+func (s *loadBalancerService) pickBackend(repo ports.BackendRepository, tried map[string]struct{}) (*balancer.Backend, bool) {
+	backend, found := repo.GetNextHealthyBackend()
+	if !found || len(tried) == 0 {
+		return backend, found
+	}
+
+	seen := make(map[string]struct{}, len(tried))
+	for {
+		key := backend.URL.String()
+		if _, failed := tried[key]; !failed {
+			return backend, true
+		}
+		if _, dup := seen[key]; dup {
+			return backend, true // все кандидаты уже пробовали, берем что есть
+		}
+		seen[key] = struct{}{}
+
+		next, ok := repo.GetNextHealthyBackend()
+		if !ok {
+			return backend, true
+		}
+		backend = next
+	}
+}
+
+// hedgeFor возвращает политику хеджирования, если ее можно применить к запросу
+// хеджируются только идемпотентные запросы без Upgrade, повторяемость тела проверяет вызывающий код
+// потоковые ответы не хеджируются: параллельные попытки копятся в памяти, и поток дошел бы до клиента только целиком
+func hedgeFor(route *routing.Route, r *http.Request, idempotent bool) *retry.Hedge {
+	if route == nil || route.Hedge == nil || !idempotent || balancer.IsUpgrade(r) {
+		return nil
+	}
+	if route.Stream != nil || acceptsEventStream(r) {
+		return nil
+	}
+	return route.Hedge
+}
+
+// streamPolicyFor возвращает политику потоковых ответов маршрута, для смены протокола - nil
+func streamPolicyFor(route *routing.Route, upgrade bool) *routing.StreamPolicy {
+	if route == nil || upgrade {
+		return nil
+	}
+	return route.Stream
+}
+
+// canRetry решает, можно ли повторить запрос после ошибки вида kind
+// неидемпотентные запросы повторяются только если соединение с бэкендом не было установлено
+func canRetry(policy *retry.Policy, kind balancer.ForwardErrorKind, replayable, idempotent bool) bool {
+	if !replayable || !policy.RetriesError(kind) {
+		return false
+	}
+	if idempotent {
+		return true
+	}
+	return kind == balancer.ForwardErrorConnect
+}
+
+// errNoHealthyBackends в пуле не осталось бэкендов для очередной попытки
+var errNoHealthyBackends = errors.New("нет доступных здоровых бэкендов")
+
+// marksUnhealthy сообщает, говорит ли ошибка попытки о недоступности бэкенда для всего пула
+// таймауты задает маршрут: медленный эндпоинт с жестким таймаутом не повод исключать бэкенд для всех маршрутов,
+// а зависший бэкенд найдет проверка здоровья; внесенные сбои здоровье бэкенда не меняют
+func marksUnhealthy(err error) bool {
+	kind := balancer.KindOf(err)
+	return kind != balancer.ForwardErrorCanceled && kind != balancer.ForwardErrorTimeout && !errors.Is(err, fault.ErrInjected)
+}
+
+// markTried запоминает упавший бэкенд, если политика просит его избегать
+func markTried(tried map[string]struct{}, policy *retry.Policy, backend *balancer.Backend) map[string]struct{} {
+	if !policy.AvoidPreviousBackend {
+		return tried
+	}
+	if tried == nil {
+		tried = make(map[string]struct{})
+	}
+	tried[backend.URL.String()] = struct{}{}
+	return tried
+}
+
+// sleepContext ждет d или отмены контекста, возвращает false при отмене
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
 }
@@ -0,0 +1,226 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"github.com/athebyme/cloud-ru-assign/internal/core/domain/mirror"
+	"github.com/athebyme/cloud-ru-assign/internal/core/ports"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultMirrorTimeout ограничивает теневой запрос, если маршрут не задал свой таймаут
+	defaultMirrorTimeout = 10 * time.Second
+	// defaultMirrorInFlight сколько теневых запросов может идти одновременно по умолчанию
+	defaultMirrorInFlight = 64
+)
+
+// Mirrorer отправляет копии запросов в теневые пулы и сравнивает их ответы с основными
+// теневые запросы идут в фоне и никак не влияют на ответ клиенту: при переполнении они просто пропускаются
+type Mirrorer struct {
+	forwarder ports.Forwarder
+	logger    ports.Logger
+	inFlight  chan struct{} // семафор одновременных теневых запросов
+
+	mu    sync.Mutex
+	stats map[string]*mirror.Stats // ключ: имя маршрута
+}
+
+// NewMirrorer создает зеркалирование поверх форвардера
+// форвардер передается без кеша ответов, иначе теневой пул получал бы ответы основного
+func NewMirrorer(forwarder ports.Forwarder, logger ports.Logger, maxInFlight int) *Mirrorer {
+	if maxInFlight <= 0 {
+		maxInFlight = defaultMirrorInFlight
+	}
+	return &Mirrorer{
+		forwarder: forwarder,
+		logger:    logger.With("component", "Mirrorer"),
+		inFlight:  make(chan struct{}, maxInFlight),
+		stats:     make(map[string]*mirror.Stats),
+	}
+}
+
+// WithMirrorer задает зеркалирование для маршрутов с теневым пулом
+// без него сервис создает зеркалирование поверх своего форвардера
+func WithMirrorer(m *Mirrorer) ServiceOption {
+	return func(s *loadBalancerService) {
+		s.mirrorer = m
+	}
+}
+
+// MirrorStats реализует ports.MirrorService
+func (m *Mirrorer) MirrorStats() map[string]mirror.Stats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := make(map[string]mirror.Stats, len(m.stats))
+	for route, st := range m.stats {
+		copied := *st
+		copied.Statuses = make(map[int]uint64, len(st.Statuses))
+		for status, n := range st.Statuses {
+			copied.Statuses[status] = n
+		}
+		out[route] = copied
+	}
+	return out
+}
+
+// update меняет статистику маршрута под блокировкой
+func (m *Mirrorer) update(route string, fn func(st *mirror.Stats)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	st, ok := m.stats[route]
+	if !ok {
+		st = &mirror.Stats{}
+		m.stats[route] = st
+	}
+	fn(st)
+}
+
+// skipBody учитывает запрос, не зеркалированный из-за размера тела
+func (m *Mirrorer) skipBody(route string) {
+	m.update(route, func(st *mirror.Stats) { st.SkippedBody++ })
+}
+
+// mirrorShot теневой запрос, ждущий итога основного для сравнения
+type mirrorShot struct {
+	primary chan mirror.Result // статус и задержка основного ответа
+	status  *statusRecorder
+	started time.Time
+}
+
+// fire отправляет копию запроса в теневой пул
+// r должен быть еще не отправлен: копия снимается до первой попытки, тело берется из буфера
+// nil - копия не отправлена, потому что теневых запросов уже слишком много
+func (m *Mirrorer) fire(route string, policy *mirror.Policy, pool *Pool, r *http.Request, body []byte) *mirrorShot {
+	select {
+	case m.inFlight <- struct{}{}:
+	default:
+		m.update(route, func(st *mirror.Stats) { st.Dropped++ })
+		return nil
+	}
+	m.update(route, func(st *mirror.Stats) { st.Mirrored++ })
+
+	timeout := policy.Timeout
+	if timeout <= 0 {
+		timeout = defaultMirrorTimeout
+	}
+	// отмена клиентом прерывает основной запрос, но теневой должен дойти до конца
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), timeout)
+	shadow := r.Clone(ctx)
+	shadow.Header.Set("X-Shadow-Request", "true")
+	if body != nil {
+		shadow.Body = io.NopCloser(bytes.NewReader(body))
+		shadow.GetBody = func() (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(body)), nil
+		}
+	} else {
+		shadow.Body = http.NoBody
+	}
+
+	shot := &mirrorShot{primary: make(chan mirror.Result, 1), started: time.Now()}
+	go func() {
+		defer func() { <-m.inFlight }()
+		defer cancel()
+
+		logger := m.logger.With("route", route, "shadow_pool", pool.Name, "method", r.Method, "uri", r.RequestURI)
+		res := mirror.Result{}
+		backend, found := pool.Repo.GetNextHealthyBackend()
+		if found {
+			logger = logger.With("shadow_backend", backend.URL.String())
+			resp := &discardResponse{header: make(http.Header)}
+			start := time.Now()
+			if err := m.forwarder.Forward(resp, shadow, backend); err != nil {
+				logger.Debug("теневой запрос не удался", "error", err)
+			} else {
+				res.ShadowStatus = resp.Status()
+			}
+			res.ShadowLatency = time.Since(start)
+		} else {
+			logger.Debug("в теневом пуле нет здоровых бэкендов")
+		}
+
+		primary := <-shot.primary
+		res.PrimaryStatus, res.PrimaryLatency = primary.PrimaryStatus, primary.PrimaryLatency
+		m.update(route, func(st *mirror.Stats) { st.Record(res) })
+		logger.Info("теневой ответ получен",
+			"shadow_status", res.ShadowStatus,
+			"shadow_duration", res.ShadowLatency,
+			"primary_status", res.PrimaryStatus,
+			"primary_duration", res.PrimaryLatency,
+			"status_match", res.ShadowStatus == res.PrimaryStatus,
+		)
+	}()
+	return shot
+}
+
+// wrap подменяет writer клиента, чтобы узнать статус основного ответа
+func (shot *mirrorShot) wrap(w http.ResponseWriter) http.ResponseWriter {
+	shot.status = &statusRecorder{ResponseWriter: w}
+	return shot.status
+}
+
+// done передает итог основного запроса теневому для сравнения
+func (shot *mirrorShot) done() {
+	shot.primary <- mirror.Result{PrimaryStatus: shot.status.status, PrimaryLatency: time.Since(shot.started)}
+}
+
+// statusRecorder запоминает статус ответа клиенту, ничего не меняя в самом ответе
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (sr *statusRecorder) WriteHeader(code int) {
+	if sr.status == 0 && code >= http.StatusOK {
+		sr.status = code
+	}
+	sr.ResponseWriter.WriteHeader(code)
+}
+
+func (sr *statusRecorder) Write(p []byte) (int, error) {
+	if sr.status == 0 {
+		sr.status = http.StatusOK
+	}
+	return sr.ResponseWriter.Write(p)
+}
+
+// Unwrap дает http.ResponseController доступ к Flush, Hijack и дедлайнам исходного writer'а
+func (sr *statusRecorder) Unwrap() http.ResponseWriter {
+	return sr.ResponseWriter
+}
+
+// discardResponse принимает теневой ответ, оставляя от него только статус
+type discardResponse struct {
+	header http.Header
+	status int
+}
+
+func (d *discardResponse) Header() http.Header {
+	return d.header
+}
+
+func (d *discardResponse) WriteHeader(code int) {
+	if d.status == 0 {
+		d.status = code
+	}
+}
+
+func (d *discardResponse) Write(p []byte) (int, error) {
+	if d.status == 0 {
+		d.status = http.StatusOK
+	}
+	return len(p), nil
+}
+
+// Status возвращает статус ответа, 200 если бэкенд не вызывал WriteHeader
+func (d *discardResponse) Status() int {
+	if d.status == 0 {
+		return http.StatusOK
+	}
+	return d.status
+}
+
+var _ ports.MirrorService = (*Mirrorer)(nil)
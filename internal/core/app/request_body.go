@@ -0,0 +1,168 @@
+package app
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+)
+
+// replayableBody буферизованное тело запроса, которое можно отправить повторно
+type replayableBody []byte
+
+// rewind подставляет в запрос свежую копию тела перед очередной попыткой
+func (b replayableBody) rewind(r *http.Request) {
+	r.Body = io.NopCloser(bytes.NewReader(b))
+	r.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(b)), nil
+	}
+}
+
+// bufferRequestBody читает тело запроса в память, но не больше limit байт
+// если тело поместилось, возвращает его и replayable=true
+// если тело больше лимита, восстанавливает r.Body для единственной попытки и возвращает replayable=false
+func bufferRequestBody(r *http.Request, limit int64) (body replayableBody, replayable bool, err error) {
+	if r.Body == nil || r.Body == http.NoBody {
+		return nil, true, nil
+	}
+	if limit <= 0 {
+		return nil, false, nil
+	}
+
+	buf, err := io.ReadAll(io.LimitReader(r.Body, limit+1))
+	if err != nil {
+		return nil, false, err
+	}
+
+	if int64(len(buf)) > limit {
+		// прочитанное возвращаем в начало потока, остальное дочитает форвардер
+		r.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(buf), r.Body), r.Body}
+		return nil, false, nil
+	}
+
+	_ = r.Body.Close()
+	body = buf
+	body.rewind(r)
+	return body, true, nil
+}
+
+// errStaleAttempt тело читает попытка, после которой уже началась следующая
+var errStaleAttempt = errors.New("тело запроса передано следующей попытке")
+
+// teeBody тело запроса, которое уходит бэкенду по мере чтения и копится для повторных попыток
+// в отличие от bufferRequestBody первая попытка не ждет конца тела: потоковая загрузка
+// и клиентский поток gRPC доходят до бэкенда сразу, а повтор возможен, пока прочитано не больше limit байт
+type teeBody struct {
+	src   io.ReadCloser
+	limit int64
+
+	readMu sync.Mutex // из src читает одна попытка за раз
+
+	mu       sync.Mutex
+	buf      []byte // прочитанное из src, после переполнения - только еще не отданное попытке
+	overflow bool   // прочитано больше limit, повтор невозможен
+	srcErr   error  // ошибка или io.EOF источника
+	current  *teeReader
+}
+
+// newTeeBody оборачивает тело запроса, nil - тела нет и оборачивать нечего
+// при limit <= 0 тело не копится, и повторить запрос с ним нельзя
+func newTeeBody(r *http.Request, limit int64) *teeBody {
+	if r.Body == nil || r.Body == http.NoBody {
+		return nil
+	}
+	return &teeBody{src: r.Body, limit: limit, overflow: limit <= 0}
+}
+
+// rewind подставляет в запрос тело для очередной попытки: прочитанное ранее, затем остаток из источника
+// false - прочитанное уже не поместилось в буфер и повторная попытка отправила бы тело не целиком
+func (b *teeBody) rewind(r *http.Request) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.overflow && b.current != nil {
+		return false
+	}
+	b.current = &teeReader{body: b}
+	r.Body = b.current
+	r.GetBody = nil
+	return true
+}
+
+// teeReader тело одной попытки, после начала следующей попытки чтение возвращает errStaleAttempt
+type teeReader struct {
+	body *teeBody
+	off  int
+}
+
+func (t *teeReader) Read(p []byte) (int, error) {
+	b := t.body
+	for {
+		b.mu.Lock()
+		if b.current != t {
+			b.mu.Unlock()
+			return 0, errStaleAttempt
+		}
+		if t.off < len(b.buf) {
+			n := copy(p, b.buf[t.off:])
+			t.off += n
+			if b.overflow && t.off == len(b.buf) {
+				b.buf, t.off = nil, 0
+			}
+			b.mu.Unlock()
+			return n, nil
+		}
+		if b.srcErr != nil {
+			err := b.srcErr
+			b.mu.Unlock()
+			return 0, err
+		}
+		b.mu.Unlock()
+
+		b.readMu.Lock()
+		b.mu.Lock()
+		// пока ждали очереди, прошлая попытка могла дочитать в буфер или сменилась попытка
+		if b.current != t || t.off < len(b.buf) || b.srcErr != nil {
+			b.mu.Unlock()
+			b.readMu.Unlock()
+			continue
+		}
+		b.mu.Unlock()
+
+		n, err := b.src.Read(p)
+
+		b.mu.Lock()
+		if !b.overflow {
+			b.buf = append(b.buf, p[:n]...)
+			if int64(len(b.buf)) > b.limit {
+				b.overflow = true
+			}
+			if b.current == t {
+				t.off += n
+				if b.overflow && t.off == len(b.buf) {
+					b.buf, t.off = nil, 0
+				}
+			}
+		}
+		if err != nil {
+			b.srcErr = err
+		}
+		stale := b.current != t
+		b.mu.Unlock()
+		b.readMu.Unlock()
+
+		if stale {
+			// прочитанное осталось в буфере для новой попытки
+			return 0, errStaleAttempt
+		}
+		return n, err
+	}
+}
+
+// Close не закрывает источник: тело понадобится следующей попытке, а закроет его сервер
+func (t *teeReader) Close() error {
+	return nil
+}
@@ -0,0 +1,102 @@
+package app
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+)
+
+// errResponseDiscarded ответ перестал помещаться в буфер, но клиенту уже отдается другой
+var errResponseDiscarded = errors.New("ответ не поместился в буфер и отброшен")
+
+// bufferedResponse накапливает ответ бэкенда в памяти вместо записи клиенту
+// нужен, когда несколько попыток идут параллельно и клиенту достается только одна из них
+// с overflow тело больше maxHeldBodyBytes не копится: overflow решает, передать ли ответ клиенту напрямую
+type bufferedResponse struct {
+	header     http.Header
+	sentHeader http.Header // заголовки на момент WriteHeader, все добавленное позже - трейлеры
+	status     int
+	body       bytes.Buffer
+	// overflow вызывается при переполнении буфера и возвращает writer клиента или nil, если ответ не нужен
+	overflow func() http.ResponseWriter
+	dst      http.ResponseWriter // после переполнения ответ пишется прямо сюда
+}
+
+func newBufferedResponse(overflow func() http.ResponseWriter) *bufferedResponse {
+	return &bufferedResponse{header: make(http.Header), overflow: overflow}
+}
+
+// Header после передачи ответа клиенту возвращает заголовки клиента (нужно для трейлеров)
+func (b *bufferedResponse) Header() http.Header {
+	if b.dst != nil {
+		return b.dst.Header()
+	}
+	return b.header
+}
+
+func (b *bufferedResponse) WriteHeader(code int) {
+	if b.status != 0 {
+		return
+	}
+	b.status = code
+	b.sentHeader = b.header.Clone()
+}
+
+func (b *bufferedResponse) Write(p []byte) (int, error) {
+	if b.dst != nil {
+		return b.dst.Write(p)
+	}
+	if b.status == 0 {
+		b.WriteHeader(http.StatusOK)
+	}
+	if b.body.Len()+len(p) <= maxHeldBodyBytes || b.overflow == nil {
+		return b.body.Write(p)
+	}
+	dst := b.overflow()
+	if dst == nil {
+		return 0, errResponseDiscarded
+	}
+	b.writeTo(dst)
+	b.dst = dst
+	return dst.Write(p)
+}
+
+// Flush нужен реверс-прокси для стриминговых ответов, пока ответ в буфере, сбрасывать нечего
+func (b *bufferedResponse) Flush() {
+	if b.dst != nil {
+		_ = http.NewResponseController(b.dst).Flush()
+	}
+}
+
+// Status возвращает статус ответа, 200 если бэкенд не вызывал WriteHeader
+func (b *bufferedResponse) Status() int {
+	if b.status == 0 {
+		return http.StatusOK
+	}
+	return b.status
+}
+
+// writeTo передает накопленный ответ в w, трейлеры бэкенда уходят после тела
+func (b *bufferedResponse) writeTo(w http.ResponseWriter) {
+	sent := b.sentHeader
+	if sent == nil {
+		sent = b.header
+	}
+	dst := w.Header()
+	for k, v := range sent {
+		dst[k] = v
+	}
+	w.WriteHeader(b.Status())
+	_, _ = w.Write(b.body.Bytes())
+	copyTrailers(w.Header(), b.header, sent)
+}
+
+// copyTrailers переносит в dst заголовки из full, появившиеся после отправки sent
+// так httputil.ReverseProxy передает трейлеры: пишет их в Header() после тела ответа
+func copyTrailers(dst, full, sent http.Header) {
+	for k, v := range full {
+		if _, ok := sent[k]; !ok {
+			dst[k] = v
+		}
+	}
+}
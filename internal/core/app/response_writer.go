@@ -0,0 +1,129 @@
+package app
+
+import (
+	"bufio"
+	"bytes"
+	"net"
+	"net/http"
+)
+
+// maxHeldBodyBytes сколько байт тела придержанного ответа хранится до решения о повторе
+// ответ больше лимита отдается клиенту как есть, и повтор становится невозможен
+const maxHeldBodyBytes = 64 << 10
+
+// attemptWriter изолирует ответ одной попытки проксирования от клиента
+// заголовки копятся в собственной карте, и до первого WriteHeader/Write/Hijack клиенту ничего не уходит
+// после этого попытка считается зафиксированной и повторять ее уже нельзя
+// ответ со статусом из holdStatus не фиксируется, а придерживается: сервис либо повторит попытку, либо вызовет Release
+// придержанный ответ со статусом из streamStatus фиксируется на первом байте тела: он может оказаться потоком,
+// который нельзя задерживать до конца, поэтому повторить его можно, только пока тела нет
+type attemptWriter struct {
+	dst          http.ResponseWriter
+	header       http.Header
+	committed    bool
+	holdStatus   func(code int) bool
+	streamStatus func(code int) bool
+	heldStatus   int
+	heldHeader   http.Header // заголовки придержанного ответа, все добавленное позже - трейлеры
+	heldBody     bytes.Buffer
+}
+
+func newAttemptWriter(dst http.ResponseWriter) *attemptWriter {
+	return &attemptWriter{dst: dst, header: make(http.Header)}
+}
+
+// Header до фиксации возвращает заголовки попытки, после - заголовки клиента (нужно для трейлеров)
+func (aw *attemptWriter) Header() http.Header {
+	if aw.committed {
+		return aw.dst.Header()
+	}
+	return aw.header
+}
+
+func (aw *attemptWriter) WriteHeader(code int) {
+	if !aw.committed {
+		if aw.heldStatus != 0 {
+			return // ответ уже придержан, повторный WriteHeader игнорируем как net/http
+		}
+		if aw.holdStatus != nil && aw.holdStatus(code) {
+			aw.heldStatus = code
+			aw.heldHeader = aw.header.Clone()
+			return
+		}
+	}
+	aw.commit()
+	aw.dst.WriteHeader(code)
+}
+
+func (aw *attemptWriter) Write(p []byte) (int, error) {
+	if !aw.committed {
+		if aw.heldStatus != 0 {
+			streaming := len(p) > 0 && aw.streamStatus != nil && aw.streamStatus(aw.heldStatus)
+			if !streaming && aw.heldBody.Len()+len(p) <= maxHeldBodyBytes {
+				return aw.heldBody.Write(p)
+			}
+			// поток и слишком большой ответ не придерживаем, отдаем клиенту как есть
+			aw.Release()
+			return aw.dst.Write(p)
+		}
+		aw.WriteHeader(http.StatusOK)
+	}
+	return aw.dst.Write(p)
+}
+
+// HeldStatus возвращает статус придержанного ответа, 0 если ответ не придерживался
+func (aw *attemptWriter) HeldStatus() int {
+	if aw.committed {
+		return 0
+	}
+	return aw.heldStatus
+}
+
+// Release передает придержанный ответ клиенту, если повторять попытку не будут
+func (aw *attemptWriter) Release() {
+	if aw.committed || aw.heldStatus == 0 {
+		return
+	}
+	full := aw.header
+	aw.header = aw.heldHeader
+	aw.commit()
+	aw.dst.WriteHeader(aw.heldStatus)
+	_, _ = aw.dst.Write(aw.heldBody.Bytes())
+	aw.heldBody.Reset()
+	copyTrailers(aw.dst.Header(), full, aw.heldHeader)
+}
+
+// Flush нужен реверс-прокси для стриминговых ответов
+func (aw *attemptWriter) Flush() {
+	if !aw.committed {
+		return
+	}
+	_ = http.NewResponseController(aw.dst).Flush()
+}
+
+// Hijack используется при Upgrade соединения, после него попытка считается зафиксированной
+func (aw *attemptWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	aw.committed = true
+	return http.NewResponseController(aw.dst).Hijack()
+}
+
+// Unwrap дает http.ResponseController доступ к исходному writer'у (дедлайны и тд)
+func (aw *attemptWriter) Unwrap() http.ResponseWriter {
+	return aw.dst
+}
+
+// Committed сообщает, начал ли ответ попытки передаваться клиенту
+func (aw *attemptWriter) Committed() bool {
+	return aw.committed
+}
+
+func (aw *attemptWriter) commit() {
+	if aw.committed {
+		return
+	}
+	dstHeader := aw.dst.Header()
+	for k, v := range aw.header {
+		dstHeader[k] = v
+	}
+	aw.committed = true
+}
@@ -0,0 +1,49 @@
+package app
+
+import (
+	"fmt"
+	"github.com/athebyme/cloud-ru-assign/internal/core/domain/routing"
+	"github.com/athebyme/cloud-ru-assign/internal/core/ports"
+)
+
+// trafficSplitService реализует входящий порт TrafficSplitService
+// меняет веса прямо в маршрутах таблицы, поэтому новые доли действуют со следующего запроса
+type trafficSplitService struct {
+	routes *routing.Table
+	logger ports.Logger
+}
+
+// NewTrafficSplitService создает сервис управления разделением трафика маршрутов
+func NewTrafficSplitService(routes *routing.Table, logger ports.Logger) ports.TrafficSplitService {
+	return &trafficSplitService{
+		routes: routes,
+		logger: logger.With("service", "TrafficSplitService"),
+	}
+}
+
+// ListSplits возвращает группы и веса всех маршрутов с разделением трафика
+func (s *trafficSplitService) ListSplits() map[string][]routing.SplitGroup {
+	splits := make(map[string][]routing.SplitGroup)
+	for _, route := range s.routes.Routes() {
+		if route.Split != nil {
+			splits[route.Name] = route.Split.Groups()
+		}
+	}
+	return splits
+}
+
+// SetWeights меняет веса групп маршрута
+func (s *trafficSplitService) SetWeights(routeName string, weights map[string]int) ([]routing.SplitGroup, error) {
+	for _, route := range s.routes.Routes() {
+		if route.Name != routeName || route.Split == nil {
+			continue
+		}
+		if err := route.Split.SetWeights(weights); err != nil {
+			return nil, err
+		}
+		groups := route.Split.Groups()
+		s.logger.Info("веса разделения трафика изменены", "route", routeName, "groups", groups)
+		return groups, nil
+	}
+	return nil, fmt.Errorf("маршрут %s: %w", routeName, routing.ErrNoSplit)
+}
@@ -0,0 +1,173 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"github.com/athebyme/cloud-ru-assign/internal/core/domain/routing"
+	"github.com/athebyme/cloud-ru-assign/internal/core/ports"
+	"mime"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// errStreamIdleTimeout причина отмены запроса, когда бэкенд слишком долго не присылает данные потока
+var errStreamIdleTimeout = errors.New("истек таймаут простоя потокового ответа")
+
+// isEventStream сообщает, что тип содержимого - Server-Sent Events
+func isEventStream(contentType string) bool {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	return mediaType == "text/event-stream"
+}
+
+// acceptsEventStream сообщает, что клиент ждет поток Server-Sent Events
+func acceptsEventStream(r *http.Request) bool {
+	for _, accept := range r.Header.Values("Accept") {
+		for _, part := range strings.Split(accept, ",") {
+			if isEventStream(strings.TrimSpace(part)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// streamWriter передает клиенту потоковый ответ маршрута
+// данные сбрасываются после каждой записи или не реже FlushInterval, ответы text/event-stream - всегда сразу;
+// WriteTimeout сервера снимается, а поток без данных дольше IdleTimeout прерывается отменой запроса
+type streamWriter struct {
+	http.ResponseWriter
+	policy routing.StreamPolicy
+	cancel context.CancelCauseFunc
+	logger ports.Logger
+
+	mu           sync.Mutex // защищает таймеры и запись, тк сброс по таймеру идет из другой горутины
+	wroteHeader  bool
+	immediate    bool // сбрасывать после каждой записи
+	flushTimer   *time.Timer
+	flushPending bool
+	idleTimer    *time.Timer
+	stopped      bool
+}
+
+// newStreamWriter снимает с соединения WriteTimeout сервера: он отсчитывается от чтения запроса и оборвал бы длинный поток
+// cancel отменяет контекст запроса к бэкенду по таймауту простоя
+func newStreamWriter(w http.ResponseWriter, policy routing.StreamPolicy, cancel context.CancelCauseFunc, logger ports.Logger) *streamWriter {
+	_ = http.NewResponseController(w).SetWriteDeadline(time.Time{})
+	return &streamWriter{ResponseWriter: w, policy: policy, cancel: cancel, logger: logger}
+}
+
+func (sw *streamWriter) WriteHeader(code int) {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+	sw.writeHeader(code)
+}
+
+func (sw *streamWriter) writeHeader(code int) {
+	if sw.wroteHeader {
+		return
+	}
+	if code < http.StatusOK {
+		// промежуточные ответы (103 Early Hints) уходят как есть
+		sw.ResponseWriter.WriteHeader(code)
+		return
+	}
+	sw.wroteHeader = true
+	sw.immediate = sw.policy.FlushInterval <= 0 || isEventStream(sw.Header().Get("Content-Type"))
+	sw.ResponseWriter.WriteHeader(code)
+	// заголовки уходят сразу: клиент (например EventSource) считает поток открытым до первого события
+	sw.flush()
+	sw.touch()
+}
+
+func (sw *streamWriter) Write(p []byte) (int, error) {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+	if !sw.wroteHeader {
+		sw.writeHeader(http.StatusOK)
+	}
+	n, err := sw.ResponseWriter.Write(p)
+	if err != nil {
+		return n, err
+	}
+	sw.touch()
+	if sw.immediate {
+		sw.flush()
+		return n, nil
+	}
+	if !sw.flushPending && !sw.stopped {
+		sw.flushPending = true
+		if sw.flushTimer == nil {
+			sw.flushTimer = time.AfterFunc(sw.policy.FlushInterval, sw.delayedFlush)
+		} else {
+			sw.flushTimer.Reset(sw.policy.FlushInterval)
+		}
+	}
+	return n, nil
+}
+
+// Flush вызывается реверс-прокси и попыткой, сбрасывает все записанное клиенту
+func (sw *streamWriter) Flush() {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+	sw.flush()
+}
+
+func (sw *streamWriter) flush() {
+	sw.flushPending = false
+	_ = http.NewResponseController(sw.ResponseWriter).Flush()
+}
+
+func (sw *streamWriter) delayedFlush() {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+	if !sw.flushPending { // stop или Flush успели раньше таймера
+		return
+	}
+	sw.flush()
+}
+
+// touch отодвигает таймер простоя и дедлайн записи после очередной порции данных
+// дедлайн записи нужен на случай клиента, который перестал читать поток
+func (sw *streamWriter) touch() {
+	if sw.policy.IdleTimeout <= 0 || sw.stopped {
+		return
+	}
+	_ = http.NewResponseController(sw.ResponseWriter).SetWriteDeadline(time.Now().Add(sw.policy.IdleTimeout))
+	if sw.idleTimer == nil {
+		sw.idleTimer = time.AfterFunc(sw.policy.IdleTimeout, sw.idleExpired)
+		return
+	}
+	sw.idleTimer.Reset(sw.policy.IdleTimeout)
+}
+
+func (sw *streamWriter) idleExpired() {
+	sw.mu.Lock()
+	stopped := sw.stopped
+	sw.mu.Unlock()
+	if stopped {
+		return
+	}
+	sw.logger.Warn("потоковый ответ прерван по таймауту простоя", "idle_timeout", sw.policy.IdleTimeout)
+	sw.cancel(errStreamIdleTimeout)
+}
+
+// stop останавливает таймеры после завершения обработки запроса
+func (sw *streamWriter) stop() {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+	sw.stopped = true
+	sw.flushPending = false
+	if sw.flushTimer != nil {
+		sw.flushTimer.Stop()
+	}
+	if sw.idleTimer != nil {
+		sw.idleTimer.Stop()
+	}
+}
+
+// Unwrap дает http.ResponseController доступ к Hijack и дедлайнам исходного writer'а
+func (sw *streamWriter) Unwrap() http.ResponseWriter {
+	return sw.ResponseWriter
+}
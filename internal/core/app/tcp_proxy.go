@@ -0,0 +1,154 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"github.com/athebyme/cloud-ru-assign/internal/core/domain/balancer"
+	"github.com/athebyme/cloud-ru-assign/internal/core/domain/routing"
+	"github.com/athebyme/cloud-ru-assign/internal/core/ports"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// TCPProxySettings задает параметры проксирования TCP соединений одного слушателя
+type TCPProxySettings struct {
+	ConnectTimeout  time.Duration // установка соединения с бэкендом, 0 - таймаут дайлера
+	ConnectAttempts int           // сколько бэкендов попробовать, если соединение не устанавливается
+	IdleTimeout     time.Duration // закрыть соединение без трафика в обе стороны, 0 - без ограничения
+	MaxLifetime     time.Duration // 0 - срок жизни не ограничен
+}
+
+// TCPProxyService реализует ports.StreamProxyService: выбирает бэкенд пула и передает байты в обе стороны
+// соединения учитываются так же, как переключенные HTTP соединения: с таймаутом простоя и закрытием в Drain
+type TCPProxyService struct {
+	repo     ports.BackendRepository
+	dialer   ports.StreamDialer
+	logger   ports.Logger
+	settings TCPProxySettings
+	tracker  *UpgradeTracker
+}
+
+// NewTCPProxyService создает сервис проксирования TCP соединений в пул repo
+func NewTCPProxyService(repo ports.BackendRepository, dialer ports.StreamDialer, logger ports.Logger, settings TCPProxySettings) *TCPProxyService {
+	if settings.ConnectAttempts <= 0 {
+		settings.ConnectAttempts = 1
+	}
+	return &TCPProxyService{
+		repo:     repo,
+		dialer:   dialer,
+		logger:   logger.With("service", "TCPProxyService"),
+		settings: settings,
+		tracker:  NewUpgradeTracker(),
+	}
+}
+
+// Active возвращает число открытых соединений
+func (s *TCPProxyService) Active() int64 {
+	return s.tracker.Active()
+}
+
+// Drain перестает принимать соединения, ждет закрытия открытых до отмены ctx и закрывает оставшиеся
+func (s *TCPProxyService) Drain(ctx context.Context) error {
+	return s.tracker.Drain(ctx)
+}
+
+// HandleConn реализует ports.StreamProxyService
+func (s *TCPProxyService) HandleConn(conn net.Conn) {
+	connLogger := s.logger.With("remote_addr", conn.RemoteAddr().String())
+
+	client := newUpgradedConn(conn, s.tracker, connLogger)
+	if !s.tracker.track(client) {
+		connLogger.Debug("соединение отклонено: балансировщик останавливается")
+		conn.Close()
+		return
+	}
+	defer client.Close()
+
+	backend, upstream, err := s.connect(connLogger)
+	if err != nil {
+		connLogger.Error("не удалось подключиться ни к одному бэкенду", "error", err)
+		return
+	}
+	defer upstream.Close()
+	s.repo.IncrementConnections(backend)
+	defer s.repo.DecrementConnections(backend)
+
+	// таймеры запускаются после соединения с бэкендом, чтобы установка соединения не считалась простоем
+	client.arm(routing.UpgradePolicy{IdleTimeout: s.settings.IdleTimeout, MaxLifetime: s.settings.MaxLifetime})
+
+	connLogger = connLogger.With("backend_url", backend.URL.String())
+	connLogger.Debug("TCP соединение установлено")
+	start := time.Now()
+	sent, received := splice(client, upstream)
+	connLogger.Debug("TCP соединение закрыто", "bytes_sent", sent, "bytes_received", received, "duration", time.Since(start))
+}
+
+// connect открывает соединение с бэкендом, при ошибке помечает его недоступным и пробует следующий
+func (s *TCPProxyService) connect(logger ports.Logger) (*balancer.Backend, net.Conn, error) {
+	var lastErr error
+	tried := make(map[string]struct{})
+	for attempt := 1; attempt <= s.settings.ConnectAttempts; attempt++ {
+		backend, ok := s.repo.GetNextHealthyBackend()
+		if !ok {
+			return nil, nil, errors.New("нет доступных бэкендов")
+		}
+		if _, failed := tried[backend.URL.String()]; failed {
+			break // стратегия вернула уже упавший бэкенд, других здоровых нет
+		}
+
+		upstream, err := s.dial(backend)
+		if err == nil {
+			return backend, upstream, nil
+		}
+
+		lastErr = err
+		tried[backend.URL.String()] = struct{}{}
+		s.repo.MarkBackendStatus(backend.URL, false)
+		logger.Warn("не удалось подключиться к бэкенду, он помечен недоступным", "backend_url", backend.URL.String(), "attempt", attempt, "error", err)
+	}
+	if lastErr == nil {
+		lastErr = errors.New("нет доступных бэкендов")
+	}
+	return nil, nil, lastErr
+}
+
+// dial открывает соединение с бэкендом с таймаутом слушателя, если он задан
+func (s *TCPProxyService) dial(backend *balancer.Backend) (net.Conn, error) {
+	if s.settings.ConnectTimeout <= 0 {
+		return s.dialer.Dial(context.Background(), backend)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), s.settings.ConnectTimeout)
+	defer cancel()
+	return s.dialer.Dial(ctx, backend)
+}
+
+// splice передает байты в обе стороны, пока обе стороны не закончат передачу
+// конец потока одной стороны передается другой полузакрытием, ошибка закрывает оба соединения
+func splice(client, upstream net.Conn) (sent, received int64) {
+	var wg sync.WaitGroup
+	wg.Add(2)
+	pipe := func(dst, src net.Conn, n *int64) {
+		defer wg.Done()
+		var err error
+		*n, err = io.Copy(dst, src)
+		if err != nil {
+			client.Close()
+			upstream.Close()
+			return
+		}
+		if cw, ok := dst.(interface{ CloseWrite() error }); !ok || cw.CloseWrite() != nil {
+			// без полузакрытия вторая сторона не узнает о конце потока
+			client.Close()
+			upstream.Close()
+		}
+	}
+	go pipe(upstream, client, &sent)
+	go pipe(client, upstream, &received)
+	wg.Wait()
+	return sent, received
+}
+
+var _ ports.StreamProxyService = (*TCPProxyService)(nil)
+var _ ports.ConnectionDrainer = (*TCPProxyService)(nil)
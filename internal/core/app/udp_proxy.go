@@ -0,0 +1,294 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"github.com/athebyme/cloud-ru-assign/internal/core/domain/balancer"
+	"github.com/athebyme/cloud-ru-assign/internal/core/ports"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// udpMaxDatagram размер буфера чтения ответов бэкенда, больше датаграмма UDP не бывает
+	udpMaxDatagram = 64 * 1024
+	// udpMaxQueued сколько датаграмм клиента ждет открытия сокета сессии, остальные отбрасываются
+	udpMaxQueued = 16
+	// udpDialTimeout ограничивает открытие сокета сессии вместе с разрешением имени бэкенда
+	udpDialTimeout = 5 * time.Second
+)
+
+// UDPProxySettings задает параметры проксирования UDP датаграмм одного слушателя
+type UDPProxySettings struct {
+	SessionIdleTimeout time.Duration // сессия без датаграмм в обе стороны удаляется, по умолчанию 30s
+	MaxSessions        int           // 0 - без ограничения, новые клиенты сверх лимита отбрасываются
+}
+
+// UDPProxyService реализует ports.DatagramProxyService
+// датаграммы клиента идут на бэкенд его сессии, выбранный стратегией пула при первой датаграмме,
+// а ответы бэкенда возвращаются тому же клиенту, пока сессия не истекла по простою
+type UDPProxyService struct {
+	repo     ports.BackendRepository
+	dialer   ports.DatagramDialer
+	logger   ports.Logger
+	settings UDPProxySettings
+
+	mu       sync.Mutex
+	sessions map[string]*udpSession // ключ: адрес клиента, слушатель и протокол у сервиса одни
+	draining bool
+	dropped  atomic.Uint64
+}
+
+// udpSession связывает клиента с бэкендом через отдельный UDP сокет
+// по адресу сокета бэкенд отличает клиентов, а балансировщик - его ответы
+// сокет открывается в фоне: имя бэкенда может разрешаться долго, а цикл чтения слушателя ждать не должен
+type udpSession struct {
+	key          string
+	backend      *balancer.Backend
+	reply        func(payload []byte) error
+	lastActivity atomic.Int64 // время последней датаграммы в наносекундах
+	closeOnce    sync.Once
+
+	mu       sync.Mutex
+	upstream net.Conn // nil, пока сокет открывается
+	queued   [][]byte // датаграммы клиента, пришедшие до открытия сокета
+	closed   bool
+}
+
+func (s *udpSession) touch() {
+	s.lastActivity.Store(time.Now().UnixNano())
+}
+
+// NewUDPProxyService создает сервис проксирования UDP датаграмм в пул repo
+func NewUDPProxyService(repo ports.BackendRepository, dialer ports.DatagramDialer, logger ports.Logger, settings UDPProxySettings) *UDPProxyService {
+	if settings.SessionIdleTimeout <= 0 {
+		settings.SessionIdleTimeout = 30 * time.Second
+	}
+	return &UDPProxyService{
+		repo:     repo,
+		dialer:   dialer,
+		logger:   logger.With("service", "UDPProxyService"),
+		settings: settings,
+		sessions: make(map[string]*udpSession),
+	}
+}
+
+// Sessions возвращает число активных сессий
+func (s *UDPProxyService) Sessions() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.sessions)
+}
+
+// Dropped возвращает число отброшенных датаграмм: нет бэкендов, лимит сессий или остановка
+func (s *UDPProxyService) Dropped() uint64 {
+	return s.dropped.Load()
+}
+
+// upstreamOrQueue возвращает сокет сессии, а пока он открывается - ставит датаграмму в очередь
+// false - датаграмма не поместилась в очередь или сессия уже закрыта
+func (us *udpSession) upstreamOrQueue(payload []byte) (net.Conn, bool) {
+	us.mu.Lock()
+	defer us.mu.Unlock()
+	if us.upstream != nil || us.closed {
+		return us.upstream, us.upstream != nil
+	}
+	if len(us.queued) >= udpMaxQueued {
+		return nil, false
+	}
+	us.queued = append(us.queued, payload)
+	return nil, true
+}
+
+// HandleDatagram реализует ports.DatagramProxyService
+func (s *UDPProxyService) HandleDatagram(payload []byte, client net.Addr, reply func(payload []byte) error) {
+	session, created, err := s.sessionFor(client, reply)
+	if err != nil {
+		s.dropped.Add(1)
+		s.logger.Debug("датаграмма отброшена", "client", client.String(), "error", err)
+		return
+	}
+
+	session.touch()
+	upstream, ok := session.upstreamOrQueue(payload)
+	if created {
+		go s.open(session)
+	}
+	if !ok {
+		s.dropped.Add(1)
+		s.logger.Debug("датаграмма отброшена: сокет сессии еще не открыт, очередь заполнена", "client", session.key)
+		return
+	}
+	if upstream == nil {
+		return // уйдет бэкенду, когда сокет откроется
+	}
+	s.send(session, upstream, payload)
+}
+
+// send отправляет датаграмму клиента бэкенду сессии
+func (s *UDPProxyService) send(session *udpSession, upstream net.Conn, payload []byte) {
+	if _, err := upstream.Write(payload); err != nil {
+		s.dropped.Add(1)
+		s.logger.Warn("не удалось отправить датаграмму бэкенду", "backend_url", session.backend.URL.String(), "error", err)
+		s.failSession(session)
+	}
+}
+
+// sessionFor возвращает сессию клиента, при первой датаграмме создает ее с новым бэкендом
+// сокет новой сессии (created) открывает вызывающий код вне мьютекса
+func (s *UDPProxyService) sessionFor(client net.Addr, reply func(payload []byte) error) (session *udpSession, created bool, err error) {
+	key := client.String()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if session, ok := s.sessions[key]; ok {
+		return session, false, nil
+	}
+	if s.draining {
+		return nil, false, errors.New("балансировщик останавливается, новые сессии не создаются")
+	}
+	if s.settings.MaxSessions > 0 && len(s.sessions) >= s.settings.MaxSessions {
+		return nil, false, errors.New("достигнут лимит сессий")
+	}
+
+	backend, ok := s.repo.GetNextHealthyBackend()
+	if !ok {
+		return nil, false, errors.New("нет доступных бэкендов")
+	}
+	session = &udpSession{key: key, backend: backend, reply: reply}
+	session.touch()
+	s.sessions[key] = session
+	s.repo.IncrementConnections(backend)
+	return session, true, nil
+}
+
+// open открывает сокет сессии, отправляет накопленные датаграммы и начинает читать ответы бэкенда
+func (s *UDPProxyService) open(session *udpSession) {
+	ctx, cancel := context.WithTimeout(context.Background(), udpDialTimeout)
+	defer cancel()
+	upstream, err := s.dialer.Dial(ctx, session.backend)
+	if err != nil {
+		session.mu.Lock()
+		s.dropped.Add(uint64(len(session.queued)))
+		session.mu.Unlock()
+		s.logger.Warn("не удалось открыть сокет до бэкенда", "backend_url", session.backend.URL.String(), "error", err)
+		s.failSession(session)
+		return
+	}
+
+	session.mu.Lock()
+	if session.closed {
+		// сессию закрыли, пока сокет открывался (остановка балансировщика)
+		session.mu.Unlock()
+		upstream.Close()
+		return
+	}
+	session.upstream = upstream
+	queued := session.queued
+	session.queued = nil
+	session.mu.Unlock()
+
+	for _, payload := range queued {
+		s.send(session, upstream, payload)
+	}
+	s.readReplies(session)
+}
+
+// readReplies возвращает клиенту ответы бэкенда и удаляет сессию после простоя
+// дедлайн чтения служит и таймером простоя: по его истечении проверяется активность в обе стороны
+func (s *UDPProxyService) readReplies(session *udpSession) {
+	buf := make([]byte, udpMaxDatagram)
+	for {
+		idle := time.Since(time.Unix(0, session.lastActivity.Load()))
+		if idle >= s.settings.SessionIdleTimeout {
+			s.logger.Debug("UDP сессия удалена по таймауту простоя", "client", session.key, "backend_url", session.backend.URL.String())
+			s.closeSession(session)
+			return
+		}
+		session.upstream.SetReadDeadline(time.Now().Add(s.settings.SessionIdleTimeout - idle))
+
+		n, err := session.upstream.Read(buf)
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				continue
+			}
+			if !errors.Is(err, net.ErrClosed) {
+				// ICMP port unreachable приходит как ошибка чтения связанного сокета
+				s.logger.Warn("бэкенд не принимает датаграммы", "backend_url", session.backend.URL.String(), "error", err)
+				s.failSession(session)
+			}
+			return
+		}
+
+		session.touch()
+		if err := session.reply(buf[:n]); err != nil {
+			s.logger.Debug("не удалось вернуть ответ клиенту", "client", session.key, "error", err)
+		}
+	}
+}
+
+// failSession помечает бэкенд сессии недоступным и удаляет сессию
+// следующая датаграмма клиента создаст сессию с другим бэкендом
+func (s *UDPProxyService) failSession(session *udpSession) {
+	s.repo.MarkBackendStatus(session.backend.URL, false)
+	s.closeSession(session)
+}
+
+func (s *UDPProxyService) closeSession(session *udpSession) {
+	session.closeOnce.Do(func() {
+		s.mu.Lock()
+		if s.sessions[session.key] == session {
+			delete(s.sessions, session.key)
+		}
+		s.mu.Unlock()
+
+		session.mu.Lock()
+		session.closed = true
+		session.queued = nil
+		upstream := session.upstream
+		session.mu.Unlock()
+		if upstream != nil {
+			upstream.Close()
+		}
+		s.repo.DecrementConnections(session.backend)
+	})
+}
+
+// Drain перестает создавать сессии и ждет их истечения до отмены ctx, после чего закрывает оставшиеся
+// у UDP нет закрытия соединения, поэтому ждать имеет смысл только ответов на уже отправленные датаграммы
+func (s *UDPProxyService) Drain(ctx context.Context) error {
+	s.mu.Lock()
+	s.draining = true
+	s.mu.Unlock()
+
+	ticker := time.NewTicker(upgradeDrainPollInterval)
+	defer ticker.Stop()
+	for s.Sessions() > 0 {
+		select {
+		case <-ctx.Done():
+			s.closeAll()
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+	return nil
+}
+
+func (s *UDPProxyService) closeAll() {
+	s.mu.Lock()
+	sessions := make([]*udpSession, 0, len(s.sessions))
+	for _, session := range s.sessions {
+		sessions = append(sessions, session)
+	}
+	s.mu.Unlock()
+
+	for _, session := range sessions {
+		s.closeSession(session)
+	}
+}
+
+var _ ports.DatagramProxyService = (*UDPProxyService)(nil)
+var _ ports.ConnectionDrainer = (*UDPProxyService)(nil)
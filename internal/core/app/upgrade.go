@@ -0,0 +1,249 @@
+package app
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"github.com/athebyme/cloud-ru-assign/internal/core/domain/routing"
+	"github.com/athebyme/cloud-ru-assign/internal/core/ports"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// upgradeDrainPollInterval как часто Drain проверяет, закрылись ли соединения
+const upgradeDrainPollInterval = 50 * time.Millisecond
+
+// errCloseWriteUnsupported возвращается, если соединение клиента не поддерживает полузакрытие
+// httputil.ReverseProxy в этом случае завершает туннель, как и без обертки
+var errCloseWriteUnsupported = errors.New("полузакрытие соединения не поддерживается")
+
+// UpgradeTracker учитывает соединения, переключенные на другой протокол (WebSocket и тд)
+// http.Server не отслеживает такие соединения после Hijack, поэтому их закрывает Drain
+type UpgradeTracker struct {
+	mu       sync.Mutex
+	conns    map[*upgradedConn]struct{}
+	draining bool
+
+	active atomic.Int64
+	total  atomic.Uint64
+}
+
+// NewUpgradeTracker создает учет переключенных соединений
+func NewUpgradeTracker() *UpgradeTracker {
+	return &UpgradeTracker{conns: make(map[*upgradedConn]struct{})}
+}
+
+// Active возвращает число открытых переключенных соединений
+func (t *UpgradeTracker) Active() int64 {
+	return t.active.Load()
+}
+
+// Total возвращает число переключенных соединений с момента старта
+func (t *UpgradeTracker) Total() uint64 {
+	return t.total.Load()
+}
+
+// Draining сообщает, что идет остановка и новые соединения не принимаются
+func (t *UpgradeTracker) Draining() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.draining
+}
+
+// Drain перестает принимать новые соединения и ждет закрытия открытых до отмены ctx,
+// после чего закрывает оставшиеся принудительно
+func (t *UpgradeTracker) Drain(ctx context.Context) error {
+	t.mu.Lock()
+	t.draining = true
+	t.mu.Unlock()
+
+	ticker := time.NewTicker(upgradeDrainPollInterval)
+	defer ticker.Stop()
+	for t.Active() > 0 {
+		select {
+		case <-ctx.Done():
+			t.closeAll()
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+	return nil
+}
+
+func (t *UpgradeTracker) closeAll() {
+	t.mu.Lock()
+	conns := make([]*upgradedConn, 0, len(t.conns))
+	for c := range t.conns {
+		conns = append(conns, c)
+	}
+	t.mu.Unlock()
+
+	for _, c := range conns {
+		c.Close()
+	}
+}
+
+// track регистрирует соединение, false - идет остановка
+func (t *UpgradeTracker) track(c *upgradedConn) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.draining {
+		return false
+	}
+	t.conns[c] = struct{}{}
+	t.active.Add(1)
+	t.total.Add(1)
+	return true
+}
+
+func (t *UpgradeTracker) untrack(c *upgradedConn) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, ok := t.conns[c]; ok {
+		delete(t.conns, c)
+		t.active.Add(-1)
+	}
+}
+
+// upgradedConn соединение клиента после Hijack с таймаутами простоя и срока жизни
+type upgradedConn struct {
+	net.Conn
+	tracker     *UpgradeTracker
+	logger      ports.Logger
+	idleTimeout time.Duration
+
+	lastActivity atomic.Int64 // время последнего чтения или записи в наносекундах
+
+	mu        sync.Mutex // защищает таймеры и closed
+	idleTimer *time.Timer
+	lifeTimer *time.Timer
+	closed    bool
+	closeErr  error
+}
+
+func newUpgradedConn(conn net.Conn, tracker *UpgradeTracker, logger ports.Logger) *upgradedConn {
+	c := &upgradedConn{
+		Conn:    conn,
+		tracker: tracker,
+		logger:  logger,
+	}
+	c.touch()
+	return c
+}
+
+// arm запускает таймеры простоя и срока жизни
+func (c *upgradedConn) arm(policy routing.UpgradePolicy) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return
+	}
+	c.idleTimeout = policy.IdleTimeout
+	if policy.IdleTimeout > 0 {
+		c.idleTimer = time.AfterFunc(policy.IdleTimeout, c.checkIdle)
+	}
+	if policy.MaxLifetime > 0 {
+		c.lifeTimer = time.AfterFunc(policy.MaxLifetime, func() {
+			c.logger.Info("переключенное соединение закрыто по истечении срока жизни")
+			c.Close()
+		})
+	}
+}
+
+func (c *upgradedConn) touch() {
+	c.lastActivity.Store(time.Now().UnixNano())
+}
+
+// checkIdle закрывает соединение, если трафика не было дольше idleTimeout, иначе переносит проверку
+// таймер не перезапускается на каждом чтении, чтобы не нагружать горячий путь
+func (c *upgradedConn) checkIdle() {
+	idle := time.Since(time.Unix(0, c.lastActivity.Load()))
+	if idle >= c.idleTimeout {
+		c.logger.Info("переключенное соединение закрыто по таймауту простоя", "idle", idle)
+		c.Close()
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.closed {
+		c.idleTimer.Reset(c.idleTimeout - idle)
+	}
+}
+
+func (c *upgradedConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	if n > 0 {
+		c.touch()
+	}
+	return n, err
+}
+
+func (c *upgradedConn) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	if n > 0 {
+		c.touch()
+	}
+	return n, err
+}
+
+// CloseWrite передает полузакрытие от бэкенда клиенту
+func (c *upgradedConn) CloseWrite() error {
+	if cw, ok := c.Conn.(interface{ CloseWrite() error }); ok {
+		return cw.CloseWrite()
+	}
+	return errCloseWriteUnsupported
+}
+
+func (c *upgradedConn) Close() error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return c.closeErr
+	}
+	c.closed = true
+	if c.idleTimer != nil {
+		c.idleTimer.Stop()
+	}
+	if c.lifeTimer != nil {
+		c.lifeTimer.Stop()
+	}
+	c.closeErr = c.Conn.Close()
+	c.mu.Unlock()
+
+	c.tracker.untrack(c)
+	return c.closeErr
+}
+
+// upgradeWriter подменяет Hijack, чтобы соединение после смены протокола попало под учет и таймауты
+type upgradeWriter struct {
+	http.ResponseWriter
+	tracker *UpgradeTracker
+	policy  routing.UpgradePolicy
+	logger  ports.Logger
+}
+
+func (uw *upgradeWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, brw, err := http.NewResponseController(uw.ResponseWriter).Hijack()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	c := newUpgradedConn(conn, uw.tracker, uw.logger)
+	if !uw.tracker.track(c) {
+		c.Close()
+		return nil, nil, errors.New("балансировщик останавливается, новые соединения не принимаются")
+	}
+	c.arm(uw.policy)
+	return c, brw, nil
+}
+
+// Unwrap дает http.ResponseController доступ к исходному writer'у
+func (uw *upgradeWriter) Unwrap() http.ResponseWriter {
+	return uw.ResponseWriter
+}
+
+var _ ports.ConnectionDrainer = (*UpgradeTracker)(nil)
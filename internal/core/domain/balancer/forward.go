@@ -0,0 +1,89 @@
+package balancer
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// ForwardErrorKind классифицирует причину неудачного проксирования
+// от нее зависит, можно ли безопасно повторить запрос на другом бэкенде
+type ForwardErrorKind int
+
+const (
+	ForwardErrorOther    ForwardErrorKind = iota // прочие ошибки проксирования
+	ForwardErrorConnect                          // не удалось установить соединение, запрос до бэкенда не дошел
+	ForwardErrorReset                            // соединение оборвано после отправки запроса
+	ForwardErrorTimeout                          // истек таймаут ожидания бэкенда
+	ForwardErrorCanceled                         // запрос отменен клиентом
+)
+
+// String возвращает имя вида ошибки (для логирования/конфигурации)
+func (k ForwardErrorKind) String() string {
+	switch k {
+	case ForwardErrorConnect:
+		return "connect"
+	case ForwardErrorReset:
+		return "reset"
+	case ForwardErrorTimeout:
+		return "timeout"
+	case ForwardErrorCanceled:
+		return "canceled"
+	default:
+		return "other"
+	}
+}
+
+// ForwardError ошибка проксирования с указанием ее вида
+type ForwardError struct {
+	Kind ForwardErrorKind
+	Err  error
+}
+
+func (e *ForwardError) Error() string { return e.Err.Error() }
+func (e *ForwardError) Unwrap() error { return e.Err }
+
+// KindOf возвращает вид ошибки проксирования, для неклассифицированных ошибок ForwardErrorOther
+func KindOf(err error) ForwardErrorKind {
+	var fe *ForwardError
+	if errors.As(err, &fe) {
+		return fe.Kind
+	}
+	return ForwardErrorOther
+}
+
+// IsIdempotent сообщает, можно ли повторить запрос без риска повторного побочного эффекта
+// идемпотентными считаются методы из RFC 7231 и запросы с заголовком Idempotency-Key (как в net/http)
+func IsIdempotent(r *http.Request) bool {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	if _, ok := r.Header["Idempotency-Key"]; ok {
+		return true
+	}
+	if _, ok := r.Header["X-Idempotency-Key"]; ok {
+		return true
+	}
+	return false
+}
+
+// IsUpgrade сообщает, просит ли клиент сменить протокол соединения (Connection: Upgrade)
+func IsUpgrade(r *http.Request) bool {
+	if r.Header.Get("Upgrade") == "" {
+		return false
+	}
+	for _, v := range r.Header.Values("Connection") {
+		for _, token := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(token), "upgrade") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// IsWebSocket сообщает, является ли запрос рукопожатием WebSocket
+func IsWebSocket(r *http.Request) bool {
+	return IsUpgrade(r) && strings.EqualFold(r.Header.Get("Upgrade"), "websocket")
+}
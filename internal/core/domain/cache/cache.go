@@ -0,0 +1,248 @@
+package cache
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Stats состояние кеша ответов
+type Stats struct {
+	Entries int    `json:"entries"`
+	Bytes   int64  `json:"bytes"`
+	Hits    uint64 `json:"hits"`
+	Misses  uint64 `json:"misses"`
+}
+
+// Directives разобранный заголовок Cache-Control
+type Directives struct {
+	NoStore              bool
+	NoCache              bool
+	Private              bool
+	MaxAge               time.Duration
+	HasMaxAge            bool
+	SMaxAge              time.Duration
+	HasSMaxAge           bool
+	StaleWhileRevalidate time.Duration
+}
+
+// ParseCacheControl разбирает все значения Cache-Control, неизвестные директивы игнорируются
+func ParseCacheControl(h http.Header) Directives {
+	var d Directives
+	for _, line := range h.Values("Cache-Control") {
+		for _, part := range strings.Split(line, ",") {
+			name, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+			value = strings.Trim(value, `"`)
+			switch strings.ToLower(name) {
+			case "no-store":
+				d.NoStore = true
+			case "no-cache":
+				d.NoCache = true
+			case "private":
+				d.Private = true
+			case "max-age":
+				d.MaxAge, d.HasMaxAge = parseSeconds(value)
+			case "s-maxage":
+				d.SMaxAge, d.HasSMaxAge = parseSeconds(value)
+			case "stale-while-revalidate":
+				d.StaleWhileRevalidate, _ = parseSeconds(value)
+			}
+		}
+	}
+	return d
+}
+
+func parseSeconds(value string) (time.Duration, bool) {
+	seconds, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || seconds < 0 {
+		return 0, false
+	}
+	return time.Duration(seconds) * time.Second, true
+}
+
+// cacheableStatus статусы, которые можно сохранять при явном сроке свежести
+var cacheableStatus = map[int]bool{
+	http.StatusOK: true, http.StatusNonAuthoritativeInfo: true, http.StatusNoContent: true,
+	http.StatusMultipleChoices: true, http.StatusMovedPermanently: true, http.StatusPermanentRedirect: true,
+	http.StatusNotFound: true, http.StatusGone: true,
+}
+
+// Cacheable сообщает, можно ли обслужить запрос из кеша и сохранить ответ на него
+// запросы с авторизацией не кешируются: общий кеш не должен раздавать чужие ответы
+func Cacheable(r *http.Request) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+	return r.Header.Get("Authorization") == ""
+}
+
+// WantsRevalidation сообщает, что клиент просит не отдавать ответ из кеша без проверки у бэкенда
+func WantsRevalidation(r *http.Request) bool {
+	d := ParseCacheControl(r.Header)
+	if d.NoCache || d.NoStore || (d.HasMaxAge && d.MaxAge == 0) {
+		return true
+	}
+	return r.Header.Get("Cache-Control") == "" && r.Header.Get("Pragma") == "no-cache"
+}
+
+// Lifetime вычисляет срок свежести ответа и окно stale-while-revalidate
+// false - ответ сохранять нельзя: no-store, private, Set-Cookie, Vary: * или нет явного срока
+func Lifetime(status int, h http.Header, now time.Time) (fresh, staleWhileRevalidate time.Duration, ok bool) {
+	if !cacheableStatus[status] {
+		return 0, 0, false
+	}
+	d := ParseCacheControl(h)
+	if d.NoStore || d.Private || h.Get("Set-Cookie") != "" || h.Get("Vary") == "*" {
+		return 0, 0, false
+	}
+
+	switch {
+	case d.HasSMaxAge:
+		fresh = d.SMaxAge
+	case d.HasMaxAge:
+		fresh = d.MaxAge
+	case h.Get("Expires") != "":
+		expires, err := http.ParseTime(h.Get("Expires"))
+		if err != nil {
+			return 0, 0, false // некорректный Expires означает уже устаревший ответ
+		}
+		date := now
+		if parsed, err := http.ParseTime(h.Get("Date")); err == nil {
+			date = parsed
+		}
+		fresh = expires.Sub(date)
+	default:
+		if !d.NoCache {
+			return 0, 0, false // эвристическую свежесть не вычисляем
+		}
+	}
+	if age, err := strconv.ParseInt(h.Get("Age"), 10, 64); err == nil && age > 0 {
+		fresh -= time.Duration(age) * time.Second
+	}
+	if d.NoCache || fresh < 0 {
+		fresh = 0 // хранится только ради валидаторов, каждый раз проверяется у бэкенда
+	}
+	return fresh, d.StaleWhileRevalidate, true
+}
+
+// VaryHeaders возвращает отсортированные имена заголовков из Vary
+func VaryHeaders(h http.Header) []string {
+	var names []string
+	for _, line := range h.Values("Vary") {
+		for _, name := range strings.Split(line, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				names = append(names, http.CanonicalHeaderKey(name))
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// VaryKey собирает значения заголовков vary из запроса для ключа варианта ответа
+func VaryKey(vary []string, r *http.Request) string {
+	var b strings.Builder
+	for _, name := range vary {
+		b.WriteString(name)
+		b.WriteByte('=')
+		b.WriteString(strings.Join(r.Header.Values(name), ","))
+		b.WriteByte(';')
+	}
+	return b.String()
+}
+
+// Entry сохраненный ответ
+// запись с непустым Vary без тела - маркер: ответы по ключу различаются по заголовкам запроса
+type Entry struct {
+	Status     int
+	Header     http.Header
+	Body       []byte
+	StoredAt   time.Time
+	FreshUntil time.Time
+	StaleUntil time.Time // до этого момента устаревший ответ отдается, пока идет фоновая проверка
+	Vary       []string
+}
+
+// entryOverhead примерный размер служебных полей записи для учета памяти
+const entryOverhead = 256
+
+// Size оценивает занимаемую записью память
+func (e *Entry) Size() int64 {
+	size := int64(len(e.Body)) + entryOverhead
+	for k, values := range e.Header {
+		size += int64(len(k))
+		for _, v := range values {
+			size += int64(len(v))
+		}
+	}
+	for _, name := range e.Vary {
+		size += int64(len(name))
+	}
+	return size
+}
+
+// Fresh сообщает, что ответ можно отдать без проверки у бэкенда
+func (e *Entry) Fresh(now time.Time) bool {
+	return now.Before(e.FreshUntil)
+}
+
+// StaleWhileRevalidate сообщает, что ответ устарел, но его можно отдать, обновляя в фоне
+func (e *Entry) StaleWhileRevalidate(now time.Time) bool {
+	return !e.Fresh(now) && now.Before(e.StaleUntil)
+}
+
+// Age возраст ответа в секундах для заголовка Age
+func (e *Entry) Age(now time.Time) int64 {
+	return int64(now.Sub(e.StoredAt) / time.Second)
+}
+
+// HasValidators сообщает, что ответ можно проверить условным запросом
+func (e *Entry) HasValidators() bool {
+	return e.Header.Get("ETag") != "" || e.Header.Get("Last-Modified") != ""
+}
+
+// Refreshed возвращает копию записи, продленную ответом 304: заголовки свежести и валидаторы берутся из него
+// сама запись не меняется, тк ее в это время могут отдавать другие запросы
+func (e *Entry) Refreshed(h http.Header, now time.Time) (*Entry, bool) {
+	merged := e.Header.Clone()
+	for _, name := range []string{"Cache-Control", "Expires", "Date", "ETag", "Last-Modified", "Age"} {
+		if values, ok := h[name]; ok {
+			merged[name] = values
+		}
+	}
+	fresh, swr, ok := Lifetime(e.Status, merged, now)
+	if !ok {
+		return nil, false
+	}
+	refreshed := *e
+	refreshed.Header = merged
+	refreshed.StoredAt = now
+	refreshed.FreshUntil = now.Add(fresh)
+	refreshed.StaleUntil = refreshed.FreshUntil.Add(swr)
+	return &refreshed, true
+}
+
+// NotModified сообщает, что условный запрос клиента совпадает с сохраненным ответом
+func (e *Entry) NotModified(r *http.Request) bool {
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		etag := e.Header.Get("ETag")
+		if etag == "" {
+			return false
+		}
+		for _, candidate := range strings.Split(inm, ",") {
+			candidate = strings.TrimSpace(candidate)
+			if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+				return true
+			}
+		}
+		return false
+	}
+	if ims := r.Header.Get("If-Modified-Since"); ims != "" {
+		since, err := http.ParseTime(ims)
+		modified, err2 := http.ParseTime(e.Header.Get("Last-Modified"))
+		return err == nil && err2 == nil && !modified.After(since)
+	}
+	return false
+}
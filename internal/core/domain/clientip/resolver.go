@@ -0,0 +1,112 @@
+package clientip
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/athebyme/cloud-ru-assign/internal/core/domain/reqctx"
+)
+
+// Resolver определяет реальный IP клиента по цепочке X-Forwarded-For / Forwarded
+// заголовкам верят только если их прислал доверенный прокси
+type Resolver struct {
+	trusted []*net.IPNet
+}
+
+// NewResolver создает резолвер, cidrs - подсети доверенных прокси (одиночный адрес тоже допустим)
+func NewResolver(cidrs []string) (*Resolver, error) {
+	r := &Resolver{}
+	for _, cidr := range cidrs {
+		if !strings.Contains(cidr, "/") {
+			ip := net.ParseIP(cidr)
+			if ip == nil {
+				return nil, fmt.Errorf("некорректный адрес доверенного прокси: %s", cidr)
+			}
+			bits := 128
+			if ip.To4() != nil {
+				bits = 32
+			}
+			cidr = fmt.Sprintf("%s/%d", cidr, bits)
+		}
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("некорректная подсеть доверенных прокси %s: %w", cidr, err)
+		}
+		r.trusted = append(r.trusted, network)
+	}
+	return r, nil
+}
+
+// Trusted сообщает, входит ли адрес в доверенные подсети
+func (r *Resolver) Trusted(ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	for _, network := range r.trusted {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Resolve вычисляет клиента запроса
+// цепочка разбирается справа налево, клиентом считается первый адрес не из доверенных подсетей
+func (r *Resolver) Resolve(req *http.Request) reqctx.Client {
+	peer := hostOf(req.RemoteAddr)
+	peerIP := net.ParseIP(peer)
+	if !r.Trusted(peerIP) {
+		return reqctx.Client{IP: peer}
+	}
+
+	chain := forwardedFor(req.Header)
+	client := reqctx.Client{IP: peer, PeerTrusted: true}
+	for i := len(chain) - 1; i >= 0; i-- {
+		ip := net.ParseIP(hostOf(chain[i]))
+		if ip == nil {
+			break // мусор в цепочке: дальше ему верить нельзя, берем последний разобранный адрес
+		}
+		client.IP = ip.String()
+		if !r.Trusted(ip) {
+			break
+		}
+	}
+	return client
+}
+
+// forwardedFor возвращает цепочку адресов из X-Forwarded-For, а если его нет - из Forwarded (RFC 7239)
+func forwardedFor(h http.Header) []string {
+	var chain []string
+	for _, v := range h.Values("X-Forwarded-For") {
+		for _, part := range strings.Split(v, ",") {
+			if part = strings.TrimSpace(part); part != "" {
+				chain = append(chain, part)
+			}
+		}
+	}
+	if len(chain) > 0 {
+		return chain
+	}
+
+	for _, v := range h.Values("Forwarded") {
+		for _, element := range strings.Split(v, ",") {
+			for _, pair := range strings.Split(element, ";") {
+				key, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+				if ok && strings.EqualFold(key, "for") {
+					chain = append(chain, strings.Trim(value, `"`))
+				}
+			}
+		}
+	}
+	return chain
+}
+
+// hostOf отбрасывает порт и скобки IPv6: "1.2.3.4:80" -> "1.2.3.4", "[::1]:80" -> "::1"
+func hostOf(addr string) string {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return strings.Trim(addr, "[]")
+}
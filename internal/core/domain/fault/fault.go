@@ -0,0 +1,214 @@
+package fault
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/athebyme/cloud-ru-assign/internal/core/domain/clientip"
+	"github.com/athebyme/cloud-ru-assign/internal/core/domain/reqctx"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Delay задержка перед отправкой запроса бэкенду: Fixed плюс случайная добавка до Random
+type Delay struct {
+	Fixed   time.Duration
+	Random  time.Duration
+	Percent float64 // доля запросов с задержкой, 0-100
+}
+
+// Abort ответ балансировщика без обращения к бэкенду
+type Abort struct {
+	Status  int
+	Percent float64
+}
+
+// Throttle ограничение скорости передачи тела ответа клиенту
+type Throttle struct {
+	BytesPerSecond int64
+	Percent        float64
+}
+
+// пределы явных сбоев из заголовка по умолчанию
+const (
+	DefaultMaxDelay          = 30 * time.Second
+	DefaultMinBytesPerSecond = 1024
+)
+
+// ErrInjected оборачивает ошибки, которые вызвал внесенный сбой, а не бэкенд
+var ErrInjected = errors.New("внесенный сбой")
+
+// Policy сбои, которые маршрут вносит в запросы для проверки устойчивости клиентов
+// с Header сбои вносятся только в запросы с этим заголовком от доверенных отправителей, так их можно включать точечно
+// без Header сбои вносятся во все запросы маршрута, и это нужно включить явно через AllTraffic
+type Policy struct {
+	Header     string
+	AllTraffic bool
+	// отправители, которым разрешено включать сбои заголовком, nil - доверенные прокси из ClientIPMiddleware
+	Trusted *clientip.Resolver
+	// пределы явных сбоев из заголовка: задержка не дольше MaxDelay, скорость не ниже MinBytesPerSecond
+	// 0 - DefaultMaxDelay и DefaultMinBytesPerSecond
+	MaxDelay          time.Duration
+	MinBytesPerSecond int64
+	Delay             *Delay
+	Abort             *Abort
+	Throttle          *Throttle
+}
+
+// Plan сбои, выбранные для конкретного запроса
+type Plan struct {
+	Delay          time.Duration
+	AbortStatus    int   // 0 - без прерывания
+	BytesPerSecond int64 // 0 - без ограничения скорости
+}
+
+// IsZero сообщает, что в запрос ничего не вносится
+func (p Plan) IsZero() bool {
+	return p.Delay == 0 && p.AbortStatus == 0 && p.BytesPerSecond == 0
+}
+
+// PlanFor выбирает сбои для запроса
+// значение заголовка вида "delay=2s,abort=503,throttle=1024" задает сбои явно и вносит их всегда,
+// любое другое значение включает сбои из конфигурации с их долями
+// заголовок от недоверенного отправителя игнорируется: иначе любой клиент мог бы задерживать запросы балансировщика
+func (p *Policy) PlanFor(r *http.Request) Plan {
+	if p.Header == "" {
+		if !p.AllTraffic {
+			return Plan{}
+		}
+	} else {
+		value := r.Header.Get(p.Header)
+		if value == "" || !p.trusted(r) {
+			return Plan{}
+		}
+		if plan, ok := parsePlan(value); ok {
+			return p.clamp(plan)
+		}
+	}
+
+	var plan Plan
+	if p.Delay != nil && sample(p.Delay.Percent) {
+		plan.Delay = p.Delay.Fixed
+		if p.Delay.Random > 0 {
+			plan.Delay += rand.N(p.Delay.Random)
+		}
+	}
+	if p.Abort != nil && sample(p.Abort.Percent) {
+		plan.AbortStatus = p.Abort.Status
+	}
+	if p.Throttle != nil && sample(p.Throttle.Percent) {
+		plan.BytesPerSecond = p.Throttle.BytesPerSecond
+	}
+	return plan
+}
+
+// trusted сообщает, можно ли включать сбои заголовком из запроса r
+func (p *Policy) trusted(r *http.Request) bool {
+	if p.Trusted != nil {
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			host = r.RemoteAddr
+		}
+		return p.Trusted.Trusted(net.ParseIP(host))
+	}
+	client, ok := reqctx.ClientFrom(r.Context())
+	return ok && client.PeerTrusted
+}
+
+// clamp ограничивает явные сбои пределами политики
+func (p *Policy) clamp(plan Plan) Plan {
+	maxDelay := p.MaxDelay
+	if maxDelay <= 0 {
+		maxDelay = DefaultMaxDelay
+	}
+	minBytesPerSecond := p.MinBytesPerSecond
+	if minBytesPerSecond <= 0 {
+		minBytesPerSecond = DefaultMinBytesPerSecond
+	}
+	plan.Delay = min(plan.Delay, maxDelay)
+	if plan.BytesPerSecond > 0 {
+		plan.BytesPerSecond = max(plan.BytesPerSecond, minBytesPerSecond)
+	}
+	return plan
+}
+
+// parsePlan разбирает явные сбои из заголовка, false - в значении нет ни одного известного сбоя
+func parsePlan(value string) (Plan, bool) {
+	var plan Plan
+	found := false
+	for _, part := range strings.Split(value, ",") {
+		name, arg, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			continue
+		}
+		switch strings.ToLower(name) {
+		case "delay":
+			if d, err := time.ParseDuration(arg); err == nil && d > 0 {
+				plan.Delay, found = d, true
+			}
+		case "abort":
+			if status, err := strconv.Atoi(arg); err == nil && ValidStatus(status) {
+				plan.AbortStatus, found = status, true
+			}
+		case "throttle":
+			if bps, err := strconv.ParseInt(arg, 10, 64); err == nil && bps > 0 {
+				plan.BytesPerSecond, found = bps, true
+			}
+		}
+	}
+	return plan, found
+}
+
+// ValidStatus проверяет статус прерывания: только финальные ответы 200-599
+func ValidStatus(status int) bool {
+	return status >= 200 && status <= 599
+}
+
+// Validate проверяет политику
+func (p *Policy) Validate() error {
+	if p.Header == "" && !p.AllTraffic {
+		return fmt.Errorf("header: без заголовка сбои вносятся во все запросы маршрута, это включается явно через allTraffic: true")
+	}
+	if p.Header != "" && p.AllTraffic {
+		return fmt.Errorf("allTraffic: несовместим с header, сбои вносятся либо по заголовку, либо во все запросы")
+	}
+	if p.MaxDelay < 0 || p.MinBytesPerSecond < 0 {
+		return fmt.Errorf("maxDelay и minBytesPerSecond не могут быть отрицательными")
+	}
+	if p.Delay != nil && (p.Delay.Fixed < 0 || p.Delay.Random < 0 || !validPercent(p.Delay.Percent)) {
+		return fmt.Errorf("delay: задержки не могут быть отрицательными, percent должен быть в диапазоне 0-100")
+	}
+	if p.Abort != nil && (!ValidStatus(p.Abort.Status) || !validPercent(p.Abort.Percent)) {
+		return fmt.Errorf("abort: status должен быть в диапазоне 200-599, percent в диапазоне 0-100")
+	}
+	if p.Throttle != nil && (p.Throttle.BytesPerSecond <= 0 || !validPercent(p.Throttle.Percent)) {
+		return fmt.Errorf("throttle: bytesPerSecond должен быть положительным, percent в диапазоне 0-100")
+	}
+	return nil
+}
+
+func validPercent(percent float64) bool {
+	return percent >= 0 && percent <= 100
+}
+
+func sample(percent float64) bool {
+	return percent >= 100 || (percent > 0 && rand.Float64()*100 < percent)
+}
+
+type planKey struct{}
+
+// WithPlan сохраняет сбои, выбранные для запроса, в его контексте
+// план выбирается один раз на запрос, повторные попытки получают те же сбои
+func WithPlan(ctx context.Context, plan Plan) context.Context {
+	return context.WithValue(ctx, planKey{}, plan)
+}
+
+// PlanFrom возвращает сбои запроса, нулевой план если их нет
+func PlanFrom(ctx context.Context) Plan {
+	plan, _ := ctx.Value(planKey{}).(Plan)
+	return plan
+}
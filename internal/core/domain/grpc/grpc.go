@@ -0,0 +1,147 @@
+package grpc
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Code код статуса gRPC из трейлера grpc-status
+type Code int
+
+const (
+	OK                 Code = 0
+	Canceled           Code = 1
+	Unknown            Code = 2
+	InvalidArgument    Code = 3
+	DeadlineExceeded   Code = 4
+	NotFound           Code = 5
+	AlreadyExists      Code = 6
+	PermissionDenied   Code = 7
+	ResourceExhausted  Code = 8
+	FailedPrecondition Code = 9
+	Aborted            Code = 10
+	OutOfRange         Code = 11
+	Unimplemented      Code = 12
+	Internal           Code = 13
+	Unavailable        Code = 14
+	DataLoss           Code = 15
+	Unauthenticated    Code = 16
+)
+
+var codeNames = []string{
+	"OK", "CANCELLED", "UNKNOWN", "INVALID_ARGUMENT", "DEADLINE_EXCEEDED", "NOT_FOUND", "ALREADY_EXISTS",
+	"PERMISSION_DENIED", "RESOURCE_EXHAUSTED", "FAILED_PRECONDITION", "ABORTED", "OUT_OF_RANGE",
+	"UNIMPLEMENTED", "INTERNAL", "UNAVAILABLE", "DATA_LOSS", "UNAUTHENTICATED",
+}
+
+func (c Code) String() string {
+	if c >= 0 && int(c) < len(codeNames) {
+		return codeNames[c]
+	}
+	return "CODE(" + strconv.Itoa(int(c)) + ")"
+}
+
+// ParseCode принимает имя кода (UNAVAILABLE) или его номер (14)
+func ParseCode(s string) (Code, error) {
+	for i, name := range codeNames {
+		if strings.EqualFold(s, name) {
+			return Code(i), nil
+		}
+	}
+	if n, err := strconv.Atoi(s); err == nil && n >= 0 && n < len(codeNames) {
+		return Code(n), nil
+	}
+	return 0, fmt.Errorf("неизвестный код gRPC: %s", s)
+}
+
+// IsGRPC сообщает, что запрос - вызов gRPC (application/grpc, application/grpc+proto и тд)
+func IsGRPC(r *http.Request) bool {
+	ct := r.Header.Get("Content-Type")
+	return ct == "application/grpc" || strings.HasPrefix(ct, "application/grpc+") || strings.HasPrefix(ct, "application/grpc;")
+}
+
+// StatusOf возвращает grpc-status ответа
+// трейлеры реверс-прокси дописывает в те же заголовки, а в ответе Trailers-Only статус приходит сразу в них
+func StatusOf(h http.Header) (Code, bool) {
+	raw := h.Get("Grpc-Status")
+	if raw == "" {
+		return 0, false
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil {
+		return Unknown, true
+	}
+	return Code(n), true
+}
+
+// Policy задает обработку gRPC вызовов маршрута
+type Policy struct {
+	RetryOn []Code // коды, при которых вызов повторяется, только для идемпотентных методов
+	// методы (/pkg.Service/Method) или сервисы целиком (/pkg.Service/), которые безопасно повторять
+	// идемпотентность метода в gRPC не видна по запросу: все вызовы - POST
+	Idempotent []string
+}
+
+// IsIdempotent сообщает, что метод method (путь запроса) объявлен идемпотентным
+func (p *Policy) IsIdempotent(method string) bool {
+	for _, m := range p.Idempotent {
+		if m == method || (strings.HasSuffix(m, "/") && strings.HasPrefix(method, m)) {
+			return true
+		}
+	}
+	return false
+}
+
+// RetriesCode сообщает, повторяется ли вызов, завершившийся кодом code
+func (p *Policy) RetriesCode(code Code) bool {
+	for _, c := range p.RetryOn {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+// CodeForStatus переводит статус ошибки, сформированной самим балансировщиком, в код gRPC
+func CodeForStatus(status int) Code {
+	switch status {
+	case http.StatusBadRequest:
+		return Internal
+	case http.StatusTooManyRequests:
+		return ResourceExhausted
+	case http.StatusGatewayTimeout:
+		return DeadlineExceeded
+	case http.StatusBadGateway, http.StatusServiceUnavailable:
+		return Unavailable
+	default:
+		return Unknown
+	}
+}
+
+// WriteError отвечает на вызов gRPC ошибкой в виде Trailers-Only: HTTP 200 и статус в заголовках
+// клиенты gRPC не разбирают HTTP статусы и текст ошибки, им нужен grpc-status
+func WriteError(w http.ResponseWriter, code Code, message string) {
+	h := w.Header()
+	h.Set("Content-Type", "application/grpc")
+	h.Set("Grpc-Status", strconv.Itoa(int(code)))
+	if message != "" {
+		h.Set("Grpc-Message", encodeMessage(message))
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// encodeMessage кодирует grpc-message: percent-encoding всего, что вне печатного ASCII, и самого %
+func encodeMessage(message string) string {
+	var b strings.Builder
+	for i := 0; i < len(message); i++ {
+		c := message[i]
+		if c < 0x20 || c > 0x7e || c == '%' {
+			fmt.Fprintf(&b, "%%%02X", c)
+			continue
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
@@ -0,0 +1,146 @@
+package headers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Vars значения переменных, доступных в шаблонах заголовков
+type Vars struct {
+	ClientIP  string // ${client_ip}
+	RequestID string // ${request_id}
+	Backend   string // ${backend} - хост выбранного бэкенда
+	Host      string // ${host} - Host запроса клиента
+	Method    string // ${method}
+	Path      string // ${path} - путь запроса клиента
+}
+
+func (v Vars) lookup(name string) (string, bool) {
+	switch name {
+	case "client_ip":
+		return v.ClientIP, true
+	case "request_id":
+		return v.RequestID, true
+	case "backend":
+		return v.Backend, true
+	case "host":
+		return v.Host, true
+	case "method":
+		return v.Method, true
+	case "path":
+		return v.Path, true
+	}
+	return "", false
+}
+
+// Template значение заголовка с подстановкой переменных вида ${client_ip}
+type Template struct {
+	parts []templatePart
+}
+
+type templatePart struct {
+	literal  string
+	variable string // пусто - часть без подстановки
+}
+
+// ParseTemplate разбирает шаблон, неизвестная переменная - ошибка конфигурации
+func ParseTemplate(s string) (Template, error) {
+	var t Template
+	for s != "" {
+		start := strings.Index(s, "${")
+		if start < 0 {
+			t.parts = append(t.parts, templatePart{literal: s})
+			break
+		}
+		if start > 0 {
+			t.parts = append(t.parts, templatePart{literal: s[:start]})
+		}
+		end := strings.IndexByte(s[start:], '}')
+		if end < 0 {
+			return Template{}, fmt.Errorf("незакрытая переменная в шаблоне %q", s)
+		}
+		name := s[start+2 : start+end]
+		if _, ok := (Vars{}).lookup(name); !ok {
+			return Template{}, fmt.Errorf("неизвестная переменная ${%s} в шаблоне заголовка", name)
+		}
+		t.parts = append(t.parts, templatePart{variable: name})
+		s = s[start+end+1:]
+	}
+	return t, nil
+}
+
+// Render подставляет значения переменных
+func (t Template) Render(vars Vars) string {
+	if len(t.parts) == 1 && t.parts[0].variable == "" {
+		return t.parts[0].literal
+	}
+	var b strings.Builder
+	for _, p := range t.parts {
+		if p.variable == "" {
+			b.WriteString(p.literal)
+			continue
+		}
+		value, _ := vars.lookup(p.variable)
+		b.WriteString(value)
+	}
+	return b.String()
+}
+
+// Header заголовок и шаблон его значения
+type Header struct {
+	Name  string
+	Value Template
+}
+
+// Ops изменения одного набора заголовков, применяются в порядке: удаление, замена, добавление
+type Ops struct {
+	Remove []string
+	Set    []Header
+	Add    []Header
+}
+
+// IsZero сообщает, что изменений нет
+func (o Ops) IsZero() bool {
+	return len(o.Remove) == 0 && len(o.Set) == 0 && len(o.Add) == 0
+}
+
+// Apply применяет изменения к заголовкам
+// значение, которое после подстановки оказалось пустым, не выставляется: пустой заголовок бэкенду не нужен
+func (o Ops) Apply(h http.Header, vars Vars) {
+	for _, name := range o.Remove {
+		h.Del(name)
+	}
+	for _, hdr := range o.Set {
+		if value := hdr.Value.Render(vars); value != "" {
+			h.Set(hdr.Name, value)
+		} else {
+			h.Del(hdr.Name)
+		}
+	}
+	for _, hdr := range o.Add {
+		if value := hdr.Value.Render(vars); value != "" {
+			h.Add(hdr.Name, value)
+		}
+	}
+}
+
+// Rules правила заголовков маршрута или пула
+type Rules struct {
+	Request  Ops // заголовки запроса перед отправкой бэкенду
+	Response Ops // заголовки ответа перед отправкой клиенту
+}
+
+type rulesKey struct{}
+
+// WithRules сохраняет правила, которые нужно применить к запросу, в порядке применения
+func WithRules(ctx context.Context, rules []*Rules) context.Context {
+	return context.WithValue(ctx, rulesKey{}, rules)
+}
+
+// RulesFrom возвращает правила запроса, nil если их нет
+func RulesFrom(ctx context.Context) []*Rules {
+	rules, _ := ctx.Value(rulesKey{}).([]*Rules)
+	return rules
+}
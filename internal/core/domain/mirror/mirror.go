@@ -0,0 +1,67 @@
+package mirror
+
+import (
+	"math/rand/v2"
+	"time"
+)
+
+// Policy описывает зеркалирование запросов маршрута в теневой пул
+// ответы теневого пула клиенту не отдаются, по ним только собирается статистика
+type Policy struct {
+	Pool         string        // теневой пул
+	Percent      float64       // доля зеркалируемых запросов, 0-100
+	MaxBodyBytes int64         // запросы с телом больше лимита не зеркалируются
+	Timeout      time.Duration // ограничение на теневой запрос
+}
+
+// Sample решает, зеркалировать ли очередной запрос
+func (p *Policy) Sample() bool {
+	if p.Percent >= 100 {
+		return true
+	}
+	return p.Percent > 0 && rand.Float64()*100 < p.Percent
+}
+
+// Stats сравнение теневых ответов с основными для одного маршрута
+type Stats struct {
+	Mirrored         uint64         `json:"mirrored"`          // отправлено теневых запросов
+	Dropped          uint64         `json:"dropped"`           // пропущено из-за лимита одновременных запросов
+	SkippedBody      uint64         `json:"skipped_body"`      // пропущено из-за размера тела
+	Errors           uint64         `json:"errors"`            // теневой запрос не получил ответа
+	Compared         uint64         `json:"compared"`          // пары, где ответили оба запроса
+	StatusMismatches uint64         `json:"status_mismatches"` // статус теневого ответа отличается от основного
+	Statuses         map[int]uint64 `json:"statuses"`          // статусы теневых ответов
+	ShadowLatency    time.Duration  `json:"shadow_latency_avg"`
+	PrimaryLatency   time.Duration  `json:"primary_latency_avg"`
+}
+
+// Result итог одной пары основного и теневого запросов
+type Result struct {
+	ShadowStatus   int // 0 - теневой запрос завершился ошибкой
+	ShadowLatency  time.Duration
+	PrimaryStatus  int
+	PrimaryLatency time.Duration
+}
+
+// Record добавляет результат пары запросов в статистику
+func (s *Stats) Record(res Result) {
+	if res.ShadowStatus == 0 {
+		s.Errors++
+		return
+	}
+	s.ShadowLatency = average(s.ShadowLatency, res.ShadowLatency, s.Compared)
+	s.PrimaryLatency = average(s.PrimaryLatency, res.PrimaryLatency, s.Compared)
+	s.Compared++
+	if s.Statuses == nil {
+		s.Statuses = make(map[int]uint64)
+	}
+	s.Statuses[res.ShadowStatus]++
+	if res.ShadowStatus != res.PrimaryStatus {
+		s.StatusMismatches++
+	}
+}
+
+// average пересчитывает среднее из n значений с добавлением еще одного
+func average(avg, value time.Duration, n uint64) time.Duration {
+	return avg + (value-avg)/time.Duration(n+1)
+}
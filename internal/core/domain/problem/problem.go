@@ -0,0 +1,262 @@
+package problem
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/athebyme/cloud-ru-assign/internal/core/domain/grpc"
+	"github.com/athebyme/cloud-ru-assign/internal/core/domain/reqctx"
+	htmltemplate "html/template"
+	"net/http"
+	"strconv"
+	"strings"
+	texttemplate "text/template"
+)
+
+// Problem ошибка, сформированная самим балансировщиком, в виде RFC 7807
+// поля доступны в шаблонах: {{.Status}}, {{.Title}}, {{.Detail}}, {{.Instance}}, {{.RequestID}}
+type Problem struct {
+	Type      string `json:"type"`
+	Title     string `json:"title"`
+	Status    int    `json:"status"`
+	Detail    string `json:"detail,omitempty"`
+	Instance  string `json:"instance,omitempty"`  // путь запроса клиента
+	RequestID string `json:"requestId,omitempty"` // расширение RFC 7807: по нему ошибку находят в логах
+}
+
+// New описывает ошибку status для запроса r, detail - подробности для клиента
+func New(r *http.Request, status int, detail string) Problem {
+	return Problem{
+		Type:      "about:blank",
+		Title:     http.StatusText(status),
+		Status:    status,
+		Detail:    detail,
+		Instance:  r.URL.Path,
+		RequestID: reqctx.RequestID(r),
+	}
+}
+
+// Format формат тела ответа об ошибке
+type Format int
+
+const (
+	FormatJSON Format = iota // application/problem+json, формат по умолчанию
+	FormatHTML
+	FormatText
+)
+
+// formatTypes типы содержимого, которые клиент может указать в Accept, в порядке предпочтения сервера
+var formatTypes = []struct {
+	format    Format
+	mediaType string
+}{
+	{FormatJSON, "application/problem+json"},
+	{FormatJSON, "application/json"},
+	{FormatHTML, "text/html"},
+	{FormatText, "text/plain"},
+}
+
+// Negotiate выбирает формат по заголовкам Accept: наибольший q, при равенстве - порядок сервера
+// без Accept, при */* и если ни один формат не подходит, ответ будет в JSON
+func Negotiate(accept []string) Format {
+	type match struct {
+		specificity int // 2 - тип целиком, 1 - type/*, 0 - */*
+		q           float64
+	}
+	matches := make([]match, len(formatTypes))
+	for i := range matches {
+		matches[i].specificity = -1
+	}
+
+	for _, line := range accept {
+		for _, part := range strings.Split(line, ",") {
+			mediaRange, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+			mediaRange = strings.ToLower(strings.TrimSpace(mediaRange))
+			if mediaRange == "" {
+				continue
+			}
+			q := 1.0
+			for _, param := range strings.Split(params, ";") {
+				if value, ok := strings.CutPrefix(strings.TrimSpace(param), "q="); ok {
+					if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+						q = parsed
+					}
+				}
+			}
+			for i, ft := range formatTypes {
+				specificity := rangeSpecificity(mediaRange, ft.mediaType)
+				// более точный диапазон важнее общего, даже если у общего q больше (text/html;q=0 и */*)
+				if specificity > matches[i].specificity || (specificity == matches[i].specificity && specificity >= 0 && q > matches[i].q) {
+					matches[i] = match{specificity: specificity, q: q}
+				}
+			}
+		}
+	}
+
+	best, bestQ := FormatJSON, 0.0
+	for i, ft := range formatTypes {
+		if matches[i].specificity >= 0 && matches[i].q > bestQ {
+			best, bestQ = ft.format, matches[i].q
+		}
+	}
+	return best
+}
+
+// rangeSpecificity сообщает, насколько точно диапазон из Accept покрывает mediaType, -1 - не покрывает
+func rangeSpecificity(mediaRange, mediaType string) int {
+	switch {
+	case mediaRange == mediaType:
+		return 2
+	case mediaRange == "*/*":
+		return 0
+	case strings.HasSuffix(mediaRange, "/*") && strings.HasPrefix(mediaType, strings.TrimSuffix(mediaRange, "*")):
+		return 1
+	}
+	return -1
+}
+
+// Templates исходные тексты шаблонов по форматам, пустой шаблон - встроенный вид
+// JSON и Text - text/template с функцией json для экранирования строк, HTML - html/template
+type Templates struct {
+	JSON string
+	HTML string
+	Text string
+}
+
+type compiledTemplates struct {
+	json *texttemplate.Template
+	html *htmltemplate.Template
+	text *texttemplate.Template
+}
+
+// Renderer отвечает клиенту ошибками балансировщика в формате, который клиент просит в Accept
+// вызовы gRPC получают ошибку как grpc-status: тело ответа их клиенты не читают
+type Renderer struct {
+	defaults compiledTemplates
+	statuses map[int]compiledTemplates
+}
+
+var templateFuncs = texttemplate.FuncMap{
+	"json": func(v any) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+}
+
+// NewRenderer разбирает шаблоны ответов: общие defaults и отдельные для статусов
+// незаданный для статуса формат берется из общих шаблонов, а если нет и его - используется встроенный вид
+func NewRenderer(defaults Templates, statuses map[int]Templates) (*Renderer, error) {
+	rr := &Renderer{statuses: make(map[int]compiledTemplates, len(statuses))}
+	var err error
+	if rr.defaults, err = compile("default", defaults); err != nil {
+		return nil, err
+	}
+	for status, templates := range statuses {
+		if rr.statuses[status], err = compile(strconv.Itoa(status), templates); err != nil {
+			return nil, err
+		}
+	}
+	return rr, nil
+}
+
+// DefaultRenderer отвечает встроенными видами ошибки без шаблонов
+func DefaultRenderer() *Renderer {
+	return &Renderer{}
+}
+
+func compile(name string, t Templates) (compiledTemplates, error) {
+	var c compiledTemplates
+	var err error
+	if t.JSON != "" {
+		if c.json, err = texttemplate.New(name).Funcs(templateFuncs).Parse(t.JSON); err != nil {
+			return c, fmt.Errorf("некорректный JSON шаблон ошибки %s: %w", name, err)
+		}
+	}
+	if t.HTML != "" {
+		if c.html, err = htmltemplate.New(name).Parse(t.HTML); err != nil {
+			return c, fmt.Errorf("некорректный HTML шаблон ошибки %s: %w", name, err)
+		}
+	}
+	if t.Text != "" {
+		if c.text, err = texttemplate.New(name).Funcs(templateFuncs).Parse(t.Text); err != nil {
+			return c, fmt.Errorf("некорректный текстовый шаблон ошибки %s: %w", name, err)
+		}
+	}
+	return c, nil
+}
+
+// Write отвечает на запрос r ошибкой status с подробностями detail
+func (rr *Renderer) Write(w http.ResponseWriter, r *http.Request, status int, detail string) {
+	if grpc.IsGRPC(r) {
+		grpc.WriteError(w, grpc.CodeForStatus(status), detail)
+		return
+	}
+
+	p := New(r, status, detail)
+	contentType, body := rr.render(Negotiate(r.Header.Values("Accept")), p)
+
+	h := w.Header()
+	// ошибка заменяет ответ целиком, заголовки тела от бэкенда к ней не относятся
+	h.Del("Content-Length")
+	h.Del("Content-Encoding")
+	h.Set("Content-Type", contentType)
+	h.Set("X-Content-Type-Options", "nosniff")
+	h.Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	_, _ = w.Write(body)
+}
+
+// render выбирает шаблон статуса, затем общий, а если шаблона нет или он не отработал - встроенный вид
+func (rr *Renderer) render(format Format, p Problem) (string, []byte) {
+	for _, c := range []compiledTemplates{rr.statuses[p.Status], rr.defaults} {
+		var buf bytes.Buffer
+		switch {
+		case format == FormatJSON && c.json != nil:
+			if c.json.Execute(&buf, p) == nil {
+				// шаблон задает собственную схему, поэтому это не problem+json
+				return "application/json", buf.Bytes()
+			}
+		case format == FormatHTML && c.html != nil:
+			if c.html.Execute(&buf, p) == nil {
+				return "text/html; charset=utf-8", buf.Bytes()
+			}
+		case format == FormatText && c.text != nil:
+			if c.text.Execute(&buf, p) == nil {
+				return "text/plain; charset=utf-8", buf.Bytes()
+			}
+		}
+	}
+	return builtin(format, p)
+}
+
+var builtinHTML = htmltemplate.Must(htmltemplate.New("builtin").Parse(`<!DOCTYPE html>
+<html>
+<head><title>{{.Status}} {{.Title}}</title></head>
+<body>
+<h1>{{.Status}} {{.Title}}</h1>
+{{if .Detail}}<p>{{.Detail}}</p>
+{{end}}{{if .RequestID}}<p><small>Request ID: {{.RequestID}}</small></p>
+{{end}}</body>
+</html>
+`))
+
+func builtin(format Format, p Problem) (string, []byte) {
+	switch format {
+	case FormatHTML:
+		var buf bytes.Buffer
+		_ = builtinHTML.Execute(&buf, p)
+		return "text/html; charset=utf-8", buf.Bytes()
+	case FormatText:
+		text := strconv.Itoa(p.Status) + " " + p.Title
+		if p.Detail != "" {
+			text += ": " + p.Detail
+		}
+		if p.RequestID != "" {
+			text += "\nRequest ID: " + p.RequestID
+		}
+		return "text/plain; charset=utf-8", []byte(text + "\n")
+	default:
+		b, _ := json.Marshal(p)
+		return "application/problem+json", append(b, '\n')
+	}
+}
@@ -0,0 +1,53 @@
+package reqctx
+
+import (
+	"context"
+	"net"
+	"net/http"
+)
+
+// Client сведения о клиенте, вычисленные на входе запроса
+type Client struct {
+	IP          string // реальный IP клиента с учетом доверенных прокси
+	PeerTrusted bool   // непосредственный отправитель - доверенный прокси, его X-Forwarded-* можно сохранять
+}
+
+type clientKey struct{}
+
+// WithClient сохраняет сведения о клиенте в контексте запроса
+func WithClient(ctx context.Context, client Client) context.Context {
+	return context.WithValue(ctx, clientKey{}, client)
+}
+
+// ClientFrom возвращает сведения о клиенте, false если их не вычисляли
+func ClientFrom(ctx context.Context) (Client, bool) {
+	client, ok := ctx.Value(clientKey{}).(Client)
+	return client, ok
+}
+
+// ClientIP возвращает IP клиента из контекста, а если его не вычисляли - IP из RemoteAddr
+func ClientIP(r *http.Request) string {
+	if client, ok := ClientFrom(r.Context()); ok && client.IP != "" {
+		return client.IP
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+type requestIDKey struct{}
+
+// WithRequestID сохраняет идентификатор запроса в контексте
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID возвращает идентификатор запроса из контекста, а если его не назначали - заголовок X-Request-ID
+func RequestID(r *http.Request) string {
+	if id, ok := r.Context().Value(requestIDKey{}).(string); ok && id != "" {
+		return id
+	}
+	return r.Header.Get("X-Request-ID")
+}
@@ -0,0 +1,86 @@
+package requestid
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"time"
+)
+
+// форматы генерируемых идентификаторов
+const (
+	FormatUUIDv4 = "uuidv4"
+	FormatULID   = "ulid"
+)
+
+// maxLength входящий идентификатор длиннее считается мусором и заменяется своим
+const maxLength = 128
+
+// NewGenerator возвращает генератор идентификаторов формата format, пустой формат - UUIDv4
+func NewGenerator(format string) (func() string, error) {
+	switch format {
+	case "", FormatUUIDv4:
+		return NewUUIDv4, nil
+	case FormatULID:
+		return NewULID, nil
+	default:
+		return nil, fmt.Errorf("неизвестный формат идентификатора запроса %q, допустимые значения: %s, %s", format, FormatUUIDv4, FormatULID)
+	}
+}
+
+// NewUUIDv4 возвращает случайный UUID версии 4 (RFC 9562)
+func NewUUIDv4() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40 // версия 4
+	b[8] = b[8]&0x3f | 0x80 // вариант RFC 9562
+
+	var out [36]byte
+	hex.Encode(out[0:8], b[0:4])
+	out[8] = '-'
+	hex.Encode(out[9:13], b[4:6])
+	out[13] = '-'
+	hex.Encode(out[14:18], b[6:8])
+	out[18] = '-'
+	hex.Encode(out[19:23], b[8:10])
+	out[23] = '-'
+	hex.Encode(out[24:], b[10:])
+	return string(out[:])
+}
+
+// crockford алфавит base32 Крокфорда, которым кодируется ULID
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// NewULID возвращает ULID: 48 бит времени в миллисекундах и 80 случайных бит
+// идентификаторы сортируются по времени создания, это удобно при поиске по логам
+func NewULID() string {
+	var b [16]byte
+	binary.BigEndian.PutUint64(b[:8], uint64(time.Now().UnixMilli())<<16)
+	_, _ = rand.Read(b[6:])
+
+	// 128 бит кодируются 26 символами по 5 бит, старший символ несет только 3 бита
+	hi := binary.BigEndian.Uint64(b[:8])
+	lo := binary.BigEndian.Uint64(b[8:])
+	var out [26]byte
+	for i := 25; i >= 0; i-- {
+		out[i] = crockford[lo&0x1f]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(out[:])
+}
+
+// Valid проверяет входящий идентификатор: непустой, не длиннее 128 символов и из видимых символов ASCII
+// иначе через него можно было бы подделать строки логов или заголовки ответа
+func Valid(id string) bool {
+	if id == "" || len(id) > maxLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
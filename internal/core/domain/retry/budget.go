@@ -0,0 +1,99 @@
+package retry
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// budgetSlots на сколько интервалов делится скользящее окно бюджета
+const budgetSlots = 10
+
+// budgetSlot счетчики одного интервала окна
+type budgetSlot struct {
+	start     int64 // начало интервала в наносекундах, по нему определяется устаревший слот
+	successes int64
+	retries   int64
+}
+
+// Budget ограничивает число повторов относительно числа успешных запросов (retry budget как в Finagle/Linkerd)
+// повтор разрешен, пока повторов в окне меньше ratio * успехи + minPerSecond * длительность окна
+// это защищает бэкенды от шторма повторов при частичной аварии
+type Budget struct {
+	ratio        float64
+	minPerSecond float64
+	window       time.Duration
+	slotDuration int64
+
+	mu        sync.Mutex
+	slots     [budgetSlots]budgetSlot
+	exhausted atomic.Uint64 // сколько повторов было пропущено из-за исчерпания бюджета
+}
+
+// NewBudget создает бюджет повторов
+// ratio - доля повторов от успешных запросов, minPerSecond - гарантированный минимум повторов в секунду
+func NewBudget(ratio, minPerSecond float64, window time.Duration) *Budget {
+	if window <= 0 {
+		window = 10 * time.Second
+	}
+	slotDuration := int64(window) / budgetSlots
+	if slotDuration == 0 {
+		slotDuration = 1
+	}
+	return &Budget{
+		ratio:        ratio,
+		minPerSecond: minPerSecond,
+		window:       window,
+		slotDuration: slotDuration,
+	}
+}
+
+// RecordSuccess учитывает успешный запрос, пополняя бюджет
+func (b *Budget) RecordSuccess() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.current(time.Now()).successes++
+}
+
+// TryRetry списывает повтор из бюджета, возвращает false, если бюджет исчерпан
+func (b *Budget) TryRetry() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	slot := b.current(now)
+
+	var successes, retries int64
+	horizon := now.UnixNano() - int64(b.window)
+	for i := range b.slots {
+		if b.slots[i].start > horizon {
+			successes += b.slots[i].successes
+			retries += b.slots[i].retries
+		}
+	}
+
+	allowed := b.ratio*float64(successes) + b.minPerSecond*b.window.Seconds()
+	if float64(retries) >= allowed {
+		b.exhausted.Add(1)
+		return false
+	}
+	slot.retries++
+	return true
+}
+
+// Exhausted возвращает число повторов, пропущенных из-за исчерпания бюджета
+func (b *Budget) Exhausted() uint64 {
+	return b.exhausted.Load()
+}
+
+// current возвращает слот для момента now, обнуляя его, если он остался от прошлого круга окна
+// вызывается под мьютексом
+func (b *Budget) current(now time.Time) *budgetSlot {
+	ts := now.UnixNano()
+	start := ts - ts%b.slotDuration
+	slot := &b.slots[(ts/b.slotDuration)%budgetSlots]
+	if slot.start != start {
+		*slot = budgetSlot{start: start}
+	}
+	return slot
+}
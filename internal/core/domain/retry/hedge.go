@@ -0,0 +1,11 @@
+package retry
+
+import "time"
+
+// Hedge политика хеджирования: если первый бэкенд не ответил за Delay,
+// тот же запрос отправляется на второй бэкенд и берется ответ, пришедший первым
+type Hedge struct {
+	Delay      time.Duration // задержка перед вторым запросом
+	Percentile float64       // если > 0, задержка берется как перцентиль недавних задержек маршрута (например 0.95)
+	MinSamples int           // сколько замеров нужно, прежде чем доверять перцентилю
+}
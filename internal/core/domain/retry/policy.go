@@ -0,0 +1,111 @@
+package retry
+
+import (
+	"fmt"
+	"github.com/athebyme/cloud-ru-assign/internal/core/domain/balancer"
+	"math/rand"
+	"time"
+)
+
+// Condition условие, при котором неудачная попытка повторяется
+type Condition string
+
+const (
+	OnConnectFailure Condition = "connect-failure" // соединение с бэкендом не установлено
+	OnReset          Condition = "reset"           // соединение оборвано или бэкенд не ответил
+	OnTimeout        Condition = "timeout"         // истек таймаут попытки
+)
+
+// ParseCondition проверяет имя условия из конфигурации
+func ParseCondition(s string) (Condition, error) {
+	switch c := Condition(s); c {
+	case OnConnectFailure, OnReset, OnTimeout:
+		return c, nil
+	default:
+		return "", fmt.Errorf("неизвестное условие повтора: %s", s)
+	}
+}
+
+// Backoff задает экспоненциальную задержку между попытками
+type Backoff struct {
+	Base   time.Duration // задержка перед второй попыткой, дальше удваивается
+	Max    time.Duration // верхняя граница задержки
+	Jitter float64       // доля случайного разброса задержки, 0..1
+}
+
+// Policy политика повторных попыток проксирования
+type Policy struct {
+	MaxAttempts          int           // всего попыток, включая первую
+	RetryOn              []Condition   // при каких ошибках транспорта повторять
+	StatusCodes          []int         // при каких статусах ответа бэкенда повторять
+	PerTryTimeout        time.Duration // таймаут одной попытки, 0 - без таймаута
+	Backoff              Backoff       // задержка между попытками
+	AvoidPreviousBackend bool          // не выбирать повторно бэкенды, уже упавшие на этом запросе
+	MaxBodyBytes         int64         // сколько байт тела буферизуется для повтора
+}
+
+// DefaultPolicy возвращает политику по умолчанию: три попытки при любых ошибках транспорта
+func DefaultPolicy() Policy {
+	return Policy{
+		MaxAttempts:  3,
+		RetryOn:      []Condition{OnConnectFailure, OnReset, OnTimeout},
+		MaxBodyBytes: 1 << 20,
+	}
+}
+
+// RetriesError сообщает, повторяется ли попытка, упавшая с ошибкой вида kind
+// неклассифицированные ошибки транспорта относятся к условию reset
+func (p *Policy) RetriesError(kind balancer.ForwardErrorKind) bool {
+	var want Condition
+	switch kind {
+	case balancer.ForwardErrorConnect:
+		want = OnConnectFailure
+	case balancer.ForwardErrorTimeout:
+		want = OnTimeout
+	case balancer.ForwardErrorReset, balancer.ForwardErrorOther:
+		want = OnReset
+	default:
+		return false
+	}
+	for _, c := range p.RetryOn {
+		if c == want {
+			return true
+		}
+	}
+	return false
+}
+
+// RetriesStatus сообщает, повторяется ли попытка, на которую бэкенд ответил статусом code
+func (p *Policy) RetriesStatus(code int) bool {
+	for _, c := range p.StatusCodes {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+// Delay возвращает задержку перед попыткой номер attempt (начиная со второй)
+func (p *Policy) Delay(attempt int) time.Duration {
+	if p.Backoff.Base <= 0 || attempt < 2 {
+		return 0
+	}
+
+	delay := p.Backoff.Base
+	for i := 2; i < attempt; i++ {
+		delay *= 2
+		if p.Backoff.Max > 0 && delay >= p.Backoff.Max {
+			break
+		}
+	}
+	if p.Backoff.Max > 0 && delay > p.Backoff.Max {
+		delay = p.Backoff.Max
+	}
+
+	if p.Backoff.Jitter > 0 {
+		// равномерный разброс в пределах ±jitter от задержки
+		spread := float64(delay) * p.Backoff.Jitter
+		delay = time.Duration(float64(delay) - spread + rand.Float64()*2*spread)
+	}
+	return delay
+}
@@ -0,0 +1,83 @@
+package routing
+
+import (
+	"context"
+	"regexp"
+	"strings"
+)
+
+// Rewrite переписывает путь запроса маршрута перед отправкой бэкенду
+// шаги применяются по порядку: StripPrefix, Regex, AddPrefix
+type Rewrite struct {
+	StripPrefix string         // убрать префикс, например /billing/ для сервиса, смонтированного под ним
+	Regex       *regexp.Regexp // nil - без замены по регулярному выражению
+	Replacement string         // замена для Regex, группы захвата через $1, ${name}
+	AddPrefix   string         // добавить префикс
+
+	// обратная замена для Location ответа, если путь переписывается регулярным выражением
+	// для префиксов обратное преобразование вычисляется само
+	RedirectRegex       *regexp.Regexp
+	RedirectReplacement string
+}
+
+// Path переписывает путь запроса
+func (rw *Rewrite) Path(path string) string {
+	if rw.StripPrefix != "" && hasPathPrefix(path, rw.StripPrefix) {
+		path = ensureLeadingSlash(path[len(rw.StripPrefix):])
+	}
+	if rw.Regex != nil {
+		path = ensureLeadingSlash(rw.Regex.ReplaceAllString(path, rw.Replacement))
+	}
+	if rw.AddPrefix != "" {
+		path = joinPath(rw.AddPrefix, path)
+	}
+	return path
+}
+
+// ReversePath переводит путь бэкенда (из Location) в путь клиента
+// false - путь не относится к переписанной части и остается как есть
+func (rw *Rewrite) ReversePath(path string) (string, bool) {
+	changed := false
+	if rw.AddPrefix != "" {
+		prefix := strings.TrimSuffix(rw.AddPrefix, "/")
+		if path != prefix && !strings.HasPrefix(path, prefix+"/") {
+			return path, false
+		}
+		path = ensureLeadingSlash(path[len(prefix):])
+		changed = true
+	}
+	if rw.RedirectRegex != nil && rw.RedirectRegex.MatchString(path) {
+		path = ensureLeadingSlash(rw.RedirectRegex.ReplaceAllString(path, rw.RedirectReplacement))
+		changed = true
+	}
+	if rw.StripPrefix != "" {
+		path = joinPath(rw.StripPrefix, path)
+		changed = true
+	}
+	return path, changed
+}
+
+// joinPath склеивает префикс и путь через один слэш
+func joinPath(prefix, path string) string {
+	return strings.TrimSuffix(prefix, "/") + ensureLeadingSlash(path)
+}
+
+func ensureLeadingSlash(path string) string {
+	if !strings.HasPrefix(path, "/") {
+		return "/" + path
+	}
+	return path
+}
+
+type rewriteKey struct{}
+
+// WithRewrite сохраняет переписывание пути маршрута в контексте запроса
+func WithRewrite(ctx context.Context, rw *Rewrite) context.Context {
+	return context.WithValue(ctx, rewriteKey{}, rw)
+}
+
+// RewriteFrom возвращает переписывание пути запроса, nil если его нет
+func RewriteFrom(ctx context.Context) *Rewrite {
+	rw, _ := ctx.Value(rewriteKey{}).(*Rewrite)
+	return rw
+}
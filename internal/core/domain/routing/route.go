@@ -0,0 +1,115 @@
+package routing
+
+import (
+	"github.com/athebyme/cloud-ru-assign/internal/core/domain/balancer"
+	"github.com/athebyme/cloud-ru-assign/internal/core/domain/fault"
+	"github.com/athebyme/cloud-ru-assign/internal/core/domain/grpc"
+	"github.com/athebyme/cloud-ru-assign/internal/core/domain/headers"
+	"github.com/athebyme/cloud-ru-assign/internal/core/domain/mirror"
+	"github.com/athebyme/cloud-ru-assign/internal/core/domain/retry"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DefaultPool имя пула, собранного из корневого списка бэкендов
+const DefaultPool = "default"
+
+// UpgradePolicy ограничивает соединения, переключенные на другой протокол (WebSocket и тд)
+type UpgradePolicy struct {
+	IdleTimeout time.Duration // закрыть соединение без трафика в обе стороны, 0 - без ограничения
+	MaxLifetime time.Duration // закрыть соединение по истечении срока жизни, 0 - без ограничения
+}
+
+// StreamPolicy описывает потоковые ответы маршрута (Server-Sent Events, длинные chunked ответы)
+// такой ответ не ограничен WriteTimeout сервера и общим таймаутом запроса, вместо них действует IdleTimeout
+type StreamPolicy struct {
+	FlushInterval time.Duration // как часто сбрасывать ответ клиенту, 0 - после каждой записи
+	IdleTimeout   time.Duration // прервать поток, если бэкенд не присылает данных, 0 - без ограничения
+}
+
+// Route описывает маршрут: какие запросы он принимает и в какой пул их отправляет
+type Route struct {
+	Name       string
+	PathPrefix string
+	Pool       string
+	WebSocket  bool           // маршрут принимает только рукопожатия WebSocket
+	Retry      *retry.Policy  // nil - используется политика пула
+	Hedge      *retry.Hedge   // nil - без хеджирования
+	Upgrade    *UpgradePolicy // nil - используется общая политика
+	Headers    *headers.Rules // nil - заголовки маршрута не меняются
+	Rewrite    *Rewrite       // nil - путь уходит бэкенду без изменений
+	Mirror     *mirror.Policy // nil - запросы не зеркалируются
+	Split      *Split         // nil - все запросы идут в Pool
+	Fault      *fault.Policy  // nil - сбои не вносятся
+	Timeouts   *Timeouts      // nil - общие таймауты, незаданные поля тоже берутся из общих
+	Stream     *StreamPolicy  // nil - ответ сбрасывается по правилам реверс-прокси и ограничен WriteTimeout
+	// маршрут принимает только вызовы gRPC, nil - любые запросы
+	// префикс без / на конце - полное имя метода (/pkg.Service/Method) и сравнивается целиком
+	GRPC *grpc.Policy
+}
+
+// Matches проверяет, подходит ли запрос под маршрут
+func (rt *Route) Matches(r *http.Request) bool {
+	if rt.WebSocket && !balancer.IsWebSocket(r) {
+		return false
+	}
+	if rt.GRPC != nil {
+		if !grpc.IsGRPC(r) {
+			return false
+		}
+		if !strings.HasSuffix(rt.PathPrefix, "/") {
+			return r.URL.Path == rt.PathPrefix
+		}
+	}
+	return hasPathPrefix(r.URL.Path, rt.PathPrefix)
+}
+
+// hasPathPrefix сравнивает путь с префиксом по сегментам: /billing подходит для /billing и /billing/x, но не для /billingx
+func hasPathPrefix(path, prefix string) bool {
+	if !strings.HasPrefix(path, prefix) {
+		return false
+	}
+	return len(path) == len(prefix) || strings.HasSuffix(prefix, "/") || path[len(prefix)] == '/'
+}
+
+// Table набор маршрутов, выбирает маршрут с самым длинным подходящим префиксом
+// при равных префиксах WebSocket- и gRPC-маршруты проверяются раньше обычных
+type Table struct {
+	routes []*Route
+}
+
+// NewTable создает таблицу маршрутов
+func NewTable(routes []*Route) *Table {
+	sorted := make([]*Route, len(routes))
+	copy(sorted, routes)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if len(sorted[i].PathPrefix) != len(sorted[j].PathPrefix) {
+			return len(sorted[i].PathPrefix) > len(sorted[j].PathPrefix)
+		}
+		return (sorted[i].WebSocket || sorted[i].GRPC != nil) && !(sorted[j].WebSocket || sorted[j].GRPC != nil)
+	})
+	return &Table{routes: sorted}
+}
+
+// Match возвращает маршрут для запроса
+func (t *Table) Match(r *http.Request) (*Route, bool) {
+	if t == nil {
+		return nil, false
+	}
+	for _, rt := range t.routes {
+		if rt.Matches(r) {
+			return rt, true
+		}
+	}
+	return nil, false
+}
+
+// Routes возвращает все маршруты таблицы
+func (t *Table) Routes() []*Route {
+	if t == nil {
+		return nil
+	}
+	return t.routes
+}
@@ -0,0 +1,173 @@
+package routing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"sync"
+)
+
+// ErrNoSplit маршрут не найден или не делит трафик между группами
+var ErrNoSplit = errors.New("маршрут без разделения трафика")
+
+// SplitGroup группа бэкендов маршрута и ее доля трафика
+type SplitGroup struct {
+	Name   string `json:"name"`
+	Pool   string `json:"pool"`
+	Weight int    `json:"weight"` // доли считаются относительно суммы весов всех групп
+}
+
+// SplitOverride принудительно отправляет запрос в группу по заголовку или cookie
+// например X-Canary: always -> canary
+type SplitOverride struct {
+	Header string // имя заголовка, пусто - проверяется cookie
+	Cookie string
+	Value  string // пусто - подходит любое непустое значение
+	Group  string
+}
+
+func (o SplitOverride) matches(r *http.Request) bool {
+	var value string
+	if o.Header != "" {
+		value = r.Header.Get(o.Header)
+	} else if c, err := r.Cookie(o.Cookie); err == nil {
+		value = c.Value
+	}
+	if value == "" {
+		return false
+	}
+	return o.Value == "" || value == o.Value
+}
+
+// Split делит трафик маршрута между группами по весам
+// веса меняются на лету через SetWeights, без перезапуска балансировщика
+type Split struct {
+	overrides []SplitOverride
+
+	mu     sync.RWMutex
+	groups []SplitGroup
+	total  int
+}
+
+// NewSplit создает разделение трафика, группы и переопределения проверяются здесь же
+func NewSplit(groups []SplitGroup, overrides []SplitOverride) (*Split, error) {
+	if len(groups) == 0 {
+		return nil, fmt.Errorf("не указаны группы разделения трафика")
+	}
+	names := make(map[string]bool, len(groups))
+	for _, g := range groups {
+		if g.Name == "" || g.Pool == "" {
+			return nil, fmt.Errorf("у группы разделения трафика должны быть указаны name и pool")
+		}
+		if names[g.Name] {
+			return nil, fmt.Errorf("дублирующаяся группа разделения трафика: %s", g.Name)
+		}
+		names[g.Name] = true
+	}
+	for _, o := range overrides {
+		if !names[o.Group] {
+			return nil, fmt.Errorf("переопределение ссылается на неизвестную группу %s", o.Group)
+		}
+		if (o.Header == "") == (o.Cookie == "") {
+			return nil, fmt.Errorf("в переопределении группы %s нужно указать ровно одно из header или cookie", o.Group)
+		}
+	}
+
+	s := &Split{overrides: overrides, groups: make([]SplitGroup, len(groups))}
+	copy(s.groups, groups)
+	weights := make(map[string]int, len(groups))
+	for _, g := range groups {
+		weights[g.Name] = g.Weight
+	}
+	if err := s.SetWeights(weights); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Pick выбирает группу для запроса: сначала по переопределениям, затем случайно по весам
+func (s *Split) Pick(r *http.Request) SplitGroup {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, o := range s.overrides {
+		if o.matches(r) {
+			for _, g := range s.groups {
+				if g.Name == o.Group {
+					return g
+				}
+			}
+		}
+	}
+
+	n := rand.IntN(s.total)
+	for _, g := range s.groups {
+		if n < g.Weight {
+			return g
+		}
+		n -= g.Weight
+	}
+	return s.groups[len(s.groups)-1]
+}
+
+// SetWeights меняет веса групп, группы не из weights сохраняют свой вес
+func (s *Split) SetWeights(weights map[string]int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	groups := make([]SplitGroup, len(s.groups))
+	copy(groups, s.groups)
+	total := 0
+	for i := range groups {
+		if w, ok := weights[groups[i].Name]; ok {
+			groups[i].Weight = w
+		}
+		if groups[i].Weight < 0 {
+			return fmt.Errorf("вес группы %s не может быть отрицательным", groups[i].Name)
+		}
+		total += groups[i].Weight
+	}
+	for name := range weights {
+		if !s.hasGroupLocked(name) {
+			return fmt.Errorf("неизвестная группа разделения трафика: %s", name)
+		}
+	}
+	if total <= 0 {
+		return fmt.Errorf("сумма весов групп должна быть положительной")
+	}
+	s.groups, s.total = groups, total
+	return nil
+}
+
+// Groups возвращает текущие группы и их веса
+func (s *Split) Groups() []SplitGroup {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	groups := make([]SplitGroup, len(s.groups))
+	copy(groups, s.groups)
+	return groups
+}
+
+func (s *Split) hasGroupLocked(name string) bool {
+	for _, g := range s.groups {
+		if g.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+type splitGroupKey struct{}
+
+type splitGroup struct{ route, group string }
+
+// WithSplitGroup сохраняет в контексте запроса группу, выбранную разделением трафика маршрута
+func WithSplitGroup(ctx context.Context, route, group string) context.Context {
+	return context.WithValue(ctx, splitGroupKey{}, splitGroup{route: route, group: group})
+}
+
+// SplitGroupFrom возвращает маршрут и группу запроса, пустая группа - маршрут не делит трафик
+func SplitGroupFrom(ctx context.Context) (route, group string) {
+	g, _ := ctx.Value(splitGroupKey{}).(splitGroup)
+	return g.route, g.group
+}
@@ -0,0 +1,46 @@
+package routing
+
+import (
+	"context"
+	"time"
+)
+
+// Timeouts ограничения на запрос к бэкендам маршрута, 0 - без ограничения
+type Timeouts struct {
+	Connect        time.Duration // установка соединения с бэкендом
+	ResponseHeader time.Duration // от начала попытки, включая соединение и отправку запроса, до заголовков ответа
+	Total          time.Duration // весь запрос вместе с повторами, по истечении клиент получает 504
+}
+
+// Merge возвращает таймауты t, незаданные поля которых берутся из parent
+func (t Timeouts) Merge(parent Timeouts) Timeouts {
+	if t.Connect == 0 {
+		t.Connect = parent.Connect
+	}
+	if t.ResponseHeader == 0 {
+		t.ResponseHeader = parent.ResponseHeader
+	}
+	if t.Total == 0 {
+		t.Total = parent.Total
+	}
+	return t
+}
+
+// IsZero сообщает, что ни один таймаут не задан
+func (t Timeouts) IsZero() bool {
+	return t == Timeouts{}
+}
+
+type timeoutsKey struct{}
+
+// WithTimeouts сохраняет таймауты маршрута в контексте запроса
+// Total сервис применяет сам как дедлайн контекста, остальные нужны форвардеру
+func WithTimeouts(ctx context.Context, t Timeouts) context.Context {
+	return context.WithValue(ctx, timeoutsKey{}, t)
+}
+
+// TimeoutsFrom возвращает таймауты запроса, нулевые если их нет
+func TimeoutsFrom(ctx context.Context) Timeouts {
+	t, _ := ctx.Value(timeoutsKey{}).(Timeouts)
+	return t
+}
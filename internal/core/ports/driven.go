@@ -2,8 +2,11 @@
 package ports
 
 import (
+	"context"
 	"github.com/athebyme/cloud-ru-assign/internal/core/domain/balancer"
+	"github.com/athebyme/cloud-ru-assign/internal/core/domain/cache"
 	"github.com/athebyme/cloud-ru-assign/internal/core/domain/ratelimit"
+	"net"
 	"net/http"
 	"net/url"
 )
@@ -40,6 +43,28 @@ type Forwarder interface {
 	Forward(w http.ResponseWriter, r *http.Request, target *balancer.Backend) error
 }
 
+// StreamDialer определяет исходящий порт для открытия соединения с бэкендом в режиме TCP (L4)
+type StreamDialer interface {
+	Dial(ctx context.Context, target *balancer.Backend) (net.Conn, error)
+}
+
+// DatagramDialer определяет исходящий порт для открытия UDP сокета, связанного с бэкендом
+type DatagramDialer interface {
+	Dial(ctx context.Context, target *balancer.Backend) (net.Conn, error)
+}
+
+// ResponseCache определяет исходящий порт хранилища кешированных ответов
+// хранилище само ограничивает свой размер и вытесняет записи
+type ResponseCache interface {
+	Get(key string) (*cache.Entry, bool)
+	Set(key string, entry *cache.Entry)
+	Delete(key string) bool
+	// DeletePrefix удаляет все записи с ключом, начинающимся с prefix, и возвращает их число
+	DeletePrefix(prefix string) int
+	Len() int
+	Size() int64
+}
+
 // RateLimiter определяет исходящий порт для проверки ограничений скорости
 type RateLimiter interface {
 	Allow(clientID string) bool
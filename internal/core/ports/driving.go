@@ -2,7 +2,12 @@
 package ports
 
 import (
+	"context"
+	"github.com/athebyme/cloud-ru-assign/internal/core/domain/cache"
+	"github.com/athebyme/cloud-ru-assign/internal/core/domain/mirror"
 	"github.com/athebyme/cloud-ru-assign/internal/core/domain/ratelimit"
+	"github.com/athebyme/cloud-ru-assign/internal/core/domain/routing"
+	"net"
 	"net/http"
 )
 
@@ -12,6 +17,28 @@ type LoadBalancerService interface {
 	HandleRequest(w http.ResponseWriter, r *http.Request)
 }
 
+// StreamProxyService определяет входящий порт для проксирования TCP соединений (L4)
+type StreamProxyService interface {
+	// HandleConn выбирает бэкенд и передает байты в обе стороны, пока соединение открыто
+	// соединение закрывается перед возвратом
+	HandleConn(conn net.Conn)
+}
+
+// DatagramProxyService определяет входящий порт для проксирования UDP датаграмм
+type DatagramProxyService interface {
+	// HandleDatagram пересылает датаграмму клиента client бэкенду его сессии
+	// ответы бэкенда возвращаются клиенту через reply, пока сессия жива
+	HandleDatagram(payload []byte, client net.Addr, reply func(payload []byte) error)
+}
+
+// ConnectionDrainer определяет входящий порт для закрытия долгоживущих соединений при остановке
+// http.Server не ждет и не закрывает соединения после Hijack (WebSocket и тд)
+type ConnectionDrainer interface {
+	// Drain перестает принимать новые соединения, ждет закрытия открытых до отмены ctx
+	// и закрывает оставшиеся принудительно
+	Drain(ctx context.Context) error
+}
+
 // RateLimitService определяет входящий порт для управления rate limiting
 type RateLimitService interface {
 	CreateOrUpdateClient(settings *ratelimit.RateLimitSettings) error
@@ -19,3 +46,25 @@ type RateLimitService interface {
 	GetClientSettings(clientID string) (*ratelimit.RateLimitSettings, error)
 	ListClients() ([]*ratelimit.RateLimitSettings, error)
 }
+
+// CacheService определяет входящий порт для управления кешем ответов
+type CacheService interface {
+	// Purge удаляет ответ по ключу вместе со всеми его вариантами (Vary)
+	Purge(key string) int
+	// PurgePrefix удаляет все ответы с ключом, начинающимся с prefix
+	PurgePrefix(prefix string) int
+	Stats() cache.Stats
+}
+
+// MirrorService определяет входящий порт для просмотра результатов зеркалирования
+type MirrorService interface {
+	// MirrorStats возвращает сравнение теневых ответов с основными по маршрутам
+	MirrorStats() map[string]mirror.Stats
+}
+
+// TrafficSplitService определяет входящий порт для управления долями трафика canary и blue/green
+type TrafficSplitService interface {
+	ListSplits() map[string][]routing.SplitGroup
+	// SetWeights меняет веса групп маршрута, группы не из weights сохраняют свой вес
+	SetWeights(route string, weights map[string]int) ([]routing.SplitGroup, error)
+}
@@ -5,11 +5,14 @@
 package mocks
 
 import (
+	context "context"
+	net "net"
 	http "net/http"
 	url "net/url"
 	reflect "reflect"
 
 	balancer "github.com/athebyme/cloud-ru-assign/internal/core/domain/balancer"
+	cache "github.com/athebyme/cloud-ru-assign/internal/core/domain/cache"
 	ratelimit "github.com/athebyme/cloud-ru-assign/internal/core/domain/ratelimit"
 	ports "github.com/athebyme/cloud-ru-assign/internal/core/ports"
 	gomock "github.com/golang/mock/gomock"
@@ -314,6 +317,188 @@ func (mr *MockForwarderMockRecorder) Forward(w, r, target interface{}) *gomock.C
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Forward", reflect.TypeOf((*MockForwarder)(nil).Forward), w, r, target)
 }
 
+// MockStreamDialer is a mock of StreamDialer interface.
+type MockStreamDialer struct {
+	ctrl     *gomock.Controller
+	recorder *MockStreamDialerMockRecorder
+}
+
+// MockStreamDialerMockRecorder is the mock recorder for MockStreamDialer.
+type MockStreamDialerMockRecorder struct {
+	mock *MockStreamDialer
+}
+
+// NewMockStreamDialer creates a new mock instance.
+func NewMockStreamDialer(ctrl *gomock.Controller) *MockStreamDialer {
+	mock := &MockStreamDialer{ctrl: ctrl}
+	mock.recorder = &MockStreamDialerMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockStreamDialer) EXPECT() *MockStreamDialerMockRecorder {
+	return m.recorder
+}
+
+// Dial mocks base method.
+func (m *MockStreamDialer) Dial(ctx context.Context, target *balancer.Backend) (net.Conn, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Dial", ctx, target)
+	ret0, _ := ret[0].(net.Conn)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Dial indicates an expected call of Dial.
+func (mr *MockStreamDialerMockRecorder) Dial(ctx, target interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Dial", reflect.TypeOf((*MockStreamDialer)(nil).Dial), ctx, target)
+}
+
+// MockDatagramDialer is a mock of DatagramDialer interface.
+type MockDatagramDialer struct {
+	ctrl     *gomock.Controller
+	recorder *MockDatagramDialerMockRecorder
+}
+
+// MockDatagramDialerMockRecorder is the mock recorder for MockDatagramDialer.
+type MockDatagramDialerMockRecorder struct {
+	mock *MockDatagramDialer
+}
+
+// NewMockDatagramDialer creates a new mock instance.
+func NewMockDatagramDialer(ctrl *gomock.Controller) *MockDatagramDialer {
+	mock := &MockDatagramDialer{ctrl: ctrl}
+	mock.recorder = &MockDatagramDialerMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockDatagramDialer) EXPECT() *MockDatagramDialerMockRecorder {
+	return m.recorder
+}
+
+// Dial mocks base method.
+func (m *MockDatagramDialer) Dial(ctx context.Context, target *balancer.Backend) (net.Conn, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Dial", ctx, target)
+	ret0, _ := ret[0].(net.Conn)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Dial indicates an expected call of Dial.
+func (mr *MockDatagramDialerMockRecorder) Dial(ctx, target interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Dial", reflect.TypeOf((*MockDatagramDialer)(nil).Dial), ctx, target)
+}
+
+// MockResponseCache is a mock of ResponseCache interface.
+type MockResponseCache struct {
+	ctrl     *gomock.Controller
+	recorder *MockResponseCacheMockRecorder
+}
+
+// MockResponseCacheMockRecorder is the mock recorder for MockResponseCache.
+type MockResponseCacheMockRecorder struct {
+	mock *MockResponseCache
+}
+
+// NewMockResponseCache creates a new mock instance.
+func NewMockResponseCache(ctrl *gomock.Controller) *MockResponseCache {
+	mock := &MockResponseCache{ctrl: ctrl}
+	mock.recorder = &MockResponseCacheMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockResponseCache) EXPECT() *MockResponseCacheMockRecorder {
+	return m.recorder
+}
+
+// Delete mocks base method.
+func (m *MockResponseCache) Delete(key string) bool {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Delete", key)
+	ret0, _ := ret[0].(bool)
+	return ret0
+}
+
+// Delete indicates an expected call of Delete.
+func (mr *MockResponseCacheMockRecorder) Delete(key interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Delete", reflect.TypeOf((*MockResponseCache)(nil).Delete), key)
+}
+
+// DeletePrefix mocks base method.
+func (m *MockResponseCache) DeletePrefix(prefix string) int {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeletePrefix", prefix)
+	ret0, _ := ret[0].(int)
+	return ret0
+}
+
+// DeletePrefix indicates an expected call of DeletePrefix.
+func (mr *MockResponseCacheMockRecorder) DeletePrefix(prefix interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeletePrefix", reflect.TypeOf((*MockResponseCache)(nil).DeletePrefix), prefix)
+}
+
+// Get mocks base method.
+func (m *MockResponseCache) Get(key string) (*cache.Entry, bool) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Get", key)
+	ret0, _ := ret[0].(*cache.Entry)
+	ret1, _ := ret[1].(bool)
+	return ret0, ret1
+}
+
+// Get indicates an expected call of Get.
+func (mr *MockResponseCacheMockRecorder) Get(key interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Get", reflect.TypeOf((*MockResponseCache)(nil).Get), key)
+}
+
+// Len mocks base method.
+func (m *MockResponseCache) Len() int {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Len")
+	ret0, _ := ret[0].(int)
+	return ret0
+}
+
+// Len indicates an expected call of Len.
+func (mr *MockResponseCacheMockRecorder) Len() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Len", reflect.TypeOf((*MockResponseCache)(nil).Len))
+}
+
+// Set mocks base method.
+func (m *MockResponseCache) Set(key string, entry *cache.Entry) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "Set", key, entry)
+}
+
+// Set indicates an expected call of Set.
+func (mr *MockResponseCacheMockRecorder) Set(key, entry interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Set", reflect.TypeOf((*MockResponseCache)(nil).Set), key, entry)
+}
+
+// Size mocks base method.
+func (m *MockResponseCache) Size() int64 {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Size")
+	ret0, _ := ret[0].(int64)
+	return ret0
+}
+
+// Size indicates an expected call of Size.
+func (mr *MockResponseCacheMockRecorder) Size() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Size", reflect.TypeOf((*MockResponseCache)(nil).Size))
+}
+
 // MockRateLimiter is a mock of RateLimiter interface.
 type MockRateLimiter struct {
 	ctrl     *gomock.Controller
@@ -2,9 +2,13 @@ package integration
 
 import (
 	"fmt"
+	"github.com/athebyme/cloud-ru-assign/internal/core/domain/balancer"
 	"github.com/athebyme/cloud-ru-assign/internal/core/domain/ratelimit"
 	"net/http"
 	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"sync"
 	"testing"
 
 	"github.com/athebyme/cloud-ru-assign/internal/adapters/secondary/logger"
@@ -146,3 +150,87 @@ func BenchmarkMemoryPool_GetNextHealthyBackend(b *testing.B) {
 		_, _ = repo.GetNextHealthyBackend()
 	}
 }
+
+// BenchmarkHttpUtilForwarder_CachedProxy проксирование через закешированный прокси и пул соединений бэкенда
+func BenchmarkHttpUtilForwarder_CachedProxy(b *testing.B) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	logger := logger.NewSlogAdapter("error", false)
+	forwarder := proxy.NewHttpUtilForwarder(logger)
+	defer forwarder.CloseIdleConnections()
+	backend := &balancer.Backend{URL: mustParseURL(b, server.URL)}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			req := httptest.NewRequest("GET", "/", nil)
+			rec := httptest.NewRecorder()
+			if err := forwarder.Forward(rec, req, backend); err != nil {
+				b.Error(err)
+			}
+		}
+	})
+}
+
+// BenchmarkReverseProxy_PerRequest прежний подход форвардера: новый прокси и замыкания на каждый запрос
+// поверх общего http.DefaultTransport, оставлен для сравнения с BenchmarkHttpUtilForwarder_CachedProxy
+func BenchmarkReverseProxy_PerRequest(b *testing.B) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	logger := logger.NewSlogAdapter("error", false)
+	target := mustParseURL(b, server.URL)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			req := httptest.NewRequest("GET", "/", nil)
+			rec := httptest.NewRecorder()
+
+			rp := httputil.NewSingleHostReverseProxy(target)
+			proxyLogger := logger.With("target_url", target.String())
+			var proxyErr error
+			var mu sync.Mutex
+			rp.ErrorHandler = func(rw http.ResponseWriter, req *http.Request, err error) {
+				mu.Lock()
+				proxyErr = err
+				mu.Unlock()
+				proxyLogger.Warn("сработал ErrorHandler реверс-прокси", "error", err)
+			}
+			originalDirector := rp.Director
+			rp.Director = func(r *http.Request) {
+				originalDirector(r)
+				r.Host = target.Host
+				r.Header.Set("X-Forwarded-For", req.RemoteAddr)
+				r.Header.Set("X-Forwarded-Proto", "http")
+				r.Header.Set("X-Forwarded-Host", req.Host)
+				proxyLogger.Debug("модифицирован запрос в директоре", "host", r.Host)
+			}
+			rp.ServeHTTP(rec, req)
+
+			mu.Lock()
+			if proxyErr != nil {
+				b.Error(proxyErr)
+			}
+			mu.Unlock()
+		}
+	})
+}
+
+func mustParseURL(tb testing.TB, raw string) *url.URL {
+	tb.Helper()
+	u, err := url.Parse(raw)
+	if err != nil {
+		tb.Fatalf("invalid url %s: %v", raw, err)
+	}
+	return u
+}
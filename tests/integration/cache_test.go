@@ -0,0 +1,232 @@
+package integration
+
+import (
+	"fmt"
+	"github.com/athebyme/cloud-ru-assign/internal/adapters/secondary/logger"
+	"github.com/athebyme/cloud-ru-assign/internal/adapters/secondary/proxy"
+	"github.com/athebyme/cloud-ru-assign/internal/adapters/secondary/repository"
+	"github.com/athebyme/cloud-ru-assign/internal/adapters/secondary/responsecache"
+	"github.com/athebyme/cloud-ru-assign/internal/core/app"
+	"github.com/athebyme/cloud-ru-assign/internal/core/domain/routing"
+	"github.com/athebyme/cloud-ru-assign/internal/core/ports"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newCachingLoadBalancer собирает балансировщик с кешем ответов перед форвардером
+func newCachingLoadBalancer(t *testing.T, backendURL string) (ports.LoadBalancerService, *app.CachingForwarder) {
+	t.Helper()
+	logger := logger.NewSlogAdapter("error", false)
+	repo, _ := repository.NewMemoryPool([]string{backendURL}, logger)
+	cached := app.NewCachingForwarder(proxy.NewHttpUtilForwarder(logger), responsecache.NewLRU(1<<20), logger, 1<<16)
+	return app.NewLoadBalancerService(repo, cached, logger), cached
+}
+
+func doCached(lb ports.LoadBalancerService, path string, header http.Header) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("GET", "http://lb.example.com"+path, nil)
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	rec := httptest.NewRecorder()
+	lb.HandleRequest(rec, req)
+	return rec
+}
+
+func TestResponseCache_HitMissAndPurge(t *testing.T) {
+	var calls atomic.Int32
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := calls.Add(1)
+		if r.URL.Path == "/private" {
+			w.Header().Set("Cache-Control", "private, max-age=60")
+		} else {
+			w.Header().Set("Cache-Control", "max-age=60")
+		}
+		fmt.Fprintf(w, "response %d", n)
+	}))
+	defer backend.Close()
+
+	lb, cached := newCachingLoadBalancer(t, backend.URL)
+
+	first := doCached(lb, "/static/app.js", nil)
+	if got := first.Header().Get("X-Cache"); got != "MISS" {
+		t.Errorf("expected MISS on first request, got %q", got)
+	}
+	second := doCached(lb, "/static/app.js", nil)
+	if got := second.Header().Get("X-Cache"); got != "HIT" {
+		t.Errorf("expected HIT on second request, got %q", got)
+	}
+	if second.Body.String() != "response 1" || calls.Load() != 1 {
+		t.Errorf("expected cached body from one backend call, got %q after %d calls", second.Body.String(), calls.Load())
+	}
+
+	doCached(lb, "/private", nil)
+	if got := doCached(lb, "/private", nil).Header().Get("X-Cache"); got != "MISS" {
+		t.Errorf("expected private response not to be cached, got %q", got)
+	}
+
+	if removed := cached.Purge("lb.example.com/static/app.js"); removed != 1 {
+		t.Errorf("expected one purged entry, got %d", removed)
+	}
+	if got := doCached(lb, "/static/app.js", nil).Body.String(); got != "response 4" {
+		t.Errorf("expected fresh response after purge, got %q", got)
+	}
+	if stats := cached.Stats(); stats.Hits != 1 || stats.Entries != 1 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+}
+
+func TestResponseCache_Vary(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Header().Set("Vary", "Accept-Language")
+		fmt.Fprint(w, "lang="+r.Header.Get("Accept-Language"))
+	}))
+	defer backend.Close()
+
+	lb, _ := newCachingLoadBalancer(t, backend.URL)
+	ru := http.Header{"Accept-Language": {"ru"}}
+	en := http.Header{"Accept-Language": {"en"}}
+
+	doCached(lb, "/page", ru)
+	doCached(lb, "/page", en)
+	for _, tt := range []struct {
+		header http.Header
+		want   string
+	}{{ru, "lang=ru"}, {en, "lang=en"}} {
+		rec := doCached(lb, "/page", tt.header)
+		if rec.Header().Get("X-Cache") != "HIT" || rec.Body.String() != tt.want {
+			t.Errorf("expected HIT %q, got %s %q", tt.want, rec.Header().Get("X-Cache"), rec.Body.String())
+		}
+	}
+}
+
+func TestResponseCache_RevalidatesWithETag(t *testing.T) {
+	var full, notModified atomic.Int32
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("ETag", `"v1"`)
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			notModified.Add(1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		full.Add(1)
+		fmt.Fprint(w, "body v1")
+	}))
+	defer backend.Close()
+
+	lb, _ := newCachingLoadBalancer(t, backend.URL)
+	doCached(lb, "/doc", nil)
+	rec := doCached(lb, "/doc", nil)
+
+	if rec.Code != http.StatusOK || rec.Body.String() != "body v1" || rec.Header().Get("X-Cache") != "HIT" {
+		t.Errorf("expected revalidated HIT with body, got %d %s %q", rec.Code, rec.Header().Get("X-Cache"), rec.Body.String())
+	}
+	if full.Load() != 1 || notModified.Load() != 1 {
+		t.Errorf("expected one full response and one 304, got %d and %d", full.Load(), notModified.Load())
+	}
+
+	// собственный условный запрос клиента получает 304 из кеша
+	conditional := doCached(lb, "/doc", http.Header{"If-None-Match": {`"v1"`}})
+	if conditional.Code != http.StatusNotModified {
+		t.Errorf("expected 304 for client conditional request, got %d", conditional.Code)
+	}
+}
+
+func TestResponseCache_StaleWhileRevalidate(t *testing.T) {
+	var version atomic.Int32
+	version.Store(1)
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=1, stale-while-revalidate=60")
+		fmt.Fprintf(w, "v%d", version.Load())
+	}))
+	defer backend.Close()
+
+	lb, _ := newCachingLoadBalancer(t, backend.URL)
+	doCached(lb, "/feed", nil)
+	version.Store(2)
+	time.Sleep(1100 * time.Millisecond)
+
+	stale := doCached(lb, "/feed", nil)
+	if stale.Body.String() != "v1" || stale.Header().Get("X-Cache") != "HIT" {
+		t.Fatalf("expected stale v1 served from cache, got %s %q", stale.Header().Get("X-Cache"), stale.Body.String())
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if doCached(lb, "/feed", nil).Body.String() == "v2" {
+			return
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Error("expected background revalidation to refresh the entry")
+}
+
+func TestResponseCache_UnsafeMethodPurges(t *testing.T) {
+	var calls atomic.Int32
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60")
+		fmt.Fprintf(w, "%d", calls.Add(1))
+	}))
+	defer backend.Close()
+
+	lb, _ := newCachingLoadBalancer(t, backend.URL)
+	doCached(lb, "/item", nil)
+	lb.HandleRequest(httptest.NewRecorder(), httptest.NewRequest("DELETE", "http://lb.example.com/item", nil))
+
+	if rec := doCached(lb, "/item", nil); rec.Header().Get("X-Cache") != "MISS" {
+		t.Errorf("expected MISS after DELETE, got %q", rec.Header().Get("X-Cache"))
+	}
+}
+
+func TestResponseCache_SplitGroupsCachedSeparately(t *testing.T) {
+	newBackend := func(name string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Cache-Control", "max-age=60")
+			w.Write([]byte(name))
+		}))
+	}
+	stable, canary := newBackend("stable"), newBackend("canary")
+	defer stable.Close()
+	defer canary.Close()
+
+	logger := logger.NewSlogAdapter("error", false)
+	stableRepo, _ := repository.NewMemoryPool([]string{stable.URL}, logger)
+	canaryRepo, _ := repository.NewMemoryPool([]string{canary.URL}, logger)
+	split, err := routing.NewSplit(
+		[]routing.SplitGroup{{Name: "stable", Pool: "stable", Weight: 100}, {Name: "canary", Pool: "canary", Weight: 0}},
+		[]routing.SplitOverride{{Header: "X-Canary", Value: "always", Group: "canary"}},
+	)
+	if err != nil {
+		t.Fatalf("new split: %v", err)
+	}
+	cached := app.NewCachingForwarder(proxy.NewHttpUtilForwarder(logger), responsecache.NewLRU(1<<20), logger, 1<<16)
+	lb := app.NewLoadBalancerService(stableRepo, cached, logger,
+		app.WithPool("stable", stableRepo, nil),
+		app.WithPool("canary", canaryRepo, nil),
+		app.WithRoutes(routing.NewTable([]*routing.Route{{Name: "checkout", PathPrefix: "/checkout/", Split: split}})),
+	)
+
+	if got := doCached(lb, "/checkout/cart", nil).Body.String(); got != "stable" {
+		t.Fatalf("expected stable response, got %q", got)
+	}
+	// закрепленный за канареечной группой запрос не получает ответ стабильной из кеша
+	forced := doCached(lb, "/checkout/cart", http.Header{"X-Canary": {"always"}})
+	if forced.Body.String() != "canary" || forced.Header().Get("X-Cache") != "MISS" {
+		t.Errorf("expected canary group to reach its pool, got %q (X-Cache %q)", forced.Body.String(), forced.Header().Get("X-Cache"))
+	}
+	if rec := doCached(lb, "/checkout/cart", nil); rec.Body.String() != "stable" || rec.Header().Get("X-Cache") != "HIT" {
+		t.Errorf("expected cached stable response, got %q (X-Cache %q)", rec.Body.String(), rec.Header().Get("X-Cache"))
+	}
+	if rec := doCached(lb, "/checkout/cart", http.Header{"X-Canary": {"always"}}); rec.Body.String() != "canary" || rec.Header().Get("X-Cache") != "HIT" {
+		t.Errorf("expected cached canary response, got %q (X-Cache %q)", rec.Body.String(), rec.Header().Get("X-Cache"))
+	}
+
+	// очистка по адресу удаляет ответы всех групп
+	if removed := cached.Purge("lb.example.com/checkout/cart"); removed != 2 {
+		t.Errorf("expected both groups purged, got %d", removed)
+	}
+}
@@ -0,0 +1,180 @@
+package integration
+
+import (
+	"compress/gzip"
+	"github.com/andybalholm/brotli"
+	"github.com/athebyme/cloud-ru-assign/internal/adapters/primary/http/middleware"
+	"github.com/athebyme/cloud-ru-assign/internal/adapters/secondary/logger"
+	"github.com/athebyme/cloud-ru-assign/internal/adapters/secondary/proxy"
+	"github.com/athebyme/cloud-ru-assign/internal/adapters/secondary/repository"
+	"github.com/athebyme/cloud-ru-assign/internal/core/app"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCompressionMiddleware_ProxiedResponses(t *testing.T) {
+	largeJSON := `{"items":"` + strings.Repeat("a", 4096) + `"}`
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/json":
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("ETag", `"v1"`)
+			io.WriteString(w, largeJSON)
+		case "/small":
+			w.Header().Set("Content-Type", "application/json")
+			io.WriteString(w, `{}`)
+		case "/image":
+			w.Header().Set("Content-Type", "image/png")
+			io.WriteString(w, strings.Repeat("x", 4096))
+		case "/encoded":
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("Content-Encoding", "br")
+			io.WriteString(w, strings.Repeat("x", 4096))
+		}
+	}))
+	defer backend.Close()
+
+	logger := logger.NewSlogAdapter("error", false)
+	repo, _ := repository.NewMemoryPool([]string{backend.URL}, logger)
+	lbService := app.NewLoadBalancerService(repo, proxy.NewHttpUtilForwarder(logger), logger)
+	handler := middleware.CompressionMiddleware(middleware.CompressionSettings{MinSize: 1024})(http.HandlerFunc(lbService.HandleRequest))
+
+	tests := []struct {
+		path           string
+		acceptEncoding string
+		wantEncoding   string
+		wantVary       bool
+	}{
+		{path: "/json", acceptEncoding: "gzip", wantEncoding: "gzip", wantVary: true},
+		{path: "/json", acceptEncoding: "br;q=1, deflate;q=0.5, gzip;q=0.8", wantEncoding: "gzip", wantVary: true},
+		{path: "/json", acceptEncoding: "gzip;q=0, *;q=0.1", wantEncoding: "deflate", wantVary: true},
+		{path: "/json", acceptEncoding: "", wantEncoding: "", wantVary: true},
+		{path: "/small", acceptEncoding: "gzip", wantEncoding: "", wantVary: true},
+		{path: "/image", acceptEncoding: "gzip", wantEncoding: "", wantVary: false},
+		{path: "/encoded", acceptEncoding: "gzip", wantEncoding: "br", wantVary: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path+" "+tt.acceptEncoding, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "http://lb.example.com"+tt.path, nil)
+			if tt.acceptEncoding != "" {
+				req.Header.Set("Accept-Encoding", tt.acceptEncoding)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if got := rec.Header().Get("Content-Encoding"); got != tt.wantEncoding {
+				t.Errorf("expected Content-Encoding %q, got %q", tt.wantEncoding, got)
+			}
+			if got := strings.Contains(rec.Header().Get("Vary"), "Accept-Encoding"); got != tt.wantVary {
+				t.Errorf("expected Vary Accept-Encoding %v, got %q", tt.wantVary, rec.Header().Get("Vary"))
+			}
+			if tt.wantEncoding != "gzip" {
+				return
+			}
+			if rec.Header().Get("Content-Length") != "" {
+				t.Error("expected Content-Length to be removed from compressed response")
+			}
+			if got := rec.Header().Get("ETag"); got != `W/"v1"` {
+				t.Errorf("expected weak ETag, got %q", got)
+			}
+			zr, err := gzip.NewReader(rec.Body)
+			if err != nil {
+				t.Fatalf("gzip reader: %v", err)
+			}
+			body, _ := io.ReadAll(zr)
+			if string(body) != largeJSON {
+				t.Errorf("decompressed body mismatch: %d bytes", len(body))
+			}
+		})
+	}
+}
+
+func TestCompressionMiddleware_Brotli(t *testing.T) {
+	largeJSON := `{"items":"` + strings.Repeat("b", 4096) + `"}`
+	handler := middleware.CompressionMiddleware(middleware.CompressionSettings{
+		Encodings: []middleware.Encoding{middleware.BrotliEncoding(), middleware.GzipEncoding()},
+		MinSize:   1024,
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, largeJSON)
+	}))
+
+	// при равных q выбирается порядок сервера: br раньше gzip
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip, br")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if got := rec.Header().Get("Content-Encoding"); got != "br" {
+		t.Fatalf("expected br, got %q", got)
+	}
+	body, err := io.ReadAll(brotli.NewReader(rec.Body))
+	if err != nil || string(body) != largeJSON {
+		t.Errorf("brotli body mismatch: %d bytes, err %v", len(body), err)
+	}
+}
+
+func TestCompressionMiddleware_EventStreamNotCompressedByDefault(t *testing.T) {
+	handler := middleware.CompressionMiddleware(middleware.CompressionSettings{})(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/event-stream; charset=utf-8")
+			io.WriteString(w, "data: "+strings.Repeat("x", 4096)+"\n\n")
+		}),
+	)
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if got := rec.Header().Get("Content-Encoding"); got != "" {
+		t.Errorf("expected event stream to pass uncompressed under text/*, got %q", got)
+	}
+	if !strings.HasPrefix(rec.Body.String(), "data: ") {
+		t.Errorf("expected plain event stream body, got %q", rec.Body.String()[:16])
+	}
+}
+
+func TestCompressionMiddleware_FlushesStream(t *testing.T) {
+	flushed := make(chan struct{})
+	// поток событий сжимается, только если его тип указан явно
+	handler := middleware.CompressionMiddleware(middleware.CompressionSettings{MinSize: 1024, ContentTypes: []string{"text/event-stream"}})(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/event-stream")
+			io.WriteString(w, "data: first\n\n")
+			http.NewResponseController(w).Flush()
+			<-flushed
+			io.WriteString(w, "data: second\n\n")
+		}),
+	)
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	resp, err := http.DefaultTransport.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("request: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.Header.Get("Content-Encoding") != "gzip" {
+		t.Fatalf("expected gzip stream, got %q", resp.Header.Get("Content-Encoding"))
+	}
+
+	zr, err := gzip.NewReader(resp.Body)
+	if err != nil {
+		t.Fatalf("gzip reader: %v", err)
+	}
+	// первое событие должно дойти до клиента до конца ответа
+	first := make([]byte, len("data: first\n\n"))
+	if _, err := io.ReadFull(zr, first); err != nil || string(first) != "data: first\n\n" {
+		t.Fatalf("expected first event before end of stream, got %q (%v)", first, err)
+	}
+	close(flushed)
+	rest, _ := io.ReadAll(zr)
+	if string(rest) != "data: second\n\n" {
+		t.Errorf("expected second event, got %q", rest)
+	}
+}
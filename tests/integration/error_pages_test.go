@@ -0,0 +1,99 @@
+package integration
+
+import (
+	"encoding/json"
+	"github.com/athebyme/cloud-ru-assign/internal/adapters/primary/http/middleware"
+	"github.com/athebyme/cloud-ru-assign/internal/adapters/secondary/logger"
+	"github.com/athebyme/cloud-ru-assign/internal/adapters/secondary/proxy"
+	"github.com/athebyme/cloud-ru-assign/internal/adapters/secondary/rate_limiter/memory"
+	"github.com/athebyme/cloud-ru-assign/internal/adapters/secondary/repository"
+	"github.com/athebyme/cloud-ru-assign/internal/config"
+	"github.com/athebyme/cloud-ru-assign/internal/core/app"
+	"github.com/athebyme/cloud-ru-assign/internal/core/domain/problem"
+	"github.com/athebyme/cloud-ru-assign/internal/core/domain/ratelimit"
+	"github.com/athebyme/cloud-ru-assign/internal/core/domain/retry"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestErrorPages_NegotiatedAndTemplated(t *testing.T) {
+	dir := t.TempDir()
+	htmlPath := filepath.Join(dir, "503.html")
+	os.WriteFile(htmlPath, []byte(`<h1>{{.Status}}</h1><p>{{.Detail}}</p><code>{{.RequestID}}</code>`), 0o644)
+	pages := config.ErrorPagesConfig{Statuses: map[int]config.ErrorTemplatesConfig{503: {HTML: htmlPath}}}
+	renderer, err := pages.Renderer()
+	if err != nil {
+		t.Fatalf("failed to load templates: %v", err)
+	}
+
+	logger := logger.NewSlogAdapter("error", false)
+	dead := httptest.NewServer(http.NotFoundHandler())
+	dead.Close()
+	repo, _ := repository.NewMemoryPool([]string{dead.URL}, logger)
+	noRetry := retry.DefaultPolicy()
+	noRetry.MaxAttempts = 1
+	lbService := app.NewLoadBalancerService(repo, proxy.NewHttpUtilForwarder(logger), logger,
+		app.WithRetryPolicy(noRetry),
+		app.WithErrorRenderer(renderer),
+	)
+
+	send := func(handler http.Handler, accept string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/orders/42", nil)
+		req.Header.Set("X-Request-ID", "req-<1>")
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// по умолчанию RFC 7807 с идентификатором запроса
+	rec := send(http.HandlerFunc(lbService.HandleRequest), "")
+	if rec.Code != http.StatusServiceUnavailable || rec.Header().Get("Content-Type") != "application/problem+json" {
+		t.Fatalf("expected 503 problem+json, got %d %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	var p problem.Problem
+	if err := json.Unmarshal(rec.Body.Bytes(), &p); err != nil {
+		t.Fatalf("invalid problem body %q: %v", rec.Body.String(), err)
+	}
+	if p.Status != 503 || p.Title != "Service Unavailable" || p.Instance != "/orders/42" || p.RequestID != "req-<1>" {
+		t.Errorf("unexpected problem %+v", p)
+	}
+
+	// шаблон статуса из файла, значения экранируются html/template
+	rec = send(http.HandlerFunc(lbService.HandleRequest), "text/html")
+	if body := rec.Body.String(); !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/html") || !strings.Contains(body, "<h1>503</h1>") || !strings.Contains(body, "req-&lt;1&gt;") {
+		t.Errorf("expected templated HTML page, got %q", body)
+	}
+
+	// бэкенд оборвал ответ: 502, а не 503
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic(http.ErrAbortHandler)
+	}))
+	defer broken.Close()
+	brokenRepo, _ := repository.NewMemoryPool([]string{broken.URL}, logger)
+	brokenService := app.NewLoadBalancerService(brokenRepo, proxy.NewHttpUtilForwarder(logger), logger,
+		app.WithRetryPolicy(noRetry),
+		app.WithErrorRenderer(renderer),
+	)
+	rec = send(http.HandlerFunc(brokenService.HandleRequest), "")
+	if err := json.Unmarshal(rec.Body.Bytes(), &p); err != nil || p.Status != http.StatusBadGateway || p.Title != "Bad Gateway" {
+		t.Errorf("expected 502 problem, got %d %q", rec.Code, rec.Body.String())
+	}
+
+	// у 429 шаблона нет: встроенный текст, тот же вид, что у ошибок сервиса
+	limiter := memory.NewMemoryRateLimiter(logger)
+	defer limiter.Stop()
+	limiter.SetRateLimit("ip_192.0.2.1", &ratelimit.RateLimitSettings{ClientID: "ip_192.0.2.1", Capacity: 1, RatePerSecond: 1})
+	limited := middleware.RateLimitMiddleware(limiter, renderer, logger)(http.NotFoundHandler())
+	send(limited, "text/plain")
+	rec = send(limited, "text/plain")
+	if rec.Code != http.StatusTooManyRequests || rec.Body.String() != "429 Too Many Requests: rate limit exceeded\nRequest ID: req-<1>\n" {
+		t.Errorf("expected plain text 429, got %d %q", rec.Code, rec.Body.String())
+	}
+}
@@ -0,0 +1,114 @@
+package integration
+
+import (
+	"encoding/json"
+	"github.com/athebyme/cloud-ru-assign/internal/adapters/secondary/logger"
+	"github.com/athebyme/cloud-ru-assign/internal/adapters/secondary/proxy"
+	"github.com/athebyme/cloud-ru-assign/internal/adapters/secondary/repository"
+	"github.com/athebyme/cloud-ru-assign/internal/core/app"
+	"github.com/athebyme/cloud-ru-assign/internal/core/domain/clientip"
+	"github.com/athebyme/cloud-ru-assign/internal/core/domain/fault"
+	"github.com/athebyme/cloud-ru-assign/internal/core/domain/problem"
+	"github.com/athebyme/cloud-ru-assign/internal/core/domain/retry"
+	"github.com/athebyme/cloud-ru-assign/internal/core/domain/routing"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestLoadBalancer_FaultInjection(t *testing.T) {
+	var backendCalls atomic.Int32
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		backendCalls.Add(1)
+		io.WriteString(w, strings.Repeat("x", 300))
+	}))
+	defer backend.Close()
+
+	logger := logger.NewSlogAdapter("error", false)
+	repo, _ := repository.NewMemoryPool([]string{backend.URL}, logger)
+	// тестовый клиент httptest приходит с 192.0.2.1
+	testers, _ := clientip.NewResolver([]string{"192.0.2.0/24"})
+	withRetry := retry.DefaultPolicy()
+	withRetry.MaxAttempts = 3
+	lbService := app.NewLoadBalancerService(repo, app.NewFaultInjectingForwarder(proxy.NewHttpUtilForwarder(logger), logger), logger,
+		app.WithRoutes(routing.NewTable([]*routing.Route{{
+			Name:       "api",
+			PathPrefix: "/api/",
+			Pool:       routing.DefaultPool,
+			Retry:      &withRetry,
+			Timeouts:   &routing.Timeouts{Total: time.Second},
+			Fault: &fault.Policy{
+				Header:   "X-Fault-Inject",
+				Trusted:  testers,
+				MaxDelay: 2 * time.Second,
+				Abort:    &fault.Abort{Status: http.StatusServiceUnavailable, Percent: 100},
+			},
+		}})),
+	)
+
+	sendFrom := func(remoteAddr, faultHeader string) (*httptest.ResponseRecorder, time.Duration) {
+		req := httptest.NewRequest("GET", "http://lb.example.com/api/items", nil)
+		req.RemoteAddr = remoteAddr
+		if faultHeader != "" {
+			req.Header.Set("X-Fault-Inject", faultHeader)
+		}
+		rec := httptest.NewRecorder()
+		start := time.Now()
+		lbService.HandleRequest(rec, req)
+		return rec, time.Since(start)
+	}
+	send := func(faultHeader string) (*httptest.ResponseRecorder, time.Duration) {
+		return sendFrom("192.0.2.1:1234", faultHeader)
+	}
+
+	if rec, _ := send(""); rec.Code != http.StatusOK {
+		t.Errorf("expected no fault without header, got %d", rec.Code)
+	}
+
+	// заголовок от недоверенного отправителя не включает сбои
+	if rec, _ := sendFrom("198.51.100.7:5555", "abort=500"); rec.Code != http.StatusOK {
+		t.Errorf("expected untrusted fault header to be ignored, got %d", rec.Code)
+	}
+
+	// прерывание - ответ балансировщика: problem+json, без повторов и обращений к бэкенду
+	rec, _ := send("on")
+	if rec.Code != http.StatusServiceUnavailable || rec.Header().Get("X-Fault-Injected") != "abort" {
+		t.Errorf("expected configured abort, got %d", rec.Code)
+	}
+	var p problem.Problem
+	if err := json.Unmarshal(rec.Body.Bytes(), &p); err != nil || p.Status != http.StatusServiceUnavailable {
+		t.Errorf("expected abort rendered as problem+json, got %q", rec.Body.String())
+	}
+	if backendCalls.Load() != 2 {
+		t.Errorf("aborted request must not reach backend, got %d calls", backendCalls.Load())
+	}
+
+	rec, took := send("delay=150ms")
+	if rec.Code != http.StatusOK || took < 150*time.Millisecond {
+		t.Errorf("expected delayed success, got %d after %v", rec.Code, took)
+	}
+
+	// задержка дольше общего таймаута дает 504, но бэкенд не виноват и остается в пуле
+	rec, _ = send("delay=1500ms")
+	if rec.Code != http.StatusGatewayTimeout {
+		t.Errorf("expected 504 after injected delay, got %d", rec.Code)
+	}
+	if _, ok := repo.GetNextHealthyBackend(); !ok {
+		t.Error("injected delay must not mark backend unhealthy")
+	}
+
+	rec, _ = send("abort=418")
+	if rec.Code != http.StatusTeapot {
+		t.Errorf("expected abort status from header, got %d", rec.Code)
+	}
+
+	// 300 байт по 1000 байт/с - не меньше ~300мс
+	rec, took = send("throttle=1000")
+	if rec.Body.Len() != 300 || took < 250*time.Millisecond {
+		t.Errorf("expected throttled body, got %d bytes after %v", rec.Body.Len(), took)
+	}
+}
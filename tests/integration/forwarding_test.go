@@ -0,0 +1,86 @@
+package integration
+
+import (
+	"github.com/athebyme/cloud-ru-assign/internal/adapters/primary/http/middleware"
+	"github.com/athebyme/cloud-ru-assign/internal/adapters/secondary/logger"
+	"github.com/athebyme/cloud-ru-assign/internal/adapters/secondary/proxy"
+	"github.com/athebyme/cloud-ru-assign/internal/adapters/secondary/repository"
+	"github.com/athebyme/cloud-ru-assign/internal/core/app"
+	"github.com/athebyme/cloud-ru-assign/internal/core/domain/clientip"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestLoadBalancer_ForwardedHeaders(t *testing.T) {
+	var gotXFF, gotForwarded, gotProto string
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotXFF = r.Header.Get("X-Forwarded-For")
+		gotForwarded = r.Header.Get("Forwarded")
+		gotProto = r.Header.Get("X-Forwarded-Proto")
+	}))
+	defer backend.Close()
+
+	logger := logger.NewSlogAdapter("error", false)
+	repo, _ := repository.NewMemoryPool([]string{backend.URL}, logger)
+	forwarder := proxy.NewHttpUtilForwarder(logger, proxy.WithForwardedHeader(true))
+	lbService := app.NewLoadBalancerService(repo, forwarder, logger)
+	resolver, _ := clientip.NewResolver([]string{"10.0.0.0/8"})
+	handler := middleware.ClientIPMiddleware(resolver)(http.HandlerFunc(lbService.HandleRequest))
+
+	tests := []struct {
+		name          string
+		remoteAddr    string
+		host          string // пусто - example.com
+		wantXFF       string
+		wantForwarded string
+		wantProto     string
+	}{
+		{
+			name:          "trusted proxy chain is extended",
+			remoteAddr:    "10.0.0.5:4000",
+			wantXFF:       "203.0.113.9, 10.0.0.5",
+			wantForwarded: `for=203.0.113.9;proto=https, for=10.0.0.5;proto=http;host="example.com"`,
+			wantProto:     "https",
+		},
+		{
+			name:          "untrusted client chain is replaced",
+			remoteAddr:    "198.51.100.7:4000",
+			wantXFF:       "198.51.100.7",
+			wantForwarded: `for=198.51.100.7;proto=http;host="example.com"`,
+			wantProto:     "http",
+		},
+		{
+			name:          "quotes in host are escaped",
+			remoteAddr:    "198.51.100.7:4000",
+			host:          `example.com";for=6.6.6.6;proto="https`,
+			wantXFF:       "198.51.100.7",
+			wantForwarded: `for=198.51.100.7;proto=http;host="example.com\";for=6.6.6.6;proto=\"https"`,
+			wantProto:     "http",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "http://example.com/", nil)
+			req.RemoteAddr = tt.remoteAddr
+			if tt.host != "" {
+				req.Host = tt.host
+			}
+			req.Header.Set("X-Forwarded-For", "203.0.113.9")
+			req.Header.Set("X-Forwarded-Proto", "https")
+			req.Header.Set("Forwarded", "for=203.0.113.9;proto=https")
+
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+
+			if gotXFF != tt.wantXFF {
+				t.Errorf("X-Forwarded-For: expected %q, got %q", tt.wantXFF, gotXFF)
+			}
+			if gotForwarded != tt.wantForwarded {
+				t.Errorf("Forwarded: expected %q, got %q", tt.wantForwarded, gotForwarded)
+			}
+			if gotProto != tt.wantProto {
+				t.Errorf("X-Forwarded-Proto: expected %q, got %q", tt.wantProto, gotProto)
+			}
+		})
+	}
+}
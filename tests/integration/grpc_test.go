@@ -0,0 +1,208 @@
+package integration
+
+import (
+	"github.com/athebyme/cloud-ru-assign/internal/adapters/secondary/logger"
+	"github.com/athebyme/cloud-ru-assign/internal/adapters/secondary/proxy"
+	"github.com/athebyme/cloud-ru-assign/internal/adapters/secondary/repository"
+	"github.com/athebyme/cloud-ru-assign/internal/core/app"
+	"github.com/athebyme/cloud-ru-assign/internal/core/domain/grpc"
+	"github.com/athebyme/cloud-ru-assign/internal/core/domain/retry"
+	"github.com/athebyme/cloud-ru-assign/internal/core/domain/routing"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestLoadBalancer_GRPCStatusRetries(t *testing.T) {
+	// первый вызов каждого метода завершается UNAVAILABLE в трейлере, следующие - OK
+	var calls atomic.Int32
+	seen := make(map[string]bool)
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		status := grpc.OK
+		if !seen[r.URL.Path] {
+			seen[r.URL.Path] = true
+			status = grpc.Unavailable
+		}
+		w.Header().Set("Content-Type", "application/grpc")
+		w.Header().Set("Trailer", "Grpc-Status")
+		w.WriteHeader(http.StatusOK)
+		if status == grpc.OK {
+			w.Write([]byte{0, 0, 0, 0, 0})
+		}
+		w.Header().Set("Grpc-Status", strconv.Itoa(int(status)))
+	}))
+	defer backend.Close()
+
+	logger := logger.NewSlogAdapter("error", false)
+	repo, _ := repository.NewMemoryPool([]string{backend.URL}, logger)
+	policy := retry.DefaultPolicy()
+	lbService := app.NewLoadBalancerService(repo, proxy.NewHttpUtilForwarder(logger), logger,
+		app.WithRoutes(routing.NewTable([]*routing.Route{{
+			Name:       "users",
+			PathPrefix: "/acme.Users/",
+			Pool:       routing.DefaultPool,
+			Retry:      &policy,
+			GRPC: &grpc.Policy{
+				RetryOn:    []grpc.Code{grpc.Unavailable, grpc.ResourceExhausted},
+				Idempotent: []string{"/acme.Users/Get"},
+			},
+		}})),
+	)
+
+	call := func(method string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "http://lb.example.com"+method, strings.NewReader("\x00\x00\x00\x00\x00"))
+		req.Header.Set("Content-Type", "application/grpc")
+		rec := httptest.NewRecorder()
+		lbService.HandleRequest(rec, req)
+		return rec
+	}
+
+	rec := call("/acme.Users/Get")
+	if code, _ := grpc.StatusOf(rec.Header()); code != grpc.OK || calls.Load() != 2 {
+		t.Errorf("expected idempotent call retried to OK, got %s after %d calls", code, calls.Load())
+	}
+
+	calls.Store(0)
+	rec = call("/acme.Users/Create")
+	if code, _ := grpc.StatusOf(rec.Header()); code != grpc.Unavailable || calls.Load() != 1 {
+		t.Errorf("expected non-idempotent call not retried, got %s after %d calls", code, calls.Load())
+	}
+
+	// ошибка самого балансировщика приходит клиенту gRPC как grpc-status, а не HTTP 503
+	backend.Close()
+	rec = call("/acme.Users/Get")
+	if code, _ := grpc.StatusOf(rec.Header()); rec.Code != http.StatusOK || code != grpc.Unavailable {
+		t.Errorf("expected UNAVAILABLE as trailers-only response, got HTTP %d grpc-status %q", rec.Code, rec.Header().Get("Grpc-Status"))
+	}
+}
+
+func TestLoadBalancer_GRPCServerStreamWithRetries(t *testing.T) {
+	// бэкенд отправляет второе сообщение только после того, как клиент получил первое
+	received := make(chan struct{})
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/grpc")
+		w.Header().Set("Trailer", "Grpc-Status")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte{0, 0, 0, 0, 0})
+		w.(http.Flusher).Flush()
+		select {
+		case <-received:
+		case <-time.After(2 * time.Second):
+		}
+		w.Write([]byte{0, 0, 0, 0, 0})
+		w.Header().Set("Grpc-Status", strconv.Itoa(int(grpc.OK)))
+	}))
+	defer backend.Close()
+
+	logger := logger.NewSlogAdapter("error", false)
+	repo, _ := repository.NewMemoryPool([]string{backend.URL}, logger)
+	policy := retry.DefaultPolicy()
+	lbService := app.NewLoadBalancerService(repo, proxy.NewHttpUtilForwarder(logger), logger,
+		app.WithRoutes(routing.NewTable([]*routing.Route{{
+			Name:       "events",
+			PathPrefix: "/acme.Events/",
+			Pool:       routing.DefaultPool,
+			Retry:      &policy,
+			GRPC: &grpc.Policy{
+				RetryOn:    []grpc.Code{grpc.Unavailable},
+				Idempotent: []string{"/acme.Events/Watch"},
+			},
+		}})),
+	)
+	lb := httptest.NewServer(http.HandlerFunc(lbService.HandleRequest))
+	defer lb.Close()
+
+	req, _ := http.NewRequest("POST", lb.URL+"/acme.Events/Watch", strings.NewReader("\x00\x00\x00\x00\x00"))
+	req.Header.Set("Content-Type", "application/grpc")
+	// повтор по grpc-status не должен придерживать поток до конца вызова
+	start := time.Now()
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if _, err := io.ReadFull(resp.Body, make([]byte, 5)); err != nil {
+		t.Fatalf("failed to read first message: %v", err)
+	}
+	if took := time.Since(start); took > time.Second {
+		t.Errorf("first message of the stream was held for %v", took)
+	}
+	close(received)
+
+	rest, _ := io.ReadAll(resp.Body)
+	if len(rest) != 5 || resp.Trailer.Get("Grpc-Status") != "0" {
+		t.Errorf("expected second message and OK status, got %d bytes, grpc-status %q", len(rest), resp.Trailer.Get("Grpc-Status"))
+	}
+}
+
+func TestLoadBalancer_GRPCClientStreamNotBuffered(t *testing.T) {
+	// клиентский поток: клиент закрывает свою сторону, только когда бэкенд получил первое сообщение
+	received := make(chan struct{})
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := io.ReadFull(r.Body, make([]byte, 5)); err == nil {
+			close(received)
+		}
+		io.Copy(io.Discard, r.Body)
+		w.Header().Set("Content-Type", "application/grpc")
+		w.Header().Set("Trailer", "Grpc-Status")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte{0, 0, 0, 0, 0})
+		w.Header().Set("Grpc-Status", strconv.Itoa(int(grpc.OK)))
+	}))
+	defer backend.Close()
+
+	logger := logger.NewSlogAdapter("error", false)
+	repo, _ := repository.NewMemoryPool([]string{backend.URL}, logger)
+	policy := retry.DefaultPolicy()
+	lbService := app.NewLoadBalancerService(repo, proxy.NewHttpUtilForwarder(logger), logger,
+		app.WithRoutes(routing.NewTable([]*routing.Route{{
+			Name:       "uploads",
+			PathPrefix: "/acme.Uploads/",
+			Pool:       routing.DefaultPool,
+			Retry:      &policy,
+			GRPC: &grpc.Policy{
+				RetryOn:    []grpc.Code{grpc.Unavailable},
+				Idempotent: []string{"/acme.Uploads/Put"},
+			},
+		}})),
+	)
+	lb := httptest.NewServer(http.HandlerFunc(lbService.HandleRequest))
+	defer lb.Close()
+
+	pr, pw := io.Pipe()
+	req, _ := http.NewRequest("POST", lb.URL+"/acme.Uploads/Put", pr)
+	req.Header.Set("Content-Type", "application/grpc")
+	go func() {
+		pw.Write([]byte{0, 0, 0, 0, 0})
+		select {
+		case <-received:
+		case <-time.After(2 * time.Second):
+		}
+		pw.Close()
+	}()
+
+	start := time.Now()
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	io.ReadAll(resp.Body)
+	select {
+	case <-received:
+	default:
+		t.Fatal("backend did not receive the first message")
+	}
+	if took := time.Since(start); took > time.Second {
+		t.Errorf("first message reached the backend only after the client closed the stream (%v)", took)
+	}
+	if resp.Trailer.Get("Grpc-Status") != "0" {
+		t.Errorf("expected OK status, got %q", resp.Trailer.Get("Grpc-Status"))
+	}
+}
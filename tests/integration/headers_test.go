@@ -0,0 +1,99 @@
+package integration
+
+import (
+	"github.com/athebyme/cloud-ru-assign/internal/adapters/secondary/logger"
+	"github.com/athebyme/cloud-ru-assign/internal/adapters/secondary/proxy"
+	"github.com/athebyme/cloud-ru-assign/internal/adapters/secondary/repository"
+	"github.com/athebyme/cloud-ru-assign/internal/core/app"
+	"github.com/athebyme/cloud-ru-assign/internal/core/domain/headers"
+	"github.com/athebyme/cloud-ru-assign/internal/core/domain/routing"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestLoadBalancer_HeaderRules(t *testing.T) {
+	var gotRealIP, gotEnv, gotDebug, gotHost string
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotRealIP = r.Header.Get("X-Real-IP")
+		gotEnv = r.Header.Get("X-Env")
+		gotDebug = r.Header.Get("X-Debug")
+		gotHost = r.Host
+		w.Header().Set("Server", "backend/1.0")
+	}))
+	defer backend.Close()
+	backendURL, _ := url.Parse(backend.URL)
+
+	newRules := func(request, response headers.Ops) *headers.Rules {
+		return &headers.Rules{Request: request, Response: response}
+	}
+	tmpl := func(s string) headers.Template {
+		parsed, err := headers.ParseTemplate(s)
+		if err != nil {
+			t.Fatalf("parse template %q: %v", s, err)
+		}
+		return parsed
+	}
+
+	logger := logger.NewSlogAdapter("error", false)
+	defaultRepo, _ := repository.NewMemoryPool([]string{backend.URL}, logger)
+	apiRepo, _ := repository.NewMemoryPool([]string{backend.URL}, logger)
+	poolRules := newRules(
+		headers.Ops{Set: []headers.Header{{Name: "X-Env", Value: tmpl("staging")}}},
+		headers.Ops{Remove: []string{"Server"}},
+	)
+	routeRules := newRules(
+		headers.Ops{
+			Remove: []string{"X-Debug"},
+			Set: []headers.Header{
+				{Name: "X-Env", Value: tmpl("prod")}, // маршрут перекрывает пул
+				{Name: "X-Real-IP", Value: tmpl("${client_ip}")},
+				{Name: "Host", Value: tmpl("api.internal")},
+			},
+		},
+		headers.Ops{Add: []headers.Header{{Name: "X-Served-By", Value: tmpl("${backend}${path}")}}},
+	)
+	lbService := app.NewLoadBalancerService(defaultRepo, proxy.NewHttpUtilForwarder(logger), logger,
+		app.WithPool("api", apiRepo, nil),
+		app.WithPoolHeaders("api", poolRules),
+		app.WithRoutes(routing.NewTable([]*routing.Route{
+			{Name: "api", PathPrefix: "/api/", Pool: "api", Headers: routeRules},
+		})),
+	)
+
+	req := httptest.NewRequest("GET", "http://example.com/api/items", nil)
+	req.RemoteAddr = "198.51.100.7:4000"
+	req.Header.Set("X-Debug", "1")
+	rec := httptest.NewRecorder()
+	lbService.HandleRequest(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	if gotRealIP != "198.51.100.7" {
+		t.Errorf("expected X-Real-IP from client IP, got %q", gotRealIP)
+	}
+	if gotEnv != "prod" {
+		t.Errorf("expected route rule to override pool rule, got X-Env %q", gotEnv)
+	}
+	if gotDebug != "" {
+		t.Errorf("expected X-Debug to be removed, got %q", gotDebug)
+	}
+	if gotHost != "api.internal" {
+		t.Errorf("expected Host rule to set upstream host, got %q", gotHost)
+	}
+	if got := rec.Header().Get("Server"); got != "" {
+		t.Errorf("expected Server header to be removed, got %q", got)
+	}
+	if got, want := rec.Header().Get("X-Served-By"), backendURL.Host+"/api/items"; got != want {
+		t.Errorf("expected X-Served-By %q, got %q", want, got)
+	}
+
+	// запрос вне маршрута идет в пул по умолчанию без правил
+	rec = httptest.NewRecorder()
+	lbService.HandleRequest(rec, httptest.NewRequest("GET", "http://example.com/other", nil))
+	if gotEnv != "" || rec.Header().Get("Server") == "" {
+		t.Errorf("expected no rules outside the route, got X-Env %q, Server %q", gotEnv, rec.Header().Get("Server"))
+	}
+}
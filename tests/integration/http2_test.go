@@ -0,0 +1,133 @@
+package integration
+
+import (
+	"context"
+	"crypto/tls"
+	"github.com/athebyme/cloud-ru-assign/internal/adapters/secondary/logger"
+	"github.com/athebyme/cloud-ru-assign/internal/adapters/secondary/proxy"
+	"github.com/athebyme/cloud-ru-assign/internal/adapters/secondary/repository"
+	"github.com/athebyme/cloud-ru-assign/internal/core/app"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	lbhttp "github.com/athebyme/cloud-ru-assign/internal/adapters/primary/http"
+)
+
+// newH2CClient клиент, который говорит HTTP/2 без TLS (prior knowledge)
+func newH2CClient() *http.Client {
+	return &http.Client{
+		Transport: &http2.Transport{
+			AllowHTTP: true,
+			DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, network, addr)
+			},
+		},
+		Timeout: 5 * time.Second,
+	}
+}
+
+func startServerAdapter(t *testing.T, adapter *lbhttp.ServerAdapter) {
+	t.Helper()
+	if err := adapter.Run(); err != nil {
+		t.Fatalf("run server adapter: %v", err)
+	}
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		adapter.Stop(ctx)
+	})
+}
+
+func TestLoadBalancer_H2CEndToEndWithTrailers(t *testing.T) {
+	// бэкенд отвечает только по h2c и отдает трейлер, как gRPC сервер
+	backend := httptest.NewServer(h2c.NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Trailer", "X-Checksum")
+		w.Header().Set("X-Backend-Proto", r.Proto)
+		w.WriteHeader(http.StatusOK)
+		io.WriteString(w, "hello")
+		w.Header().Set("X-Checksum", "42")
+	}), &http2.Server{}))
+	defer backend.Close()
+
+	logger := logger.NewSlogAdapter("error", false)
+	repo, _ := repository.NewMemoryPool([]string{backend.URL}, logger)
+	forwarder := proxy.NewHttpUtilForwarder(logger,
+		proxy.WithUpstream(backend.URL, proxy.UpstreamSettings{Protocol: proxy.ProtocolH2C}))
+	lbService := app.NewLoadBalancerService(repo, forwarder, logger)
+
+	adapter := lbhttp.NewServerAdapter("127.0.0.1:0", lbService, logger,
+		lbhttp.WithHTTP2(lbhttp.HTTP2Settings{H2C: true}))
+	startServerAdapter(t, adapter)
+
+	client := newH2CClient()
+	defer client.CloseIdleConnections()
+	resp, err := client.Get("http://" + adapter.Addr().String() + "/")
+	if err != nil {
+		t.Fatalf("h2c request: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+
+	if resp.ProtoMajor != 2 {
+		t.Errorf("expected HTTP/2 from balancer, got %s", resp.Proto)
+	}
+	if got := resp.Header.Get("X-Backend-Proto"); got != "HTTP/2.0" {
+		t.Errorf("expected balancer to talk h2c to backend, backend saw %q", got)
+	}
+	if string(body) != "hello" {
+		t.Errorf("unexpected body %q", body)
+	}
+	if got := resp.Trailer.Get("X-Checksum"); got != "42" {
+		t.Errorf("expected trailer X-Checksum=42, got %q", got)
+	}
+}
+
+func TestLoadBalancer_TLSNegotiatesHTTP2(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok")
+	}))
+	defer backend.Close()
+
+	// берем самоподписанный сертификат httptest, чтобы не хранить ключи в репозитории
+	certSource := httptest.NewTLSServer(http.NotFoundHandler())
+	defer certSource.Close()
+	rootCAs := certSource.Client().Transport.(*http.Transport).TLSClientConfig.RootCAs
+
+	logger := logger.NewSlogAdapter("error", false)
+	repo, _ := repository.NewMemoryPool([]string{backend.URL}, logger)
+	lbService := app.NewLoadBalancerService(repo, proxy.NewHttpUtilForwarder(logger), logger)
+
+	adapter := lbhttp.NewServerAdapter("127.0.0.1:0", lbService, logger,
+		lbhttp.WithTLSConfig(&tls.Config{Certificates: certSource.TLS.Certificates}),
+		lbhttp.WithHTTP2(lbhttp.HTTP2Settings{Enabled: true}))
+	startServerAdapter(t, adapter)
+
+	client := &http.Client{
+		Transport: &http2.Transport{TLSClientConfig: &tls.Config{RootCAs: rootCAs}},
+		Timeout:   5 * time.Second,
+	}
+	defer client.CloseIdleConnections()
+	resp, err := client.Get("https://" + adapter.Addr().String() + "/")
+	if err != nil {
+		t.Fatalf("https request: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+
+	if resp.ProtoMajor != 2 {
+		t.Errorf("expected HTTP/2 negotiated via ALPN, got %s", resp.Proto)
+	}
+	if resp.TLS == nil || resp.TLS.NegotiatedProtocol != "h2" {
+		t.Errorf("expected ALPN protocol h2, got %+v", resp.TLS)
+	}
+	if string(body) != "ok" {
+		t.Errorf("unexpected body %q", body)
+	}
+}
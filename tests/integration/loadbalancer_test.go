@@ -5,14 +5,18 @@ import (
 	"github.com/athebyme/cloud-ru-assign/internal/adapters/secondary/logger"
 	"github.com/athebyme/cloud-ru-assign/internal/adapters/secondary/proxy"
 	"github.com/athebyme/cloud-ru-assign/internal/adapters/secondary/repository"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"strings"
 	"sync"
 	"testing"
 	"time"
 
 	"github.com/athebyme/cloud-ru-assign/internal/core/app"
+	"github.com/athebyme/cloud-ru-assign/internal/core/domain/retry"
+	"github.com/athebyme/cloud-ru-assign/internal/core/domain/routing"
 )
 
 func TestLoadBalancer_RoundRobin(t *testing.T) {
@@ -139,3 +143,192 @@ func TestLoadBalancer_ConcurrentRequests(t *testing.T) {
 		t.Error(err)
 	}
 }
+
+func TestLoadBalancer_RetryPostOnConnectError(t *testing.T) {
+	// закрытый сервер: соединение не устанавливается, тело до него не доходит
+	deadServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	deadURL := deadServer.URL
+	deadServer.Close()
+
+	liveServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Write(body)
+	}))
+	defer liveServer.Close()
+
+	logger := logger.NewSlogAdapter("error", false)
+	repo, _ := repository.NewMemoryPool([]string{deadURL, liveServer.URL}, logger)
+	forwarder := proxy.NewHttpUtilForwarder(logger)
+	lbService := app.NewLoadBalancerService(repo, forwarder, logger)
+
+	req := httptest.NewRequest("POST", "/", strings.NewReader("payload"))
+	rec := httptest.NewRecorder()
+	lbService.HandleRequest(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200 after retry, got %d", rec.Code)
+	}
+	if rec.Body.String() != "payload" {
+		t.Errorf("expected full body to reach live backend, got %q", rec.Body.String())
+	}
+}
+
+func TestLoadBalancer_RetryResendsConsumedBody(t *testing.T) {
+	// первый бэкенд дочитывает тело и обрывает соединение: повтор должен отправить тело заново целиком
+	resetServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.ReadAll(r.Body)
+		panic(http.ErrAbortHandler)
+	}))
+	defer resetServer.Close()
+
+	liveServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Write(body)
+	}))
+	defer liveServer.Close()
+
+	logger := logger.NewSlogAdapter("error", false)
+	repo, _ := repository.NewMemoryPool([]string{resetServer.URL, liveServer.URL}, logger)
+	lbService := app.NewLoadBalancerService(repo, proxy.NewHttpUtilForwarder(logger), logger)
+
+	req := httptest.NewRequest("PUT", "/", strings.NewReader("payload"))
+	rec := httptest.NewRecorder()
+	lbService.HandleRequest(rec, req)
+
+	if rec.Code != http.StatusOK || rec.Body.String() != "payload" {
+		t.Errorf("expected full body replayed to the second backend, got %d %q", rec.Code, rec.Body.String())
+	}
+}
+
+func TestLoadBalancer_HedgedRequest(t *testing.T) {
+	slowServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(2 * time.Second):
+			w.Write([]byte("slow"))
+		case <-r.Context().Done():
+		}
+	}))
+	defer slowServer.Close()
+
+	fastServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("fast"))
+	}))
+	defer fastServer.Close()
+
+	logger := logger.NewSlogAdapter("error", false)
+	repo, _ := repository.NewMemoryPool([]string{slowServer.URL, fastServer.URL}, logger)
+	forwarder := proxy.NewHttpUtilForwarder(logger)
+	routes := routing.NewTable([]*routing.Route{{
+		Name:       "api",
+		PathPrefix: "/",
+		Pool:       routing.DefaultPool,
+		Hedge:      &retry.Hedge{Delay: 20 * time.Millisecond},
+	}})
+	lbService := app.NewLoadBalancerService(repo, forwarder, logger, app.WithRoutes(routes))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	rec := httptest.NewRecorder()
+	start := time.Now()
+	lbService.HandleRequest(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", rec.Code)
+	}
+	if rec.Body.String() != "fast" {
+		t.Errorf("expected hedged backend to win, got %q", rec.Body.String())
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("hedged request took too long: %v", elapsed)
+	}
+}
+
+func TestLoadBalancer_HedgedLargeResponseStreamed(t *testing.T) {
+	// первый бэкенд отвечает большим телом и продолжает, только когда клиент получил начало ответа
+	received := make(chan struct{})
+	chunk := strings.Repeat("x", 100<<10)
+	largeServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(50 * time.Millisecond)
+		w.Write([]byte(chunk))
+		w.(http.Flusher).Flush()
+		select {
+		case <-received:
+		case <-time.After(2 * time.Second):
+		}
+		w.Write([]byte("end"))
+	}))
+	defer largeServer.Close()
+	var hedged sync.WaitGroup
+	hedged.Add(1)
+	slowServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer hedged.Done()
+		<-r.Context().Done() // хеджирующий запрос отменяется, когда клиенту пошел большой ответ
+	}))
+	defer slowServer.Close()
+
+	logger := logger.NewSlogAdapter("error", false)
+	repo, _ := repository.NewMemoryPool([]string{largeServer.URL, slowServer.URL}, logger)
+	routes := routing.NewTable([]*routing.Route{{
+		Name:       "api",
+		PathPrefix: "/",
+		Pool:       routing.DefaultPool,
+		Hedge:      &retry.Hedge{Delay: 10 * time.Millisecond},
+	}})
+	lbService := app.NewLoadBalancerService(repo, proxy.NewHttpUtilForwarder(logger), logger, app.WithRoutes(routes))
+	lb := httptest.NewServer(http.HandlerFunc(lbService.HandleRequest))
+	defer lb.Close()
+
+	start := time.Now()
+	resp, err := http.Get(lb.URL)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if _, err := io.ReadFull(resp.Body, make([]byte, len(chunk))); err != nil {
+		t.Fatalf("failed to read response start: %v", err)
+	}
+	if took := time.Since(start); took > time.Second {
+		t.Errorf("large hedged response was buffered for %v", took)
+	}
+	close(received)
+	if rest, _ := io.ReadAll(resp.Body); string(rest) != "end" {
+		t.Errorf("expected rest of the response, got %q", rest)
+	}
+	hedged.Wait()
+}
+
+func TestLoadBalancer_HedgeRespectsRetryBudget(t *testing.T) {
+	var mu sync.Mutex
+	calls := 0
+	backend := func(delay time.Duration) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			calls++
+			mu.Unlock()
+			time.Sleep(delay)
+			w.Write([]byte("ok"))
+		}))
+	}
+	slowServer, fastServer := backend(200*time.Millisecond), backend(0)
+	defer slowServer.Close()
+	defer fastServer.Close()
+
+	logger := logger.NewSlogAdapter("error", false)
+	repo, _ := repository.NewMemoryPool([]string{slowServer.URL, fastServer.URL}, logger)
+	routes := routing.NewTable([]*routing.Route{{
+		Name:       "api",
+		PathPrefix: "/",
+		Pool:       routing.DefaultPool,
+		Hedge:      &retry.Hedge{Delay: 10 * time.Millisecond},
+	}})
+	// пустой бюджет: хеджирующий запрос, как и повтор, не отправляется
+	lbService := app.NewLoadBalancerService(repo, proxy.NewHttpUtilForwarder(logger), logger,
+		app.WithRoutes(routes),
+		app.WithRetryBudget(retry.NewBudget(0, 0, time.Second)),
+	)
+
+	rec := httptest.NewRecorder()
+	lbService.HandleRequest(rec, httptest.NewRequest("GET", "/", nil))
+	if rec.Code != http.StatusOK || calls != 1 {
+		t.Errorf("expected a single request without hedging, got %d after %d calls", rec.Code, calls)
+	}
+}
@@ -0,0 +1,96 @@
+package integration
+
+import (
+	"github.com/athebyme/cloud-ru-assign/internal/adapters/secondary/logger"
+	"github.com/athebyme/cloud-ru-assign/internal/adapters/secondary/proxy"
+	"github.com/athebyme/cloud-ru-assign/internal/adapters/secondary/repository"
+	"github.com/athebyme/cloud-ru-assign/internal/core/app"
+	"github.com/athebyme/cloud-ru-assign/internal/core/domain/mirror"
+	"github.com/athebyme/cloud-ru-assign/internal/core/domain/routing"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadBalancer_MirrorsToShadowPool(t *testing.T) {
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		io.WriteString(w, "primary")
+	}))
+	defer primary.Close()
+
+	type shadowCall struct {
+		body   string
+		marker string
+	}
+	shadowCalls := make(chan shadowCall, 4)
+	release := make(chan struct{})
+	shadow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		shadowCalls <- shadowCall{body: string(body), marker: r.Header.Get("X-Shadow-Request")}
+		<-release // медленный теневой пул не должен задерживать ответ клиенту
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer shadow.Close()
+
+	logger := logger.NewSlogAdapter("error", false)
+	primaryRepo, _ := repository.NewMemoryPool([]string{primary.URL}, logger)
+	shadowRepo, _ := repository.NewMemoryPool([]string{shadow.URL}, logger)
+	forwarder := proxy.NewHttpUtilForwarder(logger)
+	mirrorer := app.NewMirrorer(forwarder, logger, 4)
+	lbService := app.NewLoadBalancerService(primaryRepo, forwarder, logger,
+		app.WithPool("orders-v2", shadowRepo, nil),
+		app.WithMirrorer(mirrorer),
+		app.WithRoutes(routing.NewTable([]*routing.Route{{
+			Name:       "orders",
+			PathPrefix: "/orders/",
+			Pool:       routing.DefaultPool,
+			Mirror:     &mirror.Policy{Pool: "orders-v2", Percent: 100, MaxBodyBytes: 16},
+		}})),
+	)
+
+	done := make(chan *httptest.ResponseRecorder)
+	go func() {
+		rec := httptest.NewRecorder()
+		lbService.HandleRequest(rec, httptest.NewRequest("POST", "http://lb.example.com/orders/1", strings.NewReader(`{"qty":1}`)))
+		done <- rec
+	}()
+
+	var rec *httptest.ResponseRecorder
+	select {
+	case rec = <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("primary response waited for the shadow pool")
+	}
+	if rec.Code != http.StatusOK || rec.Body.String() != "primary" {
+		t.Fatalf("expected primary response, got %d %q", rec.Code, rec.Body.String())
+	}
+
+	call := <-shadowCalls
+	if call.body != `{"qty":1}` || call.marker != "true" {
+		t.Errorf("unexpected shadow request: %+v", call)
+	}
+	close(release)
+
+	// тело больше лимита зеркалирования не копируется
+	lbService.HandleRequest(httptest.NewRecorder(), httptest.NewRequest("POST", "http://lb.example.com/orders/2", strings.NewReader(strings.Repeat("x", 64))))
+
+	deadline := time.Now().Add(2 * time.Second)
+	var stats mirror.Stats
+	for time.Now().Before(deadline) {
+		stats = mirrorer.MirrorStats()["orders"]
+		if stats.Compared == 1 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if stats.Mirrored != 1 || stats.SkippedBody != 1 || stats.Compared != 1 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+	if stats.StatusMismatches != 1 || stats.Statuses[http.StatusInternalServerError] != 1 {
+		t.Errorf("expected 500 from shadow to be recorded as mismatch, got %+v", stats)
+	}
+}
@@ -0,0 +1,198 @@
+package integration
+
+import (
+	"bufio"
+	"encoding/binary"
+	"github.com/athebyme/cloud-ru-assign/internal/adapters/secondary/healthcheck"
+	"github.com/athebyme/cloud-ru-assign/internal/adapters/secondary/logger"
+	"github.com/athebyme/cloud-ru-assign/internal/adapters/secondary/proxy"
+	"github.com/athebyme/cloud-ru-assign/internal/adapters/secondary/proxyproto"
+	"github.com/athebyme/cloud-ru-assign/internal/adapters/secondary/repository"
+	"github.com/athebyme/cloud-ru-assign/internal/core/app"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	lbhttp "github.com/athebyme/cloud-ru-assign/internal/adapters/primary/http"
+)
+
+// proxyV2Header собирает заголовок PROXY v2 для TCP поверх IPv4
+func proxyV2Header(src, dst net.IP, srcPort, dstPort uint16) []byte {
+	header := []byte("\r\n\r\n\x00\r\nQUIT\n")
+	header = append(header, 0x21, 0x11, 0x00, 12)
+	header = append(header, src.To4()...)
+	header = append(header, dst.To4()...)
+	header = binary.BigEndian.AppendUint16(header, srcPort)
+	return binary.BigEndian.AppendUint16(header, dstPort)
+}
+
+// sendRawRequest отправляет prefix и GET запрос по одному TCP соединению и возвращает ответ
+func sendRawRequest(t *testing.T, addr string, prefix []byte) *http.Response {
+	t.Helper()
+	conn, err := net.DialTimeout("tcp", addr, 2*time.Second)
+	if err != nil {
+		t.Fatalf("dial balancer: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	payload := append(append([]byte{}, prefix...), "GET / HTTP/1.1\r\nHost: example.com\r\nConnection: close\r\n\r\n"...)
+	if _, err := conn.Write(payload); err != nil {
+		t.Fatalf("write request: %v", err)
+	}
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		t.Fatalf("read response: %v", err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+// newProxyProtocolBackend HTTP бэкенд, который ждет заголовок PROXY v1 в начале каждого соединения
+// строки заголовков складываются в канал
+func newProxyProtocolBackend(t *testing.T) (string, <-chan string) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen backend: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	headers := make(chan string, 16)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				reader := bufio.NewReader(conn)
+				line, err := reader.ReadString('\n')
+				if err != nil {
+					return
+				}
+				headers <- line
+				if _, err := http.ReadRequest(reader); err != nil {
+					return
+				}
+				conn.Write([]byte("HTTP/1.1 200 OK\r\nContent-Length: 2\r\nConnection: close\r\n\r\nok"))
+			}()
+		}
+	}()
+	return "http://" + ln.Addr().String(), headers
+}
+
+func TestServerAdapter_ProxyProtocolFeedsClientIP(t *testing.T) {
+	var gotXFF atomic.Value
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotXFF.Store(r.Header.Get("X-Forwarded-For"))
+	}))
+	defer backend.Close()
+
+	logger := logger.NewSlogAdapter("error", false)
+	repo, _ := repository.NewMemoryPool([]string{backend.URL}, logger)
+	lbService := app.NewLoadBalancerService(repo, proxy.NewHttpUtilForwarder(logger), logger)
+
+	var trusted atomic.Bool
+	adapter := lbhttp.NewServerAdapter("127.0.0.1:0", lbService, logger,
+		lbhttp.WithProxyProtocol(lbhttp.ProxyProtocolSettings{
+			Trusted:       func(ip net.IP) bool { return trusted.Load() },
+			HeaderTimeout: time.Second,
+		}))
+	startServerAdapter(t, adapter)
+	addr := adapter.Addr().String()
+
+	tests := []struct {
+		name       string
+		trusted    bool
+		prefix     []byte
+		wantStatus int
+		wantXFF    string
+	}{
+		{
+			name:       "v1 header from trusted source",
+			trusted:    true,
+			prefix:     []byte("PROXY TCP4 203.0.113.7 198.51.100.1 5555 443\r\n"),
+			wantStatus: http.StatusOK,
+			wantXFF:    "203.0.113.7",
+		},
+		{
+			name:       "v2 header from trusted source",
+			trusted:    true,
+			prefix:     proxyV2Header(net.ParseIP("203.0.113.8"), net.ParseIP("198.51.100.1"), 5555, 443),
+			wantStatus: http.StatusOK,
+			wantXFF:    "203.0.113.8",
+		},
+		{
+			name:       "trusted source without header keeps peer address",
+			trusted:    true,
+			wantStatus: http.StatusOK,
+			wantXFF:    "127.0.0.1",
+		},
+		{
+			name:       "header from untrusted source is rejected",
+			trusted:    false,
+			prefix:     []byte("PROXY TCP4 203.0.113.7 198.51.100.1 5555 443\r\n"),
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			trusted.Store(tt.trusted)
+			gotXFF.Store("")
+			resp := sendRawRequest(t, addr, tt.prefix)
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("expected status %d, got %d", tt.wantStatus, resp.StatusCode)
+			}
+			if got := gotXFF.Load().(string); got != tt.wantXFF {
+				t.Errorf("expected X-Forwarded-For %q, got %q", tt.wantXFF, got)
+			}
+		})
+	}
+}
+
+func TestLoadBalancer_SendsProxyProtocolToBackend(t *testing.T) {
+	backendURL, headers := newProxyProtocolBackend(t)
+
+	logger := logger.NewSlogAdapter("error", false)
+	repo, _ := repository.NewMemoryPool([]string{backendURL}, logger)
+	forwarder := proxy.NewHttpUtilForwarder(logger,
+		proxy.WithUpstream(backendURL, proxy.UpstreamSettings{ProxyProtocol: proxyproto.V1}))
+	lbService := app.NewLoadBalancerService(repo, forwarder, logger)
+
+	adapter := lbhttp.NewServerAdapter("127.0.0.1:0", lbService, logger,
+		lbhttp.WithProxyProtocol(lbhttp.ProxyProtocolSettings{
+			Trusted: func(ip net.IP) bool { return ip.IsLoopback() },
+		}))
+	startServerAdapter(t, adapter)
+
+	resp := sendRawRequest(t, adapter.Addr().String(), []byte("PROXY TCP4 203.0.113.7 198.51.100.1 5555 443\r\n"))
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d", resp.StatusCode)
+	}
+	select {
+	case got := <-headers:
+		// клиент и точка входа из заголовка L4 балансировщика уходят бэкенду без изменений
+		if want := "PROXY TCP4 203.0.113.7 198.51.100.1 5555 443\r\n"; got != want {
+			t.Errorf("expected backend header %q, got %q", want, got)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("backend did not receive PROXY header")
+	}
+
+	// health check открывает соединение сам, поэтому адресов клиента в заголовке нет
+	checker := healthcheck.NewHTTPChecker(2*time.Second, "/health",
+		healthcheck.WithBackendProxyProtocol(backendURL, proxyproto.V1))
+	target, _ := url.Parse(backendURL)
+	if err := checker.Check(target); err != nil {
+		t.Fatalf("health check: %v", err)
+	}
+	if got := <-headers; got != "PROXY UNKNOWN\r\n" {
+		t.Errorf("expected UNKNOWN header from health check, got %q", got)
+	}
+}
@@ -0,0 +1,76 @@
+package integration
+
+import (
+	"encoding/json"
+	"github.com/athebyme/cloud-ru-assign/internal/adapters/primary/http/middleware"
+	"github.com/athebyme/cloud-ru-assign/internal/adapters/secondary/logger"
+	"github.com/athebyme/cloud-ru-assign/internal/adapters/secondary/proxy"
+	"github.com/athebyme/cloud-ru-assign/internal/adapters/secondary/repository"
+	"github.com/athebyme/cloud-ru-assign/internal/core/app"
+	"github.com/athebyme/cloud-ru-assign/internal/core/domain/clientip"
+	"github.com/athebyme/cloud-ru-assign/internal/core/domain/problem"
+	"github.com/athebyme/cloud-ru-assign/internal/core/domain/requestid"
+	"github.com/athebyme/cloud-ru-assign/internal/core/domain/retry"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRequestID_GeneratedAndPropagated(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// бэкенд возвращает увиденный идентификатор в теле и пытается подменить его в ответе
+		w.Header().Set("X-Trace-ID", "from-backend")
+		w.Write([]byte(r.Header.Get("X-Trace-ID")))
+	}))
+	defer backend.Close()
+
+	logger := logger.NewSlogAdapter("error", false)
+	repo, _ := repository.NewMemoryPool([]string{backend.URL}, logger)
+	lbService := app.NewLoadBalancerService(repo, proxy.NewHttpUtilForwarder(logger), logger)
+	trustedProxies, _ := clientip.NewResolver([]string{"10.0.0.0/8"})
+	handler := middleware.ClientIPMiddleware(trustedProxies)(
+		middleware.RequestIDMiddleware(middleware.RequestIDSettings{Header: "X-Trace-ID", Generate: requestid.NewULID})(
+			http.HandlerFunc(lbService.HandleRequest),
+		),
+	)
+
+	send := func(remoteAddr, incoming string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = remoteAddr
+		if incoming != "" {
+			req.Header.Set("X-Trace-ID", incoming)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// новый идентификатор уходит бэкенду и возвращается клиенту вместо значения бэкенда
+	rec := send("198.51.100.7:5555", "")
+	id := rec.Header().Get("X-Trace-ID")
+	if len(id) != 26 || rec.Body.String() != id {
+		t.Errorf("expected generated ULID sent to backend and client, got header %q body %q", id, rec.Body.String())
+	}
+
+	// идентификатор от недоверенного клиента заменяется, от доверенного прокси - сохраняется
+	if rec := send("198.51.100.7:5555", "spoofed"); rec.Body.String() == "spoofed" || rec.Header().Get("X-Trace-ID") == "spoofed" {
+		t.Errorf("expected untrusted id to be replaced, got %q", rec.Body.String())
+	}
+	if rec := send("10.0.0.2:5555", "edge-42"); rec.Body.String() != "edge-42" || rec.Header().Get("X-Trace-ID") != "edge-42" {
+		t.Errorf("expected trusted id to be kept, got header %q body %q", rec.Header().Get("X-Trace-ID"), rec.Body.String())
+	}
+
+	// ответ об ошибке несет тот же идентификатор
+	backend.Close()
+	noRetry := retry.DefaultPolicy()
+	noRetry.MaxAttempts = 1
+	lbService = app.NewLoadBalancerService(repo, proxy.NewHttpUtilForwarder(logger), logger, app.WithRetryPolicy(noRetry))
+	handler = middleware.ClientIPMiddleware(trustedProxies)(
+		middleware.RequestIDMiddleware(middleware.RequestIDSettings{Header: "X-Trace-ID"})(http.HandlerFunc(lbService.HandleRequest)),
+	)
+	rec = send("10.0.0.2:5555", "edge-43")
+	var p problem.Problem
+	if err := json.Unmarshal(rec.Body.Bytes(), &p); err != nil || p.RequestID != "edge-43" || rec.Header().Get("X-Trace-ID") != "edge-43" {
+		t.Errorf("expected error response with request id, got %d %q (err %v)", rec.Code, rec.Body.String(), err)
+	}
+}
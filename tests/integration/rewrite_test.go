@@ -0,0 +1,61 @@
+package integration
+
+import (
+	"github.com/athebyme/cloud-ru-assign/internal/adapters/secondary/logger"
+	"github.com/athebyme/cloud-ru-assign/internal/adapters/secondary/proxy"
+	"github.com/athebyme/cloud-ru-assign/internal/adapters/secondary/repository"
+	"github.com/athebyme/cloud-ru-assign/internal/core/app"
+	"github.com/athebyme/cloud-ru-assign/internal/core/domain/routing"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestLoadBalancer_PathRewriteAndLocation(t *testing.T) {
+	var gotPath string
+	var backend *httptest.Server
+	backend = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		switch r.URL.Path {
+		case "/svc/absolute":
+			http.Redirect(w, r, backend.URL+"/svc/login", http.StatusFound)
+		case "/svc/relative":
+			http.Redirect(w, r, "/svc/login?next=%2Fhome", http.StatusFound)
+		case "/svc/external":
+			http.Redirect(w, r, "https://sso.example.org/auth", http.StatusFound)
+		}
+	}))
+	defer backend.Close()
+
+	logger := logger.NewSlogAdapter("error", false)
+	// путь бэкенда /svc склеивается с переписанным путем запроса
+	repo, _ := repository.NewMemoryPool([]string{backend.URL + "/svc"}, logger)
+	lbService := app.NewLoadBalancerService(repo, proxy.NewHttpUtilForwarder(logger), logger,
+		app.WithRoutes(routing.NewTable([]*routing.Route{
+			{Name: "billing", PathPrefix: "/billing/", Pool: routing.DefaultPool, Rewrite: &routing.Rewrite{StripPrefix: "/billing/"}},
+		})),
+	)
+
+	tests := []struct {
+		path         string
+		wantPath     string
+		wantLocation string
+	}{
+		{path: "/billing/absolute", wantPath: "/svc/absolute", wantLocation: "http://lb.example.com/billing/login"},
+		{path: "/billing/relative", wantPath: "/svc/relative", wantLocation: "/billing/login?next=%2Fhome"},
+		{path: "/billing/external", wantPath: "/svc/external", wantLocation: "https://sso.example.org/auth"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			lbService.HandleRequest(rec, httptest.NewRequest("GET", "http://lb.example.com"+tt.path, nil))
+
+			if gotPath != tt.wantPath {
+				t.Errorf("expected backend path %q, got %q", tt.wantPath, gotPath)
+			}
+			if got := rec.Header().Get("Location"); got != tt.wantLocation {
+				t.Errorf("expected Location %q, got %q", tt.wantLocation, got)
+			}
+		})
+	}
+}
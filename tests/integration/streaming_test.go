@@ -0,0 +1,105 @@
+package integration
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/athebyme/cloud-ru-assign/internal/adapters/secondary/logger"
+	"github.com/athebyme/cloud-ru-assign/internal/adapters/secondary/proxy"
+	"github.com/athebyme/cloud-ru-assign/internal/adapters/secondary/repository"
+	"github.com/athebyme/cloud-ru-assign/internal/core/app"
+	"github.com/athebyme/cloud-ru-assign/internal/core/domain/routing"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadBalancer_StreamingRoutes(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		count, _ := strconv.Atoi(r.URL.Query().Get("count"))
+		pause, _ := time.ParseDuration(r.URL.Query().Get("pause"))
+		if r.URL.Query().Get("sse") != "" {
+			w.Header().Set("Content-Type", "text/event-stream")
+		} else {
+			// длина известна, поэтому реверс-прокси сам ответ не сбрасывает
+			w.Header().Set("Content-Length", strconv.Itoa(count*len("chunk\n")))
+		}
+		w.WriteHeader(http.StatusOK)
+		for i := 0; i < count; i++ {
+			if i > 0 {
+				select {
+				case <-time.After(pause):
+				case <-r.Context().Done():
+					return
+				}
+			}
+			if r.URL.Query().Get("sse") != "" {
+				fmt.Fprintf(w, "data: %d\n\n", i)
+			} else {
+				io.WriteString(w, "chunk\n")
+			}
+			w.(http.Flusher).Flush()
+		}
+	}))
+	defer backend.Close()
+
+	logger := logger.NewSlogAdapter("error", false)
+	repo, _ := repository.NewMemoryPool([]string{backend.URL}, logger)
+	lbService := app.NewLoadBalancerService(repo, proxy.NewHttpUtilForwarder(logger), logger,
+		app.WithTimeouts(routing.Timeouts{Total: 200 * time.Millisecond}),
+		app.WithRoutes(routing.NewTable([]*routing.Route{{
+			Name:       "events",
+			PathPrefix: "/events/",
+			Pool:       routing.DefaultPool,
+			Stream:     &routing.StreamPolicy{IdleTimeout: 400 * time.Millisecond},
+		}})),
+	)
+	lb := httptest.NewUnstartedServer(http.HandlerFunc(lbService.HandleRequest))
+	lb.Config.WriteTimeout = 300 * time.Millisecond
+	lb.Start()
+	defer lb.Close()
+
+	// первая порция доходит до клиента сразу, а поток длиннее WriteTimeout и общего таймаута не обрывается
+	resp, err := http.Get(lb.URL + "/events/plain?count=6&pause=100ms")
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	reader := bufio.NewReader(resp.Body)
+	start := time.Now()
+	if line, err := reader.ReadString('\n'); err != nil || line != "chunk\n" {
+		t.Fatalf("expected first chunk, got %q (err %v)", line, err)
+	}
+	if waited := time.Since(start); waited > 200*time.Millisecond {
+		t.Errorf("expected first chunk to be flushed immediately, waited %v", waited)
+	}
+	rest, err := io.ReadAll(reader)
+	resp.Body.Close()
+	if err != nil || strings.Count(string(rest), "chunk\n") != 5 {
+		t.Errorf("expected the rest of the stream, got %q (err %v)", rest, err)
+	}
+
+	// SSE со стороны бэкенда, который замолчал дольше idleTimeout, прерывается
+	resp, err = http.Get(lb.URL + "/events/sse?sse=1&count=2&pause=2s")
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("expected text/event-stream, got %q", ct)
+	}
+	reader = bufio.NewReader(resp.Body)
+	if line, err := reader.ReadString('\n'); err != nil || line != "data: 0\n" {
+		t.Fatalf("expected first event, got %q (err %v)", line, err)
+	}
+	start = time.Now()
+	rest, _ = io.ReadAll(reader)
+	if strings.Contains(string(rest), "data: 1") {
+		t.Error("expected idle stream to be aborted before the second event")
+	}
+	if waited := time.Since(start); waited > time.Second {
+		t.Errorf("expected stream to be aborted after idle timeout, waited %v", waited)
+	}
+}
@@ -0,0 +1,98 @@
+package integration
+
+import (
+	"bufio"
+	"context"
+	"github.com/athebyme/cloud-ru-assign/internal/adapters/primary/tcp"
+	"github.com/athebyme/cloud-ru-assign/internal/adapters/secondary/logger"
+	"github.com/athebyme/cloud-ru-assign/internal/adapters/secondary/proxy"
+	"github.com/athebyme/cloud-ru-assign/internal/adapters/secondary/repository"
+	"github.com/athebyme/cloud-ru-assign/internal/core/app"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// newTCPEchoBackend отвечает на каждую строку строкой с префиксом name и закрывает запись после EOF клиента
+func newTCPEchoBackend(t *testing.T, name string) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				scanner := bufio.NewScanner(conn)
+				for scanner.Scan() {
+					io.WriteString(conn, name+":"+scanner.Text()+"\n")
+				}
+				io.WriteString(conn, name+":bye\n") // ответ после полузакрытия клиента
+			}()
+		}
+	}()
+	return "tcp://" + ln.Addr().String()
+}
+
+func TestTCPProxy_SplicesAndHalfCloses(t *testing.T) {
+	logger := logger.NewSlogAdapter("error", false)
+
+	// первый бэкенд не принимает соединения: сервис должен пометить его и перейти ко второму
+	dead, _ := net.Listen("tcp", "127.0.0.1:0")
+	deadURL := "tcp://" + dead.Addr().String()
+	dead.Close()
+	repo, _ := repository.NewMemoryPool([]string{deadURL, newTCPEchoBackend(t, "b1")}, logger)
+
+	service := app.NewTCPProxyService(repo, proxy.NewTCPDialer(time.Second, 0), logger, app.TCPProxySettings{
+		ConnectAttempts: 2,
+		IdleTimeout:     200 * time.Millisecond,
+	})
+	adapter := tcp.NewListenerAdapter("127.0.0.1:0", service, service, logger)
+	if err := adapter.Run(); err != nil {
+		t.Fatalf("failed to start listener: %v", err)
+	}
+	defer adapter.Stop(context.Background())
+
+	conn, err := net.Dial("tcp", adapter.Addr().String())
+	if err != nil {
+		t.Fatalf("failed to dial listener: %v", err)
+	}
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+
+	io.WriteString(conn, "ping\n")
+	if line, err := reader.ReadString('\n'); err != nil || line != "b1:ping\n" {
+		t.Fatalf("expected echo from live backend, got %q (err %v)", line, err)
+	}
+	if live := repo.GetBackends()[1]; repo.GetActiveConnections(live) != 1 {
+		t.Errorf("expected connection counted on live backend, got %d", repo.GetActiveConnections(live))
+	}
+
+	// полузакрытие клиента доходит до бэкенда, его ответ после EOF доходит до клиента
+	conn.(*net.TCPConn).CloseWrite()
+	rest, _ := io.ReadAll(reader)
+	if string(rest) != "b1:bye\n" {
+		t.Errorf("expected backend reply after half-close, got %q", rest)
+	}
+	if !waitFor(t, time.Second, func() bool { return service.Active() == 0 }) {
+		t.Errorf("expected connection to be released, active=%d", service.Active())
+	}
+
+	// соединение без трафика закрывается по таймауту простоя
+	idle, err := net.Dial("tcp", adapter.Addr().String())
+	if err != nil {
+		t.Fatalf("failed to dial listener: %v", err)
+	}
+	defer idle.Close()
+	idle.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, err := io.ReadAll(idle); err != nil {
+		t.Errorf("expected idle connection to be closed by balancer, got %v", err)
+	}
+}
@@ -0,0 +1,113 @@
+package integration
+
+import (
+	"github.com/athebyme/cloud-ru-assign/internal/adapters/secondary/logger"
+	"github.com/athebyme/cloud-ru-assign/internal/adapters/secondary/proxy"
+	"github.com/athebyme/cloud-ru-assign/internal/adapters/secondary/repository"
+	"github.com/athebyme/cloud-ru-assign/internal/core/app"
+	"github.com/athebyme/cloud-ru-assign/internal/core/domain/retry"
+	"github.com/athebyme/cloud-ru-assign/internal/core/domain/routing"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestLoadBalancer_RouteTimeouts(t *testing.T) {
+	seenTimeout := make(chan string, 4)
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seenTimeout <- r.Header.Get("X-Request-Timeout")
+		if d, err := time.ParseDuration(r.URL.Query().Get("sleep")); err == nil {
+			select {
+			case <-time.After(d):
+			case <-r.Context().Done():
+				return
+			}
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer backend.Close()
+
+	logger := logger.NewSlogAdapter("error", false)
+	repo, _ := repository.NewMemoryPool([]string{backend.URL}, logger)
+	noRetry := retry.DefaultPolicy()
+	noRetry.MaxAttempts = 1
+	lbService := app.NewLoadBalancerService(repo, proxy.NewHttpUtilForwarder(logger), logger,
+		app.WithRetryPolicy(noRetry),
+		app.WithTimeouts(routing.Timeouts{Total: 5 * time.Second}),
+		app.WithRoutes(routing.NewTable([]*routing.Route{{
+			Name:       "slow",
+			PathPrefix: "/slow/",
+			Pool:       routing.DefaultPool,
+			Timeouts:   &routing.Timeouts{ResponseHeader: 100 * time.Millisecond, Total: 200 * time.Millisecond},
+		}})),
+	)
+
+	send := func(target string) (*httptest.ResponseRecorder, time.Duration) {
+		rec := httptest.NewRecorder()
+		start := time.Now()
+		lbService.HandleRequest(rec, httptest.NewRequest("GET", target, nil))
+		return rec, time.Since(start)
+	}
+
+	// общий таймаут передается бэкенду как остаток в миллисекундах
+	rec, _ := send("http://lb.example.com/fast")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200 for fast request, got %d", rec.Code)
+	}
+	if ms, err := strconv.Atoi(<-seenTimeout); err != nil || ms <= 0 || ms > 5000 {
+		t.Errorf("expected remaining deadline up to 5000ms, got %v (err %v)", ms, err)
+	}
+
+	// маршрут дополняет общие таймауты и отвечает 504 вместо обрыва соединения
+	rec, took := send("http://lb.example.com/slow/item?sleep=1s")
+	if rec.Code != http.StatusGatewayTimeout {
+		t.Errorf("expected 504 on response header timeout, got %d", rec.Code)
+	}
+	if took > 500*time.Millisecond {
+		t.Errorf("route timeout not applied, request took %v", took)
+	}
+	if ms, err := strconv.Atoi(<-seenTimeout); err != nil || ms > 200 {
+		t.Errorf("expected route deadline up to 200ms, got %v (err %v)", ms, err)
+	}
+
+	// таймаут маршрута не исключает живой бэкенд из пула: другие маршруты продолжают им пользоваться
+	if _, ok := repo.GetNextHealthyBackend(); !ok {
+		t.Error("expected backend to stay healthy after a route timeout")
+	}
+	if rec, _ := send("http://lb.example.com/fast"); rec.Code != http.StatusOK {
+		t.Errorf("expected 200 after route timeout, got %d", rec.Code)
+	}
+	<-seenTimeout
+}
+
+func TestLoadBalancer_TotalTimeoutOutlivesWriteTimeout(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(2 * time.Second):
+		case <-r.Context().Done():
+		}
+	}))
+	defer backend.Close()
+
+	logger := logger.NewSlogAdapter("error", false)
+	repo, _ := repository.NewMemoryPool([]string{backend.URL}, logger)
+	lbService := app.NewLoadBalancerService(repo, proxy.NewHttpUtilForwarder(logger), logger,
+		app.WithTimeouts(routing.Timeouts{Total: 400 * time.Millisecond}),
+	)
+	lb := httptest.NewUnstartedServer(http.HandlerFunc(lbService.HandleRequest))
+	lb.Config.WriteTimeout = 200 * time.Millisecond
+	lb.Start()
+	defer lb.Close()
+
+	// total больше WriteTimeout сервера: клиент все равно получает 504, а не оборванное соединение
+	resp, err := http.Get(lb.URL)
+	if err != nil {
+		t.Fatalf("expected 504 response, got transport error: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusGatewayTimeout {
+		t.Errorf("expected 504, got %d", resp.StatusCode)
+	}
+}
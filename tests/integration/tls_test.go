@@ -0,0 +1,251 @@
+package integration
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"github.com/athebyme/cloud-ru-assign/internal/adapters/secondary/healthcheck"
+	"github.com/athebyme/cloud-ru-assign/internal/adapters/secondary/logger"
+	"github.com/athebyme/cloud-ru-assign/internal/adapters/secondary/proxy"
+	"github.com/athebyme/cloud-ru-assign/internal/adapters/secondary/repository"
+	"github.com/athebyme/cloud-ru-assign/internal/adapters/secondary/tlsconfig"
+	"github.com/athebyme/cloud-ru-assign/internal/core/app"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	lbhttp "github.com/athebyme/cloud-ru-assign/internal/adapters/primary/http"
+)
+
+// writeSelfSignedCert создает самоподписанный сертификат для names и пишет пару в dir
+func writeSelfSignedCert(t *testing.T, dir, prefix string, serial int64, names ...string) (certFile, keyFile string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(serial),
+		Subject:               pkix.Name{CommonName: names[0]},
+		DNSNames:              names,
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("create certificate: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("marshal key: %v", err)
+	}
+
+	certFile = filepath.Join(dir, prefix+".crt")
+	keyFile = filepath.Join(dir, prefix+".key")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+// servedSerial выполняет рукопожатие с указанным SNI и возвращает серийный номер сертификата сервера
+func servedSerial(t *testing.T, addr, serverName string) int64 {
+	t.Helper()
+	conn, err := tls.Dial("tcp", addr, &tls.Config{ServerName: serverName, InsecureSkipVerify: true})
+	if err != nil {
+		t.Fatalf("tls dial %s: %v", serverName, err)
+	}
+	defer conn.Close()
+	return conn.ConnectionState().PeerCertificates[0].SerialNumber.Int64()
+}
+
+func TestCertificateStore_SelectsBySNIAndReloads(t *testing.T) {
+	dir := t.TempDir()
+	defaultCert, defaultKey := writeSelfSignedCert(t, dir, "default", 1, "default.example.com")
+	apiCert, apiKey := writeSelfSignedCert(t, dir, "api", 2, "api.example.com", "*.api.example.com")
+
+	logger := logger.NewSlogAdapter("error", false)
+	store, err := lbhttp.NewCertificateStore([]lbhttp.CertificateSource{
+		{CertFile: defaultCert, KeyFile: defaultKey},
+		{CertFile: apiCert, KeyFile: apiKey},
+	}, logger)
+	if err != nil {
+		t.Fatalf("create store: %v", err)
+	}
+
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{GetCertificate: store.GetCertificate})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				conn.(*tls.Conn).Handshake()
+				conn.Close()
+			}()
+		}
+	}()
+	addr := ln.Addr().String()
+
+	if got := servedSerial(t, addr, "api.example.com"); got != 2 {
+		t.Errorf("exact SNI: expected serial 2, got %d", got)
+	}
+	if got := servedSerial(t, addr, "v1.api.example.com"); got != 2 {
+		t.Errorf("wildcard SNI: expected serial 2, got %d", got)
+	}
+	if got := servedSerial(t, addr, "unknown.example.org"); got != 1 {
+		t.Errorf("unknown SNI: expected default serial 1, got %d", got)
+	}
+
+	// перевыпуск сертификата на диске подхватывается без перезапуска слушателя
+	writeSelfSignedCert(t, dir, "api", 3, "api.example.com")
+	future := time.Now().Add(time.Minute)
+	os.Chtimes(apiCert, future, future)
+	store.Start(20 * time.Millisecond)
+	defer store.Stop()
+
+	if !waitFor(t, 2*time.Second, func() bool { return servedSerial(t, addr, "api.example.com") == 3 }) {
+		t.Error("expected reloaded certificate with serial 3")
+	}
+}
+
+func TestCertificateStore_BrokenReloadKeepsPrevious(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeSelfSignedCert(t, dir, "site", 7, "site.example.com")
+
+	store, err := lbhttp.NewCertificateStore([]lbhttp.CertificateSource{{CertFile: certFile, KeyFile: keyFile}},
+		logger.NewSlogAdapter("error", false))
+	if err != nil {
+		t.Fatalf("create store: %v", err)
+	}
+
+	os.WriteFile(certFile, []byte("not a certificate"), 0o600)
+	if err := store.Reload(); err == nil {
+		t.Fatal("expected reload of broken certificate to fail")
+	}
+
+	cert, err := store.GetCertificate(&tls.ClientHelloInfo{ServerName: "site.example.com"})
+	if err != nil || cert == nil || cert.Leaf.SerialNumber.Int64() != 7 {
+		t.Errorf("expected previous certificate to stay active, got %v, %v", cert, err)
+	}
+}
+
+func TestLoadBalancer_TLSTerminationSetsForwardedProto(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, r.Header.Get("X-Forwarded-Proto"))
+	}))
+	defer backend.Close()
+
+	dir := t.TempDir()
+	certFile, keyFile := writeSelfSignedCert(t, dir, "lb", 1, "lb.example.com")
+	logger := logger.NewSlogAdapter("error", false)
+	store, err := lbhttp.NewCertificateStore([]lbhttp.CertificateSource{{CertFile: certFile, KeyFile: keyFile}}, logger)
+	if err != nil {
+		t.Fatalf("create store: %v", err)
+	}
+
+	repo, _ := repository.NewMemoryPool([]string{backend.URL}, logger)
+	lbService := app.NewLoadBalancerService(repo, proxy.NewHttpUtilForwarder(logger), logger)
+	adapter := lbhttp.NewServerAdapter("127.0.0.1:0", lbService, logger,
+		lbhttp.WithTLSConfig(&tls.Config{GetCertificate: store.GetCertificate, MinVersion: tls.VersionTLS12}))
+	startServerAdapter(t, adapter)
+
+	client := &http.Client{
+		Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}},
+		Timeout:   5 * time.Second,
+	}
+	defer client.CloseIdleConnections()
+
+	resp, err := client.Get("https://" + adapter.Addr().String() + "/")
+	if err != nil {
+		t.Fatalf("https request: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if string(body) != "https" {
+		t.Errorf("expected backend to see X-Forwarded-Proto https, got %q", body)
+	}
+}
+
+func TestLoadBalancer_UpstreamMutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	serverCert, serverKey := writeSelfSignedCert(t, dir, "backend", 10, "backend.internal")
+	clientCert, clientKey := writeSelfSignedCert(t, dir, "client", 11, "lb-client")
+
+	serverPair, err := tls.LoadX509KeyPair(serverCert, serverKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientPEM, _ := os.ReadFile(clientCert)
+	clientCAs := x509.NewCertPool()
+	clientCAs.AppendCertsFromPEM(clientPEM)
+
+	// бэкенд требует клиентский сертификат и возвращает имя из SNI
+	backend := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, r.TLS.ServerName)
+	}))
+	backend.TLS = &tls.Config{
+		Certificates: []tls.Certificate{serverPair},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    clientCAs,
+	}
+	backend.StartTLS()
+	defer backend.Close()
+
+	upstreamTLS, err := tlsconfig.Build(tlsconfig.Upstream{
+		CAFile:     serverCert,
+		CertFile:   clientCert,
+		KeyFile:    clientKey,
+		ServerName: "backend.internal",
+	})
+	if err != nil {
+		t.Fatalf("build upstream tls: %v", err)
+	}
+
+	logger := logger.NewSlogAdapter("error", false)
+	repo, _ := repository.NewMemoryPool([]string{backend.URL}, logger)
+	forwarder := proxy.NewHttpUtilForwarder(logger,
+		proxy.WithUpstream(backend.URL, proxy.UpstreamSettings{TLS: upstreamTLS}))
+	lbService := app.NewLoadBalancerService(repo, forwarder, logger)
+
+	rec := httptest.NewRecorder()
+	lbService.HandleRequest(rec, httptest.NewRequest("GET", "/", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200 through mTLS backend, got %d", rec.Code)
+	}
+	if rec.Body.String() != "backend.internal" {
+		t.Errorf("expected SNI override backend.internal, got %q", rec.Body.String())
+	}
+
+	backendURL := repo.GetBackends()[0].URL
+	checker := healthcheck.NewHTTPChecker(time.Second, "", healthcheck.WithBackendTLS(backend.URL, upstreamTLS))
+	if err := checker.Check(backendURL); err != nil {
+		t.Errorf("expected health check over mTLS to pass, got %v", err)
+	}
+	if err := healthcheck.NewHTTPChecker(time.Second, "").Check(backendURL); err == nil {
+		t.Error("expected health check without client certificate to fail")
+	}
+}
@@ -0,0 +1,160 @@
+package integration
+
+import (
+	"context"
+	"github.com/athebyme/cloud-ru-assign/internal/adapters/primary/udp"
+	"github.com/athebyme/cloud-ru-assign/internal/adapters/secondary/healthcheck"
+	"github.com/athebyme/cloud-ru-assign/internal/adapters/secondary/logger"
+	"github.com/athebyme/cloud-ru-assign/internal/adapters/secondary/proxy"
+	"github.com/athebyme/cloud-ru-assign/internal/adapters/secondary/repository"
+	"github.com/athebyme/cloud-ru-assign/internal/core/app"
+	"github.com/athebyme/cloud-ru-assign/internal/core/domain/balancer"
+	"net"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newUDPEchoBackend отвечает на каждую датаграмму ее содержимым с префиксом name
+func newUDPEchoBackend(t *testing.T, name string) string {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	go func() {
+		buf := make([]byte, 1500)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			conn.WriteTo([]byte(name+":"+string(buf[:n])), addr)
+		}
+	}()
+	return "udp://" + conn.LocalAddr().String()
+}
+
+func TestUDPProxy_SessionAffinityAndExpiry(t *testing.T) {
+	logger := logger.NewSlogAdapter("error", false)
+	repo, _ := repository.NewMemoryPool([]string{newUDPEchoBackend(t, "b1"), newUDPEchoBackend(t, "b2")}, logger)
+
+	service := app.NewUDPProxyService(repo, proxy.NewUDPDialer(), logger, app.UDPProxySettings{SessionIdleTimeout: 200 * time.Millisecond})
+	adapter := udp.NewListenerAdapter("127.0.0.1:0", service, service, logger)
+	if err := adapter.Run(); err != nil {
+		t.Fatalf("failed to start listener: %v", err)
+	}
+	defer adapter.Stop(context.Background())
+
+	exchange := func(conn net.Conn, msg string) string {
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		conn.Write([]byte(msg))
+		buf := make([]byte, 1500)
+		n, err := conn.Read(buf)
+		if err != nil {
+			t.Fatalf("no reply for %q: %v", msg, err)
+		}
+		return string(buf[:n])
+	}
+
+	// все датаграммы одного клиента идут на один бэкенд, разные клиенты распределяются стратегией
+	c1, _ := net.Dial("udp", adapter.Addr().String())
+	defer c1.Close()
+	c2, _ := net.Dial("udp", adapter.Addr().String())
+	defer c2.Close()
+
+	first := exchange(c1, "a")
+	backend := strings.SplitN(first, ":", 2)[0]
+	for _, msg := range []string{"b", "c"} {
+		if reply := exchange(c1, msg); reply != backend+":"+msg {
+			t.Errorf("expected reply from %s, got %q", backend, reply)
+		}
+	}
+	if other := strings.SplitN(exchange(c2, "x"), ":", 2)[0]; other == backend {
+		t.Errorf("expected second client on another backend, both on %s", backend)
+	}
+	if service.Sessions() != 2 {
+		t.Errorf("expected 2 sessions, got %d", service.Sessions())
+	}
+
+	if !waitFor(t, 2*time.Second, func() bool { return service.Sessions() == 0 }) {
+		t.Errorf("expected idle sessions to expire, got %d", service.Sessions())
+	}
+	for _, b := range repo.GetBackends() {
+		if n := repo.GetActiveConnections(b); n != 0 {
+			t.Errorf("expected session count released on %s, got %d", b.URL, n)
+		}
+	}
+}
+
+// slowDialer имитирует долгое разрешение имени бэкенда slow
+type slowDialer struct {
+	next  *proxy.UDPDialer
+	slow  string
+	delay time.Duration
+}
+
+func (d *slowDialer) Dial(ctx context.Context, target *balancer.Backend) (net.Conn, error) {
+	if target.URL.String() == d.slow {
+		time.Sleep(d.delay)
+	}
+	return d.next.Dial(ctx, target)
+}
+
+func TestUDPProxy_SlowDialDoesNotBlockOtherClients(t *testing.T) {
+	logger := logger.NewSlogAdapter("error", false)
+	slow := newUDPEchoBackend(t, "slow")
+	repo, _ := repository.NewMemoryPool([]string{slow, newUDPEchoBackend(t, "fast")}, logger)
+	dialer := &slowDialer{next: proxy.NewUDPDialer(), slow: slow, delay: 500 * time.Millisecond}
+	service := app.NewUDPProxyService(repo, dialer, logger, app.UDPProxySettings{SessionIdleTimeout: time.Second})
+	adapter := udp.NewListenerAdapter("127.0.0.1:0", service, service, logger)
+	if err := adapter.Run(); err != nil {
+		t.Fatalf("failed to start listener: %v", err)
+	}
+	defer adapter.Stop(context.Background())
+
+	// первый клиент попадает на бэкенд с медленным открытием сокета, второй не должен его ждать
+	c1, _ := net.Dial("udp", adapter.Addr().String())
+	defer c1.Close()
+	c2, _ := net.Dial("udp", adapter.Addr().String())
+	defer c2.Close()
+	c1.Write([]byte("a"))
+	time.Sleep(20 * time.Millisecond)
+
+	start := time.Now()
+	c2.SetReadDeadline(time.Now().Add(time.Second))
+	c2.Write([]byte("b"))
+	buf := make([]byte, 1500)
+	n, err := c2.Read(buf)
+	if err != nil || string(buf[:n]) != "fast:b" || time.Since(start) > 250*time.Millisecond {
+		t.Errorf("expected quick reply from fast backend, got %q (err %v) after %v", buf[:n], err, time.Since(start))
+	}
+
+	// датаграмма, пришедшая до открытия сокета, доставляется после него
+	c1.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if n, err := c1.Read(buf); err != nil || string(buf[:n]) != "slow:a" {
+		t.Errorf("expected queued datagram delivered, got %q (err %v)", buf[:n], err)
+	}
+}
+
+func TestUDPChecker_Probes(t *testing.T) {
+	live, _ := url.Parse(newUDPEchoBackend(t, "b1"))
+	closed, _ := net.ListenPacket("udp", "127.0.0.1:0")
+	dead, _ := url.Parse("udp://" + closed.LocalAddr().String())
+	closed.Close()
+
+	checker := healthcheck.NewUDPChecker(300*time.Millisecond, healthcheck.PayloadProbe([]byte("ping"), true))
+	if err := checker.Check(live); err != nil {
+		t.Errorf("expected live backend to pass, got %v", err)
+	}
+	if err := checker.Check(dead); err == nil {
+		t.Error("expected closed port to fail")
+	}
+
+	// echo бэкенд не DNS сервер: ответ без флага QR проба не принимает
+	if err := healthcheck.NewUDPChecker(300*time.Millisecond, healthcheck.DNSProbe()).Check(live); err == nil {
+		t.Error("expected DNS probe to reject non-DNS reply")
+	}
+}
@@ -0,0 +1,180 @@
+package integration
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/athebyme/cloud-ru-assign/internal/adapters/secondary/logger"
+	"github.com/athebyme/cloud-ru-assign/internal/adapters/secondary/proxy"
+	"github.com/athebyme/cloud-ru-assign/internal/adapters/secondary/repository"
+	"github.com/athebyme/cloud-ru-assign/internal/core/app"
+	"github.com/athebyme/cloud-ru-assign/internal/core/domain/routing"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newEchoUpgradeBackend поднимает бэкенд, который после рукопожатия возвращает клиенту все, что получил
+func newEchoUpgradeBackend(t *testing.T) *httptest.Server {
+	t.Helper()
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+			http.Error(w, "upgrade required", http.StatusUpgradeRequired)
+			return
+		}
+		conn, brw, err := http.NewResponseController(w).Hijack()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		brw.WriteString("HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: websocket\r\n\r\n")
+		brw.Flush()
+		io.Copy(conn, brw)
+	}))
+}
+
+// dialUpgrade выполняет рукопожатие через балансировщик и возвращает открытый туннель
+func dialUpgrade(t *testing.T, lbURL string) (net.Conn, *bufio.Reader) {
+	t.Helper()
+	conn, err := net.Dial("tcp", strings.TrimPrefix(lbURL, "http://"))
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	fmt.Fprintf(conn, "GET /ws HTTP/1.1\r\nHost: lb\r\nConnection: Upgrade\r\nUpgrade: websocket\r\n\r\n")
+
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, nil)
+	if err != nil {
+		conn.Close()
+		t.Fatalf("read handshake: %v", err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		conn.Close()
+		t.Fatalf("expected 101, got %d", resp.StatusCode)
+	}
+	return conn, reader
+}
+
+func waitFor(t *testing.T, timeout time.Duration, cond func() bool) bool {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if cond() {
+			return true
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return cond()
+}
+
+func TestLoadBalancer_UpgradeTunnel(t *testing.T) {
+	backend := newEchoUpgradeBackend(t)
+	defer backend.Close()
+
+	logger := logger.NewSlogAdapter("error", false)
+	repo, _ := repository.NewMemoryPool([]string{backend.URL}, logger)
+	forwarder := proxy.NewHttpUtilForwarder(logger)
+	tracker := app.NewUpgradeTracker()
+	lbService := app.NewLoadBalancerService(repo, forwarder, logger, app.WithUpgradeTracker(tracker))
+	lb := httptest.NewServer(http.HandlerFunc(lbService.HandleRequest))
+	defer lb.Close()
+
+	conn, reader := dialUpgrade(t, lb.URL)
+	conn.Write([]byte("ping"))
+	buf := make([]byte, 4)
+	if _, err := io.ReadFull(reader, buf); err != nil {
+		t.Fatalf("read echo: %v", err)
+	}
+	if string(buf) != "ping" {
+		t.Errorf("expected echo %q, got %q", "ping", buf)
+	}
+
+	if tracker.Active() != 1 {
+		t.Errorf("expected 1 active upgraded connection, got %d", tracker.Active())
+	}
+	if n := repo.GetActiveConnections(repo.GetBackends()[0]); n != 1 {
+		t.Errorf("expected backend to count 1 connection, got %d", n)
+	}
+
+	conn.Close()
+	if !waitFor(t, time.Second, func() bool {
+		return tracker.Active() == 0 && repo.GetActiveConnections(repo.GetBackends()[0]) == 0
+	}) {
+		t.Errorf("connection accounting not released: tracker=%d backend=%d",
+			tracker.Active(), repo.GetActiveConnections(repo.GetBackends()[0]))
+	}
+}
+
+func TestLoadBalancer_UpgradeIdleTimeout(t *testing.T) {
+	backend := newEchoUpgradeBackend(t)
+	defer backend.Close()
+
+	logger := logger.NewSlogAdapter("error", false)
+	repo, _ := repository.NewMemoryPool([]string{backend.URL}, logger)
+	forwarder := proxy.NewHttpUtilForwarder(logger)
+	lbService := app.NewLoadBalancerService(repo, forwarder, logger,
+		app.WithUpgradePolicy(routing.UpgradePolicy{IdleTimeout: 100 * time.Millisecond}))
+	lb := httptest.NewServer(http.HandlerFunc(lbService.HandleRequest))
+	defer lb.Close()
+
+	conn, reader := dialUpgrade(t, lb.URL)
+	defer conn.Close()
+
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	start := time.Now()
+	_, err := reader.ReadByte()
+	if !errors.Is(err, io.EOF) {
+		t.Fatalf("expected idle connection to be closed by balancer, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("idle connection closed too late: %v", elapsed)
+	}
+}
+
+func TestLoadBalancer_UpgradeDrain(t *testing.T) {
+	backend := newEchoUpgradeBackend(t)
+	defer backend.Close()
+
+	logger := logger.NewSlogAdapter("error", false)
+	repo, _ := repository.NewMemoryPool([]string{backend.URL}, logger)
+	forwarder := proxy.NewHttpUtilForwarder(logger)
+	tracker := app.NewUpgradeTracker()
+	lbService := app.NewLoadBalancerService(repo, forwarder, logger, app.WithUpgradeTracker(tracker))
+	lb := httptest.NewServer(http.HandlerFunc(lbService.HandleRequest))
+	defer lb.Close()
+
+	conn, reader := dialUpgrade(t, lb.URL)
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err := tracker.Drain(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected drain to hit deadline, got %v", err)
+	}
+	if tracker.Active() != 0 {
+		t.Errorf("expected no active connections after drain, got %d", tracker.Active())
+	}
+
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := reader.ReadByte(); !errors.Is(err, io.EOF) {
+		t.Errorf("expected client connection to be closed, got %v", err)
+	}
+
+	// после начала остановки новые рукопожатия отклоняются
+	req, _ := http.NewRequest("GET", lb.URL+"/ws", nil)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("request after drain: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("expected 503 while draining, got %d", resp.StatusCode)
+	}
+}
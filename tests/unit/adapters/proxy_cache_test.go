@@ -0,0 +1,63 @@
+package adapters
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/athebyme/cloud-ru-assign/internal/adapters/secondary/logger"
+	"github.com/athebyme/cloud-ru-assign/internal/adapters/secondary/proxy"
+	"github.com/athebyme/cloud-ru-assign/internal/adapters/secondary/repository"
+	"github.com/athebyme/cloud-ru-assign/internal/core/domain/balancer"
+)
+
+func TestForwarder_InvalidateOnlyAfterRemovalFromAllPools(t *testing.T) {
+	closed := make(chan struct{}, 1)
+	backend := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	backend.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateClosed {
+			closed <- struct{}{}
+		}
+	}
+	backend.Start()
+	defer backend.Close()
+
+	logger := logger.NewSlogAdapter("error", false)
+	forwarder := proxy.NewHttpUtilForwarder(logger)
+	// один бэкенд в двух пулах делит один прокси и его соединения
+	pools := make([]*repository.MemoryPool, 2)
+	for i := range pools {
+		pools[i], _ = repository.NewMemoryPool([]string{backend.URL}, logger)
+		pools[i].OnBackendAdded(forwarder.Retain)
+		pools[i].OnBackendRemoved(forwarder.Invalidate)
+	}
+
+	target, _ := url.Parse(backend.URL)
+	rec := httptest.NewRecorder()
+	if err := forwarder.Forward(rec, httptest.NewRequest("GET", "/", nil), &balancer.Backend{URL: target}); err != nil {
+		t.Fatalf("forward failed: %v", err)
+	}
+
+	// бэкенд остался во втором пуле: простаивающее соединение живет
+	if err := pools[0].RemoveBackend(target); err != nil {
+		t.Fatalf("remove failed: %v", err)
+	}
+	select {
+	case <-closed:
+		t.Fatal("proxy invalidated while backend is still used by another pool")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// удаление из последнего пула закрывает соединения прокси
+	if err := pools[1].RemoveBackend(target); err != nil {
+		t.Fatalf("remove failed: %v", err)
+	}
+	select {
+	case <-closed:
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected idle connection to be closed after removal from all pools")
+	}
+}
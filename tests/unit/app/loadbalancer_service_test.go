@@ -2,13 +2,18 @@ package app
 
 import (
 	"errors"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/athebyme/cloud-ru-assign/internal/core/app"
 	"github.com/athebyme/cloud-ru-assign/internal/core/domain/balancer"
+	"github.com/athebyme/cloud-ru-assign/internal/core/domain/retry"
+	"github.com/athebyme/cloud-ru-assign/internal/core/domain/routing"
 	"github.com/athebyme/cloud-ru-assign/internal/test/mocks"
 	"github.com/golang/mock/gomock"
 )
@@ -31,6 +36,7 @@ func TestLoadBalancerService_HandleRequest_Success(t *testing.T) {
 		"method", gomock.Any(),
 		"uri", gomock.Any(),
 		"remote_addr", gomock.Any(),
+		"client_ip", gomock.Any(),
 	).Return(mockLogger)
 
 	mockLogger.EXPECT().Info("начало обработки входящего запроса").Return()
@@ -69,6 +75,7 @@ func TestLoadBalancerService_HandleRequest_NoHealthyBackends(t *testing.T) {
 		"method", gomock.Any(),
 		"uri", gomock.Any(),
 		"remote_addr", gomock.Any(),
+		"client_ip", gomock.Any(),
 	).Return(mockLogger)
 
 	mockLogger.EXPECT().Info("начало обработки входящего запроса").Return()
@@ -153,8 +160,171 @@ func TestLoadBalancerService_HandleRequest_MaxRetriesExhausted(t *testing.T) {
 	rec := httptest.NewRecorder()
 	service.HandleRequest(rec, req)
 
+	if rec.Code != http.StatusBadGateway {
+		t.Errorf("expected status %d after exhausting retries, got %d", http.StatusBadGateway, rec.Code)
+	}
+}
+
+func TestLoadBalancerService_HandleRequest_NonIdempotentNotRetried(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mocks.NewMockBackendRepository(ctrl)
+	mockForwarder := mocks.NewMockForwarder(ctrl)
+	mockLogger := mocks.NewMockLogger(ctrl)
+
+	backend := &balancer.Backend{URL: parseURL("http://backend")}
+
+	// ошибка после установки соединения: POST мог дойти до бэкенда, повторять нельзя
+	resetErr := &balancer.ForwardError{Kind: balancer.ForwardErrorReset, Err: errors.New("connection reset")}
+	mockRepo.EXPECT().GetNextHealthyBackend().Return(backend, true).Times(1)
+	mockForwarder.EXPECT().Forward(gomock.Any(), gomock.Any(), backend).Return(resetErr).Times(1)
+	mockRepo.EXPECT().MarkBackendStatus(backend.URL, false).Times(1)
+
+	mockLogger.EXPECT().With("service", "LoadBalancerService").Return(mockLogger)
+	mockLogger.EXPECT().With(gomock.Any()).Return(mockLogger).AnyTimes()
+	mockLogger.EXPECT().Info(gomock.Any(), gomock.Any()).AnyTimes()
+	mockLogger.EXPECT().Warn(gomock.Any(), gomock.Any()).AnyTimes()
+	mockLogger.EXPECT().Error(gomock.Any(), gomock.Any()).AnyTimes()
+
+	service := app.NewLoadBalancerService(mockRepo, mockForwarder, mockLogger)
+
+	req := httptest.NewRequest("POST", "/", strings.NewReader("payload"))
+	rec := httptest.NewRecorder()
+	service.HandleRequest(rec, req)
+
+	if rec.Code != http.StatusBadGateway {
+		t.Errorf("expected status %d, got %d", http.StatusBadGateway, rec.Code)
+	}
+}
+
+func TestLoadBalancerService_HandleRequest_NonIdempotentRetriedOnConnectError(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mocks.NewMockBackendRepository(ctrl)
+	mockForwarder := mocks.NewMockForwarder(ctrl)
+	mockLogger := mocks.NewMockLogger(ctrl)
+
+	backend1 := &balancer.Backend{URL: parseURL("http://backend1")}
+	backend2 := &balancer.Backend{URL: parseURL("http://backend2")}
+
+	connectErr := &balancer.ForwardError{Kind: balancer.ForwardErrorConnect, Err: errors.New("connection refused")}
+	gomock.InOrder(
+		mockRepo.EXPECT().GetNextHealthyBackend().Return(backend1, true),
+		mockForwarder.EXPECT().Forward(gomock.Any(), gomock.Any(), backend1).DoAndReturn(
+			func(w http.ResponseWriter, r *http.Request, b *balancer.Backend) error {
+				io.ReadAll(r.Body) // имитируем частично отправленное тело
+				return connectErr
+			}),
+		mockRepo.EXPECT().MarkBackendStatus(backend1.URL, false),
+		mockRepo.EXPECT().GetNextHealthyBackend().Return(backend2, true),
+		mockForwarder.EXPECT().Forward(gomock.Any(), gomock.Any(), backend2).DoAndReturn(
+			func(w http.ResponseWriter, r *http.Request, b *balancer.Backend) error {
+				body, _ := io.ReadAll(r.Body)
+				if string(body) != "payload" {
+					t.Errorf("expected full body on retry, got %q", body)
+				}
+				w.WriteHeader(http.StatusCreated)
+				return nil
+			}),
+	)
+
+	mockLogger.EXPECT().With("service", "LoadBalancerService").Return(mockLogger)
+	mockLogger.EXPECT().With(gomock.Any()).Return(mockLogger).AnyTimes()
+	mockLogger.EXPECT().Info(gomock.Any(), gomock.Any()).AnyTimes()
+	mockLogger.EXPECT().Warn(gomock.Any(), gomock.Any()).AnyTimes()
+
+	service := app.NewLoadBalancerService(mockRepo, mockForwarder, mockLogger)
+
+	req := httptest.NewRequest("POST", "/", strings.NewReader("payload"))
+	rec := httptest.NewRecorder()
+	service.HandleRequest(rec, req)
+
+	if rec.Code != http.StatusCreated {
+		t.Errorf("expected status %d, got %d", http.StatusCreated, rec.Code)
+	}
+}
+
+func TestLoadBalancerService_HandleRequest_BodyOverLimitNotRetried(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mocks.NewMockBackendRepository(ctrl)
+	mockForwarder := mocks.NewMockForwarder(ctrl)
+	mockLogger := mocks.NewMockLogger(ctrl)
+
+	backend := &balancer.Backend{URL: parseURL("http://backend")}
+
+	policy := retry.DefaultPolicy()
+	policy.MaxBodyBytes = 4
+
+	connectErr := &balancer.ForwardError{Kind: balancer.ForwardErrorConnect, Err: errors.New("connection refused")}
+	mockRepo.EXPECT().GetNextHealthyBackend().Return(backend, true).Times(1)
+	mockForwarder.EXPECT().Forward(gomock.Any(), gomock.Any(), backend).DoAndReturn(
+		func(w http.ResponseWriter, r *http.Request, b *balancer.Backend) error {
+			body, _ := io.ReadAll(r.Body)
+			if string(body) != "payload" {
+				t.Errorf("expected body to be forwarded intact, got %q", body)
+			}
+			return connectErr
+		}).Times(1)
+	mockRepo.EXPECT().MarkBackendStatus(backend.URL, false).Times(1)
+
+	mockLogger.EXPECT().With("service", "LoadBalancerService").Return(mockLogger)
+	mockLogger.EXPECT().With(gomock.Any()).Return(mockLogger).AnyTimes()
+	mockLogger.EXPECT().Info(gomock.Any(), gomock.Any()).AnyTimes()
+	mockLogger.EXPECT().Warn(gomock.Any(), gomock.Any()).AnyTimes()
+	mockLogger.EXPECT().Error(gomock.Any(), gomock.Any()).AnyTimes()
+
+	service := app.NewLoadBalancerService(mockRepo, mockForwarder, mockLogger, app.WithRetryPolicy(policy))
+
+	req := httptest.NewRequest("PUT", "/", strings.NewReader("payload"))
+	rec := httptest.NewRecorder()
+	service.HandleRequest(rec, req)
+
 	if rec.Code != http.StatusServiceUnavailable {
-		t.Errorf("expected status %d after exhausting retries, got %d", http.StatusServiceUnavailable, rec.Code)
+		t.Errorf("expected status %d, got %d", http.StatusServiceUnavailable, rec.Code)
+	}
+}
+
+func TestLoadBalancerService_HandleRequest_NoRetryAfterCommit(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mocks.NewMockBackendRepository(ctrl)
+	mockForwarder := mocks.NewMockForwarder(ctrl)
+	mockLogger := mocks.NewMockLogger(ctrl)
+
+	backend := &balancer.Backend{URL: parseURL("http://backend")}
+
+	// бэкенд начал отвечать и оборвал соединение: повтора и второго ответа быть не должно
+	mockRepo.EXPECT().GetNextHealthyBackend().Return(backend, true).Times(1)
+	mockForwarder.EXPECT().Forward(gomock.Any(), gomock.Any(), backend).DoAndReturn(
+		func(w http.ResponseWriter, r *http.Request, b *balancer.Backend) error {
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte("partial"))
+			return errors.New("unexpected EOF")
+		}).Times(1)
+	mockRepo.EXPECT().MarkBackendStatus(backend.URL, false).Times(1)
+
+	mockLogger.EXPECT().With("service", "LoadBalancerService").Return(mockLogger)
+	mockLogger.EXPECT().With(gomock.Any()).Return(mockLogger).AnyTimes()
+	mockLogger.EXPECT().Info(gomock.Any(), gomock.Any()).AnyTimes()
+	mockLogger.EXPECT().Warn(gomock.Any(), gomock.Any()).AnyTimes()
+	mockLogger.EXPECT().Error(gomock.Any(), gomock.Any()).AnyTimes()
+
+	service := app.NewLoadBalancerService(mockRepo, mockForwarder, mockLogger)
+
+	req := httptest.NewRequest("GET", "/", nil)
+	rec := httptest.NewRecorder()
+	service.HandleRequest(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Errorf("expected committed status %d, got %d", http.StatusOK, rec.Code)
+	}
+	if rec.Body.String() != "partial" {
+		t.Errorf("expected only backend body, got %q", rec.Body.String())
 	}
 }
 
@@ -162,3 +332,242 @@ func parseURL(s string) *url.URL {
 	u, _ := url.Parse(s)
 	return u
 }
+
+func TestLoadBalancerService_HandleRequest_RetryOnStatusCode(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mocks.NewMockBackendRepository(ctrl)
+	mockForwarder := mocks.NewMockForwarder(ctrl)
+	mockLogger := mocks.NewMockLogger(ctrl)
+
+	backend1 := &balancer.Backend{URL: parseURL("http://backend1")}
+	backend2 := &balancer.Backend{URL: parseURL("http://backend2")}
+
+	policy := retry.DefaultPolicy()
+	policy.StatusCodes = []int{http.StatusServiceUnavailable}
+	policy.AvoidPreviousBackend = true
+
+	gomock.InOrder(
+		mockRepo.EXPECT().GetNextHealthyBackend().Return(backend1, true),
+		mockForwarder.EXPECT().Forward(gomock.Any(), gomock.Any(), backend1).DoAndReturn(
+			func(w http.ResponseWriter, r *http.Request, b *balancer.Backend) error {
+				w.Header().Set("X-Backend", "1")
+				w.WriteHeader(http.StatusServiceUnavailable)
+				w.Write([]byte("overloaded"))
+				return nil
+			}),
+		// первый вызов снова возвращает упавший бэкенд, сервис должен взять следующий
+		mockRepo.EXPECT().GetNextHealthyBackend().Return(backend1, true),
+		mockRepo.EXPECT().GetNextHealthyBackend().Return(backend2, true),
+		mockForwarder.EXPECT().Forward(gomock.Any(), gomock.Any(), backend2).DoAndReturn(
+			func(w http.ResponseWriter, r *http.Request, b *balancer.Backend) error {
+				w.Write([]byte("ok"))
+				return nil
+			}),
+	)
+
+	mockLogger.EXPECT().With("service", "LoadBalancerService").Return(mockLogger)
+	mockLogger.EXPECT().With(gomock.Any()).Return(mockLogger).AnyTimes()
+	mockLogger.EXPECT().Info(gomock.Any(), gomock.Any()).AnyTimes()
+	mockLogger.EXPECT().Warn(gomock.Any(), gomock.Any()).AnyTimes()
+
+	service := app.NewLoadBalancerService(mockRepo, mockForwarder, mockLogger, app.WithRetryPolicy(policy))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	rec := httptest.NewRecorder()
+	service.HandleRequest(rec, req)
+
+	if rec.Code != http.StatusOK || rec.Body.String() != "ok" {
+		t.Errorf("expected retried response 200 ok, got %d %q", rec.Code, rec.Body.String())
+	}
+	if rec.Header().Get("X-Backend") != "" {
+		t.Errorf("headers of discarded attempt leaked to client")
+	}
+}
+
+func TestLoadBalancerService_HandleRequest_RetryStatusExhaustedReturnsBackendResponse(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mocks.NewMockBackendRepository(ctrl)
+	mockForwarder := mocks.NewMockForwarder(ctrl)
+	mockLogger := mocks.NewMockLogger(ctrl)
+
+	backend := &balancer.Backend{URL: parseURL("http://backend")}
+
+	policy := retry.DefaultPolicy()
+	policy.MaxAttempts = 2
+	policy.StatusCodes = []int{http.StatusBadGateway}
+
+	mockRepo.EXPECT().GetNextHealthyBackend().Return(backend, true).Times(2)
+	mockForwarder.EXPECT().Forward(gomock.Any(), gomock.Any(), backend).DoAndReturn(
+		func(w http.ResponseWriter, r *http.Request, b *balancer.Backend) error {
+			w.WriteHeader(http.StatusBadGateway)
+			w.Write([]byte("upstream says no"))
+			return nil
+		}).Times(2)
+
+	mockLogger.EXPECT().With("service", "LoadBalancerService").Return(mockLogger)
+	mockLogger.EXPECT().With(gomock.Any()).Return(mockLogger).AnyTimes()
+	mockLogger.EXPECT().Info(gomock.Any(), gomock.Any()).AnyTimes()
+	mockLogger.EXPECT().Warn(gomock.Any(), gomock.Any()).AnyTimes()
+
+	service := app.NewLoadBalancerService(mockRepo, mockForwarder, mockLogger, app.WithRetryPolicy(policy))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	rec := httptest.NewRecorder()
+	service.HandleRequest(rec, req)
+
+	if rec.Code != http.StatusBadGateway || rec.Body.String() != "upstream says no" {
+		t.Errorf("expected backend response 502 after last attempt, got %d %q", rec.Code, rec.Body.String())
+	}
+}
+
+func TestLoadBalancerService_HandleRequest_RouteSelectsPool(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	defaultRepo := mocks.NewMockBackendRepository(ctrl)
+	reportsRepo := mocks.NewMockBackendRepository(ctrl)
+	mockForwarder := mocks.NewMockForwarder(ctrl)
+	mockLogger := mocks.NewMockLogger(ctrl)
+
+	reportsBackend := &balancer.Backend{URL: parseURL("http://reports")}
+
+	// у маршрута одна попытка: упавший бэкенд не повторяется
+	routePolicy := retry.DefaultPolicy()
+	routePolicy.MaxAttempts = 1
+
+	reportsRepo.EXPECT().GetNextHealthyBackend().Return(reportsBackend, true).Times(1)
+	mockForwarder.EXPECT().Forward(gomock.Any(), gomock.Any(), reportsBackend).Return(errors.New("forwarding failed")).Times(1)
+	reportsRepo.EXPECT().MarkBackendStatus(reportsBackend.URL, false).Times(1)
+
+	mockLogger.EXPECT().With("service", "LoadBalancerService").Return(mockLogger)
+	mockLogger.EXPECT().With(gomock.Any()).Return(mockLogger).AnyTimes()
+	mockLogger.EXPECT().Info(gomock.Any(), gomock.Any()).AnyTimes()
+	mockLogger.EXPECT().Warn(gomock.Any(), gomock.Any()).AnyTimes()
+	mockLogger.EXPECT().Error(gomock.Any(), gomock.Any()).AnyTimes()
+
+	table := routing.NewTable([]*routing.Route{
+		{Name: "reports", PathPrefix: "/reports/", Pool: "reports", Retry: &routePolicy},
+	})
+	service := app.NewLoadBalancerService(defaultRepo, mockForwarder, mockLogger,
+		app.WithPool("reports", reportsRepo, nil),
+		app.WithRoutes(table),
+	)
+
+	req := httptest.NewRequest("GET", "/reports/daily", nil)
+	rec := httptest.NewRecorder()
+	service.HandleRequest(rec, req)
+
+	if rec.Code != http.StatusBadGateway {
+		t.Errorf("expected status %d, got %d", http.StatusBadGateway, rec.Code)
+	}
+}
+
+func TestLoadBalancerService_HandleRequest_RetryBudgetExhausted(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mocks.NewMockBackendRepository(ctrl)
+	mockForwarder := mocks.NewMockForwarder(ctrl)
+	mockLogger := mocks.NewMockLogger(ctrl)
+
+	backend := &balancer.Backend{URL: parseURL("http://backend")}
+
+	// бюджет без успехов и без минимума: повторов нет, только первая попытка
+	budget := retry.NewBudget(0.2, 0, time.Minute)
+
+	mockRepo.EXPECT().GetNextHealthyBackend().Return(backend, true).Times(1)
+	mockForwarder.EXPECT().Forward(gomock.Any(), gomock.Any(), backend).Return(errors.New("forwarding failed")).Times(1)
+	mockRepo.EXPECT().MarkBackendStatus(backend.URL, false).Times(1)
+
+	mockLogger.EXPECT().With("service", "LoadBalancerService").Return(mockLogger)
+	mockLogger.EXPECT().With(gomock.Any()).Return(mockLogger).AnyTimes()
+	mockLogger.EXPECT().Info(gomock.Any(), gomock.Any()).AnyTimes()
+	mockLogger.EXPECT().Warn(gomock.Any(), gomock.Any()).AnyTimes()
+	mockLogger.EXPECT().Error(gomock.Any(), gomock.Any()).AnyTimes()
+
+	service := app.NewLoadBalancerService(mockRepo, mockForwarder, mockLogger, app.WithRetryBudget(budget))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	rec := httptest.NewRecorder()
+	service.HandleRequest(rec, req)
+
+	if rec.Code != http.StatusBadGateway {
+		t.Errorf("expected status %d, got %d", http.StatusBadGateway, rec.Code)
+	}
+	if budget.Exhausted() != 1 {
+		t.Errorf("expected skipped retry to be counted, got %d", budget.Exhausted())
+	}
+}
+
+func TestLoadBalancerService_HandleRequest_TrafficSplit(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	stableRepo := mocks.NewMockBackendRepository(ctrl)
+	canaryRepo := mocks.NewMockBackendRepository(ctrl)
+	mockForwarder := mocks.NewMockForwarder(ctrl)
+	mockLogger := mocks.NewMockLogger(ctrl)
+
+	stableBackend := &balancer.Backend{URL: parseURL("http://stable")}
+	canaryBackend := &balancer.Backend{URL: parseURL("http://canary")}
+	stableRepo.EXPECT().GetNextHealthyBackend().Return(stableBackend, true).AnyTimes()
+	canaryRepo.EXPECT().GetNextHealthyBackend().Return(canaryBackend, true).AnyTimes()
+
+	var got []string
+	mockForwarder.EXPECT().Forward(gomock.Any(), gomock.Any(), gomock.Any()).
+		DoAndReturn(func(w http.ResponseWriter, r *http.Request, b *balancer.Backend) error {
+			got = append(got, b.URL.Host)
+			return nil
+		}).AnyTimes()
+
+	mockLogger.EXPECT().With(gomock.Any()).Return(mockLogger).AnyTimes()
+	mockLogger.EXPECT().Info(gomock.Any(), gomock.Any()).AnyTimes()
+
+	split, err := routing.NewSplit(
+		[]routing.SplitGroup{{Name: "stable", Pool: "stable", Weight: 100}, {Name: "canary", Pool: "canary", Weight: 0}},
+		[]routing.SplitOverride{{Header: "X-Canary", Value: "always", Group: "canary"}},
+	)
+	if err != nil {
+		t.Fatalf("new split: %v", err)
+	}
+	table := routing.NewTable([]*routing.Route{{Name: "checkout", PathPrefix: "/checkout/", Split: split}})
+	service := app.NewLoadBalancerService(stableRepo, mockForwarder, mockLogger,
+		app.WithPool("stable", stableRepo, nil),
+		app.WithPool("canary", canaryRepo, nil),
+		app.WithRoutes(table),
+	)
+	splits := app.NewTrafficSplitService(table, mockLogger)
+
+	send := func(header string) {
+		req := httptest.NewRequest("GET", "/checkout/cart", nil)
+		if header != "" {
+			req.Header.Set("X-Canary", header)
+		}
+		service.HandleRequest(httptest.NewRecorder(), req)
+	}
+
+	send("")
+	send("always")
+	if _, err := splits.SetWeights("checkout", map[string]int{"stable": 0, "canary": 100}); err != nil {
+		t.Fatalf("set weights: %v", err)
+	}
+	send("")
+
+	want := []string{"stable", "canary", "canary"}
+	if len(got) != len(want) {
+		t.Fatalf("expected backends %v, got %v", want, got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("request %d: expected %s, got %s", i, want[i], got[i])
+		}
+	}
+
+	if _, err := splits.SetWeights("unknown", map[string]int{"canary": 1}); !errors.Is(err, routing.ErrNoSplit) {
+		t.Errorf("expected ErrNoSplit for unknown route, got %v", err)
+	}
+}
@@ -0,0 +1,123 @@
+package domain
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/athebyme/cloud-ru-assign/internal/adapters/secondary/responsecache"
+	"github.com/athebyme/cloud-ru-assign/internal/core/domain/cache"
+)
+
+func TestLifetime(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name      string
+		status    int
+		header    http.Header
+		wantFresh time.Duration
+		wantSWR   time.Duration
+		wantOK    bool
+	}{
+		{name: "max-age", status: 200, header: http.Header{"Cache-Control": {"max-age=60"}}, wantFresh: time.Minute, wantOK: true},
+		{name: "s-maxage wins", status: 200, header: http.Header{"Cache-Control": {"max-age=60, s-maxage=10"}}, wantFresh: 10 * time.Second, wantOK: true},
+		{name: "age subtracted", status: 200, header: http.Header{"Cache-Control": {"max-age=60"}, "Age": {"20"}}, wantFresh: 40 * time.Second, wantOK: true},
+		{name: "stale-while-revalidate", status: 200, header: http.Header{"Cache-Control": {"max-age=1, stale-while-revalidate=30"}}, wantFresh: time.Second, wantSWR: 30 * time.Second, wantOK: true},
+		{
+			name:      "expires",
+			status:    200,
+			header:    http.Header{"Expires": {now.Add(5 * time.Minute).Format(http.TimeFormat)}, "Date": {now.Format(http.TimeFormat)}},
+			wantFresh: 5 * time.Minute,
+			wantOK:    true,
+		},
+		{name: "no-cache stored for revalidation", status: 200, header: http.Header{"Cache-Control": {"no-cache"}, "Etag": {`"v1"`}}, wantOK: true},
+		{name: "no-store", status: 200, header: http.Header{"Cache-Control": {"no-store, max-age=60"}}},
+		{name: "private", status: 200, header: http.Header{"Cache-Control": {"private, max-age=60"}}},
+		{name: "set-cookie", status: 200, header: http.Header{"Cache-Control": {"max-age=60"}, "Set-Cookie": {"a=b"}}},
+		{name: "vary star", status: 200, header: http.Header{"Cache-Control": {"max-age=60"}, "Vary": {"*"}}},
+		{name: "no explicit lifetime", status: 200, header: http.Header{}},
+		{name: "server error", status: 500, header: http.Header{"Cache-Control": {"max-age=60"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fresh, swr, ok := cache.Lifetime(tt.status, tt.header, now)
+			if ok != tt.wantOK || fresh != tt.wantFresh || swr != tt.wantSWR {
+				t.Errorf("expected (%v, %v, %v), got (%v, %v, %v)", tt.wantFresh, tt.wantSWR, tt.wantOK, fresh, swr, ok)
+			}
+		})
+	}
+}
+
+func TestVaryKey(t *testing.T) {
+	vary := cache.VaryHeaders(http.Header{"Vary": {"accept-encoding, Accept-Language"}})
+	if len(vary) != 2 || vary[0] != "Accept-Encoding" || vary[1] != "Accept-Language" {
+		t.Fatalf("unexpected vary headers %v", vary)
+	}
+
+	gzip := httptest.NewRequest("GET", "/", nil)
+	gzip.Header.Set("Accept-Encoding", "gzip")
+	plain := httptest.NewRequest("GET", "/", nil)
+	if cache.VaryKey(vary, gzip) == cache.VaryKey(vary, plain) {
+		t.Error("expected different variant keys for different Accept-Encoding")
+	}
+}
+
+func TestEntry_NotModified(t *testing.T) {
+	lastModified := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	entry := &cache.Entry{Header: http.Header{
+		"Etag":          {`W/"v1"`},
+		"Last-Modified": {lastModified.Format(http.TimeFormat)},
+	}}
+
+	tests := []struct {
+		name   string
+		header http.Header
+		want   bool
+	}{
+		{name: "matching etag", header: http.Header{"If-None-Match": {`"v0", "v1"`}}, want: true},
+		{name: "other etag", header: http.Header{"If-None-Match": {`"v2"`}}},
+		{name: "not modified since", header: http.Header{"If-Modified-Since": {lastModified.Format(http.TimeFormat)}}, want: true},
+		{name: "modified since", header: http.Header{"If-Modified-Since": {lastModified.Add(-time.Hour).Format(http.TimeFormat)}}},
+		{name: "unconditional"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			for k, v := range tt.header {
+				r.Header[k] = v
+			}
+			if got := entry.NotModified(r); got != tt.want {
+				t.Errorf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestLRU_EvictsLeastRecentlyUsed(t *testing.T) {
+	entry := func() *cache.Entry { return &cache.Entry{Body: make([]byte, 100)} }
+	size := entry().Size() + 1 // плюс однобуквенный ключ
+	lru := responsecache.NewLRU(3 * size)
+
+	lru.Set("a", entry())
+	lru.Set("b", entry())
+	lru.Set("c", entry())
+	lru.Get("a") // a становится недавно использованным, первым вытесняется b
+	lru.Set("d", entry())
+
+	if _, ok := lru.Get("b"); ok {
+		t.Error("expected b to be evicted")
+	}
+	for _, key := range []string{"a", "c", "d"} {
+		if _, ok := lru.Get(key); !ok {
+			t.Errorf("expected %s to stay in cache", key)
+		}
+	}
+	if lru.Size() != 3*size {
+		t.Errorf("expected size %d, got %d", 3*size, lru.Size())
+	}
+
+	if removed := lru.DeletePrefix("c"); removed != 1 || lru.Len() != 2 {
+		t.Errorf("expected one entry removed by prefix, got %d (len %d)", removed, lru.Len())
+	}
+}
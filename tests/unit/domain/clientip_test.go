@@ -0,0 +1,63 @@
+package domain
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/athebyme/cloud-ru-assign/internal/core/domain/clientip"
+)
+
+func newResolver(t *testing.T, cidrs ...string) *clientip.Resolver {
+	t.Helper()
+	r, err := clientip.NewResolver(cidrs)
+	if err != nil {
+		t.Fatalf("new resolver: %v", err)
+	}
+	return r
+}
+
+func TestResolver_UntrustedPeerIgnoresForwardedFor(t *testing.T) {
+	r := newResolver(t, "10.0.0.0/8")
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "198.51.100.7:5555"
+	req.Header.Set("X-Forwarded-For", "1.1.1.1")
+
+	client := r.Resolve(req)
+	if client.IP != "198.51.100.7" || client.PeerTrusted {
+		t.Errorf("expected spoofed chain to be ignored, got %+v", client)
+	}
+}
+
+func TestResolver_TrustedChainSkipsProxies(t *testing.T) {
+	r := newResolver(t, "10.0.0.0/8", "192.168.1.10")
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "10.0.0.2:5555"
+	// крайний левый адрес мог подставить сам клиент, ему не верим
+	req.Header.Set("X-Forwarded-For", "6.6.6.6, 203.0.113.9, 192.168.1.10")
+
+	client := r.Resolve(req)
+	if client.IP != "203.0.113.9" || !client.PeerTrusted {
+		t.Errorf("expected first untrusted hop from the right, got %+v", client)
+	}
+}
+
+func TestResolver_ForwardedHeaderWithIPv6(t *testing.T) {
+	r := newResolver(t, "10.0.0.0/8")
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "10.1.2.3:5555"
+	req.Header.Set("Forwarded", `for="[2001:db8::1]:4711";proto=https, for=10.0.0.9`)
+
+	client := r.Resolve(req)
+	if client.IP != "2001:db8::1" {
+		t.Errorf("expected IPv6 client from Forwarded, got %+v", client)
+	}
+}
+
+func TestResolver_RejectsInvalidCIDR(t *testing.T) {
+	if _, err := clientip.NewResolver([]string{"10.0.0.0/33"}); err == nil {
+		t.Error("expected invalid CIDR to be rejected")
+	}
+}
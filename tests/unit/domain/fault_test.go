@@ -0,0 +1,73 @@
+package domain
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/athebyme/cloud-ru-assign/internal/core/domain/clientip"
+	"github.com/athebyme/cloud-ru-assign/internal/core/domain/fault"
+	"github.com/athebyme/cloud-ru-assign/internal/core/domain/reqctx"
+)
+
+func TestFaultPolicy_PlanFor(t *testing.T) {
+	testers, _ := clientip.NewResolver([]string{"10.0.0.0/8"})
+	policy := &fault.Policy{
+		Header:            "X-Fault-Inject",
+		Trusted:           testers,
+		MaxDelay:          time.Second,
+		MinBytesPerSecond: 512,
+	}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		value      string
+		want       fault.Plan
+	}{
+		{name: "no header", remoteAddr: "10.0.0.1:1000", want: fault.Plan{}},
+		{name: "untrusted sender", remoteAddr: "198.51.100.7:1000", value: "abort=503", want: fault.Plan{}},
+		{name: "explicit", remoteAddr: "10.0.0.1:1000", value: "delay=200ms,abort=503", want: fault.Plan{Delay: 200 * time.Millisecond, AbortStatus: 503}},
+		{name: "capped", remoteAddr: "10.0.0.1:1000", value: "delay=1h,throttle=1", want: fault.Plan{Delay: time.Second, BytesPerSecond: 512}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			req.RemoteAddr = tt.remoteAddr
+			if tt.value != "" {
+				req.Header.Set("X-Fault-Inject", tt.value)
+			}
+			if got := policy.PlanFor(req); got != tt.want {
+				t.Errorf("PlanFor() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFaultPolicy_TrustedProxyAndAllTraffic(t *testing.T) {
+	abort := &fault.Abort{Status: 503, Percent: 100}
+
+	// без своего списка заголовок принимается только от доверенного прокси из ClientIPMiddleware
+	byHeader := &fault.Policy{Header: "X-Fault-Inject", Abort: abort}
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("X-Fault-Inject", "on")
+	if plan := byHeader.PlanFor(req); !plan.IsZero() {
+		t.Errorf("expected no faults without trusted peer, got %+v", plan)
+	}
+	req = req.WithContext(reqctx.WithClient(req.Context(), reqctx.Client{IP: "10.0.0.1", PeerTrusted: true}))
+	if plan := byHeader.PlanFor(req); plan.AbortStatus != 503 {
+		t.Errorf("expected configured abort from trusted proxy, got %+v", plan)
+	}
+
+	// без заголовка сбои вносятся во все запросы только при явном allTraffic
+	if err := (&fault.Policy{Abort: abort}).Validate(); err == nil {
+		t.Error("expected policy without header and allTraffic to be rejected")
+	}
+	allTraffic := &fault.Policy{AllTraffic: true, Abort: abort}
+	if err := allTraffic.Validate(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if plan := allTraffic.PlanFor(httptest.NewRequest("GET", "/", nil)); plan.AbortStatus != 503 {
+		t.Errorf("expected abort for all traffic, got %+v", plan)
+	}
+}
@@ -0,0 +1,65 @@
+package domain
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/athebyme/cloud-ru-assign/internal/core/domain/headers"
+)
+
+func TestParseTemplate_RendersVariables(t *testing.T) {
+	tmpl, err := headers.ParseTemplate("ip=${client_ip}; via ${backend}")
+	if err != nil {
+		t.Fatalf("parse template: %v", err)
+	}
+	got := tmpl.Render(headers.Vars{ClientIP: "203.0.113.7", Backend: "app1:8080"})
+	if want := "ip=203.0.113.7; via app1:8080"; got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
+
+func TestParseTemplate_Errors(t *testing.T) {
+	for _, raw := range []string{"${unknown}", "prefix ${client_ip"} {
+		if _, err := headers.ParseTemplate(raw); err == nil {
+			t.Errorf("expected error for %q", raw)
+		}
+	}
+}
+
+func TestOps_ApplyOrder(t *testing.T) {
+	mustTemplate := func(s string) headers.Template {
+		tmpl, err := headers.ParseTemplate(s)
+		if err != nil {
+			t.Fatalf("parse template %q: %v", s, err)
+		}
+		return tmpl
+	}
+	ops := headers.Ops{
+		Remove: []string{"X-Debug"},
+		Set: []headers.Header{
+			{Name: "X-Env", Value: mustTemplate("prod")},
+			{Name: "X-Request-ID", Value: mustTemplate("${request_id}")},
+		},
+		Add: []headers.Header{{Name: "Via", Value: mustTemplate("lb")}},
+	}
+
+	h := http.Header{}
+	h.Set("X-Debug", "1")
+	h.Set("X-Env", "dev")
+	h.Set("X-Request-ID", "spoofed")
+	h.Set("Via", "1.1 edge")
+	ops.Apply(h, headers.Vars{})
+
+	if h.Get("X-Debug") != "" {
+		t.Error("expected X-Debug to be removed")
+	}
+	if got := h.Get("X-Env"); got != "prod" {
+		t.Errorf("expected X-Env to be replaced, got %q", got)
+	}
+	if got := h.Values("X-Request-ID"); len(got) != 0 {
+		t.Errorf("expected empty template to clear header, got %v", got)
+	}
+	if got := h.Values("Via"); len(got) != 2 || got[1] != "lb" {
+		t.Errorf("expected Via to be appended, got %v", got)
+	}
+}
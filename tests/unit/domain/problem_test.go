@@ -0,0 +1,33 @@
+package domain
+
+import (
+	"testing"
+
+	"github.com/athebyme/cloud-ru-assign/internal/core/domain/problem"
+)
+
+func TestNegotiate_PicksFormatByAccept(t *testing.T) {
+	tests := []struct {
+		name   string
+		accept []string
+		want   problem.Format
+	}{
+		{"no accept", nil, problem.FormatJSON},
+		{"any", []string{"*/*"}, problem.FormatJSON},
+		{"browser", []string{"text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8"}, problem.FormatHTML},
+		{"plain text", []string{"text/plain"}, problem.FormatText},
+		{"problem json", []string{"application/problem+json"}, problem.FormatJSON},
+		{"higher q wins", []string{"text/html;q=0.5, text/plain;q=0.9"}, problem.FormatText},
+		{"type wildcard", []string{"text/*"}, problem.FormatHTML},
+		// точный диапазон с q=0 запрещает формат, хотя */* его разрешает
+		{"explicit refusal", []string{"application/json;q=0, application/problem+json;q=0, text/plain;q=0.1, */*"}, problem.FormatHTML},
+		{"unsupported", []string{"image/png"}, problem.FormatJSON},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := problem.Negotiate(tt.accept); got != tt.want {
+				t.Errorf("expected format %d, got %d", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,47 @@
+package domain
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/athebyme/cloud-ru-assign/internal/core/domain/requestid"
+)
+
+func TestRequestID_Formats(t *testing.T) {
+	uuid := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+	if id := requestid.NewUUIDv4(); !uuid.MatchString(id) {
+		t.Errorf("expected UUIDv4, got %q", id)
+	}
+
+	ulid := regexp.MustCompile(`^[0-7][0-9A-HJKMNP-TV-Z]{25}$`)
+	first := requestid.NewULID()
+	time.Sleep(2 * time.Millisecond)
+	second := requestid.NewULID()
+	if !ulid.MatchString(first) || !ulid.MatchString(second) {
+		t.Fatalf("expected ULIDs, got %q and %q", first, second)
+	}
+	// первые 10 символов - время, поэтому более поздний идентификатор больше
+	if first[:10] >= second[:10] {
+		t.Errorf("expected ULIDs ordered by time, got %q then %q", first, second)
+	}
+
+	if _, err := requestid.NewGenerator("snowflake"); err == nil {
+		t.Error("expected unknown format to be rejected")
+	}
+}
+
+func TestRequestID_Valid(t *testing.T) {
+	for id, want := range map[string]bool{
+		"abc-123":                 true,
+		"":                        false,
+		"with space":              false,
+		"line\r\nX-Injected: yes": false,
+		strings.Repeat("a", 129):  false,
+	} {
+		if got := requestid.Valid(id); got != want {
+			t.Errorf("Valid(%q) = %v, expected %v", id, got, want)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package domain
+
+import (
+	"testing"
+	"time"
+
+	"github.com/athebyme/cloud-ru-assign/internal/core/domain/retry"
+)
+
+func TestBudget_AllowsRatioOfSuccesses(t *testing.T) {
+	budget := retry.NewBudget(0.5, 0, time.Minute)
+
+	for i := 0; i < 4; i++ {
+		budget.RecordSuccess()
+	}
+
+	// 50% от 4 успехов - два повтора
+	for i := 0; i < 2; i++ {
+		if !budget.TryRetry() {
+			t.Fatalf("retry %d should be allowed", i+1)
+		}
+	}
+	if budget.TryRetry() {
+		t.Error("retry beyond budget should be denied")
+	}
+	if budget.Exhausted() != 1 {
+		t.Errorf("expected 1 skipped retry, got %d", budget.Exhausted())
+	}
+}
+
+func TestBudget_MinRetriesWithoutTraffic(t *testing.T) {
+	// минимум 1 повтор в секунду на окне 2s дает два повтора даже без успешных запросов
+	budget := retry.NewBudget(0.2, 1, 2*time.Second)
+
+	if !budget.TryRetry() || !budget.TryRetry() {
+		t.Fatal("minimum retries should be allowed without traffic")
+	}
+	if budget.TryRetry() {
+		t.Error("retry beyond minimum should be denied")
+	}
+}
+
+func TestBudget_WindowExpires(t *testing.T) {
+	budget := retry.NewBudget(0, 0, 50*time.Millisecond)
+	if budget.TryRetry() {
+		t.Fatal("empty budget should deny retries")
+	}
+
+	budget = retry.NewBudget(1, 0, 50*time.Millisecond)
+	budget.RecordSuccess()
+	if !budget.TryRetry() {
+		t.Fatal("retry should be allowed right after success")
+	}
+
+	time.Sleep(80 * time.Millisecond)
+	budget.RecordSuccess()
+	if !budget.TryRetry() {
+		t.Error("retries from expired window should not count")
+	}
+}
@@ -0,0 +1,246 @@
+package domain
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	"github.com/athebyme/cloud-ru-assign/internal/core/domain/grpc"
+	"github.com/athebyme/cloud-ru-assign/internal/core/domain/routing"
+)
+
+func TestTable_WebSocketRoutePreferredForHandshake(t *testing.T) {
+	table := routing.NewTable([]*routing.Route{
+		{Name: "http", PathPrefix: "/dash/", Pool: "web"},
+		{Name: "ws", PathPrefix: "/dash/", Pool: "realtime", WebSocket: true},
+	})
+
+	handshake := httptest.NewRequest("GET", "/dash/live", nil)
+	handshake.Header.Set("Connection", "keep-alive, Upgrade")
+	handshake.Header.Set("Upgrade", "websocket")
+	route, ok := table.Match(handshake)
+	if !ok || route.Name != "ws" {
+		t.Fatalf("expected websocket route for handshake, got %+v", route)
+	}
+
+	plain := httptest.NewRequest("GET", "/dash/live", nil)
+	route, ok = table.Match(plain)
+	if !ok || route.Name != "http" {
+		t.Fatalf("expected http route for plain request, got %+v", route)
+	}
+}
+
+func TestTable_PathPrefixMatchesWholeSegments(t *testing.T) {
+	table := routing.NewTable([]*routing.Route{
+		{Name: "billing", PathPrefix: "/billing", Pool: "billing"},
+		{Name: "static", PathPrefix: "/static/", Pool: "web"},
+	})
+
+	tests := []struct {
+		path string
+		want string // пусто - ни один маршрут не подходит
+	}{
+		{"/billing", "billing"},
+		{"/billing/", "billing"},
+		{"/billing/invoices", "billing"},
+		{"/billingx", ""},
+		{"/billing-admin/users", ""},
+		{"/static/app.js", "web"},
+		{"/staticfiles", ""},
+	}
+	for _, tt := range tests {
+		route, ok := table.Match(httptest.NewRequest("GET", tt.path, nil))
+		got := ""
+		if ok {
+			got = route.Pool
+		}
+		if got != tt.want {
+			t.Errorf("%s: expected pool %q, got %q", tt.path, tt.want, got)
+		}
+	}
+
+	// префикс без / на конце не отрезается от пути, который продолжает его сегмент
+	rw := routing.Rewrite{StripPrefix: "/billing"}
+	if got := rw.Path("/billingx/a"); got != "/billingx/a" {
+		t.Errorf("expected path outside the prefix kept, got %q", got)
+	}
+	if got := rw.Path("/billing/a"); got != "/a" {
+		t.Errorf("expected prefix stripped, got %q", got)
+	}
+}
+
+func TestRewrite_PathAndReverse(t *testing.T) {
+	tests := []struct {
+		name        string
+		rewrite     routing.Rewrite
+		path        string
+		wantPath    string
+		location    string
+		wantReverse string
+		wantOK      bool
+	}{
+		{
+			name:        "strip prefix",
+			rewrite:     routing.Rewrite{StripPrefix: "/billing/"},
+			path:        "/billing/invoices/7",
+			wantPath:    "/invoices/7",
+			location:    "/login",
+			wantReverse: "/billing/login",
+			wantOK:      true,
+		},
+		{
+			name:        "strip and add prefix",
+			rewrite:     routing.Rewrite{StripPrefix: "/billing/", AddPrefix: "/api/v2"},
+			path:        "/billing/invoices",
+			wantPath:    "/api/v2/invoices",
+			location:    "/api/v2/login",
+			wantReverse: "/billing/login",
+			wantOK:      true,
+		},
+		{
+			name:        "location outside added prefix is untouched",
+			rewrite:     routing.Rewrite{AddPrefix: "/api/v2"},
+			path:        "/invoices",
+			wantPath:    "/api/v2/invoices",
+			location:    "/static/app.js",
+			wantReverse: "/static/app.js",
+		},
+		{
+			name: "regex with capture groups",
+			rewrite: routing.Rewrite{
+				Regex:               regexp.MustCompile(`^/users/(\d+)/orders$`),
+				Replacement:         "/orders/by-user/$1",
+				RedirectRegex:       regexp.MustCompile(`^/orders/(\d+)$`),
+				RedirectReplacement: "/my/orders/$1",
+			},
+			path:        "/users/42/orders",
+			wantPath:    "/orders/by-user/42",
+			location:    "/orders/9",
+			wantReverse: "/my/orders/9",
+			wantOK:      true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.rewrite.Path(tt.path); got != tt.wantPath {
+				t.Errorf("Path(%q) = %q, want %q", tt.path, got, tt.wantPath)
+			}
+			got, ok := tt.rewrite.ReversePath(tt.location)
+			if got != tt.wantReverse || ok != tt.wantOK {
+				t.Errorf("ReversePath(%q) = %q, %v, want %q, %v", tt.location, got, ok, tt.wantReverse, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestSplit_Weights(t *testing.T) {
+	split, err := routing.NewSplit([]routing.SplitGroup{
+		{Name: "stable", Pool: "default", Weight: 90},
+		{Name: "canary", Pool: "canary", Weight: 10},
+	}, []routing.SplitOverride{{Cookie: "canary", Group: "canary"}})
+	if err != nil {
+		t.Fatalf("new split: %v", err)
+	}
+
+	counts := make(map[string]int)
+	for i := 0; i < 10000; i++ {
+		counts[split.Pick(httptest.NewRequest("GET", "/", nil)).Name]++
+	}
+	if counts["canary"] < 700 || counts["canary"] > 1300 {
+		t.Errorf("expected about 10%% canary, got %d of 10000", counts["canary"])
+	}
+
+	withCookie := httptest.NewRequest("GET", "/", nil)
+	withCookie.AddCookie(&http.Cookie{Name: "canary", Value: "yes"})
+	if got := split.Pick(withCookie).Name; got != "canary" {
+		t.Errorf("expected cookie override to pick canary, got %s", got)
+	}
+
+	for _, weights := range []map[string]int{
+		{"stable": 0, "canary": 0},
+		{"canary": -1},
+		{"blue": 10},
+	} {
+		if err := split.SetWeights(weights); err == nil {
+			t.Errorf("expected error for weights %v", weights)
+		}
+	}
+	if groups := split.Groups(); groups[0].Weight != 90 || groups[1].Weight != 10 {
+		t.Errorf("failed update must keep previous weights, got %+v", groups)
+	}
+}
+
+func TestNewSplit_Errors(t *testing.T) {
+	tests := []struct {
+		name      string
+		groups    []routing.SplitGroup
+		overrides []routing.SplitOverride
+	}{
+		{name: "no groups"},
+		{name: "duplicate group", groups: []routing.SplitGroup{{Name: "a", Pool: "p", Weight: 1}, {Name: "a", Pool: "q", Weight: 1}}},
+		{
+			name:      "override to unknown group",
+			groups:    []routing.SplitGroup{{Name: "a", Pool: "p", Weight: 1}},
+			overrides: []routing.SplitOverride{{Header: "X-Canary", Group: "b"}},
+		},
+		{
+			name:      "override without header or cookie",
+			groups:    []routing.SplitGroup{{Name: "a", Pool: "p", Weight: 1}},
+			overrides: []routing.SplitOverride{{Group: "a"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := routing.NewSplit(tt.groups, tt.overrides); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
+
+func TestTable_GRPCRoutesMatchOnlyGRPCCalls(t *testing.T) {
+	table := routing.NewTable([]*routing.Route{
+		{Name: "web", PathPrefix: "/", Pool: "web"},
+		{Name: "users", PathPrefix: "/acme.Users/", Pool: "users", GRPC: &grpc.Policy{}},
+		{Name: "users-get", PathPrefix: "/acme.Users/Get", Pool: "users-ro", GRPC: &grpc.Policy{}},
+	})
+
+	call := func(path string) *http.Request {
+		r := httptest.NewRequest("POST", path, nil)
+		r.Header.Set("Content-Type", "application/grpc+proto")
+		return r
+	}
+	tests := []struct {
+		req  *http.Request
+		want string
+	}{
+		{call("/acme.Users/Get"), "users-get"},
+		{call("/acme.Users/GetAll"), "users"}, // метод сравнивается целиком, а не по префиксу
+		{call("/acme.Users/Create"), "users"},
+		{httptest.NewRequest("POST", "/acme.Users/Get", nil), "web"},
+	}
+	for _, tt := range tests {
+		route, ok := table.Match(tt.req)
+		if !ok || route.Name != tt.want {
+			t.Errorf("%s: expected route %s, got %+v", tt.req.URL.Path, tt.want, route)
+		}
+	}
+}
+
+func TestGRPCPolicy_IdempotentMethods(t *testing.T) {
+	policy := &grpc.Policy{Idempotent: []string{"/acme.Users/Get", "/acme.Catalog/"}}
+	for method, want := range map[string]bool{
+		"/acme.Users/Get":    true,
+		"/acme.Users/GetAll": false,
+		"/acme.Catalog/List": true,
+		"/acme.Users/Create": false,
+	} {
+		if got := policy.IsIdempotent(method); got != want {
+			t.Errorf("IsIdempotent(%s) = %v, want %v", method, got, want)
+		}
+	}
+	if code, err := grpc.ParseCode("unavailable"); err != nil || code != grpc.Unavailable {
+		t.Errorf("expected UNAVAILABLE, got %v (err %v)", code, err)
+	}
+}